@@ -29,7 +29,16 @@ func main() {
 		os.Exit(2)
 	}
 
-	exitCode := run.Run(ctx, opts)
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	exitCode, err := run.Run(ctx, opts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "ec: timed out after %s\n", opts.Timeout)
+		exitCode = 2
+	}
+	cancel()
 	os.Exit(exitCode)
 }
 
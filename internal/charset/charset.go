@@ -0,0 +1,123 @@
+// Package charset converts files in legacy encodings such as Shift-JIS or
+// Latin-1 to UTF-8 for display, and resolved output back on write.
+package charset
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// asciiProbe holds the bytes conflict markers and line splitting rely on.
+const asciiProbe = "<|=>\r\n"
+
+// Lookup returns the encoding registered under an IANA name or alias, e.g.
+// "shift_jis" or "latin1". It returns nil for "" and UTF-8, meaning bytes
+// are used as is. Encodings that do not keep ASCII as single bytes, such as
+// UTF-16, are rejected because conflict markers could not be found in them.
+func Lookup(name string) (encoding.Encoding, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	probe, err := enc.NewEncoder().Bytes([]byte(asciiProbe))
+	if err != nil || string(probe) != asciiProbe {
+		return nil, fmt.Errorf("unsupported encoding %q: not ASCII compatible", name)
+	}
+	return enc, nil
+}
+
+// Decode converts data from the named encoding to UTF-8.
+func Decode(name string, data []byte) ([]byte, error) {
+	enc, err := Lookup(name)
+	if err != nil || enc == nil {
+		return data, err
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	return decoded, nil
+}
+
+// Encode converts UTF-8 data to the named encoding. Characters the encoding
+// cannot represent are an error rather than being replaced.
+func Encode(name string, data []byte) ([]byte, error) {
+	enc, err := Lookup(name)
+	if err != nil || enc == nil {
+		return data, err
+	}
+	encoded, err := enc.NewEncoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", name, err)
+	}
+	return encoded, nil
+}
+
+// DecodeDocument converts the text of every segment of doc, which was parsed
+// from raw bytes, from the named encoding to UTF-8. Conflict structure is
+// left untouched, so marker detection never depends on the encoding.
+func DecodeDocument(name string, doc markers.Document) (markers.Document, error) {
+	enc, err := Lookup(name)
+	if err != nil || enc == nil {
+		return doc, err
+	}
+	decoder := enc.NewDecoder()
+	decode := func(data []byte) ([]byte, error) {
+		if len(data) == 0 {
+			return data, nil
+		}
+		decoded, err := decoder.Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", name, err)
+		}
+		return decoded, nil
+	}
+	decodeLabel := func(label string) (string, error) {
+		decoded, err := decode([]byte(label))
+		return string(decoded), err
+	}
+
+	out := markers.CloneDocument(doc)
+	for i, seg := range out.Segments {
+		switch s := seg.(type) {
+		case markers.TextSegment:
+			if s.Bytes, err = decode(s.Bytes); err != nil {
+				return markers.Document{}, err
+			}
+			out.Segments[i] = s
+		case markers.ConflictSegment:
+			// Marker lines are written back as they were when their label
+			// still matches, so they must be UTF-8 like the rest.
+			for _, side := range []*[]byte{&s.Ours, &s.Base, &s.Theirs, &s.Markers.Start, &s.Markers.Base, &s.Markers.Mid, &s.Markers.End} {
+				if *side, err = decode(*side); err != nil {
+					return markers.Document{}, err
+				}
+			}
+			for _, label := range []*string{&s.OursLabel, &s.BaseLabel, &s.TheirsLabel} {
+				if *label, err = decodeLabel(*label); err != nil {
+					return markers.Document{}, err
+				}
+			}
+			out.Segments[i] = s
+		}
+	}
+	for i, ref := range out.Conflicts {
+		if seg, ok := out.Segments[ref.SegmentIndex].(markers.ConflictSegment); ok {
+			out.Conflicts[i].Hash = seg.Hash()
+		}
+	}
+	return out, nil
+}
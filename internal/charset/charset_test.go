@@ -0,0 +1,119 @@
+package charset
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// "日本" in Shift-JIS.
+var shiftJISNihon = []byte{0x93, 0xfa, 0x96, 0x7b}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"", "utf-8", "UTF-8"} {
+		enc, err := Lookup(name)
+		if err != nil || enc != nil {
+			t.Fatalf("Lookup(%q) = %v, %v, want nil, nil", name, enc, err)
+		}
+	}
+	for _, name := range []string{"shift_jis", "latin1", "ISO-8859-1", "windows-1252"} {
+		if enc, err := Lookup(name); err != nil || enc == nil {
+			t.Fatalf("Lookup(%q) = %v, %v, want an encoding", name, enc, err)
+		}
+	}
+	for _, name := range []string{"no-such-charset", "utf-16le"} {
+		if _, err := Lookup(name); err == nil {
+			t.Fatalf("Lookup(%q) error = nil, want error", name)
+		}
+	}
+}
+
+func TestDecodeEncodeRoundTrip(t *testing.T) {
+	raw := append(append([]byte("a "), shiftJISNihon...), '\n')
+
+	decoded, err := Decode("shift_jis", raw)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if string(decoded) != "a 日本\n" {
+		t.Fatalf("Decode = %q, want %q", decoded, "a 日本\n")
+	}
+
+	encoded, err := Encode("shift_jis", decoded)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Fatalf("Encode = %x, want %x", encoded, raw)
+	}
+
+	if _, err := Encode("latin1", []byte("日本\n")); err == nil {
+		t.Fatalf("Encode latin1 error = nil, want error for unrepresentable text")
+	}
+}
+
+func TestDecodeDocument(t *testing.T) {
+	var raw bytes.Buffer
+	raw.WriteString("<<<<<<< ours\n")
+	raw.Write(shiftJISNihon)
+	raw.WriteString("\n=======\ncaf\xe9\n>>>>>>> theirs\n")
+
+	doc, err := markers.Parse(raw.Bytes())
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if _, err := DecodeDocument("latin1", doc); err != nil {
+		t.Fatalf("DecodeDocument latin1 error: %v", err)
+	}
+
+	decoded, err := DecodeDocument("shift_jis", doc)
+	if err != nil {
+		t.Fatalf("DecodeDocument error: %v", err)
+	}
+	if len(decoded.Conflicts) != 1 {
+		t.Fatalf("conflicts = %d, want 1", len(decoded.Conflicts))
+	}
+	seg := decoded.Segments[decoded.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	if string(seg.Ours) != "日本\n" {
+		t.Fatalf("ours = %q, want %q", seg.Ours, "日本\n")
+	}
+	if seg.Base != nil {
+		t.Fatalf("base = %q, want nil", seg.Base)
+	}
+	if decoded.Conflicts[0].Hash != seg.Hash() {
+		t.Fatalf("conflict hash = %q, want hash of the decoded segment", decoded.Conflicts[0].Hash)
+	}
+	original := doc.Segments[doc.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	if !bytes.HasPrefix(original.Ours, shiftJISNihon) {
+		t.Fatalf("DecodeDocument modified the input document")
+	}
+}
+
+func TestDecodeDocumentMarkerLinesRoundTrip(t *testing.T) {
+	raw := []byte("<<<<<<< ours caf\xe9\nours\n||||||| base\nbase\n======= caf\xe9 note\ntheirs\n>>>>>>> theirs caf\xe9\n")
+	doc, err := markers.Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	decoded, err := DecodeDocument("latin1", doc)
+	if err != nil {
+		t.Fatalf("DecodeDocument error: %v", err)
+	}
+	seg := decoded.Segments[decoded.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	if string(seg.Markers.Mid) != "======= café note\n" {
+		t.Fatalf("mid marker = %q, want it decoded", seg.Markers.Mid)
+	}
+
+	rendered, err := markers.RenderWithUnresolved(decoded)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved error: %v", err)
+	}
+	encoded, err := Encode("latin1", rendered)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Fatalf("round trip = %q, want %q", encoded, raw)
+	}
+}
@@ -1,5 +1,11 @@
 package cli
 
+import "time"
+
+// DefaultFullDiffLimit is the --full-diff-limit used when the flag is not
+// given.
+const DefaultFullDiffLimit = 200
+
 // Options is the fully-parsed configuration for a single invocation.
 //
 // It supports both:
@@ -11,10 +17,98 @@ type Options struct {
 	RemotePath string
 	MergedPath string
 
-	ApplyAll string // ours|theirs|both
-	Check    bool
+	ApplyAll       string // ours|theirs|both|none
+	Annotate       string // comment prefix for --annotate
+	Plan           string // JSON resolution plan for --plan
+	Strict         bool   // with --plan, fail on conflicts the plan leaves out
+	PreferBranch   string // branch label whose side --prefer-branch takes
+	PrintResolved  string // ours|theirs|both|none; print the result, never write
+	EmitPlan       bool
+	Report         bool // print a review report of $MERGED's conflicts
+	Markdown       bool // with Report, format it as markdown
+	Check          bool
+	CheckDir       string // directory --check <dir> searches for conflict markers
+	Patch          bool
+	Stdout         bool // print the resolved result instead of writing $MERGED
+	ExportWordDiff bool
+	DryRun         bool
+	Verbose        bool
+	// Timeout cancels a non-interactive run, and the git commands it started,
+	// once it has taken this long; 0 means no limit.
+	Timeout time.Duration
+	// Quiet drops informational messages and warnings; errors and the
+	// output a mode was asked for (--patch, --dry-run, --emit-plan,
+	// --print-resolved) remain.
+	Quiet bool
+	// OursLabel, BaseLabel and TheirsLabel replace the marker labels of
+	// conflicts --plan or --prefer-branch writes back unresolved; empty keeps
+	// the originals.
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
 
 	Backup bool
+	// RestoreBackup copies the backup of $MERGED back over it and exits.
+	RestoreBackup bool
+	// BackupSuffix is appended to the merged file name to name its backup;
+	// BackupDir, when set, holds backups instead of the merged file's
+	// directory.
+	BackupSuffix string
+	BackupDir    string
+	Batch        bool
+	AutoWrite    bool
+	// Force lets the resolver write $MERGED without asking when the file
+	// changed on disk since it was read.
+	Force bool
+	// RecordNotes attaches a git note summarizing each file's resolutions
+	// to HEAD once W has continued the merge or rebase in no-args mode.
+	RecordNotes bool
+	// Stage runs git add on each file written fully resolved in no-args
+	// mode or by --apply-all --all.
+	Stage        bool
+	NoAltScreen  bool // draw the TUI inline instead of on the alternate screen
+	NoColor      bool // never color output, as with NO_COLOR set
+	Unified      bool // open the resolver in the single-pane unified layout
+	Swap         bool // show theirs on the left and ours on the right
+	NormalizeEOF bool
+	NormalizeEOL string // lf|crlf
+	// BothSeparator is a line written between ours and theirs when a
+	// conflict is resolved to both; empty writes them back to back.
+	BothSeparator string
+	// TabWidth is the columns between tab stops in the resolver's panes;
+	// 0 takes tab_width from themes.json, or 4.
+	TabWidth int
+	// ConflictStyle is the style of the regenerated conflict view:
+	// diff3 (default) or zdiff3.
+	ConflictStyle string
+	// Encoding names the character set of the input files (e.g. shift_jis);
+	// empty means UTF-8.
+	Encoding string
+	// IgnoreWhitespace resolves conflicts whose sides differ only in
+	// whitespace to WhitespaceSide (ours|theirs) when the resolver opens.
+	IgnoreWhitespace bool
+	WhitespaceSide   string
+
+	PerFileTool string
+	AllFiles    bool
+	// Watch keeps the no-args selector open, re-listing conflicted files
+	// periodically; KeepWatching keeps it open once none are left.
+	Watch        bool
+	KeepWatching bool
+	// Only and Exclude are glob patterns filtering the conflicted files
+	// offered in no-args mode.
+	Only    []string
+	Exclude []string
+	// DiffContext limits the resolver's full-file diff to this many lines
+	// around each conflict; 0 diffs the whole files.
+	DiffContext int
+	// FullDiffLimit skips the full-file diff for files with more conflicts
+	// than this, showing each conflict on its own; 0 means no limit.
+	FullDiffLimit int
+	BaseRev       string
+	// EditPath is the conflicted file named by `ec edit <file>`, opened
+	// directly instead of through the selector.
+	EditPath string
 
 	AllowMissingBase bool
 }
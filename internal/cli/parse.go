@@ -5,7 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"path"
+	"strconv"
 	"strings"
+
+	"github.com/chojs23/ec/internal/charset"
 )
 
 var ErrHelp = errors.New("help requested")
@@ -16,6 +20,7 @@ func Parse(args []string) (Options, error) {
 	var help bool
 	var backup bool
 	var showVersion bool
+	var diffContext string
 
 	opts.Backup = false
 
@@ -26,13 +31,66 @@ func Parse(args []string) (Options, error) {
 	fs.StringVar(&opts.LocalPath, "local", "", "Path to LOCAL (ours) file")
 	fs.StringVar(&opts.RemotePath, "remote", "", "Path to REMOTE (theirs) file")
 	fs.StringVar(&opts.MergedPath, "merged", "", "Path to MERGED file (output target)")
-	fs.StringVar(&opts.ApplyAll, "apply-all", "", "Non-interactive resolution: ours|theirs|both")
+	fs.StringVar(&opts.ApplyAll, "apply-all", "", "Non-interactive resolution: ours|theirs|both|none")
+	fs.StringVar(&opts.Annotate, "annotate", "", "Non-interactive: write both sides of each conflict under <prefix> OURS/THEIRS comments")
+	fs.StringVar(&opts.Plan, "plan", "", "Non-interactive: resolve conflicts as listed in a JSON plan file and write $MERGED")
+	fs.StringVar(&opts.PreferBranch, "prefer-branch", "", "Non-interactive: resolve each conflict to the side labelled <name> and write $MERGED")
+	fs.StringVar(&opts.PrintResolved, "print-resolved", "", "Non-interactive: print the result of resolving every conflict to ours|theirs|both|none")
+	fs.BoolVar(&opts.Strict, "strict", false, "With --plan, fail when a conflict is not in the plan")
+	fs.StringVar(&opts.OursLabel, "ours-label", "", "With --plan or --prefer-branch, label the ours marker of unresolved conflicts")
+	fs.StringVar(&opts.BaseLabel, "base-label", "", "With --plan or --prefer-branch, label the base marker of unresolved conflicts")
+	fs.StringVar(&opts.TheirsLabel, "theirs-label", "", "With --plan or --prefer-branch, label the theirs marker of unresolved conflicts")
+	fs.BoolVar(&opts.EmitPlan, "emit-plan", false, "Print a JSON plan listing each conflict's number and hash")
+	fs.BoolVar(&opts.Report, "report", false, "Print a report of each conflict in $MERGED with a suggested resolution")
+	fs.BoolVar(&opts.Markdown, "markdown", false, "With --report, format the report as markdown")
 	fs.BoolVar(&opts.Check, "check", false, "Exit 0 if resolved (no conflict markers), else 1")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "With --check, list unresolved conflicts on stderr")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "Non-interactive modes: give up after this long, e.g. 30s (exit 2)")
+	fs.BoolVar(&opts.Quiet, "quiet", false, "Print only errors and the output a mode was asked for")
+	fs.BoolVar(&opts.Patch, "patch", false, "With --apply-all, print a unified diff instead of writing $MERGED")
+	fs.BoolVar(&opts.Stdout, "stdout", false, "Print the resolved result instead of writing $MERGED")
+	fs.BoolVar(&opts.ExportWordDiff, "export-word-diff", false, "With --apply-all, print a base-to-result word diff instead of writing $MERGED")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "With --apply-all, print which side each conflict takes instead of writing $MERGED")
 	fs.BoolVar(&backup, "backup", false, "Create $MERGED.ec.bak on write")
+	fs.BoolVar(&opts.RestoreBackup, "restore-backup", false, "Copy the backup of $MERGED back over it")
+	fs.StringVar(&opts.BackupSuffix, "backup-suffix", ".ec.bak", "With --backup, suffix appended to the backup file name")
+	fs.StringVar(&opts.BackupDir, "backup-dir", "", "With --backup, write backups to this directory instead of next to $MERGED")
+	fs.StringVar(&opts.NormalizeEOL, "normalize-eol", "", "On write, convert every line ending to lf|crlf")
+	fs.StringVar(&opts.BothSeparator, "both-separator", "", "Line to write between ours and theirs of conflicts resolved to both")
+	fs.StringVar(&opts.ConflictStyle, "conflict-style", "diff3", "Conflict style of the regenerated merge view: diff3|zdiff3")
+	fs.StringVar(&opts.Encoding, "encoding", "", "Character set of the input files, e.g. shift_jis or latin1 (default utf-8)")
+	fs.BoolVar(&opts.IgnoreWhitespace, "ignore-whitespace", false, "Resolve conflicts whose sides differ only in whitespace when the resolver opens")
+	fs.StringVar(&opts.WhitespaceSide, "whitespace-side", "ours", "With --ignore-whitespace, the side whitespace-only conflicts take: ours|theirs")
+	fs.BoolVar(&opts.NormalizeEOF, "normalize-eof", false, "Match the sides' final newline when that is the only difference on write")
+	fs.StringVar(&opts.PerFileTool, "per-file-tool", "", "No-args mode: resolve each selected file with an external command")
+	fs.StringVar(&opts.BaseRev, "base-rev", "", "No-args mode: read BASE from <rev>:<path> instead of index stage 1")
+	fs.StringVar(&diffContext, "context", "full", "Diff N lines around each conflict instead of the whole files (full|N)")
+	fs.IntVar(&opts.FullDiffLimit, "full-diff-limit", DefaultFullDiffLimit, "Skip the full-file diff for files with more conflicts than N (0: no limit)")
+	fs.Var((*stringList)(&opts.Only), "only", "No-args mode: only offer conflicted files matching this glob (repeatable)")
+	fs.Var((*stringList)(&opts.Exclude), "exclude", "No-args mode: skip conflicted files matching this glob (repeatable)")
+	fs.BoolVar(&opts.AllFiles, "all", false, "No-args mode: list conflicted files in the whole repository, not just the current directory")
+	fs.BoolVar(&opts.Stage, "stage", false, "No-args mode and --apply-all --all: git add each file written without conflicts")
+	fs.BoolVar(&opts.RecordNotes, "record-notes", false, "No-args mode: after W continues the merge or rebase, add a git note summarizing each file's resolutions to the commit it made")
+	fs.BoolVar(&opts.AutoWrite, "auto-write", false, "Write $MERGED when quitting the resolver with every conflict resolved")
+	fs.BoolVar(&opts.Force, "force", false, "Write $MERGED from the resolver even if it changed on disk since ec read it")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Never color output, like setting NO_COLOR")
+	fs.BoolVar(&opts.Swap, "swap", false, "Show theirs on the left and ours on the right, e.g. during a rebase")
+	fs.IntVar(&opts.TabWidth, "tab-width", 0, "Columns between tab stops in the resolver's panes (default 4)")
+	fs.BoolVar(&opts.Unified, "unified", false, "Open the resolver in one column showing each conflict as a unified diff")
+	fs.BoolVar(&opts.NoAltScreen, "no-altscreen", false, "Draw the resolver and file list inline instead of on the alternate screen")
+	fs.BoolVar(&opts.Batch, "batch", false, "No-args mode: open the next unresolved file after writing a resolved one")
+	fs.BoolVar(&opts.Watch, "watch", false, "No-args mode: keep the file list open and refresh it as files become conflicted or resolved")
+	fs.BoolVar(&opts.KeepWatching, "keep-watching", false, "With --watch, keep watching when no conflicts remain")
 	fs.BoolVar(&help, "help", false, "Show help")
 	fs.BoolVar(&help, "h", false, "Show help")
 	fs.BoolVar(&showVersion, "version", false, "Show version")
 
+	// `ec edit <file>` opens one conflicted file without the selector.
+	edit := len(args) > 0 && args[0] == "edit"
+	if edit {
+		args = args[1:]
+	}
+
 	fs.Usage = func() {}
 	if err := fs.Parse(args); err != nil {
 		return Options{}, fmt.Errorf("%w\n\n%s", err, Usage())
@@ -47,6 +105,25 @@ func Parse(args []string) (Options, error) {
 	if backup {
 		opts.Backup = true
 	}
+	backupSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "backup-suffix" || f.Name == "backup-dir" {
+			backupSet = true
+		}
+	})
+	if backupSet && !opts.Backup && !opts.RestoreBackup {
+		return Options{}, fmt.Errorf("--backup-suffix and --backup-dir require --backup or --restore-backup\n\n%s", Usage())
+	}
+	if strings.ContainsAny(opts.BackupSuffix, `/\`) || (opts.BackupSuffix == "" && opts.BackupDir == "") {
+		return Options{}, fmt.Errorf("invalid --backup-suffix: %q (must be non-empty without --backup-dir and contain no path separator)", opts.BackupSuffix)
+	}
+
+	if edit {
+		if fs.NArg() != 1 {
+			return Options{}, fmt.Errorf("edit requires exactly one file\n\n%s", Usage())
+		}
+		opts.EditPath = fs.Arg(0)
+	}
 
 	// Positional mergetool form: <BASE> <LOCAL> <REMOTE> <MERGED>
 	if opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" && opts.MergedPath == "" {
@@ -63,10 +140,204 @@ func Parse(args []string) (Options, error) {
 		return Options{}, fmt.Errorf("invalid --apply-all: %q (expected ours|theirs|both|none)", opts.ApplyAll)
 	}
 
+	opts.PrintResolved = strings.ToLower(strings.TrimSpace(opts.PrintResolved))
+	if opts.PrintResolved != "" && opts.PrintResolved != "ours" && opts.PrintResolved != "theirs" && opts.PrintResolved != "both" && opts.PrintResolved != "none" {
+		return Options{}, fmt.Errorf("invalid --print-resolved: %q (expected ours|theirs|both|none)", opts.PrintResolved)
+	}
+
+	opts.Annotate = strings.TrimSpace(opts.Annotate)
+	if opts.Annotate != "" && (opts.ApplyAll != "" || opts.Check) {
+		return Options{}, fmt.Errorf("--annotate cannot be combined with --apply-all or --check\n\n%s", Usage())
+	}
+
+	opts.Plan = strings.TrimSpace(opts.Plan)
+	opts.PreferBranch = strings.TrimSpace(opts.PreferBranch)
+	modes := 0
+	for _, set := range []bool{opts.Check, opts.ApplyAll != "", opts.Annotate != "", opts.Plan != "", opts.EmitPlan, opts.PreferBranch != "", opts.PrintResolved != ""} {
+		if set {
+			modes++
+		}
+	}
+	if (opts.Plan != "" || opts.EmitPlan) && modes > 1 {
+		return Options{}, fmt.Errorf("--plan and --emit-plan cannot be combined with each other or another mode\n\n%s", Usage())
+	}
+	if opts.PreferBranch != "" && modes > 1 {
+		return Options{}, fmt.Errorf("--prefer-branch cannot be combined with another mode\n\n%s", Usage())
+	}
+	if opts.PrintResolved != "" && modes > 1 {
+		return Options{}, fmt.Errorf("--print-resolved cannot be combined with another mode\n\n%s", Usage())
+	}
+	if opts.Report && (modes > 0 || opts.RestoreBackup) {
+		return Options{}, fmt.Errorf("--report cannot be combined with another mode or --restore-backup\n\n%s", Usage())
+	}
+	if opts.Markdown && !opts.Report {
+		return Options{}, fmt.Errorf("--markdown requires --report\n\n%s", Usage())
+	}
+	if opts.Verbose && !opts.Check {
+		return Options{}, fmt.Errorf("--verbose requires --check\n\n%s", Usage())
+	}
+	if opts.Timeout < 0 {
+		return Options{}, fmt.Errorf("invalid --timeout: %s (expected a non-negative duration)", opts.Timeout)
+	}
+	if opts.Timeout > 0 && modes == 0 {
+		return Options{}, fmt.Errorf("--timeout only applies to --check, --apply-all, --annotate, --plan, --emit-plan, --prefer-branch and --print-resolved\n\n%s", Usage())
+	}
+	if opts.Strict && opts.Plan == "" {
+		return Options{}, fmt.Errorf("--strict requires --plan\n\n%s", Usage())
+	}
+	for _, label := range []*string{&opts.OursLabel, &opts.BaseLabel, &opts.TheirsLabel} {
+		*label = strings.TrimSpace(*label)
+		if strings.ContainsAny(*label, "\r\n") {
+			return Options{}, fmt.Errorf("invalid marker label %q: must be a single line", *label)
+		}
+	}
+	if (opts.OursLabel != "" || opts.BaseLabel != "" || opts.TheirsLabel != "") && opts.Plan == "" && opts.PreferBranch == "" {
+		return Options{}, fmt.Errorf("--ours-label, --base-label and --theirs-label require --plan or --prefer-branch\n\n%s", Usage())
+	}
+
+	diffContext = strings.ToLower(strings.TrimSpace(diffContext))
+	if diffContext != "full" {
+		n, err := strconv.Atoi(diffContext)
+		if err != nil || n < 0 {
+			return Options{}, fmt.Errorf("invalid --context: %q (expected full or a non-negative number)", diffContext)
+		}
+		opts.DiffContext = n
+	}
+	if opts.FullDiffLimit < 0 {
+		return Options{}, fmt.Errorf("invalid --full-diff-limit: %d (expected a non-negative number)", opts.FullDiffLimit)
+	}
+
+	opts.NormalizeEOL = strings.ToLower(strings.TrimSpace(opts.NormalizeEOL))
+	if opts.NormalizeEOL != "" && opts.NormalizeEOL != "lf" && opts.NormalizeEOL != "crlf" {
+		return Options{}, fmt.Errorf("invalid --normalize-eol: %q (expected lf|crlf)", opts.NormalizeEOL)
+	}
+	if opts.TabWidth < 0 {
+		return Options{}, fmt.Errorf("invalid --tab-width: %d (expected a positive number)", opts.TabWidth)
+	}
+	if strings.ContainsAny(opts.BothSeparator, "\r\n") {
+		return Options{}, fmt.Errorf("invalid --both-separator: %q (expected a single line)", opts.BothSeparator)
+	}
+
+	opts.ConflictStyle = strings.ToLower(strings.TrimSpace(opts.ConflictStyle))
+	if opts.ConflictStyle != "diff3" && opts.ConflictStyle != "zdiff3" {
+		return Options{}, fmt.Errorf("invalid --conflict-style: %q (expected diff3|zdiff3)", opts.ConflictStyle)
+	}
+
+	opts.Encoding = strings.ToLower(strings.TrimSpace(opts.Encoding))
+	if _, err := charset.Lookup(opts.Encoding); err != nil {
+		return Options{}, fmt.Errorf("invalid --encoding: %w", err)
+	}
+
+	opts.WhitespaceSide = strings.ToLower(strings.TrimSpace(opts.WhitespaceSide))
+	if opts.WhitespaceSide != "ours" && opts.WhitespaceSide != "theirs" {
+		return Options{}, fmt.Errorf("invalid --whitespace-side: %q (expected ours|theirs)", opts.WhitespaceSide)
+	}
+	whitespaceSideSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "whitespace-side" {
+			whitespaceSideSet = true
+		}
+	})
+	if whitespaceSideSet && !opts.IgnoreWhitespace {
+		return Options{}, fmt.Errorf("--whitespace-side requires --ignore-whitespace\n\n%s", Usage())
+	}
+	if opts.IgnoreWhitespace && modes > 0 {
+		return Options{}, fmt.Errorf("--ignore-whitespace is only supported by the interactive resolver\n\n%s", Usage())
+	}
+
+	if opts.Patch && opts.ApplyAll == "" {
+		return Options{}, fmt.Errorf("--patch requires --apply-all\n\n%s", Usage())
+	}
+	if opts.ExportWordDiff && opts.ApplyAll == "" {
+		return Options{}, fmt.Errorf("--export-word-diff requires --apply-all\n\n%s", Usage())
+	}
+	if opts.DryRun && opts.ApplyAll == "" {
+		return Options{}, fmt.Errorf("--dry-run requires --apply-all\n\n%s", Usage())
+	}
+	if opts.DryRun && (opts.Patch || opts.ExportWordDiff) {
+		return Options{}, fmt.Errorf("--dry-run cannot be combined with --patch or --export-word-diff\n\n%s", Usage())
+	}
+	if opts.ExportWordDiff && opts.Patch {
+		return Options{}, fmt.Errorf("--export-word-diff and --patch are mutually exclusive\n\n%s", Usage())
+	}
+
+	if opts.Stdout && opts.ApplyAll == "" && opts.Annotate == "" && opts.Plan == "" && opts.PreferBranch == "" {
+		return Options{}, fmt.Errorf("--stdout requires --apply-all, --annotate, --plan or --prefer-branch\n\n%s", Usage())
+	}
+
+	opts.BaseRev = strings.TrimSpace(opts.BaseRev)
+	noPaths := opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" && opts.MergedPath == ""
+	// --apply-all --all without paths resolves every conflicted file in the
+	// repository, so it takes the no-args file options too.
+	repoApply := opts.ApplyAll != "" && opts.AllFiles && noPaths && modes == 1 && !edit
+	// --check --all without paths checks every conflicted file instead.
+	repoCheck := opts.Check && opts.AllFiles && noPaths && fs.NArg() == 0 && modes == 1 && !edit
+	if opts.BaseRev != "" && !repoApply && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("--base-rev is only supported in no-args mode\n\n%s", Usage())
+	}
+	if edit && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("edit cannot be combined with a mode or explicit paths\n\n%s", Usage())
+	}
+	if edit && (opts.AllFiles || len(opts.Only) > 0 || len(opts.Exclude) > 0) {
+		return Options{}, fmt.Errorf("--all, --only and --exclude cannot be combined with edit\n\n%s", Usage())
+	}
+	if opts.Watch && (modes > 0 || !noPaths || edit) {
+		return Options{}, fmt.Errorf("--watch is only supported in no-args mode\n\n%s", Usage())
+	}
+	if opts.Stage && !repoApply && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("--stage is only supported in no-args mode and with --apply-all --all\n\n%s", Usage())
+	}
+	if opts.RecordNotes && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("--record-notes is only supported in no-args mode\n\n%s", Usage())
+	}
+	if opts.KeepWatching && !opts.Watch {
+		return Options{}, fmt.Errorf("--keep-watching requires --watch\n\n%s", Usage())
+	}
+	if opts.AllFiles && !repoApply && !repoCheck && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("--all is only supported in no-args mode\n\n%s", Usage())
+	}
+	if (len(opts.Only) > 0 || len(opts.Exclude) > 0) && !repoApply && !repoCheck && (modes > 0 || !noPaths) {
+		return Options{}, fmt.Errorf("--only and --exclude are only supported in no-args mode\n\n%s", Usage())
+	}
+	for _, pattern := range append(append([]string(nil), opts.Only...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Options{}, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	if opts.RestoreBackup {
+		if modes > 0 || opts.MergedPath == "" || opts.BasePath != "" || opts.LocalPath != "" || opts.RemotePath != "" {
+			return Options{}, fmt.Errorf("--restore-backup takes only --merged <path>\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
+	if opts.Report {
+		// Only $MERGED is read; --all reports every conflicted file.
+		if opts.MergedPath == "" && !(opts.AllFiles && fs.NArg() == 0) {
+			return Options{}, fmt.Errorf("--report requires --merged or --all\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
 	if opts.Check {
-		// Only needs merged.
+		// Only needs merged, or a directory or --all to check many files.
+		if repoCheck {
+			return opts, nil
+		}
+		if noPaths && fs.NArg() == 1 {
+			opts.CheckDir = fs.Arg(0)
+			return opts, nil
+		}
 		if opts.MergedPath == "" {
-			return Options{}, fmt.Errorf("--check requires --merged (or positional args)\n\n%s", Usage())
+			return Options{}, fmt.Errorf("--check requires --merged, a directory or --all\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
+	if repoApply {
+		if opts.Patch || opts.ExportWordDiff || opts.DryRun || opts.Stdout {
+			return Options{}, fmt.Errorf("--patch, --export-word-diff, --dry-run and --stdout cannot be combined with --all\n\n%s", Usage())
 		}
 		return opts, nil
 	}
@@ -78,12 +349,52 @@ func Parse(args []string) (Options, error) {
 		return opts, nil
 	}
 
+	if opts.Annotate != "" {
+		if opts.BasePath == "" || opts.LocalPath == "" || opts.RemotePath == "" || opts.MergedPath == "" {
+			return Options{}, fmt.Errorf("--annotate requires base/local/remote/merged\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
+	if opts.PreferBranch != "" {
+		if opts.BasePath == "" || opts.LocalPath == "" || opts.RemotePath == "" || opts.MergedPath == "" {
+			return Options{}, fmt.Errorf("--prefer-branch requires base/local/remote/merged\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
+	if opts.PrintResolved != "" {
+		// $MERGED is neither read nor written, so it may be left out.
+		if opts.BasePath == "" || opts.LocalPath == "" || opts.RemotePath == "" {
+			return Options{}, fmt.Errorf("--print-resolved requires base/local/remote\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
+	if opts.Plan != "" || opts.EmitPlan {
+		if opts.BasePath == "" || opts.LocalPath == "" || opts.RemotePath == "" || opts.MergedPath == "" {
+			return Options{}, fmt.Errorf("--plan and --emit-plan require base/local/remote/merged\n\n%s", Usage())
+		}
+		return opts, nil
+	}
+
 	// No-arg mode: detect conflicts in current repo and select a file.
-	if opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" && opts.MergedPath == "" {
+	if noPaths {
 		return opts, nil
 	}
 
-	// Interactive mode needs full paths.
+	if opts.PerFileTool != "" {
+		return Options{}, fmt.Errorf("--per-file-tool is only supported in no-args mode\n\n%s", Usage())
+	}
+
+	// A lone --merged file, e.g. one written with merge.conflictStyle=merge,
+	// has no stage files to rebuild a base from, so it is resolved two-way.
+	if opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" {
+		opts.AllowMissingBase = true
+		return opts, nil
+	}
+
+	// Otherwise interactive mode needs full paths.
 	if opts.BasePath == "" || opts.LocalPath == "" || opts.RemotePath == "" || opts.MergedPath == "" {
 		return Options{}, fmt.Errorf("missing required paths\n\n%s", Usage())
 	}
@@ -96,17 +407,146 @@ func Usage() string {
 	  ec
 	  ec <BASE> <LOCAL> <REMOTE> <MERGED>
 	  ec --base <path> --local <path> --remote <path> --merged <path>
+	  ec --merged <path>          Resolve $MERGED two-way from its own conflict markers
+	  ec edit <file>              Resolve the conflicted <file> of the current repository
+	                              without picking it from the list
 
 Modes:
-	  --check                     Exit 0 if $MERGED has no valid conflict blocks, else 1
-	  --apply-all ours|theirs|both|none Resolve all conflicts non-interactively and write $MERGED
+	  --check                     Exit 0 if $MERGED has no valid conflict blocks, else 1;
+	                              given a directory instead, check every file under it, and
+	                              with --all and no paths, every conflicted file in the
+	                              repository, printing the files that still have conflicts
+	  --apply-all ours|theirs|both|none Resolve all conflicts non-interactively and write $MERGED;
+	                              with --all and no paths, do so for every conflicted file
+	                              in the repository (narrowed by --only and --exclude)
+	                              none deletes every conflicting region, keeping neither
+	                              side, and prints a warning unless --quiet
+	  --annotate <prefix>         Write both sides of each conflict to $MERGED, introduced by
+	                              "<prefix> OURS" and "<prefix> THEIRS" comment lines
+	  --plan <file>               Resolve conflicts as listed in a JSON plan and write $MERGED;
+	                              conflicts not in the plan keep their markers, or fail with --strict
+	  --emit-plan                 Print a JSON plan with each conflict's number and hash to fill in
+	  --prefer-branch <name>      Resolve each conflict to the side whose marker label is <name>,
+	                              ours or theirs; conflicts labelled <name> on neither side or
+	                              both keep their markers and are reported (exit 1)
+	  --restore-backup            Copy the backup of $MERGED (see --backup) back over it; takes
+	                              only --merged, plus the --backup-suffix or --backup-dir the
+	                              backup was written with
+	  --print-resolved ours|theirs|both|none
+	                              Print the result of resolving every conflict to one side;
+	                              needs only BASE, LOCAL and REMOTE and never writes (exit 0)
+	  --report                    Print each conflict of $MERGED with its labels, sides and a
+	                              suggested resolution, for review away from the resolver;
+	                              only reads $MERGED; with --all and no paths, reports every
+	                              conflicted file in the repository (narrowed by --only and
+	                              --exclude)
 
 No-args mode:
 	  If invoked with no paths and no mode flags, ec lists
 	  conflicted files under the current directory and prompts to select one.
+	  --all                       List conflicted files in the whole repository instead of
+	                              only under the current directory
+	  --only <glob>               Only offer conflicted files matching <glob>; a pattern without
+	                              a slash matches file names, ** matches any number of
+	                              directories (repeatable)
+	  --exclude <glob>            Skip conflicted files matching <glob> (repeatable)
+	  --per-file-tool <cmd>       Run <cmd> BASE LOCAL REMOTE MERGED for the selected file
+	                              instead of the built-in resolver
+	  --base-rev <rev>            Read BASE from <rev>:<path> instead of index stage 1,
+	                              e.g. for octopus or criss-cross merges
+	  --watch                     Keep the file list open on a terminal and refresh it every
+	                              few seconds; exits once no conflicts remain
+	  --keep-watching             With --watch, keep watching when no conflicts remain
 
 Options:
+	  --auto-write                Write $MERGED when quitting the resolver (q or ctrl+c) once
+	                              every conflict is resolved, without pressing w
 	  --backup                    Create $MERGED.ec.bak
+	  --backup-dir <dir>          With --backup, write backups to <dir> (created if missing)
+	                              instead of next to $MERGED; with --restore-backup, read from it
+	  --backup-suffix <suffix>    With --backup or --restore-backup, name backups
+	                              $MERGED<suffix> (default .ec.bak)
+	  --base-label <label>        With --plan or --prefer-branch, label the ||||||| marker of
+	                              unresolved conflicts
+	  --batch                     No-args mode: open the next unresolved file after a resolved write
+	  --both-separator <line>     Write <line> between ours and theirs of conflicts resolved to
+	                              both, ended like the sides' lines (default: none; the
+	                              resolver also reads both_separator from themes.json)
+	  --conflict-style diff3|zdiff3
+	                              Style of the conflicts ec rebuilds from BASE, LOCAL and
+	                              REMOTE (default diff3); zdiff3 moves lines both sides share
+	                              out of each conflict and needs git 2.35+, falling back to diff3
+	  --context full|N            Diff only N lines around each conflict in the panes instead of
+	                              the whole files (default full; 0 also means full)
+	  --dry-run                   With --apply-all, print which side each conflict takes and
+	                              how many lines it contributes; writes nothing
+	  --encoding <name>           Decode the input files from <name> (e.g. shift_jis, latin1)
+	                              for display and write $MERGED back in it (default utf-8)
+	  --export-word-diff          With --apply-all, print the BASE to result change in
+	                              git's --word-diff format instead of writing
+	  --force                     Let the resolver write $MERGED without asking when another
+	                              program changed it on disk since ec read it
+	  --full-diff-limit <n>       Show conflicts on their own instead of diffing the whole files
+	                              when a file has more than <n> conflicts (default 200; 0: no limit)
+	  --ignore-whitespace         Resolve conflicts whose sides differ only in whitespace
+	                              (indentation, trailing blanks, line endings) when the
+	                              resolver opens; the chosen side is written byte for byte
+	  --markdown                  With --report, write the report as markdown with the sides in
+	                              fenced code blocks
+	  --normalize-eol lf|crlf     On write, convert every line ending to one style; ec warns
+	                              when a file mixes LF, CRLF or lone CR endings
+	  --normalize-eof             On write, add or drop the final newline so $MERGED ends like
+	                              LOCAL and REMOTE when both agree; the added newline reuses
+	                              the file's own line ending (CRLF stays CRLF)
+	  --no-altscreen              Draw the resolver and file list inline instead of on the
+	                              terminal's alternate screen, e.g. in tmux popups
+	  --no-color                  Never color output, like setting NO_COLOR; --patch and
+	                              warnings are only colored on a terminal anyway
+	  --ours-label <label>        With --plan or --prefer-branch, label the <<<<<<< marker of
+	                              unresolved conflicts
+	  --patch                     With --apply-all, print a unified diff instead of writing
+	  --quiet                     Suppress informational messages and warnings; errors and
+	                              requested output (--patch, --dry-run, --emit-plan, --stdout,
+	                              --print-resolved) still print
+	  --record-notes              No-args mode: once W has continued the merge or rebase, add a
+	                              git note to the commit it made listing how each file's
+	                              conflicts were resolved
+	  --stage                     No-args mode and --apply-all --all: git add each file once it
+	                              is written without conflict markers; a failure is reported
+	                              but leaves the written file in place
+	  --stdout                    With --apply-all, --annotate, --plan or --prefer-branch, print
+	                              the result instead of writing $MERGED or backups; --patch,
+	                              --export-word-diff and --dry-run take precedence
+	  --strict                    With --plan, fail when a conflict is not in the plan
+	  --swap                      Show theirs in the left pane and ours in the right one, as a
+	                              rebase reads (toggle with zs); o, t and the written result
+	                              still mean git's ours and theirs
+	  --tab-width <n>             Columns between tab stops in the resolver's panes (default 4;
+	                              the resolver also reads tab_width from themes.json)
+	  --theirs-label <label>      With --plan or --prefer-branch, label the >>>>>>> marker of
+	                              unresolved conflicts
+	  --timeout <duration>        With --check, --apply-all, --annotate, --plan, --emit-plan,
+	                              --prefer-branch or --print-resolved, stop with exit code 2
+	                              after <duration> (e.g. 30s), canceling any git command
+	                              still running
+	  --unified                   Open the resolver in one column that shows each conflict as a
+	                              unified diff of both sides against BASE (toggle with zu)
+	  --verbose                   With --check, list unresolved conflicts on stderr
 	  --version                   Show version
+	  --whitespace-side ours|theirs
+	                              With --ignore-whitespace, the side whitespace-only
+	                              conflicts take (default ours)
 `)
 }
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseBackupDefault(t *testing.T) {
@@ -32,3 +34,695 @@ func TestParseVersionFlag(t *testing.T) {
 		t.Fatalf("Parse() error = %v, want ErrVersion", err)
 	}
 }
+
+func TestParsePatchRequiresApplyAll(t *testing.T) {
+	if _, err := Parse([]string{"--patch", "--merged", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --patch without --apply-all")
+	}
+
+	args := []string{"--apply-all", "theirs", "--patch", "b", "l", "r", "m"}
+	opts, err := Parse(args)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Patch {
+		t.Fatalf("Parse() Patch = false, want true")
+	}
+}
+
+func TestParseExportWordDiff(t *testing.T) {
+	if _, err := Parse([]string{"--export-word-diff", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --export-word-diff without --apply-all")
+	}
+	if _, err := Parse([]string{"--apply-all", "ours", "--export-word-diff", "--patch", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --export-word-diff with --patch")
+	}
+
+	opts, err := Parse([]string{"--apply-all", "ours", "--export-word-diff", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.ExportWordDiff {
+		t.Fatalf("Parse() ExportWordDiff = false, want true")
+	}
+}
+
+func TestParseDryRun(t *testing.T) {
+	if _, err := Parse([]string{"--dry-run", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --dry-run without --apply-all")
+	}
+	if _, err := Parse([]string{"--apply-all", "ours", "--dry-run", "--patch", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --dry-run with --patch")
+	}
+
+	opts, err := Parse([]string{"--apply-all", "ours", "--dry-run", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.DryRun {
+		t.Fatalf("Parse() DryRun = false, want true")
+	}
+}
+
+func TestParseAnnotate(t *testing.T) {
+	opts, err := Parse([]string{"--annotate", " # ", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Annotate != "#" {
+		t.Fatalf("Parse() Annotate = %q, want #", opts.Annotate)
+	}
+
+	if _, err := Parse([]string{"--annotate", "#", "--apply-all", "ours", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --annotate with --apply-all")
+	}
+	if _, err := Parse([]string{"--annotate", "#", "--merged", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for --annotate without all paths")
+	}
+}
+
+func TestParseQuiet(t *testing.T) {
+	opts, err := Parse([]string{"--quiet", "--apply-all", "ours", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Quiet {
+		t.Fatalf("Parse() Quiet = false, want true")
+	}
+}
+
+func TestParseEdit(t *testing.T) {
+	opts, err := Parse([]string{"edit", "--base-rev", "HEAD~1", "src/main.go"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.EditPath != "src/main.go" || opts.BaseRev != "HEAD~1" {
+		t.Fatalf("Parse() EditPath = %q, BaseRev = %q", opts.EditPath, opts.BaseRev)
+	}
+	if opts.MergedPath != "" {
+		t.Fatalf("Parse() MergedPath = %q, want empty", opts.MergedPath)
+	}
+
+	for _, args := range [][]string{
+		{"edit"},
+		{"edit", "a.go", "b.go"},
+		{"edit", "--check", "a.go"},
+		{"edit", "--merged", "m", "a.go"},
+		{"edit", "--all", "a.go"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseApplyAllToRepo(t *testing.T) {
+	opts, err := Parse([]string{"--apply-all", "theirs", "--all", "--only", "*.go"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.ApplyAll != "theirs" || !opts.AllFiles || opts.MergedPath != "" {
+		t.Fatalf("Parse() = %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{"--apply-all", "theirs"},
+		{"--apply-all", "theirs", "--only", "*.go"},
+		{"--apply-all", "theirs", "--all", "--patch"},
+		{"--apply-all", "theirs", "--all", "b", "l", "r", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseBackupOptions(t *testing.T) {
+	opts, err := Parse([]string{"--backup", "--backup-dir", "/tmp/bak", "--backup-suffix", ".orig", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Backup || opts.BackupDir != "/tmp/bak" || opts.BackupSuffix != ".orig" {
+		t.Fatalf("Parse() = %+v", opts)
+	}
+
+	opts, err = Parse([]string{"b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.BackupSuffix != ".ec.bak" {
+		t.Fatalf("Parse() BackupSuffix = %q, want .ec.bak", opts.BackupSuffix)
+	}
+
+	for _, args := range [][]string{
+		{"--backup-dir", "/tmp/bak", "b", "l", "r", "m"},
+		{"--backup", "--backup-suffix", "", "b", "l", "r", "m"},
+		{"--backup", "--backup-suffix", "x/y", "b", "l", "r", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseWatch(t *testing.T) {
+	opts, err := Parse([]string{"--watch", "--keep-watching"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Watch || !opts.KeepWatching {
+		t.Fatalf("Parse() Watch = %v, KeepWatching = %v", opts.Watch, opts.KeepWatching)
+	}
+
+	for _, args := range [][]string{
+		{"--keep-watching"},
+		{"--watch", "b", "l", "r", "m"},
+		{"--watch", "--check", "--merged", "m"},
+		{"edit", "--watch", "a.go"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseVerbose(t *testing.T) {
+	opts, err := Parse([]string{"--check", "--verbose", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Check || !opts.Verbose {
+		t.Fatalf("Parse() Check = %v, Verbose = %v", opts.Check, opts.Verbose)
+	}
+	if _, err := Parse([]string{"--verbose", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse(--verbose without --check) error = nil, want error")
+	}
+}
+
+func TestParseCheckMany(t *testing.T) {
+	opts, err := Parse([]string{"--check", "src"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Check || opts.CheckDir != "src" || opts.MergedPath != "" {
+		t.Fatalf("Parse() Check = %v, CheckDir = %q, MergedPath = %q", opts.Check, opts.CheckDir, opts.MergedPath)
+	}
+
+	opts, err = Parse([]string{"--check", "--all", "--only", "*.go"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.AllFiles || opts.CheckDir != "" {
+		t.Fatalf("Parse() AllFiles = %v, CheckDir = %q", opts.AllFiles, opts.CheckDir)
+	}
+
+	for _, args := range [][]string{
+		{"--check"},
+		{"--check", "--all", "src"},
+		{"--check", "--only", "*.go", "src"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseIgnoreWhitespace(t *testing.T) {
+	opts, err := Parse([]string{"--ignore-whitespace", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.IgnoreWhitespace || opts.WhitespaceSide != "ours" {
+		t.Fatalf("Parse() IgnoreWhitespace = %v, WhitespaceSide = %q", opts.IgnoreWhitespace, opts.WhitespaceSide)
+	}
+
+	opts, err = Parse([]string{"--ignore-whitespace", "--whitespace-side", "Theirs"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.WhitespaceSide != "theirs" {
+		t.Fatalf("Parse() WhitespaceSide = %q, want theirs", opts.WhitespaceSide)
+	}
+
+	for _, args := range [][]string{
+		{"--whitespace-side", "theirs"},
+		{"--ignore-whitespace", "--whitespace-side", "both"},
+		{"--ignore-whitespace", "--apply-all", "ours", "b", "l", "r", "m"},
+		{"--ignore-whitespace", "--check", "--merged", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParsePreferBranch(t *testing.T) {
+	opts, err := Parse([]string{"--prefer-branch", " feature/foo ", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.PreferBranch != "feature/foo" {
+		t.Fatalf("Parse() PreferBranch = %q, want feature/foo", opts.PreferBranch)
+	}
+
+	for _, args := range [][]string{
+		{"--prefer-branch", "main"},
+		{"--prefer-branch", "main", "--apply-all", "ours", "b", "l", "r", "m"},
+		{"--prefer-branch", "main", "--plan", "plan.json", "b", "l", "r", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParsePrintResolved(t *testing.T) {
+	opts, err := Parse([]string{"--print-resolved", "Theirs", "--base", "b", "--local", "l", "--remote", "r"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.PrintResolved != "theirs" || opts.MergedPath != "" {
+		t.Fatalf("Parse() PrintResolved = %q, MergedPath = %q", opts.PrintResolved, opts.MergedPath)
+	}
+
+	for _, args := range [][]string{
+		{"--print-resolved", "mine", "b", "l", "r", "m"},
+		{"--print-resolved", "ours", "--merged", "m"},
+		{"--print-resolved", "ours", "--apply-all", "ours", "b", "l", "r", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseReport(t *testing.T) {
+	opts, err := Parse([]string{"--report", "--markdown", "--merged", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Report || !opts.Markdown || opts.MergedPath != "m" {
+		t.Fatalf("Parse() Report = %v, Markdown = %v, MergedPath = %q", opts.Report, opts.Markdown, opts.MergedPath)
+	}
+	if opts, err := Parse([]string{"--report", "--all", "--only", "*.go"}); err != nil || !opts.AllFiles {
+		t.Fatalf("Parse(--report --all) = %+v, %v", opts, err)
+	}
+
+	for _, args := range [][]string{
+		{"--report"},
+		{"--report", "--all", "--merged", "m"},
+		{"--report", "--restore-backup", "--merged", "m"},
+		{"--markdown", "--merged", "m"},
+		{"--report", "--check", "--merged", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseStage(t *testing.T) {
+	for _, args := range [][]string{{"--stage"}, {"--stage", "--apply-all", "ours", "--all"}} {
+		opts, err := Parse(args)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", args, err)
+		}
+		if !opts.Stage {
+			t.Fatalf("Parse(%q) Stage = false, want true", args)
+		}
+	}
+	for _, args := range [][]string{
+		{"--stage", "b", "l", "r", "m"},
+		{"--stage", "--apply-all", "ours", "b", "l", "r", "m"},
+		{"--stage", "--check", "--merged", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseRecordNotes(t *testing.T) {
+	opts, err := Parse([]string{"--record-notes"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.RecordNotes {
+		t.Fatalf("Parse() RecordNotes = false, want true")
+	}
+	for _, args := range [][]string{
+		{"--record-notes", "b", "l", "r", "m"},
+		{"--record-notes", "--check", "--all"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParseUnified(t *testing.T) {
+	opts, err := Parse([]string{"--unified", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Unified {
+		t.Fatalf("Parse() Unified = false, want true")
+	}
+}
+
+func TestParseSwap(t *testing.T) {
+	opts, err := Parse([]string{"--swap", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Swap {
+		t.Fatalf("Parse() Swap = false, want true")
+	}
+}
+
+func TestParseForce(t *testing.T) {
+	opts, err := Parse([]string{"--force", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Force {
+		t.Fatalf("Parse() Force = false, want true")
+	}
+}
+
+func TestParseTabWidth(t *testing.T) {
+	opts, err := Parse([]string{"--tab-width", "8", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.TabWidth != 8 {
+		t.Fatalf("Parse() TabWidth = %d, want 8", opts.TabWidth)
+	}
+	if _, err := Parse([]string{"--tab-width", "-1", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() with a negative tab width error = nil, want error")
+	}
+}
+
+func TestParseBothSeparator(t *testing.T) {
+	opts, err := Parse([]string{"--both-separator", "// ---", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.BothSeparator != "// ---" {
+		t.Fatalf("Parse() BothSeparator = %q, want // ---", opts.BothSeparator)
+	}
+	if _, err := Parse([]string{"--both-separator", "a\nb", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() with a multi-line separator error = nil, want error")
+	}
+}
+
+func TestParseRestoreBackup(t *testing.T) {
+	opts, err := Parse([]string{"--restore-backup", "--backup-suffix", ".orig", "--merged", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.RestoreBackup || opts.MergedPath != "m" || opts.BackupSuffix != ".orig" {
+		t.Fatalf("Parse() RestoreBackup = %v, MergedPath = %q, BackupSuffix = %q", opts.RestoreBackup, opts.MergedPath, opts.BackupSuffix)
+	}
+
+	for _, args := range [][]string{
+		{"--restore-backup"},
+		{"--restore-backup", "b", "l", "r", "m"},
+		{"--restore-backup", "--apply-all", "ours", "--merged", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	opts, err := Parse([]string{"--plan", "plan.json", "--strict", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Plan != "plan.json" || !opts.Strict {
+		t.Fatalf("Parse() Plan = %q, Strict = %v", opts.Plan, opts.Strict)
+	}
+
+	opts, err = Parse([]string{"--emit-plan", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.EmitPlan {
+		t.Fatalf("Parse() EmitPlan = false, want true")
+	}
+
+	opts, err = Parse([]string{"--plan", "plan.json", "--ours-label", "HEAD", "--base-label", "BASE", "--theirs-label", "BRANCH", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.OursLabel != "HEAD" || opts.BaseLabel != "BASE" || opts.TheirsLabel != "BRANCH" {
+		t.Fatalf("Parse() labels = %q/%q/%q", opts.OursLabel, opts.BaseLabel, opts.TheirsLabel)
+	}
+	if _, err := Parse([]string{"--apply-all", "ours", "--ours-label", "HEAD", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() with --ours-label and no --plan error = nil, want error")
+	}
+	opts, err = Parse([]string{"--prefer-branch", "feature/foo", "--theirs-label", "BRANCH", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() with --prefer-branch and --theirs-label error = %v", err)
+	}
+	if opts.TheirsLabel != "BRANCH" {
+		t.Fatalf("Parse() TheirsLabel = %q, want BRANCH", opts.TheirsLabel)
+	}
+
+	for _, args := range [][]string{
+		{"--plan", "plan.json", "--merged", "m"},
+		{"--plan", "plan.json", "--apply-all", "ours", "b", "l", "r", "m"},
+		{"--plan", "plan.json", "--emit-plan", "b", "l", "r", "m"},
+		{"--strict", "b", "l", "r", "m"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatalf("Parse(%v) error = nil, want error", args)
+		}
+	}
+}
+
+func TestParsePerFileToolOnlyInNoArgsMode(t *testing.T) {
+	opts, err := Parse([]string{"--per-file-tool", "meld"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.PerFileTool != "meld" {
+		t.Fatalf("Parse() PerFileTool = %q, want meld", opts.PerFileTool)
+	}
+
+	if _, err := Parse([]string{"--per-file-tool", "meld", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with explicit paths")
+	}
+}
+
+func TestParseBaseRevOnlyInNoArgsMode(t *testing.T) {
+	opts, err := Parse([]string{"--base-rev", "HEAD~1"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.BaseRev != "HEAD~1" {
+		t.Fatalf("Parse() BaseRev = %q, want HEAD~1", opts.BaseRev)
+	}
+
+	if _, err := Parse([]string{"--base-rev", "HEAD~1", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with explicit paths")
+	}
+	if _, err := Parse([]string{"--base-rev", "HEAD~1", "--apply-all", "ours", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with --apply-all")
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	opts, err := Parse([]string{"b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.DiffContext != 0 {
+		t.Fatalf("Parse() DiffContext = %d, want 0 (full) by default", opts.DiffContext)
+	}
+
+	opts, err = Parse([]string{"--context", "10", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.DiffContext != 10 {
+		t.Fatalf("Parse() DiffContext = %d, want 10", opts.DiffContext)
+	}
+
+	for _, value := range []string{"-1", "lots"} {
+		if _, err := Parse([]string{"--context", value, "b", "l", "r", "m"}); err == nil {
+			t.Fatalf("Parse(--context %s) error = nil, want error", value)
+		}
+	}
+}
+
+func TestParseStdout(t *testing.T) {
+	opts, err := Parse([]string{"--apply-all", "ours", "--stdout", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Stdout {
+		t.Fatalf("Parse() Stdout = false, want true")
+	}
+
+	if _, err := Parse([]string{"--stdout", "b", "l", "r", "m"}); err == nil || !strings.Contains(err.Error(), "--stdout requires") {
+		t.Fatalf("Parse(--stdout) error = %v, want a mode error", err)
+	}
+	if _, err := Parse([]string{"--apply-all", "ours", "--all", "--stdout"}); err == nil {
+		t.Fatalf("Parse(--apply-all --all --stdout) error = nil, want error")
+	}
+}
+
+func TestParseFullDiffLimit(t *testing.T) {
+	opts, err := Parse([]string{"b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.FullDiffLimit != DefaultFullDiffLimit {
+		t.Fatalf("Parse() FullDiffLimit = %d, want %d by default", opts.FullDiffLimit, DefaultFullDiffLimit)
+	}
+
+	opts, err = Parse([]string{"--full-diff-limit", "0", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.FullDiffLimit != 0 {
+		t.Fatalf("Parse() FullDiffLimit = %d, want 0", opts.FullDiffLimit)
+	}
+
+	if _, err := Parse([]string{"--full-diff-limit", "-1", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse(--full-diff-limit -1) error = nil, want error")
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	opts, err := Parse([]string{"--apply-all", "ours", "--timeout", "30s", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Timeout != 30*time.Second {
+		t.Fatalf("Parse() Timeout = %s, want 30s", opts.Timeout)
+	}
+
+	if _, err := Parse([]string{"--timeout", "30s", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse(--timeout) in interactive mode error = nil, want error")
+	}
+	if _, err := Parse([]string{"--check", "--timeout", "-1s", "m"}); err == nil {
+		t.Fatalf("Parse(--timeout -1s) error = nil, want error")
+	}
+}
+
+func TestParseAllOnlyInNoArgsMode(t *testing.T) {
+	opts, err := Parse([]string{"--all"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.AllFiles {
+		t.Fatalf("Parse() AllFiles = false, want true")
+	}
+
+	if _, err := Parse([]string{"--all", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with explicit paths")
+	}
+}
+
+func TestParseMergedOnlyRunsTwoWay(t *testing.T) {
+	opts, err := Parse([]string{"--merged", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.AllowMissingBase {
+		t.Fatalf("Parse() AllowMissingBase = false, want true with only --merged")
+	}
+
+	opts, err = Parse([]string{"b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.AllowMissingBase {
+		t.Fatalf("Parse() AllowMissingBase = true, want false with stage paths")
+	}
+
+	if _, err := Parse([]string{"--local", "l", "--merged", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with partial stage paths")
+	}
+}
+
+func TestParseConflictStyle(t *testing.T) {
+	opts, err := Parse([]string{"b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.ConflictStyle != "diff3" {
+		t.Fatalf("Parse() ConflictStyle = %q, want diff3 by default", opts.ConflictStyle)
+	}
+
+	opts, err = Parse([]string{"--conflict-style", "ZDIFF3", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.ConflictStyle != "zdiff3" {
+		t.Fatalf("Parse() ConflictStyle = %q, want zdiff3", opts.ConflictStyle)
+	}
+
+	if _, err := Parse([]string{"--conflict-style", "merge", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for unknown style")
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	opts, err := Parse([]string{"--encoding", " Shift_JIS ", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Encoding != "shift_jis" {
+		t.Fatalf("Parse() Encoding = %q, want shift_jis", opts.Encoding)
+	}
+
+	if _, err := Parse([]string{"--encoding", "no-such-charset", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for unknown encoding")
+	}
+}
+
+func TestParseOnlyAndExclude(t *testing.T) {
+	opts, err := Parse([]string{"--only", "*.go", "--only", "docs/**", "--exclude", "*_test.go"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if strings.Join(opts.Only, ",") != "*.go,docs/**" || strings.Join(opts.Exclude, ",") != "*_test.go" {
+		t.Fatalf("Parse() Only = %q, Exclude = %q", opts.Only, opts.Exclude)
+	}
+
+	if _, err := Parse([]string{"--only", "["}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for malformed glob")
+	}
+	if _, err := Parse([]string{"--exclude", "*.go", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error with explicit paths")
+	}
+}
+
+func TestParseNormalizeEOF(t *testing.T) {
+	opts, err := Parse([]string{"--normalize-eof", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.NormalizeEOF {
+		t.Fatalf("Parse() NormalizeEOF = false, want true")
+	}
+}
+
+func TestParseNormalizeEOL(t *testing.T) {
+	opts, err := Parse([]string{"--normalize-eol", "CRLF", "b", "l", "r", "m"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.NormalizeEOL != "crlf" {
+		t.Fatalf("Parse() NormalizeEOL = %q, want crlf", opts.NormalizeEOL)
+	}
+
+	if _, err := Parse([]string{"--normalize-eol", "cr", "b", "l", "r", "m"}); err == nil {
+		t.Fatalf("Parse() error = nil, want error for unknown --normalize-eol style")
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chojs23/ec/internal/cli"
+)
+
+// DefaultBackupSuffix is appended to the merged file name when
+// --backup-suffix is not given.
+const DefaultBackupSuffix = ".ec.bak"
+
+// BackupPath returns where the backup of path goes: next to it, or in
+// opts.BackupDir when set, named after path plus opts.BackupSuffix.
+func BackupPath(path string, opts cli.Options) string {
+	suffix := opts.BackupSuffix
+	if suffix == "" && opts.BackupDir == "" {
+		suffix = DefaultBackupSuffix
+	}
+	if opts.BackupDir == "" {
+		return path + suffix
+	}
+	return filepath.Join(opts.BackupDir, filepath.Base(path)+suffix)
+}
+
+// WriteBackup writes data, the content of path before ec overwrites it, to
+// BackupPath. It does nothing unless opts.Backup is set.
+func WriteBackup(path string, data []byte, opts cli.Options) error {
+	if !opts.Backup {
+		return nil
+	}
+	bak := BackupPath(path, opts)
+	if opts.BackupDir != "" {
+		if err := os.MkdirAll(opts.BackupDir, 0o755); err != nil {
+			return fmt.Errorf("create backup dir: %w", err)
+		}
+	}
+	if err := os.WriteFile(bak, data, 0o644); err != nil {
+		return fmt.Errorf("write backup %s: %w", filepath.Base(bak), err)
+	}
+	return nil
+}
+
+// RestoreBackup copies the backup of path, as found at BackupPath, back over
+// path. It fails without touching path when there is no backup, and leaves
+// the backup in place.
+func RestoreBackup(path string, opts cli.Options) error {
+	bak := BackupPath(path, opts)
+	data, err := os.ReadFile(bak)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no backup of %s at %s", filepath.Base(path), bak)
+		}
+		return fmt.Errorf("read backup %s: %w", filepath.Base(bak), err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("restore %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
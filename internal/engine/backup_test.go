@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chojs23/ec/internal/cli"
+)
+
+func TestBackupPath(t *testing.T) {
+	tests := []struct {
+		name string
+		opts cli.Options
+		want string
+	}{
+		{"default", cli.Options{}, "/repo/a.go.ec.bak"},
+		{"suffix", cli.Options{BackupSuffix: ".orig"}, "/repo/a.go.orig"},
+		{"dir", cli.Options{BackupDir: "/tmp/bak", BackupSuffix: ".orig"}, "/tmp/bak/a.go.orig"},
+		{"dir without suffix", cli.Options{BackupDir: "/tmp/bak"}, "/tmp/bak/a.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BackupPath("/repo/a.go", tt.opts); got != filepath.FromSlash(tt.want) {
+				t.Fatalf("BackupPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(path, []byte("after\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := cli.Options{BackupSuffix: ".orig"}
+	if err := RestoreBackup(path, opts); err == nil {
+		t.Fatalf("RestoreBackup without a backup error = nil, want error")
+	}
+	if err := os.WriteFile(path+".orig", []byte("before\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreBackup(path, opts); err != nil {
+		t.Fatalf("RestoreBackup error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "before\n" {
+		t.Fatalf("restored content = %q, want backup", data)
+	}
+}
+
+func TestWriteBackupCreatesDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups", "nested")
+	opts := cli.Options{Backup: true, BackupDir: dir, BackupSuffix: ".orig"}
+	if err := WriteBackup("/repo/a.go", []byte("before\n"), opts); err != nil {
+		t.Fatalf("WriteBackup error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.go.orig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "before\n" {
+		t.Fatalf("backup = %q", data)
+	}
+
+	opts.Backup = false
+	opts.BackupDir = filepath.Join(t.TempDir(), "unused")
+	if err := WriteBackup("/repo/a.go", []byte("before\n"), opts); err != nil {
+		t.Fatalf("WriteBackup error = %v", err)
+	}
+	if _, err := os.Stat(opts.BackupDir); !os.IsNotExist(err) {
+		t.Fatalf("backup dir created without --backup: %v", err)
+	}
+}
@@ -1,21 +1,47 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/chojs23/ec/internal/markers"
 )
 
+// OpenBaseFile returns a command that shows the BASE file in the user's
+// viewer: $PAGER if set, else $EDITOR, else less. The caller decides how to
+// run it so a TUI can hand over the terminal first.
+func OpenBaseFile(basePath string) (*exec.Cmd, error) {
+	if basePath == "" {
+		return nil, errors.New("no base file")
+	}
+	if _, err := os.Stat(basePath); err != nil {
+		return nil, fmt.Errorf("stat base: %w", err)
+	}
+
+	viewer := strings.Fields(os.Getenv("PAGER"))
+	if len(viewer) == 0 {
+		viewer = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(viewer) == 0 {
+		viewer = []string{"less"}
+	}
+
+	cmd := exec.Command(viewer[0], append(viewer[1:], basePath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
 // ValidateBaseCompleteness checks that every conflict in the document has a base chunk.
 // Returns error if any conflict is missing its base section.
 func ValidateBaseCompleteness(doc markers.Document) error {
-	for i, ref := range doc.Conflicts {
-		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
-		if !ok {
-			return fmt.Errorf("internal: conflict %d is not a ConflictSegment", i)
-		}
-		if len(seg.Base) == 0 && seg.BaseLabel == "" {
-			return fmt.Errorf("conflict %d is missing base chunk (base completeness requires exact base for all conflicts)", i)
+	for _, issue := range markers.Validate(doc) {
+		if issue.Kind == markers.IssueNotConflict || issue.Kind == markers.IssueMissingBase {
+			return issue
 		}
 	}
 	return nil
@@ -5,6 +5,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/chojs23/ec/internal/gitmerge"
@@ -255,3 +256,38 @@ func TestBaseDisplayIntegration_MultipleConflicts(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenBaseFilePrefersPagerOverEditor(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "base.txt")
+	if err := os.WriteFile(basePath, []byte("base\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PAGER", "less -R")
+	t.Setenv("EDITOR", "vim")
+	cmd, err := OpenBaseFile(basePath)
+	if err != nil {
+		t.Fatalf("OpenBaseFile failed: %v", err)
+	}
+	if got, want := cmd.Args, []string{"less", "-R", basePath}; !slices.Equal(got, want) {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+
+	t.Setenv("PAGER", "")
+	cmd, err = OpenBaseFile(basePath)
+	if err != nil {
+		t.Fatalf("OpenBaseFile failed: %v", err)
+	}
+	if got, want := cmd.Args, []string{"vim", basePath}; !slices.Equal(got, want) {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+}
+
+func TestOpenBaseFileMissingBase(t *testing.T) {
+	if _, err := OpenBaseFile(""); err == nil {
+		t.Fatalf("expected error for empty base path")
+	}
+	if _, err := OpenBaseFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected error for missing base file")
+	}
+}
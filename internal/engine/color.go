@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/chojs23/ec/internal/cli"
+)
+
+const (
+	ansiReset  = "\x1b[m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// ColorEnabled reports whether output written to f may be colored: f is a
+// terminal whose TERM is not dumb, and neither --no-color nor a non-empty
+// NO_COLOR (https://no-color.org) asks for plain text.
+func ColorEnabled(f *os.File, opts cli.Options) bool {
+	if opts.NoColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorizePatch colors a unified diff the way git diff does: file headers
+// bold, hunk headers cyan, removed lines red and added lines green.
+func ColorizePatch(patch []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(patch, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		body := bytes.TrimSuffix(line, []byte("\n"))
+		color := ""
+		switch {
+		case bytes.HasPrefix(body, []byte("--- ")), bytes.HasPrefix(body, []byte("+++ ")):
+			color = ansiBold
+		case bytes.HasPrefix(body, []byte("@@")):
+			color = ansiCyan
+		case bytes.HasPrefix(body, []byte("-")):
+			color = ansiRed
+		case bytes.HasPrefix(body, []byte("+")):
+			color = ansiGreen
+		}
+		if color == "" {
+			out.Write(line)
+			continue
+		}
+		out.WriteString(color)
+		out.Write(body)
+		out.WriteString(ansiReset)
+		out.Write(line[len(body):])
+	}
+	return out.Bytes()
+}
+
+// WarningPrefix returns the "warning: " that starts a warning written to f,
+// in yellow when ColorEnabled.
+func WarningPrefix(f *os.File, opts cli.Options) string {
+	if !ColorEnabled(f, opts) {
+		return "warning: "
+	}
+	return ansiYellow + "warning:" + ansiReset + " "
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chojs23/ec/internal/cli"
+)
+
+func TestColorizePatch(t *testing.T) {
+	patch := "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-old\n+new\n ctx\n"
+	want := "\x1b[1m--- a/f\x1b[m\n\x1b[1m+++ b/f\x1b[m\n\x1b[36m@@ -1 +1 @@\x1b[m\n\x1b[31m-old\x1b[m\n\x1b[32m+new\x1b[m\n ctx\n"
+	if got := string(ColorizePatch([]byte(patch))); got != want {
+		t.Fatalf("ColorizePatch = %q, want %q", got, want)
+	}
+}
+
+func TestColorEnabledNeedsTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	t.Setenv("NO_COLOR", "")
+	if ColorEnabled(f, cli.Options{}) {
+		t.Fatalf("ColorEnabled = true for a regular file")
+	}
+	if got := WarningPrefix(f, cli.Options{}); got != "warning: " {
+		t.Fatalf("WarningPrefix = %q, want plain", got)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("no terminal available")
+	}
+	defer tty.Close()
+	t.Setenv("TERM", "xterm")
+	if !ColorEnabled(tty, cli.Options{}) {
+		t.Fatalf("ColorEnabled = false for a terminal")
+	}
+	if ColorEnabled(tty, cli.Options{NoColor: true}) {
+		t.Fatalf("ColorEnabled = true with --no-color")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(tty, cli.Options{}) {
+		t.Fatalf("ColorEnabled = true with NO_COLOR set")
+	}
+}
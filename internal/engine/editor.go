@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+)
+
+// editorWaitFlags maps GUI editors that return as soon as the window opens
+// to the flag that makes them block until the file is closed.
+var editorWaitFlags = map[string]string{
+	"atom":          "--wait",
+	"bbedit":        "--wait",
+	"code":          "--wait",
+	"code-insiders": "--wait",
+	"codium":        "--wait",
+	"cursor":        "--wait",
+	"gvim":          "-f",
+	"mate":          "-w",
+	"mvim":          "-f",
+	"subl":          "--wait",
+	"zed":           "--wait",
+}
+
+// EditorArgs returns the command line that edits path with editor, a
+// $EDITOR-style command that may carry arguments; empty means vi. Known GUI
+// editors get their wait flag unless editor already passes it, so ec only
+// reloads the file once it is closed. Unknown commands run as given.
+func EditorArgs(editor string, path string) []string {
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	// Split on both separators so Windows paths match on any platform.
+	name := strings.ToLower(args[0][strings.LastIndexAny(args[0], `/\`)+1:])
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".exe"), ".cmd")
+	if flag, ok := editorWaitFlags[name]; ok && !slices.Contains(args[1:], flag) && !slices.Contains(args[1:], "-w") {
+		args = append(args, flag)
+	}
+	return append(args, path)
+}
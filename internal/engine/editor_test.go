@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditorArgs(t *testing.T) {
+	tests := []struct {
+		editor string
+		want   []string
+	}{
+		{editor: "", want: []string{"vi", "f.txt"}},
+		{editor: "nvim", want: []string{"nvim", "f.txt"}},
+		{editor: "emacs -nw", want: []string{"emacs", "-nw", "f.txt"}},
+		{editor: "code", want: []string{"code", "--wait", "f.txt"}},
+		{editor: "code --wait", want: []string{"code", "--wait", "f.txt"}},
+		{editor: "subl -w", want: []string{"subl", "-w", "f.txt"}},
+		{editor: "/usr/local/bin/subl", want: []string{"/usr/local/bin/subl", "--wait", "f.txt"}},
+		{editor: "mate", want: []string{"mate", "-w", "f.txt"}},
+		{editor: "gvim", want: []string{"gvim", "-f", "f.txt"}},
+		{editor: `C:\Tools\Code.cmd`, want: []string{`C:\Tools\Code.cmd`, "--wait", "f.txt"}},
+	}
+	for _, tt := range tests {
+		if got := EditorArgs(tt.editor, "f.txt"); !slices.Equal(got, tt.want) {
+			t.Errorf("EditorArgs(%q) = %q, want %q", tt.editor, got, tt.want)
+		}
+	}
+}
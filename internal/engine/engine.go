@@ -5,31 +5,87 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/chojs23/ec/internal/charset"
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/markers"
 	"github.com/chojs23/ec/internal/mergeview"
 )
 
 func CheckResolvedFile(mergedPath string) (bool, error) {
+	resolved, _, err := CheckResolvedFileDocument(mergedPath)
+	return resolved, err
+}
+
+// CheckResolvedFileDocument is CheckResolvedFile that also returns the parsed
+// merged document so callers can report the remaining conflicts.
+func CheckResolvedFileDocument(mergedPath string) (bool, markers.Document, error) {
 	data, err := os.ReadFile(mergedPath)
 	if err != nil {
-		return false, fmt.Errorf("read merged: %w", err)
+		return false, markers.Document{}, fmt.Errorf("read merged: %w", err)
 	}
 
 	doc, err := markers.Parse(data)
 	if err != nil {
 		// Treat malformed markers as an error to avoid false success.
-		return false, err
+		return false, markers.Document{}, err
+	}
+
+	return len(doc.Conflicts) == 0, doc, nil
+}
+
+// resolveAll sets the resolution of every conflict in doc.
+func resolveAll(doc markers.Document, resolution markers.Resolution) error {
+	for _, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			return fmt.Errorf("internal: conflict index %d is not a ConflictSegment", ref.SegmentIndex)
+		}
+		seg.Resolution = resolution
+		doc.Segments[ref.SegmentIndex] = seg
 	}
+	return nil
+}
 
-	return len(doc.Conflicts) == 0, nil
+// PrintResolved merges opts' BASE, LOCAL and REMOTE files, resolves every
+// conflict to opts.PrintResolved and writes the result to w. Nothing is
+// read from or written to $MERGED.
+func PrintResolved(ctx context.Context, opts cli.Options, w io.Writer) error {
+	doc, err := mergeview.LoadCanonicalDocument(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := resolveAll(doc, markers.Resolution(opts.PrintResolved)); err != nil {
+		return err
+	}
+	if opts.NormalizeEOL != "" {
+		doc = markers.NormalizeDocumentEOL(doc, markers.LineEndingFor(opts.NormalizeEOL))
+	}
+	resolved, err := markers.RenderResolved(doc)
+	if err != nil {
+		return err
+	}
+	if opts.NormalizeEOF {
+		resolved, err = NormalizeFinalNewlineFromFiles(resolved, opts.LocalPath, opts.RemotePath)
+		if err != nil {
+			return err
+		}
+	}
+	resolved, err = charset.Encode(opts.Encoding, resolved)
+	if err != nil {
+		return fmt.Errorf("encode result: %w", err)
+	}
+	if _, err := w.Write(resolved); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	return nil
 }
 
 func ApplyAllAndWrite(ctx context.Context, opts cli.Options) error {
-	if opts.ApplyAll == "" {
+	if opts.ApplyAll == "" && opts.Annotate == "" && opts.Plan == "" && opts.PreferBranch == "" {
 		return errors.New("internal: ApplyAllAndWrite called without apply mode")
 	}
 
@@ -43,6 +99,11 @@ func ApplyAllAndWrite(ctx context.Context, opts cli.Options) error {
 	}
 	if len(mergedDoc.Conflicts) == 0 {
 		// Per plan: no conflicts detected → exit 0 without writing.
+		if opts.Stdout {
+			if _, err := os.Stdout.Write(mergedBytes); err != nil {
+				return fmt.Errorf("write result: %w", err)
+			}
+		}
 		return nil
 	}
 
@@ -58,44 +119,241 @@ func ApplyAllAndWrite(ctx context.Context, opts cli.Options) error {
 		return fmt.Errorf("base display validation failed: %w", err)
 	}
 
-	for _, ref := range viewDoc.Conflicts {
-		seg, ok := viewDoc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
-		if !ok {
-			return fmt.Errorf("internal: conflict index %d is not a ConflictSegment", ref.SegmentIndex)
+	// unmatched reports the conflicts --prefer-branch could not resolve once
+	// the rest are written.
+	var unmatched error
+
+	if opts.Plan != "" {
+		entries, err := ReadPlan(opts.Plan)
+		if err != nil {
+			return err
 		}
-		seg.Resolution = markers.Resolution(opts.ApplyAll)
-		viewDoc.Segments[ref.SegmentIndex] = seg
+		state, err := NewState(viewDoc)
+		if err != nil {
+			return err
+		}
+		if err := ApplyPlan(state, entries, opts.Strict); err != nil {
+			return err
+		}
+		viewDoc = withMergedLabels(state.Document(), mergedDoc)
+	} else if opts.PreferBranch != "" {
+		// The stage files carry temporary names; match against the labels
+		// git wrote into the merged file.
+		var indices []int
+		viewDoc, indices = ApplyPreferBranch(withMergedLabels(viewDoc, mergedDoc), opts.PreferBranch)
+		if len(indices) > 0 {
+			err := &UnmatchedBranchError{Branch: opts.PreferBranch}
+			for _, index := range indices {
+				err.Conflicts = append(err.Conflicts, index+1)
+			}
+			unmatched = err
+		}
+	} else if err := resolveAll(viewDoc, markers.Resolution(opts.ApplyAll)); err != nil {
+		// With --annotate the conflicts stay unresolved and are rendered with
+		// both sides under comment lines.
+		return err
+	}
+	if opts.NormalizeEOL != "" {
+		viewDoc = markers.NormalizeDocumentEOL(viewDoc, markers.LineEndingFor(opts.NormalizeEOL))
 	}
 
-	resolved, err := markers.RenderResolved(viewDoc)
+	var resolved []byte
+	if opts.Annotate != "" {
+		resolved, err = markers.RenderAnnotated(viewDoc, opts.Annotate)
+	} else if opts.PreferBranch != "" || opts.Plan != "" {
+		// Conflicts the plan leaves out, or that name the branch on neither
+		// side, keep their markers.
+		resolved, err = markers.RenderWithLabels(viewDoc, markers.Labels{Ours: opts.OursLabel, Base: opts.BaseLabel, Theirs: opts.TheirsLabel})
+	} else {
+		resolved, err = markers.RenderResolved(viewDoc)
+	}
 	if err != nil {
 		return err
 	}
+	if opts.NormalizeEOF {
+		resolved, err = NormalizeFinalNewlineFromFiles(resolved, opts.LocalPath, opts.RemotePath)
+		if err != nil {
+			return err
+		}
+	}
+	resolved, err = charset.Encode(opts.Encoding, resolved)
+	if err != nil {
+		return fmt.Errorf("encode merged: %w", err)
+	}
 
-	if bytes.Equal(resolved, mergedBytes) {
-		// Already matches (unlikely), but keep it safe: don't write.
+	if opts.Patch {
+		patch := UnifiedPatch(opts.MergedPath, mergedBytes, resolved)
+		if ColorEnabled(os.Stdout, opts) {
+			patch = ColorizePatch(patch)
+		}
+		if _, err := os.Stdout.Write(patch); err != nil {
+			return fmt.Errorf("write patch: %w", err)
+		}
 		return nil
 	}
 
-	if opts.Backup {
-		bak := opts.MergedPath + ".ec.bak"
-		if err := os.WriteFile(bak, mergedBytes, 0o644); err != nil {
-			return fmt.Errorf("write backup %s: %w", filepath.Base(bak), err)
+	if opts.ExportWordDiff {
+		baseBytes, err := os.ReadFile(opts.BasePath)
+		if err != nil {
+			return fmt.Errorf("read base: %w", err)
+		}
+		if _, err := os.Stdout.Write(WordDiffPatch(opts.MergedPath, baseBytes, resolved)); err != nil {
+			return fmt.Errorf("write word diff: %w", err)
 		}
+		return nil
+	}
+
+	if opts.DryRun {
+		if _, err := os.Stdout.Write(DryRunSummary(opts.MergedPath, viewDoc)); err != nil {
+			return fmt.Errorf("write dry-run summary: %w", err)
+		}
+		return nil
+	}
+
+	if opts.Stdout {
+		if err := checkNoMarkers(resolved, opts); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(resolved); err != nil {
+			return fmt.Errorf("write result: %w", err)
+		}
+		return unmatched
+	}
+
+	if bytes.Equal(resolved, mergedBytes) {
+		// Already matches (unlikely, or --prefer-branch matched nothing),
+		// but keep it safe: don't write.
+		return unmatched
+	}
+
+	if err := WriteBackup(opts.MergedPath, mergedBytes, opts); err != nil {
+		return err
 	}
 
 	if err := os.WriteFile(opts.MergedPath, resolved, 0o644); err != nil {
 		return fmt.Errorf("write merged: %w", err)
 	}
 
-	// Verify no conflict markers remain.
+	if err := checkNoMarkers(resolved, opts); err != nil {
+		return err
+	}
+
+	return unmatched
+}
+
+// checkNoMarkers verifies no conflict markers remain in resolved, except
+// where --plan or --prefer-branch leave conflicts unresolved on purpose.
+func checkNoMarkers(resolved []byte, opts cli.Options) error {
 	postDoc, err := markers.Parse(resolved)
 	if err != nil {
 		return fmt.Errorf("post-parse merged: %w", err)
 	}
-	if len(postDoc.Conflicts) != 0 {
+	if len(postDoc.Conflicts) != 0 && opts.Plan == "" && opts.PreferBranch == "" {
 		return errors.New("resolution output still contains conflict markers")
 	}
-
 	return nil
 }
+
+// withMergedLabels gives the conflicts of doc the marker labels and marker
+// lines of the matching conflicts in merged, so conflicts written back
+// unresolved read like the ones git wrote rather than naming temporary stage
+// files, text after ======= included. The labels are kept when the two
+// documents disagree on the conflict count.
+func withMergedLabels(doc markers.Document, merged markers.Document) markers.Document {
+	if len(doc.Conflicts) != len(merged.Conflicts) {
+		return doc
+	}
+	for i, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		labels, ok := merged.Segments[merged.Conflicts[i].SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		seg.OursLabel, seg.BaseLabel, seg.TheirsLabel = labels.OursLabel, labels.BaseLabel, labels.TheirsLabel
+		seg.Markers = labels.Markers
+		doc.Segments[ref.SegmentIndex] = seg
+	}
+	return doc
+}
+
+// DryRunSummary describes, per conflict of a resolved document, which side
+// would be taken and how many lines it contributes to the result.
+func DryRunSummary(path string, doc markers.Document) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s: %d conflict(s), dry run (nothing written)\n", path, len(doc.Conflicts))
+	for i, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		var rendered bytes.Buffer
+		markers.AppendConflictSegment(&rendered, seg, "", "", "")
+		lines := len(markers.SplitLinesKeepEOL(rendered.Bytes()))
+		fmt.Fprintf(&out, "  conflict %d: %s, %d line(s)\n", i+1, seg.Resolution, lines)
+	}
+	return out.Bytes()
+}
+
+// NormalizeFinalNewlineFromFiles applies NormalizeFinalNewline using the
+// contents of the given side files as the reference.
+func NormalizeFinalNewlineFromFiles(output []byte, paths ...string) ([]byte, error) {
+	sides := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+		}
+		sides = append(sides, data)
+	}
+	return NormalizeFinalNewline(output, sides...), nil
+}
+
+// NormalizeFinalNewline makes output end the way every side ends when they
+// all agree and output differs only by its final line ending. A missing
+// newline is added using the line ending output already uses (falling back to
+// the sides'), and a single extra one is dropped. Any other output, including
+// trailing blank lines, is returned unchanged.
+func NormalizeFinalNewline(output []byte, sides ...[]byte) []byte {
+	if len(output) == 0 || len(sides) == 0 {
+		return output
+	}
+	want := bytes.HasSuffix(sides[0], []byte("\n"))
+	for _, side := range sides[1:] {
+		if bytes.HasSuffix(side, []byte("\n")) != want {
+			return output
+		}
+	}
+
+	has := bytes.HasSuffix(output, []byte("\n"))
+	switch {
+	case want && !has:
+		eol := lastLineEnding(output)
+		if eol == "" {
+			eol = lastLineEnding(sides[0])
+		}
+		return append(append([]byte(nil), output...), eol...)
+	case !want && has:
+		trimmed := bytes.TrimSuffix(bytes.TrimSuffix(output, []byte("\n")), []byte("\r"))
+		if len(trimmed) == 0 || bytes.HasSuffix(trimmed, []byte("\n")) {
+			return output
+		}
+		return trimmed
+	}
+	return output
+}
+
+// lastLineEnding reports the line ending of the last terminated line in data,
+// or "" when data has none.
+func lastLineEnding(data []byte) string {
+	idx := bytes.LastIndexByte(data, '\n')
+	if idx == -1 {
+		return ""
+	}
+	if idx > 0 && data[idx-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
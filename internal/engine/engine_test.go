@@ -6,10 +6,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/gitmerge"
+	"github.com/chojs23/ec/internal/markers"
 )
 
 func TestApplyAllAndWrite_WritesResolvedAndBackup(t *testing.T) {
@@ -115,6 +117,169 @@ func TestApplyAllAndWrite_NoConflictsNoWrite(t *testing.T) {
 	}
 }
 
+func TestApplyAllAndWriteWithoutGit(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase\nline3\n",
+		localPath:  "line1\nlocal\nline3\n",
+		remotePath: "line1\nremote\nline3\n",
+		mergedPath: "line1\n<<<<<<< ours\nlocal\n=======\nremote\n>>>>>>> theirs\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "theirs",
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite without git failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line1\nremote\nline3\n" {
+		t.Fatalf("merged content = %q", string(data))
+	}
+}
+
+func TestApplyAllAndWriteNoneDropsConflicts(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "head\nbase1\nmiddle\nbase2\ntail\n",
+		localPath:  "head\nlocal1\nmiddle\nlocal2\ntail\n",
+		remotePath: "head\nremote1\nmiddle\nremote2\ntail\n",
+		mergedPath: "head\n<<<<<<< ours\nlocal1\n=======\nremote1\n>>>>>>> theirs\nmiddle\n<<<<<<< ours\nlocal2\n=======\nremote2\n>>>>>>> theirs\ntail\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "none",
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "head\nmiddle\ntail\n" {
+		t.Fatalf("merged content = %q, want both conflicting regions removed", string(data))
+	}
+}
+
+func TestApplyAllAndWriteAnnotate(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase\nline3\n",
+		localPath:  "line1\nlocal\nline3\n",
+		remotePath: "line1\nremote\nline3\n",
+		mergedPath: "line1\n<<<<<<< ours\nlocal\n=======\nremote\n>>>>>>> theirs\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		Annotate:   "#",
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite with annotate failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line1\n# OURS\nlocal\n# THEIRS\nremote\nline3\n" {
+		t.Fatalf("merged content = %q", string(data))
+	}
+}
+
+func TestApplyAllAndWriteKeepsEncoding(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	// "caf\xe9" is "café" in Latin-1.
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase\nline3\n",
+		localPath:  "line1\nlocal\nline3\n",
+		remotePath: "line1\ncaf\xe9\nline3\n",
+		mergedPath: "line1\n<<<<<<< ours\nlocal\n=======\ncaf\xe9\n>>>>>>> theirs\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "theirs",
+		Encoding:   "latin1",
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite with encoding failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line1\ncaf\xe9\nline3\n" {
+		t.Fatalf("merged content = %q, want Latin-1 bytes kept", string(data))
+	}
+}
+
 func TestApplyAllAndWriteUsesCanonicalThreeWayInputsOverMergedMarkers(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration-style test in short mode")
@@ -208,3 +373,337 @@ func TestCheckResolvedFile(t *testing.T) {
 		t.Fatalf("expected error for malformed markers")
 	}
 }
+
+func TestApplyAllAndWritePatchPrintsDiffWithoutWriting(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration-style test in short mode")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase content\nline3\n",
+		localPath:  "line1\nlocal change\nline3\n",
+		remotePath: "line1\nremote change\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mergeView, err := gitmerge.MergeFileDiff3(ctx, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 failed: %v", err)
+	}
+	if err := os.WriteFile(mergedPath, mergeView, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := os.CreateTemp(tmpDir, "stdout-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = oldStdout
+		stdout.Close()
+	}()
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "theirs",
+		Patch:      true,
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite failed: %v", err)
+	}
+
+	merged, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(merged, mergeView) {
+		t.Fatalf("merged file was modified in patch mode")
+	}
+
+	patch, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(patch, []byte("\n+++ b/"+strings.TrimPrefix(filepath.ToSlash(mergedPath), "/")+"\n")) {
+		t.Fatalf("patch missing b/ header: %q", patch)
+	}
+	if !bytes.Contains(patch, []byte("\n remote change\n")) || !bytes.Contains(patch, []byte("\n-<<<<<<< ")) {
+		t.Fatalf("patch missing expected hunk lines: %q", patch)
+	}
+}
+
+func TestApplyAllAndWriteStdout(t *testing.T) {
+	opts := writePlanFixture(t, "[]")
+	opts.Plan = ""
+	opts.ApplyAll = "theirs"
+	opts.Stdout = true
+	opts.Backup = true
+	before, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = oldStdout
+		stdout.Close()
+	}()
+
+	if err := ApplyAllAndWrite(context.Background(), opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite failed: %v", err)
+	}
+
+	printed, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(printed) != "a\nremote1\nb\nremote2\nc\n" {
+		t.Fatalf("stdout = %q, want the resolved file", printed)
+	}
+	merged, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(merged, before) {
+		t.Fatalf("merged file was modified with --stdout")
+	}
+	if _, err := os.Stat(BackupPath(opts.MergedPath, opts)); !os.IsNotExist(err) {
+		t.Fatalf("backup written with --stdout: %v", err)
+	}
+}
+
+func TestPrintResolved(t *testing.T) {
+	opts := writePlanFixture(t, "[]")
+	opts.Plan = ""
+	opts.MergedPath = ""
+	opts.PrintResolved = "theirs"
+
+	var out bytes.Buffer
+	if err := PrintResolved(context.Background(), opts, &out); err != nil {
+		t.Fatalf("PrintResolved failed: %v", err)
+	}
+	if out.String() != "a\nremote1\nb\nremote2\nc\n" {
+		t.Fatalf("PrintResolved = %q, want every conflict resolved to theirs", out.String())
+	}
+
+	out.Reset()
+	opts.PrintResolved = "both"
+	if err := PrintResolved(context.Background(), opts, &out); err != nil {
+		t.Fatalf("PrintResolved failed: %v", err)
+	}
+	if out.String() != "a\nlocal1\nremote1\nb\nlocal2\nremote2\nc\n" {
+		t.Fatalf("PrintResolved = %q, want both sides of every conflict", out.String())
+	}
+}
+
+func TestDryRunSummary(t *testing.T) {
+	doc := markers.Document{
+		Segments: []markers.Segment{
+			markers.TextSegment{Bytes: []byte("a\n")},
+			markers.ConflictSegment{Ours: []byte("o1\no2\n"), Theirs: []byte("t1\n"), Resolution: markers.ResolutionOurs},
+			markers.TextSegment{Bytes: []byte("b\n")},
+			markers.ConflictSegment{Ours: []byte("o\n"), Theirs: []byte("t1\nt2\n"), Resolution: markers.ResolutionBoth},
+			markers.ConflictSegment{Ours: []byte("o\n"), Theirs: []byte("t\n"), Resolution: markers.ResolutionNone},
+		},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 1}, {SegmentIndex: 3}, {SegmentIndex: 4}},
+	}
+
+	got := string(DryRunSummary("file.txt", doc))
+	want := "file.txt: 3 conflict(s), dry run (nothing written)\n" +
+		"  conflict 1: ours, 2 line(s)\n" +
+		"  conflict 2: both, 3 line(s)\n" +
+		"  conflict 3: none, 0 line(s)\n"
+	if got != want {
+		t.Fatalf("DryRunSummary() = %q, want %q", got, want)
+	}
+}
+
+func TestApplyAllAndWriteDryRunDoesNotWrite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration-style test in short mode")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase content\nline3\n",
+		localPath:  "line1\nlocal change\nline3\n",
+		remotePath: "line1\nremote change\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mergeView, err := gitmerge.MergeFileDiff3(ctx, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 failed: %v", err)
+	}
+	if err := os.WriteFile(mergedPath, mergeView, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := os.CreateTemp(tmpDir, "stdout-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() {
+		os.Stdout = oldStdout
+		stdout.Close()
+	}()
+
+	opts := cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "ours",
+		DryRun:     true,
+		Backup:     true,
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite failed: %v", err)
+	}
+
+	merged, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(merged, mergeView) {
+		t.Fatalf("merged file was modified in dry-run mode")
+	}
+	if _, err := os.Stat(mergedPath + ".ec.bak"); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup in dry-run mode, stat err = %v", err)
+	}
+
+	summary, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(summary, []byte("  conflict 1: ours, 1 line(s)\n")) {
+		t.Fatalf("summary = %q, want conflict 1 taking ours", summary)
+	}
+}
+
+func TestNormalizeFinalNewline(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		sides  []string
+		want   string
+	}{
+		{name: "adds missing newline", output: "a\nb", sides: []string{"x\n", "y\n"}, want: "a\nb\n"},
+		{name: "adds crlf from output", output: "a\r\nb", sides: []string{"x\n", "y\n"}, want: "a\r\nb\r\n"},
+		{name: "adds crlf from side", output: "a", sides: []string{"x\r\n", "y\r\n"}, want: "a\r\n"},
+		{name: "drops extra newline", output: "a\nb\n", sides: []string{"x", "y"}, want: "a\nb"},
+		{name: "drops extra crlf", output: "a\r\nb\r\n", sides: []string{"x", "y"}, want: "a\r\nb"},
+		{name: "keeps trailing blank line", output: "a\n\n", sides: []string{"x", "y"}, want: "a\n\n"},
+		{name: "sides disagree", output: "a", sides: []string{"x\n", "y"}, want: "a"},
+		{name: "already matches", output: "a\n", sides: []string{"x\n", "y\n"}, want: "a\n"},
+		{name: "empty output", output: "", sides: []string{"x\n", "y\n"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sides := make([][]byte, len(tt.sides))
+			for i, side := range tt.sides {
+				sides[i] = []byte(side)
+			}
+			if got := string(NormalizeFinalNewline([]byte(tt.output), sides...)); got != tt.want {
+				t.Fatalf("NormalizeFinalNewline = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAllAndWriteNormalizeEOF(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration-style test in short mode")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase",
+		localPath:  "line1\nlocal",
+		remotePath: "line1\nremote",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// git merge-file ends the conflict block with a newline even though
+	// neither side has one, so resolving to theirs gains a final newline.
+	mergeView, err := gitmerge.MergeFileDiff3(ctx, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 failed: %v", err)
+	}
+	if err := os.WriteFile(mergedPath, mergeView, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := cli.Options{
+		BasePath:     basePath,
+		LocalPath:    localPath,
+		RemotePath:   remotePath,
+		MergedPath:   mergedPath,
+		ApplyAll:     "theirs",
+		NormalizeEOF: true,
+	}
+	if err := ApplyAllAndWrite(ctx, opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite failed: %v", err)
+	}
+
+	got, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "line1\nremote" {
+		t.Fatalf("merged = %q, want %q", got, "line1\nremote")
+	}
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// maxUndoSteps bounds the undo history; the oldest step is dropped first.
+const maxUndoSteps = 100
+
+// historyStep is one undoable step: the contents of the state on the other
+// side of it, and the label the resolver shows for it.
+type historyStep struct {
+	contents *State
+	label    string
+}
+
+// Do runs mutate as one undoable step described by label. The step is only
+// recorded when mutate succeeds and changed the state; recording it clears
+// the redo history. OnChange fires once for the whole step.
+func (s *State) Do(label string, mutate func() error) error {
+	before := s.Clone()
+	s.batching++
+	err := mutate()
+	s.batching--
+	if s.Equal(before) {
+		return err
+	}
+	if err == nil {
+		s.undo = append(s.undo, historyStep{contents: before, label: label})
+		if len(s.undo) > maxUndoSteps {
+			s.undo = s.undo[1:]
+		}
+		s.redo = nil
+	}
+	s.changed()
+	return err
+}
+
+// Undo reverts the last step recorded by Do and reports whether there was
+// one.
+func (s *State) Undo() bool {
+	if !s.CanUndo() {
+		return false
+	}
+	step := s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+	s.redo = append(s.redo, historyStep{contents: s.Clone(), label: step.label})
+	s.setContents(step.contents)
+	s.changed()
+	return true
+}
+
+// Redo applies the last step Undo reverted again and reports whether there
+// was one.
+func (s *State) Redo() bool {
+	if !s.CanRedo() {
+		return false
+	}
+	step := s.redo[len(s.redo)-1]
+	s.redo = s.redo[:len(s.redo)-1]
+	s.undo = append(s.undo, historyStep{contents: s.Clone(), label: step.label})
+	s.setContents(step.contents)
+	s.changed()
+	return true
+}
+
+func (s *State) CanUndo() bool {
+	return len(s.undo) > 0
+}
+
+func (s *State) CanRedo() bool {
+	return len(s.redo) > 0
+}
+
+func (s *State) UndoDepth() int {
+	return len(s.undo)
+}
+
+func (s *State) RedoDepth() int {
+	return len(s.redo)
+}
+
+// History lists the labels of the undoable steps oldest first followed by
+// the redoable ones, and returns how many of them are applied: entries
+// before current are in effect, entries from current on were undone.
+func (s *State) History() (entries []string, current int) {
+	entries = make([]string, 0, len(s.undo)+len(s.redo))
+	for _, step := range s.undo {
+		entries = append(entries, step.label)
+	}
+	for i := len(s.redo) - 1; i >= 0; i-- {
+		entries = append(entries, s.redo[i].label)
+	}
+	return entries, len(s.undo)
+}
+
+// OnChange registers fn to run after every change to the state, including
+// undo and redo; nil removes it. Clones start without it.
+func (s *State) OnChange(fn func()) {
+	s.onChange = fn
+}
+
+func (s *State) changed() {
+	if s.onChange != nil && s.batching == 0 {
+		s.onChange()
+	}
+}
+
+// Restore replaces the contents of s with those of other, keeping the
+// history and OnChange callback of s. Run it inside Do to make it undoable.
+func (s *State) Restore(other *State) {
+	s.setContents(other)
+	s.changed()
+}
+
+func (s *State) setContents(other *State) {
+	contents := other.Clone()
+	s.canonical = contents.canonical
+	s.segments = contents.segments
+	s.boundaries = contents.boundaries
+	s.doc = contents.doc
+}
+
+// Equal reports whether s and other hold the same document, output and
+// merged-file labels; their histories are not compared.
+func (s *State) Equal(other *State) bool {
+	leftLabels, leftKnown := s.MergedLabels()
+	rightLabels, rightKnown := other.MergedLabels()
+	if len(leftLabels) != len(rightLabels) || len(leftKnown) != len(rightKnown) {
+		return false
+	}
+	for i := range leftLabels {
+		if leftLabels[i] != rightLabels[i] || leftKnown[i] != rightKnown[i] {
+			return false
+		}
+	}
+	return markers.DocumentsEqual(s.Document(), other.Document()) && bytes.Equal(s.RenderMerged(), other.RenderMerged())
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+func newHistoryTestState(t *testing.T) *State {
+	t.Helper()
+	doc, err := markers.Parse([]byte("a\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> branch\nb\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nc\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	return state
+}
+
+func TestStateUndoRedo(t *testing.T) {
+	state := newHistoryTestState(t)
+	notified := 0
+	state.OnChange(func() { notified++ })
+
+	if state.CanUndo() || state.CanRedo() {
+		t.Fatalf("CanUndo = %v, CanRedo = %v on a new state, want false, false", state.CanUndo(), state.CanRedo())
+	}
+
+	if err := state.Do("conflict 1: ours", func() error {
+		return state.ApplyResolution(0, markers.ResolutionOurs)
+	}); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if err := state.Do("apply-all: theirs", func() error {
+		return state.ApplyAll(markers.ResolutionTheirs)
+	}); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if notified != 2 {
+		t.Fatalf("OnChange ran %d times after two steps, want once per step", notified)
+	}
+	if !state.CanUndo() || state.CanRedo() || state.UndoDepth() != 2 {
+		t.Fatalf("after two steps: CanUndo = %v, CanRedo = %v, UndoDepth = %d", state.CanUndo(), state.CanRedo(), state.UndoDepth())
+	}
+	if got := string(state.RenderMerged()); got != "a\ntheirs1\nb\ntheirs2\nc\n" {
+		t.Fatalf("merged = %q", got)
+	}
+
+	if !state.Undo() {
+		t.Fatalf("Undo = false, want true")
+	}
+	if got := string(state.RenderMerged()); got != "a\nours1\nb\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nc\n" {
+		t.Fatalf("merged after undo = %q", got)
+	}
+	if !state.CanUndo() || !state.CanRedo() || notified != 3 {
+		t.Fatalf("after undo: CanUndo = %v, CanRedo = %v, notified = %d", state.CanUndo(), state.CanRedo(), notified)
+	}
+	entries, current := state.History()
+	if !slices.Equal(entries, []string{"conflict 1: ours", "apply-all: theirs"}) || current != 1 {
+		t.Fatalf("History = %q, %d", entries, current)
+	}
+
+	if !state.Redo() {
+		t.Fatalf("Redo = false, want true")
+	}
+	if got := string(state.RenderMerged()); got != "a\ntheirs1\nb\ntheirs2\nc\n" {
+		t.Fatalf("merged after redo = %q", got)
+	}
+	if state.CanRedo() || notified != 4 {
+		t.Fatalf("after redo: CanRedo = %v, notified = %d", state.CanRedo(), notified)
+	}
+
+	state.Undo()
+	state.Undo()
+	if state.Undo() {
+		t.Fatalf("Undo past the first step = true, want false")
+	}
+	if err := state.Do("conflict 2: none", func() error {
+		return state.ApplyResolution(1, markers.ResolutionNone)
+	}); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if state.CanRedo() {
+		t.Fatalf("CanRedo = true after a new step, want the redo history cleared")
+	}
+}
+
+func TestStateDoSkipsNoOpsAndFailures(t *testing.T) {
+	state := newHistoryTestState(t)
+	notified := 0
+	state.OnChange(func() { notified++ })
+
+	if err := state.Do("nothing", func() error { return nil }); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	failure := errors.New("boom")
+	if err := state.Do("fails", func() error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("Do error = %v, want %v", err, failure)
+	}
+	if state.CanUndo() || notified != 0 {
+		t.Fatalf("CanUndo = %v, notified = %d after no-op and failed steps", state.CanUndo(), notified)
+	}
+
+	// Changes made outside Do notify but are not undoable.
+	if err := state.ApplyResolution(0, markers.ResolutionOurs); err != nil {
+		t.Fatalf("ApplyResolution failed: %v", err)
+	}
+	if state.CanUndo() || notified != 1 {
+		t.Fatalf("CanUndo = %v, notified = %d after a direct change", state.CanUndo(), notified)
+	}
+
+	// Restore inside Do is undoable and keeps the callback.
+	pristine := newHistoryTestState(t)
+	if err := state.Do("revert file", func() error {
+		state.Restore(pristine)
+		return nil
+	}); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if !state.Equal(pristine) || !state.CanUndo() || notified != 2 {
+		t.Fatalf("after restore: Equal = %v, CanUndo = %v, notified = %d", state.Equal(pristine), state.CanUndo(), notified)
+	}
+	if clone := state.Clone(); clone.CanUndo() {
+		t.Fatalf("Clone kept the history, want contents only")
+	}
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+const patchContextLines = 3
+
+type patchLine struct {
+	kind    diffKind
+	text    []byte
+	oldLine int
+	newLine int
+}
+
+// UnifiedPatch formats a unified diff that turns oldData into newData for path.
+// The file headers use git's a/ and b/ prefixes. It returns nil when the
+// inputs are identical.
+func UnifiedPatch(path string, oldData []byte, newData []byte) []byte {
+	if bytes.Equal(oldData, newData) {
+		return nil
+	}
+
+	lines := flattenPatchLines(diffLines(markers.SplitLinesKeepEOL(oldData), markers.SplitLinesKeepEOL(newData)))
+
+	label := patchLabel(path)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- a/%s\n", label)
+	fmt.Fprintf(&out, "+++ b/%s\n", label)
+
+	for _, hunk := range patchHunks(lines) {
+		writePatchHunk(&out, hunk)
+	}
+
+	return out.Bytes()
+}
+
+// patchLabel is the path shown after a/ and b/. An absolute path is made
+// relative to the work tree that holds it, as git apply expects; outside any
+// work tree only the leading separator is dropped.
+func patchLabel(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	path = filepath.Clean(path)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path[len(filepath.VolumeName(path)):]), "/")
+}
+
+// patchHunks groups changed lines with patchContextLines of context, merging
+// changes whose context would overlap.
+func patchHunks(lines []patchLine) [][]patchLine {
+	var hunks [][]patchLine
+	for start := 0; start < len(lines); {
+		first := nextPatchChange(lines, start)
+		if first == -1 {
+			break
+		}
+		hunkStart := max(first-patchContextLines, start)
+		last := first
+		for {
+			next := nextPatchChange(lines, last+1)
+			if next == -1 || next-last > 2*patchContextLines {
+				break
+			}
+			last = next
+		}
+		hunkEnd := min(last+patchContextLines+1, len(lines))
+		hunks = append(hunks, lines[hunkStart:hunkEnd])
+		start = hunkEnd
+	}
+	return hunks
+}
+
+func flattenPatchLines(ops []diffOp) []patchLine {
+	var lines []patchLine
+	oldLine, newLine := 0, 0
+	for _, op := range ops {
+		switch op.kind {
+		case diffEqual:
+			for _, line := range op.oldLines {
+				lines = append(lines, patchLine{kind: diffEqual, text: line, oldLine: oldLine, newLine: newLine})
+				oldLine++
+				newLine++
+			}
+		case diffDelete:
+			for _, line := range op.oldLines {
+				lines = append(lines, patchLine{kind: diffDelete, text: line, oldLine: oldLine, newLine: newLine})
+				oldLine++
+			}
+		case diffInsert:
+			for _, line := range op.newLines {
+				lines = append(lines, patchLine{kind: diffInsert, text: line, oldLine: oldLine, newLine: newLine})
+				newLine++
+			}
+		}
+	}
+	return lines
+}
+
+func nextPatchChange(lines []patchLine, from int) int {
+	for i := from; i < len(lines); i++ {
+		if lines[i].kind != diffEqual {
+			return i
+		}
+	}
+	return -1
+}
+
+func writePatchHunk(out *bytes.Buffer, lines []patchLine) {
+	writeHunkHeader(out, lines)
+
+	for _, line := range lines {
+		switch line.kind {
+		case diffEqual:
+			out.WriteByte(' ')
+		case diffDelete:
+			out.WriteByte('-')
+		case diffInsert:
+			out.WriteByte('+')
+		}
+		out.Write(line.text)
+		if !bytes.HasSuffix(line.text, []byte("\n")) {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func writeHunkHeader(out *bytes.Buffer, lines []patchLine) {
+	oldCount, newCount := 0, 0
+	for _, line := range lines {
+		if line.kind != diffInsert {
+			oldCount++
+		}
+		if line.kind != diffDelete {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(lines[0].oldLine, oldCount), hunkRange(lines[0].newLine, newCount))
+}
+
+// hunkRange formats a 0-based start line and count as a unified diff range.
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
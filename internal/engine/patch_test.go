@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedPatchSingleHunk(t *testing.T) {
+	oldData := []byte("a\nb\nc\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nd\ne\nf\ng\n")
+	newData := []byte("a\nb\nc\nours\nd\ne\nf\ng\n")
+
+	got := string(UnifiedPatch("dir/file.txt", oldData, newData))
+	want := `--- a/dir/file.txt
++++ b/dir/file.txt
+@@ -1,11 +1,7 @@
+ a
+ b
+ c
+-<<<<<<< HEAD
+ ours
+-=======
+-theirs
+->>>>>>> branch
+ d
+ e
+ f
+`
+	if got != want {
+		t.Fatalf("UnifiedPatch mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedPatchSeparateHunks(t *testing.T) {
+	oldData := []byte("1\nx\n3\n4\n5\n6\n7\n8\n9\n10\ny\n12\n")
+	newData := []byte("1\nX\n3\n4\n5\n6\n7\n8\n9\n10\nY\n12\n")
+
+	got := string(UnifiedPatch("f", oldData, newData))
+	want := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ 1
+-x
++X
+ 3
+ 4
+ 5
+@@ -8,5 +8,5 @@
+ 8
+ 9
+ 10
+-y
++Y
+ 12
+`
+	if got != want {
+		t.Fatalf("UnifiedPatch mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedPatchNoNewlineAndEmptySides(t *testing.T) {
+	got := string(UnifiedPatch("f", []byte("old"), []byte("new\n")))
+	want := `--- a/f
++++ b/f
+@@ -1 +1 @@
+-old
+\ No newline at end of file
++new
+`
+	if got != want {
+		t.Fatalf("UnifiedPatch mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = string(UnifiedPatch("f", nil, []byte("a\n")))
+	if want := "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n"; got != want {
+		t.Fatalf("UnifiedPatch from empty = %q, want %q", got, want)
+	}
+
+	if patch := UnifiedPatch("f", []byte("same\n"), []byte("same\n")); patch != nil {
+		t.Fatalf("UnifiedPatch identical = %q, want nil", patch)
+	}
+}
+
+func TestUnifiedPatchAbsolutePathLabel(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	inRepo := string(UnifiedPatch(filepath.Join(root, "dir", "file.txt"), []byte("a\n"), []byte("b\n")))
+	if !strings.HasPrefix(inRepo, "--- a/dir/file.txt\n+++ b/dir/file.txt\n") {
+		t.Fatalf("headers = %q, want paths relative to the work tree", inRepo)
+	}
+
+	outside := filepath.Join(t.TempDir(), "file.txt")
+	label := strings.TrimPrefix(filepath.ToSlash(outside), "/")
+	got := string(WordDiffPatch(outside, []byte("a\n"), []byte("b\n")))
+	if !strings.HasPrefix(got, "--- a/"+label+"\n+++ b/"+label+"\n") {
+		t.Fatalf("headers = %q, want %q without the leading slash", got, label)
+	}
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
+	"github.com/chojs23/ec/internal/mergeview"
+)
+
+// PlanEntry resolves one conflict of a --plan file. Conflict is the 1-based
+// conflict number and Hash the conflict's content hash as printed by
+// --emit-plan; an entry needs at least one of them, and when it has both
+// they must name the same conflict.
+type PlanEntry struct {
+	Conflict   int                `json:"conflict,omitempty"`
+	Hash       string             `json:"hash,omitempty"`
+	Resolution markers.Resolution `json:"resolution"`
+}
+
+// ReadPlan reads a JSON list of plan entries from path.
+func ReadPlan(path string) ([]PlanEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plan: %w", err)
+	}
+	var entries []PlanEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse plan %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// EmitPlan returns a plan listing every conflict of doc with its number and
+// hash and an empty resolution to fill in.
+func EmitPlan(doc markers.Document) []PlanEntry {
+	entries := make([]PlanEntry, 0, len(doc.Conflicts))
+	for i, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		entries = append(entries, PlanEntry{Conflict: i + 1, Hash: seg.Hash()})
+	}
+	return entries
+}
+
+// WritePlan writes the EmitPlan of the conflicts rebuilt from opts' stage
+// files to w as indented JSON.
+func WritePlan(ctx context.Context, opts cli.Options, w io.Writer) error {
+	doc, err := mergeview.LoadCanonicalDocument(ctx, opts)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(EmitPlan(doc), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode plan: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
+
+// ApplyPlan applies entries to state. An entry with only a hash resolves
+// every conflict with that content. With strict set, a conflict the plan
+// leaves out is an error; otherwise it stays unresolved.
+func ApplyPlan(state *State, entries []PlanEntry, strict bool) error {
+	doc := state.Document()
+	byHash := make(map[string][]int, len(doc.Conflicts))
+	for i, ref := range doc.Conflicts {
+		if seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment); ok {
+			hash := seg.Hash()
+			byHash[hash] = append(byHash[hash], i)
+		}
+	}
+
+	planned := make([]bool, len(doc.Conflicts))
+	for n, entry := range entries {
+		var targets []int
+		switch {
+		case entry.Hash != "":
+			targets = byHash[entry.Hash]
+			if len(targets) == 0 {
+				return fmt.Errorf("plan entry %d: no conflict has hash %s", n+1, entry.Hash)
+			}
+			if entry.Conflict != 0 {
+				if !slices.Contains(targets, entry.Conflict-1) {
+					return fmt.Errorf("plan entry %d: hash %s does not belong to conflict %d", n+1, entry.Hash, entry.Conflict)
+				}
+				targets = []int{entry.Conflict - 1}
+			}
+		case entry.Conflict != 0:
+			if entry.Conflict < 1 || entry.Conflict > len(doc.Conflicts) {
+				return fmt.Errorf("plan entry %d: conflict %d does not exist (%d conflicts)", n+1, entry.Conflict, len(doc.Conflicts))
+			}
+			targets = []int{entry.Conflict - 1}
+		default:
+			return fmt.Errorf("plan entry %d: needs a conflict number or hash", n+1)
+		}
+		if entry.Resolution == markers.ResolutionUnset {
+			continue
+		}
+		for _, index := range targets {
+			if err := state.ApplyResolution(index, entry.Resolution); err != nil {
+				return fmt.Errorf("plan entry %d: %w", n+1, err)
+			}
+			planned[index] = true
+		}
+	}
+
+	if strict {
+		for i, ok := range planned {
+			if !ok {
+				return fmt.Errorf("conflict %d is not resolved by the plan", i+1)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
+)
+
+func writePlanFixture(t *testing.T, plan string) cli.Options {
+	t.Helper()
+	tmpDir := t.TempDir()
+	opts := cli.Options{
+		BasePath:   filepath.Join(tmpDir, "base.txt"),
+		LocalPath:  filepath.Join(tmpDir, "local.txt"),
+		RemotePath: filepath.Join(tmpDir, "remote.txt"),
+		MergedPath: filepath.Join(tmpDir, "merged.txt"),
+		Plan:       filepath.Join(tmpDir, "plan.json"),
+	}
+	for path, content := range map[string]string{
+		opts.BasePath:   "a\nbase1\nb\nbase2\nc\n",
+		opts.LocalPath:  "a\nlocal1\nb\nlocal2\nc\n",
+		opts.RemotePath: "a\nremote1\nb\nremote2\nc\n",
+		opts.MergedPath: "a\n<<<<<<< HEAD\nlocal1\n=======\nremote1\n>>>>>>> topic\nb\n<<<<<<< HEAD\nlocal2\n=======\nremote2\n>>>>>>> topic\nc\n",
+		opts.Plan:       plan,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return opts
+}
+
+func TestApplyAllAndWritePlanKeepsUnplannedConflicts(t *testing.T) {
+	opts := writePlanFixture(t, `[{"conflict": 1, "resolution": "theirs"}]`)
+	if err := ApplyAllAndWrite(context.Background(), opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite with plan failed: %v", err)
+	}
+
+	data, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a\nremote1\nb\n<<<<<<< HEAD\nlocal2\n|||||||\nbase2\n=======\nremote2\n>>>>>>> topic\nc\n"
+	if string(data) != want {
+		t.Fatalf("merged content = %q, want %q", data, want)
+	}
+}
+
+func TestApplyAllAndWritePlanOverridesLabels(t *testing.T) {
+	opts := writePlanFixture(t, `[{"conflict": 1, "resolution": "theirs"}]`)
+	opts.OursLabel, opts.BaseLabel, opts.TheirsLabel = "HEAD", "BASE", "BRANCH"
+	if err := ApplyAllAndWrite(context.Background(), opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite with plan failed: %v", err)
+	}
+
+	data, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a\nremote1\nb\n<<<<<<< HEAD\nlocal2\n||||||| BASE\nbase2\n=======\nremote2\n>>>>>>> BRANCH\nc\n"
+	if string(data) != want {
+		t.Fatalf("merged content = %q, want %q", data, want)
+	}
+}
+
+func TestApplyAllAndWritePlanKeepsAnnotatedSeparator(t *testing.T) {
+	opts := writePlanFixture(t, `[{"conflict": 1, "resolution": "theirs"}]`)
+	merged := "a\n<<<<<<< HEAD\nlocal1\n=======\nremote1\n>>>>>>> topic\nb\n<<<<<<< HEAD (mine)\nlocal2\n======= theirs below\nremote2\n>>>>>>> topic\nc\n"
+	if err := os.WriteFile(opts.MergedPath, []byte(merged), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyAllAndWrite(context.Background(), opts); err != nil {
+		t.Fatalf("ApplyAllAndWrite with plan failed: %v", err)
+	}
+
+	data, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a\nremote1\nb\n<<<<<<< HEAD (mine)\nlocal2\n|||||||\nbase2\n======= theirs below\nremote2\n>>>>>>> topic\nc\n"
+	if string(data) != want {
+		t.Fatalf("merged content = %q, want %q", data, want)
+	}
+}
+
+func TestApplyAllAndWritePlanStrict(t *testing.T) {
+	opts := writePlanFixture(t, `[{"conflict": 1, "resolution": "theirs"}]`)
+	opts.Strict = true
+	err := ApplyAllAndWrite(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "conflict 2 is not resolved by the plan") {
+		t.Fatalf("ApplyAllAndWrite error = %v, want unplanned conflict error", err)
+	}
+}
+
+func TestApplyPlanByHash(t *testing.T) {
+	doc, err := markers.Parse([]byte("<<<<<<< HEAD\nx\n||||||| base\no\n=======\ny\n>>>>>>> topic\nmid\n<<<<<<< HEAD\nx\n||||||| base\no\n=======\ny\n>>>>>>> topic\n<<<<<<< HEAD\np\n||||||| base\no\n=======\nq\n>>>>>>> topic\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := EmitPlan(doc)
+	if len(plan) != 3 || plan[0].Hash != plan[1].Hash || plan[0].Hash == plan[2].Hash {
+		t.Fatalf("EmitPlan = %+v, want equal hashes for identical conflicts only", plan)
+	}
+
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []PlanEntry{
+		{Hash: plan[0].Hash, Resolution: markers.ResolutionOurs},
+		{Conflict: 3, Hash: plan[2].Hash, Resolution: markers.ResolutionTheirs},
+	}
+	if err := ApplyPlan(state, entries, true); err != nil {
+		t.Fatalf("ApplyPlan error = %v", err)
+	}
+	out, err := state.Preview()
+	if err != nil {
+		t.Fatalf("Preview error = %v", err)
+	}
+	if string(out) != "x\nmid\nx\nq\n" {
+		t.Fatalf("Preview = %q", out)
+	}
+}
+
+func TestApplyPlanRejectsBadEntries(t *testing.T) {
+	doc, err := markers.Parse([]byte("<<<<<<< HEAD\nx\n||||||| base\no\n=======\ny\n>>>>>>> topic\n<<<<<<< HEAD\np\n||||||| base\no\n=======\nq\n>>>>>>> topic\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := EmitPlan(doc)
+	tests := []struct {
+		name  string
+		entry PlanEntry
+		want  string
+	}{
+		{"no target", PlanEntry{Resolution: markers.ResolutionOurs}, "needs a conflict number or hash"},
+		{"out of range", PlanEntry{Conflict: 3, Resolution: markers.ResolutionOurs}, "conflict 3 does not exist"},
+		{"unknown hash", PlanEntry{Hash: "abc", Resolution: markers.ResolutionOurs}, "no conflict has hash abc"},
+		{"hash mismatch", PlanEntry{Conflict: 2, Hash: plan[0].Hash, Resolution: markers.ResolutionOurs}, "does not belong to conflict 2"},
+		{"bad resolution", PlanEntry{Conflict: 1, Resolution: "mine"}, "invalid resolution"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := NewState(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ApplyPlan(state, []PlanEntry{tt.entry}, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ApplyPlan error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
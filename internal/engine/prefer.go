@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// UnmatchedBranchError reports the conflicts --prefer-branch left unresolved
+// because neither side, or both, carry the branch label. Conflicts holds
+// 1-based conflict numbers.
+type UnmatchedBranchError struct {
+	Branch    string
+	Conflicts []int
+}
+
+func (e *UnmatchedBranchError) Error() string {
+	numbers := make([]string, len(e.Conflicts))
+	for i, n := range e.Conflicts {
+		numbers[i] = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d conflict(s) not labelled %s on exactly one side, left unresolved: %s", len(e.Conflicts), e.Branch, strings.Join(numbers, ", "))
+}
+
+// ApplyPreferBranch resolves every unresolved conflict of doc to the side
+// whose marker label names branch, whether that is ours or theirs. It returns
+// the resolved document and the 0-based indices of the conflicts it left
+// alone because neither label matches or both do.
+func ApplyPreferBranch(doc markers.Document, branch string) (markers.Document, []int) {
+	doc = markers.CloneDocument(doc)
+	var unmatched []int
+	for i, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok || seg.Resolution != markers.ResolutionUnset {
+			continue
+		}
+		ours, theirs := labelNamesBranch(seg.OursLabel, branch), labelNamesBranch(seg.TheirsLabel, branch)
+		switch {
+		case ours && !theirs:
+			seg.Resolution = markers.ResolutionOurs
+		case theirs && !ours:
+			seg.Resolution = markers.ResolutionTheirs
+		default:
+			unmatched = append(unmatched, i)
+			continue
+		}
+		doc.Segments[ref.SegmentIndex] = seg
+	}
+	return doc, unmatched
+}
+
+// labelNamesBranch reports whether a conflict marker label names branch.
+// git labels a side with the branch name, or with branch:path when the file
+// was renamed on it.
+func labelNamesBranch(label string, branch string) bool {
+	label = strings.TrimSpace(label)
+	return label == branch || strings.HasPrefix(label, branch+":")
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
+)
+
+func TestApplyPreferBranch(t *testing.T) {
+	conflict := func(ours, theirs string, resolution markers.Resolution) markers.ConflictSegment {
+		return markers.ConflictSegment{Ours: []byte("o\n"), Theirs: []byte("t\n"), OursLabel: ours, TheirsLabel: theirs, Resolution: resolution}
+	}
+	doc := markers.Document{
+		Segments: []markers.Segment{
+			conflict("HEAD", "feature/foo", markers.ResolutionUnset),
+			conflict("feature/foo", "main", markers.ResolutionUnset),
+			conflict("HEAD", "feature/foo:src/renamed.go", markers.ResolutionUnset),
+			conflict("HEAD", "feature/foobar", markers.ResolutionUnset),
+			conflict("feature/foo", "feature/foo", markers.ResolutionUnset),
+			conflict("HEAD", "feature/foo", markers.ResolutionNone),
+		},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 0}, {SegmentIndex: 1}, {SegmentIndex: 2}, {SegmentIndex: 3}, {SegmentIndex: 4}, {SegmentIndex: 5}},
+	}
+
+	resolved, unmatched := ApplyPreferBranch(doc, "feature/foo")
+	want := []markers.Resolution{markers.ResolutionTheirs, markers.ResolutionOurs, markers.ResolutionTheirs, markers.ResolutionUnset, markers.ResolutionUnset, markers.ResolutionNone}
+	for i, ref := range resolved.Conflicts {
+		if got := resolved.Segments[ref.SegmentIndex].(markers.ConflictSegment).Resolution; got != want[i] {
+			t.Fatalf("conflict %d resolution = %q, want %q", i+1, got, want[i])
+		}
+	}
+	if !slices.Equal(unmatched, []int{3, 4}) {
+		t.Fatalf("unmatched = %v, want [3 4]", unmatched)
+	}
+	if got := doc.Segments[0].(markers.ConflictSegment).Resolution; got != markers.ResolutionUnset {
+		t.Fatalf("ApplyPreferBranch modified its input: %q", got)
+	}
+}
+
+func TestApplyAllAndWritePreferBranch(t *testing.T) {
+	tmpDir := t.TempDir()
+	opts := cli.Options{
+		BasePath:     filepath.Join(tmpDir, "base.txt"),
+		LocalPath:    filepath.Join(tmpDir, "local.txt"),
+		RemotePath:   filepath.Join(tmpDir, "remote.txt"),
+		MergedPath:   filepath.Join(tmpDir, "merged.txt"),
+		PreferBranch: "feature/foo",
+	}
+	for path, content := range map[string]string{
+		opts.BasePath:   "a\nbase1\nb\nbase2\nc\n",
+		opts.LocalPath:  "a\nlocal1\nb\nlocal2\nc\n",
+		opts.RemotePath: "a\nremote1\nb\nremote2\nc\n",
+		opts.MergedPath: "a\n<<<<<<< HEAD\nlocal1\n=======\nremote1\n>>>>>>> feature/foo\nb\n<<<<<<< HEAD\nlocal2\n=======\nremote2\n>>>>>>> other\nc\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := ApplyAllAndWrite(context.Background(), opts)
+	var unmatched *UnmatchedBranchError
+	if !errors.As(err, &unmatched) || !slices.Equal(unmatched.Conflicts, []int{2}) {
+		t.Fatalf("ApplyAllAndWrite error = %v, want conflict 2 unmatched", err)
+	}
+	data, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a\nremote1\nb\n<<<<<<< HEAD\nlocal2\n|||||||\nbase2\n=======\nremote2\n>>>>>>> other\nc\n"
+	if string(data) != want {
+		t.Fatalf("merged content = %q, want %q", data, want)
+	}
+
+	// The label options rename the markers of the conflicts left unresolved.
+	opts.MergedPath = filepath.Join(tmpDir, "labelled.txt")
+	opts.OursLabel, opts.TheirsLabel = "MINE", "OTHER"
+	if err := os.WriteFile(opts.MergedPath, []byte("a\n<<<<<<< HEAD\nlocal1\n=======\nremote1\n>>>>>>> feature/foo\nb\n<<<<<<< HEAD\nlocal2\n=======\nremote2\n>>>>>>> other\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyAllAndWrite(context.Background(), opts); !errors.As(err, &unmatched) {
+		t.Fatalf("ApplyAllAndWrite error = %v, want conflict 2 unmatched", err)
+	}
+	data, err = os.ReadFile(opts.MergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "a\nremote1\nb\n<<<<<<< MINE\nlocal2\n|||||||\nbase2\n=======\nremote2\n>>>>>>> OTHER\nc\n"
+	if string(data) != want {
+		t.Fatalf("labelled content = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// WriteReport writes the WriteConflictReport of opts.MergedPath to w, in
+// markdown with opts.Markdown. Only $MERGED is read, so it works on any
+// file with conflict markers.
+func WriteReport(opts cli.Options, w io.Writer) error {
+	_, doc, err := CheckResolvedFileDocument(opts.MergedPath)
+	if err != nil {
+		return err
+	}
+	return WriteConflictReport(w, opts.MergedPath, doc, opts.Markdown)
+}
+
+// WriteConflictReport writes a report of the conflicts of doc, read from
+// path, for reviewing them away from the resolver: per conflict its lines in
+// the file, each side under its label and a suggested resolution. With
+// markdown the sides are fenced code blocks under headings.
+func WriteConflictReport(w io.Writer, path string, doc markers.Document, markdown bool) error {
+	var out bytes.Buffer
+	if markdown {
+		fmt.Fprintf(&out, "# %s\n\n%d conflict(s)\n", path, len(doc.Conflicts))
+	} else {
+		fmt.Fprintf(&out, "%s: %d conflict(s)\n", path, len(doc.Conflicts))
+	}
+
+	line := 1
+	conflict := 0
+	for _, segment := range doc.Segments {
+		switch seg := segment.(type) {
+		case markers.TextSegment:
+			line += len(markers.SplitLinesKeepEOL(seg.Bytes))
+		case markers.ConflictSegment:
+			conflict++
+			lines := conflictLineCount(seg)
+			title := fmt.Sprintf("Conflict %d of %d, lines %d-%d", conflict, len(doc.Conflicts), line, line+lines-1)
+			line += lines
+
+			sides := []reportSide{{"Ours", seg.OursLabel, seg.Ours}}
+			if hasBaseSection(seg) {
+				sides = append(sides, reportSide{"Base", seg.BaseLabel, seg.Base})
+			}
+			sides = append(sides, reportSide{"Theirs", seg.TheirsLabel, seg.Theirs})
+
+			resolution, reason := suggestResolution(seg)
+			suggestion := "review by hand"
+			if resolution != markers.ResolutionUnset {
+				suggestion = string(resolution)
+			}
+
+			if markdown {
+				fmt.Fprintf(&out, "\n## %s\n", title)
+				for _, side := range sides {
+					out.WriteString("\n" + side.name)
+					if side.label != "" {
+						fmt.Fprintf(&out, " (`%s`)", side.label)
+					}
+					out.WriteString(":\n\n")
+					writeFencedBlock(&out, side.text)
+				}
+				fmt.Fprintf(&out, "\nSuggested: **%s** (%s)\n", suggestion, reason)
+				continue
+			}
+			fmt.Fprintf(&out, "\n%s\n", title)
+			for _, side := range sides {
+				out.WriteString("  " + strings.ToLower(side.name))
+				if side.label != "" {
+					fmt.Fprintf(&out, " (%s)", side.label)
+				}
+				out.WriteString(":\n")
+				writeIndentedBlock(&out, side.text)
+			}
+			fmt.Fprintf(&out, "  suggested: %s (%s)\n", suggestion, reason)
+		}
+	}
+
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
+
+// reportSide is one side of a conflict as the report shows it.
+type reportSide struct {
+	name  string
+	label string
+	text  []byte
+}
+
+// suggestResolution proposes a resolution for seg from how its sides relate
+// to each other and to base, with the reason. It returns ResolutionUnset
+// when both sides changed the same lines and only a person can decide.
+func suggestResolution(seg markers.ConflictSegment) (markers.Resolution, string) {
+	switch {
+	case bytes.Equal(seg.Ours, seg.Theirs):
+		return markers.ResolutionOurs, "both sides made the same change"
+	case conflictIsWhitespaceOnly(seg):
+		return markers.ResolutionOurs, "the sides differ only in whitespace"
+	case hasBaseSection(seg) && bytes.Equal(seg.Ours, seg.Base):
+		return markers.ResolutionTheirs, "only theirs changed base"
+	case hasBaseSection(seg) && bytes.Equal(seg.Theirs, seg.Base):
+		return markers.ResolutionOurs, "only ours changed base"
+	}
+	return markers.ResolutionUnset, "both sides changed the same lines"
+}
+
+// hasBaseSection reports whether seg came with a ||||||| section, so an
+// empty Base means base had no lines rather than that it is unknown.
+func hasBaseSection(seg markers.ConflictSegment) bool {
+	return len(seg.Base) > 0 || seg.BaseLabel != "" || seg.Markers.Base != nil
+}
+
+// conflictLineCount returns the lines seg takes in the file with its markers.
+func conflictLineCount(seg markers.ConflictSegment) int {
+	lines := 3 + len(markers.SplitLinesKeepEOL(seg.Ours)) + len(markers.SplitLinesKeepEOL(seg.Theirs))
+	if hasBaseSection(seg) {
+		lines += 1 + len(markers.SplitLinesKeepEOL(seg.Base))
+	}
+	return lines
+}
+
+// writeIndentedBlock writes text indented under a side's heading of the
+// plain text report, or (empty) when the side has no lines.
+func writeIndentedBlock(out *bytes.Buffer, text []byte) {
+	lines := markers.SplitLinesKeepEOL(text)
+	if len(lines) == 0 {
+		out.WriteString("    (empty)\n")
+		return
+	}
+	for _, line := range lines {
+		out.WriteString("    " + strings.TrimRight(string(line), "\r\n") + "\n")
+	}
+}
+
+// writeFencedBlock writes text as a markdown code block, fenced with more
+// backticks than any run inside it.
+func writeFencedBlock(out *bytes.Buffer, text []byte) {
+	longest, run := 0, 0
+	for _, b := range text {
+		if b == '`' {
+			run++
+			longest = max(longest, run)
+			continue
+		}
+		run = 0
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	out.WriteString(fence + "\n")
+	for _, line := range markers.SplitLinesKeepEOL(text) {
+		out.WriteString(strings.TrimRight(string(line), "\r\n") + "\n")
+	}
+	out.WriteString(fence + "\n")
+}
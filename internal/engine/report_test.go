@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+func TestWriteConflictReport(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "report.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		golden   string
+		markdown bool
+	}{
+		{"report.golden", false},
+		{"report.md.golden", true},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := WriteConflictReport(&out, "report.input", doc, tt.markdown); err != nil {
+				t.Fatalf("WriteConflictReport failed: %v", err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("report mismatch:\n--- got\n%s\n--- want\n%s", out.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestSuggestResolution(t *testing.T) {
+	tests := []struct {
+		name string
+		seg  markers.ConflictSegment
+		want markers.Resolution
+	}{
+		{"same change", markers.ConflictSegment{Ours: []byte("a\n"), Theirs: []byte("a\n")}, markers.ResolutionOurs},
+		{"whitespace only", markers.ConflictSegment{Ours: []byte("a  b\n"), Theirs: []byte("a b\n")}, markers.ResolutionOurs},
+		{"only theirs changed", markers.ConflictSegment{Ours: []byte("a\n"), Base: []byte("a\n"), Theirs: []byte("b\n")}, markers.ResolutionTheirs},
+		{"only ours changed", markers.ConflictSegment{Ours: []byte("b\n"), Base: []byte("a\n"), Theirs: []byte("a\n")}, markers.ResolutionOurs},
+		{"both changed", markers.ConflictSegment{Ours: []byte("b\n"), Base: []byte("a\n"), Theirs: []byte("c\n")}, markers.ResolutionUnset},
+		// Without a base section an empty ours says nothing about base.
+		{"no base", markers.ConflictSegment{Theirs: []byte("b\n")}, markers.ResolutionUnset},
+	}
+	for _, tt := range tests {
+		if got, reason := suggestResolution(tt.seg); got != tt.want {
+			t.Errorf("%s: suggestResolution = %q (%s), want %q", tt.name, got, reason, tt.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ type ConflictLabels struct {
 
 type conflictState struct {
 	canonical      markers.ConflictSegment
+	bothSeparator  string // the document's BothSeparator
 	output         []byte
 	resolution     markers.Resolution
 	manual         bool
@@ -47,6 +48,13 @@ type State struct {
 	segments   []segmentState
 	boundaries [][]byte
 	doc        markers.Document
+
+	// undo and redo hold the history recorded by Do; see history.go.
+	undo     []historyStep
+	redo     []historyStep
+	onChange func()
+	// batching is non-zero while Do runs, which notifies once at the end.
+	batching int
 }
 
 func NewState(doc markers.Document) (*State, error) {
@@ -61,7 +69,7 @@ func newStateFromDocument(doc markers.Document) *State {
 		case markers.TextSegment:
 			segments = append(segments, segmentState{text: append([]byte(nil), s.Bytes...)})
 		case markers.ConflictSegment:
-			cs := newConflictState(s)
+			cs := newConflictState(s, canonical.BothSeparator)
 			segments = append(segments, segmentState{conflict: &cs})
 		}
 	}
@@ -70,9 +78,10 @@ func newStateFromDocument(doc markers.Document) *State {
 	return state
 }
 
-func newConflictState(seg markers.ConflictSegment) conflictState {
+func newConflictState(seg markers.ConflictSegment, bothSeparator string) conflictState {
 	state := conflictState{
-		canonical: seg,
+		canonical:     seg,
+		bothSeparator: bothSeparator,
 		labels: ConflictLabels{
 			OursLabel:   seg.OursLabel,
 			BaseLabel:   seg.BaseLabel,
@@ -89,22 +98,47 @@ func newConflictState(seg markers.ConflictSegment) conflictState {
 }
 
 func (s *State) ApplyResolution(conflictIndex int, resolution markers.Resolution) error {
-	if conflictIndex < 0 || conflictIndex >= len(s.canonical.Conflicts) {
-		return fmt.Errorf("conflict index %d out of bounds [0, %d)", conflictIndex, len(s.canonical.Conflicts))
-	}
 	if !isSupportedResolution(resolution) {
 		return fmt.Errorf("invalid resolution: %q", resolution)
 	}
-	segIndex := s.canonical.Conflicts[conflictIndex].SegmentIndex
-	conflict := s.segments[segIndex].conflict
-	if conflict == nil {
-		return fmt.Errorf("internal: conflict index %d points to non-ConflictSegment", conflictIndex)
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return err
 	}
 	conflict.setResolved(resolution)
 	s.syncDocument()
 	return nil
 }
 
+// CycleResolution advances a conflict through ours, theirs, both, none and
+// back to unresolved. A manually edited conflict counts as unresolved, so
+// cycling replaces the edit with ours.
+func (s *State) CycleResolution(conflictIndex int) error {
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return err
+	}
+	next := markers.ResolutionOurs
+	if !conflict.manual {
+		next = nextCycledResolution(conflict.resolution)
+	}
+	conflict.setResolved(next)
+	s.syncDocument()
+	return nil
+}
+
+func (s *State) conflictAt(conflictIndex int) (*conflictState, error) {
+	if conflictIndex < 0 || conflictIndex >= len(s.canonical.Conflicts) {
+		return nil, fmt.Errorf("conflict index %d out of bounds [0, %d)", conflictIndex, len(s.canonical.Conflicts))
+	}
+	segIndex := s.canonical.Conflicts[conflictIndex].SegmentIndex
+	conflict := s.segments[segIndex].conflict
+	if conflict == nil {
+		return nil, fmt.Errorf("internal: conflict index %d points to non-ConflictSegment", conflictIndex)
+	}
+	return conflict, nil
+}
+
 func (s *State) ApplyAll(resolution markers.Resolution) error {
 	if !isSupportedResolution(resolution) {
 		return fmt.Errorf("invalid resolution: %q", resolution)
@@ -125,6 +159,7 @@ func (s *State) ReplaceDocument(doc markers.Document) {
 	s.canonical = next.canonical
 	s.segments = next.segments
 	s.doc = next.doc
+	s.changed()
 }
 
 func (s *State) Preview() ([]byte, error) {
@@ -134,10 +169,37 @@ func (s *State) Preview() ([]byte, error) {
 	return s.RenderMerged(), nil
 }
 
+// Range is a half-open byte span [Start, End) of rendered output.
+type Range struct {
+	Start int
+	End   int
+}
+
+// PreviewWithRanges is Preview that also reports where each conflict's
+// resolved output lands: ranges[i] is the byte span of conflict i in the
+// returned bytes, including a leading byte-order mark in the offsets. A
+// conflict resolved to nothing gets an empty range at its position.
+func (s *State) PreviewWithRanges() ([]byte, []Range, error) {
+	if s.HasUnresolvedConflicts() {
+		return nil, nil, fmt.Errorf("%w: conflict without resolution", markers.ErrUnresolved)
+	}
+	body, ranges := s.renderBodyWithRanges()
+	out := markers.AddBOM(body, s.canonical.BOM)
+	if shift := len(out) - len(body); shift > 0 {
+		for i := range ranges {
+			ranges[i].Start += shift
+			ranges[i].End += shift
+		}
+	}
+	return out, ranges, nil
+}
+
 func (s *State) Document() markers.Document {
 	return markers.CloneDocument(s.doc)
 }
 
+// syncDocument rebuilds doc from the segments. Every mutation ends with it,
+// so it also notifies the OnChange callback.
 func (s *State) syncDocument() {
 	doc := markers.CloneDocument(s.canonical)
 	for i, segment := range s.segments {
@@ -160,8 +222,11 @@ func (s *State) syncDocument() {
 		}
 	}
 	s.doc = doc
+	s.changed()
 }
 
+// Clone returns a deep copy of the contents of s, without its history or
+// OnChange callback.
 func (s *State) Clone() *State {
 	clone := &State{canonical: markers.CloneDocument(s.canonical), doc: markers.CloneDocument(s.doc)}
 	clone.segments = make([]segmentState, len(s.segments))
@@ -182,19 +247,34 @@ func (s *State) Clone() *State {
 }
 
 func (s *State) RenderMerged() []byte {
+	return markers.AddBOM(s.renderBody(), s.canonical.BOM)
+}
+
+// renderBody renders the merged output without the byte-order mark.
+func (s *State) renderBody() []byte {
+	body, _ := s.renderBodyWithRanges()
+	return body
+}
+
+// renderBodyWithRanges is renderBody that records the byte span each
+// conflict's output occupies, in conflict order.
+func (s *State) renderBodyWithRanges() ([]byte, []Range) {
 	var out bytes.Buffer
+	ranges := make([]Range, 0, len(s.canonical.Conflicts))
 	for i, segment := range s.segments {
 		out.Write(s.boundaries[i])
 		if segment.conflict == nil {
 			out.Write(segment.text)
 			continue
 		}
+		start := out.Len()
 		out.Write(segment.conflict.output)
+		ranges = append(ranges, Range{Start: start, End: out.Len()})
 	}
 	if len(s.boundaries) > 0 {
 		out.Write(s.boundaries[len(s.boundaries)-1])
 	}
-	return out.Bytes()
+	return out.Bytes(), ranges
 }
 
 func (s *State) BoundaryText() [][]byte {
@@ -215,6 +295,89 @@ func (s *State) HasUnresolvedConflicts() bool {
 	return false
 }
 
+// IdenticalAddConflicts returns the unresolved conflicts with an empty base
+// where both sides added byte-identical text. Taking either side is safe.
+func (s *State) IdenticalAddConflicts() []int {
+	var indices []int
+	for idx, ref := range s.canonical.Conflicts {
+		conflict := s.segments[ref.SegmentIndex].conflict
+		if conflict == nil || conflict.manual || conflict.resolution != markers.ResolutionUnset {
+			continue
+		}
+		seg := conflict.canonical
+		if len(seg.Base) == 0 && len(seg.Ours) > 0 && bytes.Equal(seg.Ours, seg.Theirs) {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// WhitespaceOnlyConflicts returns the unresolved conflicts whose sides differ
+// only in whitespace.
+func (s *State) WhitespaceOnlyConflicts() []int {
+	var indices []int
+	for idx, ref := range s.canonical.Conflicts {
+		conflict := s.segments[ref.SegmentIndex].conflict
+		if conflict == nil || conflict.manual || conflict.resolution != markers.ResolutionUnset {
+			continue
+		}
+		if conflictIsWhitespaceOnly(conflict.canonical) {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// IsWhitespaceOnly reports whether the sides of a conflict differ only in
+// whitespace, however it is resolved.
+func (s *State) IsWhitespaceOnly(conflictIndex int) bool {
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return false
+	}
+	return conflictIsWhitespaceOnly(conflict.canonical)
+}
+
+// ResetResolution returns a conflict to unresolved, with its markers back in
+// the output.
+func (s *State) ResetResolution(conflictIndex int) error {
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return err
+	}
+	conflict.setResolved(markers.ResolutionUnset)
+	s.syncDocument()
+	return nil
+}
+
+// StartManualFrom returns the text a conflict would have resolved with seed,
+// as the starting point for editing it by hand. The state is left unchanged;
+// SetManualResolution stores the edited text.
+func (s *State) StartManualFrom(conflictIndex int, seed markers.Resolution) ([]byte, error) {
+	if !isSupportedResolution(seed) {
+		return nil, fmt.Errorf("invalid resolution: %q", seed)
+	}
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return nil, err
+	}
+	return renderResolution(conflict.canonical, seed, conflict.bothSeparator), nil
+}
+
+// SetManualResolution replaces a conflict's text with content. Content that
+// matches one of the resolutions, or still holds the conflict markers, is
+// classified as such, the same as an edit read back from the merged file.
+func (s *State) SetManualResolution(conflictIndex int, content []byte) error {
+	conflict, err := s.conflictAt(conflictIndex)
+	if err != nil {
+		return err
+	}
+	conflict.output = append([]byte(nil), content...)
+	conflict.classifyUpdatedOutput()
+	s.syncDocument()
+	return nil
+}
+
 func (s *State) ManualResolved() map[int][]byte {
 	manual := map[int][]byte{}
 	for idx, ref := range s.canonical.Conflicts {
@@ -252,27 +415,32 @@ func (s *State) ImportMerged(merged []byte) error {
 		}
 	}
 
-	oldLines := markers.SplitLinesKeepEOL(s.RenderMerged())
+	// The byte-order mark lives on the document, not in any slot.
+	merged, _ = markers.StripBOM(merged)
+	oldLines := markers.SplitLinesKeepEOL(s.renderBody())
 	newLines := markers.SplitLinesKeepEOL(merged)
 	slots := s.renderSlots()
 	lineToSlot, boundarySlotAtCursor := s.slotLineOwnership(slots)
 	ops := diffLines(oldLines, newLines)
 	assigned := make([][][]byte, len(slots))
 	oldCursor := 0
-	pendingDeletedSlot := -1
+	// pendingDeletedSlots holds the slot of each line of a deletion that an
+	// insertion may replace.
+	var pendingDeletedSlots []int
 
 	for _, op := range ops {
 		switch op.kind {
 		case diffInsert:
-			target := pendingDeletedSlot
-			if target == -1 {
-				target = slotIndexAtCursor(lineToSlot, boundarySlotAtCursor, oldCursor)
+			if len(pendingDeletedSlots) > 0 {
+				assignReplacedLines(assigned, pendingDeletedSlots, op.newLines)
+				pendingDeletedSlots = nil
+				continue
 			}
+			target := slotIndexAtCursor(lineToSlot, boundarySlotAtCursor, oldCursor)
 			if target == -1 {
 				target = 0
 			}
 			assigned[target] = append(assigned[target], op.newLines...)
-			pendingDeletedSlot = -1
 		case diffEqual:
 			for _, line := range op.newLines {
 				if oldCursor >= len(lineToSlot) {
@@ -282,10 +450,13 @@ func (s *State) ImportMerged(merged []byte) error {
 				assigned[target] = append(assigned[target], line)
 				oldCursor++
 			}
-			pendingDeletedSlot = -1
+			pendingDeletedSlots = nil
 		case diffDelete:
-			if len(op.oldLines) > 0 && oldCursor < len(lineToSlot) {
-				pendingDeletedSlot = lineToSlot[oldCursor]
+			pendingDeletedSlots = nil
+			for i := range op.oldLines {
+				if oldCursor+i < len(lineToSlot) {
+					pendingDeletedSlots = append(pendingDeletedSlots, lineToSlot[oldCursor+i])
+				}
 			}
 			oldCursor += len(op.oldLines)
 		}
@@ -419,12 +590,12 @@ func (s *State) slotBytes(slot renderSlot) []byte {
 }
 
 func (c *conflictState) setResolved(resolution markers.Resolution) {
-	c.output = renderResolution(c.canonical, resolution)
+	c.output = renderResolution(c.canonical, resolution, c.bothSeparator)
 	c.applyClassification(resolution, resolution == markers.ResolutionUnset, false, ConflictLabels{}, false)
 }
 
 func (c *conflictState) classifyUpdatedOutput() {
-	resolution, unresolved, manual, labels, known := classifyConflictOutput(c.canonical, c.output)
+	resolution, unresolved, manual, labels, known := classifyConflictOutput(c.canonical, c.output, c.bothSeparator)
 	c.applyClassification(resolution, unresolved, manual, labels, known)
 }
 
@@ -461,21 +632,23 @@ func classifyResolvedSides(seg markers.ConflictSegment, resolution markers.Resol
 	case markers.ResolutionTheirs:
 		resolvedOurs := len(seg.Ours) == 0
 		return resolvedOurs, true, !resolvedOurs
-	case markers.ResolutionBoth, markers.ResolutionNone:
+	case markers.ResolutionBoth, markers.ResolutionBothDedup, markers.ResolutionNone:
 		return true, true, false
 	default:
 		return false, false, false
 	}
 }
 
-func renderResolution(seg markers.ConflictSegment, resolution markers.Resolution) []byte {
+func renderResolution(seg markers.ConflictSegment, resolution markers.Resolution, bothSeparator string) []byte {
 	switch resolution {
 	case markers.ResolutionOurs:
 		return append([]byte(nil), seg.Ours...)
 	case markers.ResolutionTheirs:
 		return append([]byte(nil), seg.Theirs...)
 	case markers.ResolutionBoth:
-		return append(append([]byte(nil), seg.Ours...), seg.Theirs...)
+		return markers.JoinBoth(seg.Ours, seg.Theirs, bothSeparator)
+	case markers.ResolutionBothDedup:
+		return markers.BothDedup(seg.Base, seg.Ours, seg.Theirs)
 	case markers.ResolutionNone:
 		return nil
 	default:
@@ -499,9 +672,8 @@ func sameConflictIdentity(left markers.Segment, right markers.ConflictSegment) b
 	return bytes.Equal(canonical.Ours, right.Ours) && bytes.Equal(canonical.Base, right.Base) && bytes.Equal(canonical.Theirs, right.Theirs)
 }
 
-func classifyConflictOutput(seg markers.ConflictSegment, output []byte) (markers.Resolution, bool, bool, ConflictLabels, bool) {
-	both := append(append([][]byte{}, markers.SplitLinesKeepEOL(seg.Ours)...), markers.SplitLinesKeepEOL(seg.Theirs)...)
-	bothBytes := joinLines(both)
+func classifyConflictOutput(seg markers.ConflictSegment, output []byte, bothSeparator string) (markers.Resolution, bool, bool, ConflictLabels, bool) {
+	bothBytes := markers.JoinBoth(seg.Ours, seg.Theirs, bothSeparator)
 	switch {
 	case bytes.Equal(output, seg.Ours):
 		return markers.ResolutionOurs, false, false, ConflictLabels{}, false
@@ -509,6 +681,8 @@ func classifyConflictOutput(seg markers.ConflictSegment, output []byte) (markers
 		return markers.ResolutionTheirs, false, false, ConflictLabels{}, false
 	case bytes.Equal(output, bothBytes):
 		return markers.ResolutionBoth, false, false, ConflictLabels{}, false
+	case bytes.Equal(output, markers.BothDedup(seg.Base, seg.Ours, seg.Theirs)):
+		return markers.ResolutionBothDedup, false, false, ConflictLabels{}, false
 	case len(output) == 0:
 		return markers.ResolutionNone, false, false, ConflictLabels{}, false
 	}
@@ -533,15 +707,61 @@ func classifyConflictOutput(seg markers.ConflictSegment, output []byte) (markers
 	return markers.ResolutionUnset, false, true, ConflictLabels{}, false
 }
 
+// conflictIsWhitespaceOnly reports whether the sides of seg differ but are
+// equal once whitespace is normalized: indentation, trailing blanks, runs of
+// spaces and line endings are ignored, line breaks and the words are not.
+func conflictIsWhitespaceOnly(seg markers.ConflictSegment) bool {
+	if bytes.Equal(seg.Ours, seg.Theirs) {
+		return false
+	}
+	return bytes.Equal(normalizeWhitespace(seg.Ours), normalizeWhitespace(seg.Theirs))
+}
+
+func normalizeWhitespace(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.Join(bytes.Fields(line), []byte(" "))
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func nextCycledResolution(resolution markers.Resolution) markers.Resolution {
+	switch resolution {
+	case markers.ResolutionOurs:
+		return markers.ResolutionTheirs
+	case markers.ResolutionTheirs:
+		return markers.ResolutionBoth
+	case markers.ResolutionBoth:
+		return markers.ResolutionNone
+	case markers.ResolutionNone:
+		return markers.ResolutionUnset
+	default:
+		return markers.ResolutionOurs
+	}
+}
+
 func isSupportedResolution(resolution markers.Resolution) bool {
 	switch resolution {
-	case markers.ResolutionOurs, markers.ResolutionTheirs, markers.ResolutionBoth, markers.ResolutionNone:
+	case markers.ResolutionOurs, markers.ResolutionTheirs, markers.ResolutionBoth, markers.ResolutionBothDedup, markers.ResolutionNone:
 		return true
 	default:
 		return false
 	}
 }
 
+// assignReplacedLines attributes the lines replacing a deleted block to the
+// slots the deleted lines came from. When a block spanning several slots,
+// such as a conflict and the context around it, is rewritten line for line,
+// each new line goes to the slot of the line it replaces, so editing context
+// does not pull a conflict's output into the neighbouring text. Lines beyond
+// the deleted ones go to the last deleted line's slot.
+func assignReplacedLines(assigned [][][]byte, deletedSlots []int, newLines [][]byte) {
+	for i, line := range newLines {
+		target := deletedSlots[min(i, len(deletedSlots)-1)]
+		assigned[target] = append(assigned[target], line)
+	}
+}
+
 func slotIndexAtCursor(lineToSlot []int, boundarySlotAtCursor map[int]int, cursor int) int {
 	if slot, ok := boundarySlotAtCursor[cursor]; ok {
 		return slot
@@ -580,26 +800,10 @@ type diffOp struct {
 	newLines [][]byte
 }
 
+// diffLines diffs newLines against oldLines on their longest common
+// subsequence. Within each changed run, deletions come before insertions.
 func diffLines(oldLines [][]byte, newLines [][]byte) []diffOp {
-	n := len(oldLines)
-	m := len(newLines)
-	dp := make([][]int, n+1)
-	for i := range dp {
-		dp[i] = make([]int, m+1)
-	}
-	for i := n - 1; i >= 0; i-- {
-		for j := m - 1; j >= 0; j-- {
-			if bytes.Equal(oldLines[i], newLines[j]) {
-				dp[i][j] = dp[i+1][j+1] + 1
-				continue
-			}
-			if dp[i+1][j] >= dp[i][j+1] {
-				dp[i][j] = dp[i+1][j]
-			} else {
-				dp[i][j] = dp[i][j+1]
-			}
-		}
-	}
+	match := markers.MatchLines(oldLines, newLines)
 
 	var ops []diffOp
 	appendOp := func(kind diffKind, oldLine []byte, newLine []byte) {
@@ -628,29 +832,20 @@ func diffLines(oldLines [][]byte, newLines [][]byte) []diffOp {
 		ops = append(ops, op)
 	}
 
-	i, j := 0, 0
-	for i < n && j < m {
-		if bytes.Equal(oldLines[i], newLines[j]) {
-			appendOp(diffEqual, oldLines[i], newLines[j])
-			i++
-			j++
+	j := 0
+	for i, line := range oldLines {
+		if match[i] < 0 {
+			appendOp(diffDelete, line, nil)
 			continue
 		}
-		if dp[i+1][j] >= dp[i][j+1] {
-			appendOp(diffDelete, oldLines[i], nil)
-			i++
-			continue
+		for ; j < match[i]; j++ {
+			appendOp(diffInsert, nil, newLines[j])
 		}
-		appendOp(diffInsert, nil, newLines[j])
+		appendOp(diffEqual, line, newLines[j])
 		j++
 	}
-	for i < n {
-		appendOp(diffDelete, oldLines[i], nil)
-		i++
-	}
-	for j < m {
+	for ; j < len(newLines); j++ {
 		appendOp(diffInsert, nil, newLines[j])
-		j++
 	}
 	return ops
 }
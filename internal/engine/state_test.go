@@ -153,6 +153,55 @@ line3
 	}
 }
 
+func TestCycleResolution(t *testing.T) {
+	doc, err := markers.Parse([]byte("a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nb\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+
+	want := []markers.Resolution{
+		markers.ResolutionOurs,
+		markers.ResolutionTheirs,
+		markers.ResolutionBoth,
+		markers.ResolutionNone,
+		markers.ResolutionUnset,
+		markers.ResolutionOurs,
+	}
+	for i, resolution := range want {
+		if err := state.CycleResolution(0); err != nil {
+			t.Fatalf("CycleResolution step %d failed: %v", i, err)
+		}
+		seg := state.doc.Segments[state.doc.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+		if seg.Resolution != resolution {
+			t.Fatalf("step %d resolution = %q, want %q", i, seg.Resolution, resolution)
+		}
+	}
+
+	if err := state.ImportMerged([]byte("a\nmanual\nb\n")); err != nil {
+		t.Fatalf("ImportMerged failed: %v", err)
+	}
+	if len(state.ManualResolved()) != 1 {
+		t.Fatalf("expected manual resolution before cycling")
+	}
+	if err := state.CycleResolution(0); err != nil {
+		t.Fatalf("CycleResolution failed: %v", err)
+	}
+	if len(state.ManualResolved()) != 0 {
+		t.Fatalf("expected cycling to clear manual resolution")
+	}
+	if got := string(state.RenderMerged()); got != "a\nours\nb\n" {
+		t.Fatalf("RenderMerged = %q, want ours", got)
+	}
+
+	if err := state.CycleResolution(1); err == nil {
+		t.Fatalf("expected out of bounds error")
+	}
+}
+
 func TestPreview(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -323,6 +372,58 @@ func TestImportMergedManualConflict(t *testing.T) {
 	}
 }
 
+func TestImportMergedRecognizesBothWithSeparator(t *testing.T) {
+	doc, err := markers.Parse([]byte("line1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nline2\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc.BothSeparator = "# ---"
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	if err := state.ApplyResolution(0, markers.ResolutionBoth); err != nil {
+		t.Fatalf("ApplyResolution failed: %v", err)
+	}
+	written := state.RenderMerged()
+	if string(written) != "line1\nours\n# ---\ntheirs\nline2\n" {
+		t.Fatalf("RenderMerged = %q, want the separator between the sides", written)
+	}
+
+	reloaded, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	if err := reloaded.ImportMerged(written); err != nil {
+		t.Fatalf("ImportMerged failed: %v", err)
+	}
+	seg := reloaded.Document().Segments[reloaded.Document().Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	if seg.Resolution != markers.ResolutionBoth || len(reloaded.ManualResolved()) != 0 {
+		t.Fatalf("resolution = %q, manual = %d, want both", seg.Resolution, len(reloaded.ManualResolved()))
+	}
+}
+
+func TestImportMergedKeepsSingleBOM(t *testing.T) {
+	input := []byte("\xef\xbb\xbfline1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nline2\n")
+	doc, err := markers.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	if err := state.ImportMerged([]byte("\xef\xbb\xbfline1\nmanual\nline2\n")); err != nil {
+		t.Fatalf("ImportMerged failed: %v", err)
+	}
+	if got := string(state.ManualResolved()[0]); got != "manual\n" {
+		t.Fatalf("manual[0] = %q, want %q", got, "manual\\n")
+	}
+	if got, want := string(state.RenderMerged()), "\xef\xbb\xbfline1\nmanual\nline2\n"; got != want {
+		t.Fatalf("RenderMerged = %q, want %q", got, want)
+	}
+}
+
 func TestPreviewDeterministic(t *testing.T) {
 	input := []byte(`line1
 <<<<<<< HEAD
@@ -364,6 +465,50 @@ line2
 	}
 }
 
+func TestPreviewWithRanges(t *testing.T) {
+	input := []byte("\xef\xbb\xbfa\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> branch\nb\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nc\n")
+	doc, err := markers.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+
+	if _, _, err := state.PreviewWithRanges(); err == nil {
+		t.Fatalf("PreviewWithRanges() error = nil, want unresolved error")
+	}
+
+	if err := state.ApplyResolution(0, markers.ResolutionBoth); err != nil {
+		t.Fatalf("ApplyResolution failed: %v", err)
+	}
+	if err := state.ApplyResolution(1, markers.ResolutionNone); err != nil {
+		t.Fatalf("ApplyResolution failed: %v", err)
+	}
+
+	out, ranges, err := state.PreviewWithRanges()
+	if err != nil {
+		t.Fatalf("PreviewWithRanges() error = %v", err)
+	}
+	preview, err := state.Preview()
+	if err != nil {
+		t.Fatalf("Preview() error = %v", err)
+	}
+	if !bytes.Equal(out, preview) {
+		t.Fatalf("PreviewWithRanges() output = %q, want Preview() %q", out, preview)
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("ranges len = %d, want 2", len(ranges))
+	}
+	if got := string(out[ranges[0].Start:ranges[0].End]); got != "ours1\ntheirs1\n" {
+		t.Fatalf("conflict 0 span = %q, want both sides", got)
+	}
+	if ranges[1].Start != ranges[1].End || string(out[ranges[1].Start:]) != "c\n" {
+		t.Fatalf("conflict 1 range = %+v, want empty range before \"c\"", ranges[1])
+	}
+}
+
 func TestDocument(t *testing.T) {
 	input := []byte(`line1
 <<<<<<< HEAD
@@ -457,6 +602,38 @@ func TestImportMergedPreservesLeadingBoundaryTextAfterResolve(t *testing.T) {
 	}
 }
 
+func TestImportMergedToleratesEditedContextLines(t *testing.T) {
+	input := []byte("top\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> one\nmiddle\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> two\nbottom\n")
+	doc, err := markers.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatalf("NewState failed: %v", err)
+	}
+	if err := state.ApplyAll(markers.ResolutionOurs); err != nil {
+		t.Fatalf("ApplyAll failed: %v", err)
+	}
+
+	// Context around both conflicts is edited along with the first conflict,
+	// so no segment can be located by exact matching.
+	merged := []byte("top edited\nours1 edited\nmiddle edited\nours2\nbottom edited\n")
+	if err := state.ImportMerged(merged); err != nil {
+		t.Fatalf("ImportMerged failed: %v", err)
+	}
+	if got := string(state.RenderMerged()); got != string(merged) {
+		t.Fatalf("RenderMerged = %q, want %q", got, merged)
+	}
+	manual := state.ManualResolved()
+	if got := string(manual[0]); got != "ours1 edited\n" {
+		t.Fatalf("conflict 0 manual = %q, want edited ours", got)
+	}
+	if _, ok := manual[1]; ok {
+		t.Fatalf("conflict 1 manual = %q, want it to stay resolved to ours", manual[1])
+	}
+}
+
 func TestImportMergedPreservesTextBetweenAdjacentConflictsAfterResolve(t *testing.T) {
 	input := []byte("<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> one\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> two\n")
 	doc, err := markers.Parse(input)
@@ -538,7 +715,7 @@ func TestClassifyConflictOutputTreatsSurvivingMarkersAsUnresolved(t *testing.T)
 		Theirs: []byte("theirs\n"),
 	}
 	output := []byte("before\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nafter\n")
-	res, unresolved, manual, _, _ := classifyConflictOutput(seg, output)
+	res, unresolved, manual, _, _ := classifyConflictOutput(seg, output, "")
 	if res != markers.ResolutionUnset {
 		t.Fatalf("resolution = %q, want Unset", res)
 	}
@@ -556,7 +733,7 @@ func TestClassifyConflictOutputMarkerFreeCustomTextIsManual(t *testing.T) {
 		Theirs: []byte("theirs\n"),
 	}
 	output := []byte("user typed a custom resolution here\n")
-	res, unresolved, manual, _, _ := classifyConflictOutput(seg, output)
+	res, unresolved, manual, _, _ := classifyConflictOutput(seg, output, "")
 	if res != markers.ResolutionUnset {
 		t.Fatalf("resolution = %q, want Unset", res)
 	}
@@ -597,3 +774,120 @@ func TestImportMergedRejectsReorderedSeparatedConflicts(t *testing.T) {
 		t.Fatalf("RenderMerged = %q, want original %q", got, string(input))
 	}
 }
+
+func TestClassifyConflictOutputRecognizesBothDedup(t *testing.T) {
+	seg := markers.ConflictSegment{
+		Ours:   []byte("shared\nours\n"),
+		Theirs: []byte("shared\ntheirs\n"),
+	}
+	output := []byte("shared\nours\ntheirs\n")
+	res, unresolved, manual, _, _ := classifyConflictOutput(seg, output, "")
+	if res != markers.ResolutionBothDedup {
+		t.Fatalf("resolution = %q, want both-dedup", res)
+	}
+	if unresolved || manual {
+		t.Fatalf("unresolved/manual = %v/%v, want false/false", unresolved, manual)
+	}
+}
+
+func TestWhitespaceOnlyConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		ours   string
+		theirs string
+		want   bool
+	}{
+		{"indentation", "\tfoo()\n", "    foo()\n", true},
+		{"trailing blanks", "foo() \n", "foo()\n", true},
+		{"line endings", "foo()\r\n", "foo()\n", true},
+		{"inner spacing", "a  = 1\n", "a = 1\n", true},
+		{"identical", "foo()\n", "foo()\n", false},
+		{"joined words", "a b\n", "ab\n", false},
+		{"extra line", "foo()\n\n", "foo()\n", false},
+		{"content", "foo()\n", "bar()\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := markers.Document{
+				Segments:  []markers.Segment{markers.ConflictSegment{Ours: []byte(tt.ours), Base: []byte("base\n"), Theirs: []byte(tt.theirs)}},
+				Conflicts: []markers.ConflictRef{{SegmentIndex: 0}},
+			}
+			state, err := NewState(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := state.IsWhitespaceOnly(0); got != tt.want {
+				t.Fatalf("IsWhitespaceOnly = %v, want %v", got, tt.want)
+			}
+			if got := len(state.WhitespaceOnlyConflicts()) == 1; got != tt.want {
+				t.Fatalf("WhitespaceOnlyConflicts = %v, want listed %v", state.WhitespaceOnlyConflicts(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResetResolution(t *testing.T) {
+	doc := markers.Document{
+		Segments:  []markers.Segment{markers.ConflictSegment{Ours: []byte("foo() \n"), Base: []byte("base\n"), Theirs: []byte("foo()\n")}},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 0}},
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.ApplyResolution(0, markers.ResolutionOurs); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.WhitespaceOnlyConflicts()) != 0 {
+		t.Fatalf("resolved conflict listed as whitespace-only: %v", state.WhitespaceOnlyConflicts())
+	}
+	out, err := state.Preview()
+	if err != nil || string(out) != "foo() \n" {
+		t.Fatalf("Preview = %q, %v; want ours bytes unchanged", out, err)
+	}
+	if err := state.ResetResolution(0); err != nil {
+		t.Fatal(err)
+	}
+	if !state.HasUnresolvedConflicts() || len(state.WhitespaceOnlyConflicts()) != 1 {
+		t.Fatalf("ResetResolution left the conflict resolved")
+	}
+}
+
+func TestSetManualResolution(t *testing.T) {
+	doc := markers.Document{
+		Segments:  []markers.Segment{markers.ConflictSegment{Ours: []byte("ours\n"), Base: []byte("base\n"), Theirs: []byte("theirs\n")}},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 0}},
+	}
+	state, err := NewState(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := state.StartManualFrom(0, markers.ResolutionBoth)
+	if err != nil || string(seed) != "ours\ntheirs\n" {
+		t.Fatalf("StartManualFrom = %q, %v; want both sides", seed, err)
+	}
+	if !state.HasUnresolvedConflicts() {
+		t.Fatalf("StartManualFrom resolved the conflict")
+	}
+
+	if err := state.SetManualResolution(0, append(seed, "extra\n"...)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := state.Preview()
+	if err != nil || string(out) != "ours\ntheirs\nextra\n" {
+		t.Fatalf("Preview = %q, %v", out, err)
+	}
+	if _, ok := state.ManualResolved()[0]; !ok {
+		t.Fatalf("edited conflict not reported as manual")
+	}
+
+	if err := state.SetManualResolution(0, []byte("theirs\n")); err != nil {
+		t.Fatal(err)
+	}
+	if doc := state.Document(); doc.Segments[0].(markers.ConflictSegment).Resolution != markers.ResolutionTheirs {
+		t.Fatalf("text equal to theirs not classified as theirs")
+	}
+	if _, err := state.StartManualFrom(1, markers.ResolutionOurs); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// WordDiffPatch formats the change from oldData to newData like
+// `git diff --word-diff=plain`. Hunks are found line by line as in
+// UnifiedPatch; inside each hunk removed words are shown as [-...-] and added
+// words as {+...+}. It returns nil when the inputs are identical.
+func WordDiffPatch(path string, oldData []byte, newData []byte) []byte {
+	if bytes.Equal(oldData, newData) {
+		return nil
+	}
+
+	lines := flattenPatchLines(diffLines(markers.SplitLinesKeepEOL(oldData), markers.SplitLinesKeepEOL(newData)))
+
+	label := patchLabel(path)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- a/%s\n", label)
+	fmt.Fprintf(&out, "+++ b/%s\n", label)
+
+	for _, hunk := range patchHunks(lines) {
+		writeHunkHeader(&out, hunk)
+		writeWordDiffHunk(&out, hunk)
+	}
+
+	return out.Bytes()
+}
+
+func writeWordDiffHunk(out *bytes.Buffer, lines []patchLine) {
+	var oldText, newText []byte
+	for _, line := range lines {
+		if line.kind != diffInsert {
+			oldText = append(oldText, line.text...)
+		}
+		if line.kind != diffDelete {
+			newText = append(newText, line.text...)
+		}
+	}
+
+	var body bytes.Buffer
+	for _, op := range diffLines(splitWords(oldText), splitWords(newText)) {
+		switch op.kind {
+		case diffEqual:
+			body.Write(bytes.Join(op.oldLines, nil))
+		case diffDelete:
+			writeWordRun(&body, op.oldLines, "[-", "-]")
+		case diffInsert:
+			writeWordRun(&body, op.newLines, "{+", "+}")
+		}
+	}
+	if body.Len() > 0 && !bytes.HasSuffix(body.Bytes(), []byte("\n")) {
+		body.WriteByte('\n')
+	}
+	out.Write(body.Bytes())
+}
+
+// writeWordRun wraps a run of changed tokens in open/close markers. Like git,
+// a run spanning lines is marked separately on each line so that line endings
+// stay outside the markers.
+func writeWordRun(out *bytes.Buffer, tokens [][]byte, open string, close string) {
+	pieces := bytes.Split(bytes.Join(tokens, nil), []byte("\n"))
+	for i, piece := range pieces {
+		eol := ""
+		if i < len(pieces)-1 {
+			eol = "\n"
+			if bytes.HasSuffix(piece, []byte("\r")) {
+				piece = piece[:len(piece)-1]
+				eol = "\r\n"
+			}
+		}
+		if len(piece) > 0 {
+			out.WriteString(open)
+			out.Write(piece)
+			out.WriteString(close)
+		}
+		out.WriteString(eol)
+	}
+}
+
+// splitWords tokenizes text into words, runs of blanks, and line endings so
+// that concatenating the tokens reproduces text exactly.
+func splitWords(text []byte) [][]byte {
+	var tokens [][]byte
+	for start := 0; start < len(text); {
+		class := wordClass(text[start])
+		end := start + 1
+		if class != wordClassNewline {
+			for end < len(text) && wordClass(text[end]) == class {
+				end++
+			}
+		}
+		tokens = append(tokens, text[start:end])
+		start = end
+	}
+	return tokens
+}
+
+const (
+	wordClassWord = iota
+	wordClassBlank
+	wordClassNewline
+)
+
+func wordClass(b byte) int {
+	switch b {
+	case '\n':
+		return wordClassNewline
+	case ' ', '\t', '\r':
+		return wordClassBlank
+	default:
+		return wordClassWord
+	}
+}
@@ -0,0 +1,33 @@
+package engine
+
+import "testing"
+
+func TestWordDiffPatchMarksChangedWords(t *testing.T) {
+	base := []byte("intro\nreturn a + b\nkeep this line\nend\n")
+	result := []byte("intro\nreturn a * c\nkeep this line\nend\n")
+
+	got := string(WordDiffPatch("calc.go", base, result))
+	want := `--- a/calc.go
++++ b/calc.go
+@@ -1,4 +1,4 @@
+intro
+return a [-+-]{+*+} [-b-]{+c+}
+keep this line
+end
+`
+	if got != want {
+		t.Fatalf("WordDiffPatch mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWordDiffPatchMarksEachLineOfMultiLineRun(t *testing.T) {
+	got := string(WordDiffPatch("f", []byte("a\r\n"), []byte("a\r\nnew words\r\nmore\r\n")))
+	want := "--- a/f\n+++ b/f\n@@ -1 +1,3 @@\na\r\n{+new words+}\r\n{+more+}\r\n"
+	if got != want {
+		t.Fatalf("WordDiffPatch = %q, want %q", got, want)
+	}
+
+	if patch := WordDiffPatch("f", []byte("same\n"), []byte("same\n")); patch != nil {
+		t.Fatalf("WordDiffPatch identical = %q, want nil", patch)
+	}
+}
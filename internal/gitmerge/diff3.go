@@ -0,0 +1,145 @@
+package gitmerge
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+// Diff3 is a pure-Go three-way merge producing the same view as
+// `git merge-file --diff3 -p`: changes made by one side, or identically by
+// both, merge cleanly, and every other overlapping change becomes a conflict
+// block with a base section. Conflict markers carry the given labels.
+func Diff3(local, base, remote []byte, localLabel, baseLabel, remoteLabel string) []byte {
+	baseLines := markers.SplitLinesKeepEOL(base)
+	localLines := markers.SplitLinesKeepEOL(local)
+	remoteLines := markers.SplitLinesKeepEOL(remote)
+
+	localMatch := markers.MatchLines(baseLines, localLines)
+	remoteMatch := markers.MatchLines(baseLines, remoteLines)
+
+	w := diff3Writer{
+		eol:         markerLineEnding(localLines, baseLines),
+		localLabel:  localLabel,
+		baseLabel:   baseLabel,
+		remoteLabel: remoteLabel,
+	}
+
+	o, a, b := 0, 0, 0
+	for {
+		// The next base line both sides kept unchanged ends the current chunk.
+		next := o
+		for next < len(baseLines) && (localMatch[next] < 0 || remoteMatch[next] < 0) {
+			next++
+		}
+		aEnd, bEnd := len(localLines), len(remoteLines)
+		if next < len(baseLines) {
+			aEnd, bEnd = localMatch[next], remoteMatch[next]
+		}
+		w.writeChunk(baseLines[o:next], localLines[a:aEnd], remoteLines[b:bEnd])
+		if next >= len(baseLines) {
+			break
+		}
+		w.out.Write(baseLines[next])
+		o, a, b = next+1, aEnd+1, bEnd+1
+	}
+	return w.out.Bytes()
+}
+
+// mergeFilesDiff3 runs Diff3 on the given files, labelling the markers with
+// their paths as git merge-file does.
+func mergeFilesDiff3(localPath, basePath, remotePath string) ([]byte, error) {
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("read local: %w", err)
+	}
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("read base: %w", err)
+	}
+	remote, err := os.ReadFile(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("read remote: %w", err)
+	}
+	return Diff3(local, base, remote, localPath, basePath, remotePath), nil
+}
+
+type diff3Writer struct {
+	out         bytes.Buffer
+	eol         string
+	localLabel  string
+	baseLabel   string
+	remoteLabel string
+}
+
+func (w *diff3Writer) writeChunk(base, local, remote [][]byte) {
+	localChanged := !equalLines(base, local)
+	remoteChanged := !equalLines(base, remote)
+	switch {
+	case !remoteChanged:
+		writeLines(&w.out, local)
+	case !localChanged || equalLines(local, remote):
+		writeLines(&w.out, remote)
+	default:
+		w.writeMarker("<<<<<<<", w.localLabel)
+		w.writeSection(local)
+		w.writeMarker("|||||||", w.baseLabel)
+		w.writeSection(base)
+		w.writeMarker("=======", "")
+		w.writeSection(remote)
+		w.writeMarker(">>>>>>>", w.remoteLabel)
+	}
+}
+
+func (w *diff3Writer) writeMarker(marker string, label string) {
+	w.out.WriteString(marker)
+	if label != "" {
+		w.out.WriteByte(' ')
+		w.out.WriteString(label)
+	}
+	w.out.WriteString(w.eol)
+}
+
+// writeSection writes the lines of one conflict side. Like git, a side whose
+// last line has no newline gets one so the next marker starts its own line.
+func (w *diff3Writer) writeSection(lines [][]byte) {
+	writeLines(&w.out, lines)
+	if len(lines) > 0 && !bytes.HasSuffix(lines[len(lines)-1], []byte("\n")) {
+		w.out.WriteString(w.eol)
+	}
+}
+
+func writeLines(out *bytes.Buffer, lines [][]byte) {
+	for _, line := range lines {
+		out.Write(line)
+	}
+}
+
+func equalLines(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// markerLineEnding returns "\r\n" when the files use CRLF so the markers
+// match the surrounding content.
+func markerLineEnding(sides ...[][]byte) string {
+	for _, lines := range sides {
+		if len(lines) == 0 {
+			continue
+		}
+		if bytes.HasSuffix(lines[0], []byte("\r\n")) {
+			return "\r\n"
+		}
+		return "\n"
+	}
+	return "\n"
+}
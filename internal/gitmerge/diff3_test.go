@@ -0,0 +1,108 @@
+package gitmerge
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/chojs23/ec/internal/markers"
+)
+
+var diff3Cases = []struct {
+	name      string
+	base      string
+	local     string
+	remote    string
+	conflicts int
+}{
+	{name: "identical", base: "line\n", local: "line\n", remote: "line\n"},
+	{name: "local only", base: "a\nb\nc\n", local: "a\nB\nc\n", remote: "a\nb\nc\n"},
+	{name: "remote only", base: "a\nb\nc\n", local: "a\nb\nc\n", remote: "a\nb\nC\n"},
+	{name: "same change", base: "a\nb\nc\n", local: "a\nX\nc\n", remote: "a\nX\nc\n"},
+	{name: "separate changes", base: "a\nb\nc\nd\ne\n", local: "A\nb\nc\nd\ne\n", remote: "a\nb\nc\nd\nE\n"},
+	{name: "append conflict", base: "line\n", local: "line\nlocal\n", remote: "line\nremote\n", conflicts: 1},
+	{name: "modify conflict", base: "a\nb\nc\n", local: "a\nlocal\nc\n", remote: "a\nremote\nc\n", conflicts: 1},
+	{name: "delete vs modify", base: "a\nb\nc\n", local: "a\nc\n", remote: "a\nB\nc\n", conflicts: 1},
+	{name: "adjacent changes", base: "a\nb\nc\nd\n", local: "a\nB\nc\nd\n", remote: "a\nb\nC\nd\n", conflicts: 1},
+	{name: "two conflicts", base: "1\n2\n3\n4\n5\n", local: "L1\n2\n3\n4\nL5\n", remote: "R1\n2\n3\n4\nR5\n", conflicts: 2},
+	{name: "empty base", base: "", local: "local\n", remote: "remote\n", conflicts: 1},
+	{name: "no final newline", base: "a\nb", local: "a\nlocal", remote: "a\nremote", conflicts: 1},
+	{name: "crlf", base: "a\r\nb\r\n", local: "a\r\nlocal\r\n", remote: "a\r\nremote\r\n", conflicts: 1},
+}
+
+func TestDiff3ParsesWithBaseSections(t *testing.T) {
+	for _, tc := range diff3Cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Diff3([]byte(tc.local), []byte(tc.base), []byte(tc.remote), "local", "base", "remote")
+			doc, err := markers.Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(Diff3 output) error: %v\n%s", err, got)
+			}
+			if len(doc.Conflicts) != tc.conflicts {
+				t.Fatalf("conflicts = %d, want %d\n%s", len(doc.Conflicts), tc.conflicts, got)
+			}
+			for _, ref := range doc.Conflicts {
+				seg := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+				if seg.BaseLabel != "base" {
+					t.Fatalf("BaseLabel = %q, want base", seg.BaseLabel)
+				}
+			}
+		})
+	}
+}
+
+func TestDiff3MatchesGitMergeFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	for _, tc := range diff3Cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			localPath := filepath.Join(tmpDir, "local.txt")
+			basePath := filepath.Join(tmpDir, "base.txt")
+			remotePath := filepath.Join(tmpDir, "remote.txt")
+			for path, content := range map[string]string{localPath: tc.local, basePath: tc.base, remotePath: tc.remote} {
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := MergeFileDiff3(context.Background(), localPath, basePath, remotePath)
+			if err != nil {
+				t.Fatalf("MergeFileDiff3 error: %v", err)
+			}
+			got, err := mergeFilesDiff3(localPath, basePath, remotePath)
+			if err != nil {
+				t.Fatalf("mergeFilesDiff3 error: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("Diff3 output differs from git merge-file\ngot:\n%q\nwant:\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeFileDiff3FallsBackWithoutGit(t *testing.T) {
+	tmpDir := t.TempDir()
+	localPath := filepath.Join(tmpDir, "local.txt")
+	basePath := filepath.Join(tmpDir, "base.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	for path, content := range map[string]string{localPath: "line\nlocal\n", basePath: "line\n", remotePath: "line\nremote\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	got, err := MergeFileDiff3(context.Background(), localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 error: %v", err)
+	}
+	want := "line\n<<<<<<< " + localPath + "\nlocal\n||||||| " + basePath + "\n=======\nremote\n>>>>>>> " + remotePath + "\n"
+	if string(got) != want {
+		t.Fatalf("MergeFileDiff3 without git = %q, want %q", got, want)
+	}
+}
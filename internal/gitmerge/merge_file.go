@@ -1,11 +1,23 @@
 package gitmerge
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chojs23/ec/internal/gitutil"
+)
+
+// Conflict styles accepted by MergeFile.
+const (
+	StyleDiff3 = "diff3"
+	// StyleZdiff3 also moves lines that ours and theirs share at the edges
+	// of a conflict out of it. It needs git 2.35 or newer.
+	StyleZdiff3 = "zdiff3"
 )
 
 // MergeFileDiff3 runs git's canonical three-way merge and returns a diff3-style
@@ -13,29 +25,98 @@ import (
 //
 // Exit code 0 means clean merge. Any positive exit code indicates the number of
 // conflicts found (truncated to 127 if >127). Negative exit codes indicate errors.
+//
+// When git is not installed the merge is computed in process by Diff3.
 func MergeFileDiff3(ctx context.Context, localPath, basePath, remotePath string) ([]byte, error) {
-	cmd := exec.CommandContext(ctx, "git", "merge-file", "--diff3", "-p", localPath, basePath, remotePath)
+	return MergeFile(ctx, StyleDiff3, localPath, basePath, remotePath)
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// MergeFile is MergeFileDiff3 with a choice of conflict style. StyleZdiff3
+// falls back to StyleDiff3 when the installed git is too old for it or git
+// is missing.
+func MergeFile(ctx context.Context, style string, localPath, basePath, remotePath string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("git merge-file: %w", err)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return mergeFilesDiff3(localPath, basePath, remotePath)
+	}
 
-	err := cmd.Run()
+	styleFlag := "--diff3"
+	if style == StyleZdiff3 && supportsZdiff3(ctx) {
+		styleFlag = "--zdiff3"
+	}
+	stdout, err := gitutil.RunGit(ctx, "", "merge-file", styleFlag, "-p", localPath, basePath, remotePath)
 	if err == nil {
-		return stdout.Bytes(), nil
+		return stdout, nil
 	}
 
+	// A canceled run kills git, which would otherwise read as a failure.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("git merge-file: %w", ctxErr)
+	}
+	msg := err.Error()
 	var ee *exec.ExitError
 	if errors.As(err, &ee) {
 		code := ee.ExitCode()
 		if code > 0 {
-			return stdout.Bytes(), nil
+			return stdout, nil
 		}
+		if len(ee.Stderr) > 0 {
+			msg = string(ee.Stderr)
+		}
+	}
+	return nil, fmt.Errorf("git merge-file failed: %s", msg)
+}
+
+// gitVersion returns the output of `git --version`; tests replace it.
+var gitVersion = func(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "--version").Output()
+	if err != nil {
+		return "", err
 	}
+	return string(out), nil
+}
+
+// The installed git does not change during a run, so its version is asked
+// once; tests that replace gitVersion reset zdiff3Once.
+var (
+	zdiff3Once      sync.Once
+	zdiff3Supported bool
+)
+
+// supportsZdiff3 reports whether the installed git understands --zdiff3.
+func supportsZdiff3(ctx context.Context) bool {
+	zdiff3Once.Do(func() {
+		// A canceled run must not leave zdiff3 off for the rest of it.
+		version, err := gitVersion(context.WithoutCancel(ctx))
+		if err != nil {
+			return
+		}
+		major, minor, ok := parseGitVersion(version)
+		zdiff3Supported = ok && (major > 2 || major == 2 && minor >= 35)
+	})
+	return zdiff3Supported
+}
 
-	msg := stderr.String()
-	if msg == "" {
-		msg = err.Error()
+// parseGitVersion extracts the major and minor numbers from `git --version`
+// output such as "git version 2.39.5" or "git version 2.37.1 (Apple Git-137.1)".
+func parseGitVersion(output string) (int, int, bool) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return 0, 0, false
 	}
-	return nil, fmt.Errorf("git merge-file failed: %s", msg)
+	parts := strings.SplitN(fields[2], ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
 }
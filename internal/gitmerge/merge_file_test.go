@@ -3,9 +3,11 @@ package gitmerge
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -39,6 +41,23 @@ func TestMergeFileDiff3Clean(t *testing.T) {
 	}
 }
 
+func TestMergeFileDiff3Canceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := make([]string, 3)
+	for i, name := range []string{"local.txt", "base.txt", "remote.txt"} {
+		paths[i] = filepath.Join(tmpDir, name)
+		if err := os.WriteFile(paths[i], []byte("line\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MergeFileDiff3(ctx, paths[0], paths[1], paths[2]); !errors.Is(err, context.Canceled) {
+		t.Fatalf("MergeFileDiff3 error = %v, want context.Canceled", err)
+	}
+}
+
 func TestMergeFileDiff3Conflict(t *testing.T) {
 	if _, err := exec.LookPath("git"); err != nil {
 		t.Skip("git not found in PATH")
@@ -67,3 +86,109 @@ func TestMergeFileDiff3Conflict(t *testing.T) {
 		t.Fatalf("expected conflict markers in output")
 	}
 }
+
+func TestParseGitVersion(t *testing.T) {
+	tests := []struct {
+		output       string
+		major, minor int
+		ok           bool
+	}{
+		{"git version 2.39.5\n", 2, 39, true},
+		{"git version 2.37.1 (Apple Git-137.1)", 2, 37, true},
+		{"git version 2.35.0.windows.1", 2, 35, true},
+		{"not git", 0, 0, false},
+		{"git version x.y", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseGitVersion(tt.output)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseGitVersion(%q) = %d, %d, %v; want %d, %d, %v", tt.output, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func writeSharedEdgeStages(t *testing.T) (string, string, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	for path, content := range map[string]string{
+		basePath:   "a\nb\n",
+		localPath:  "a\nshared\nlocal\nb\n",
+		remotePath: "a\nshared\nremote\nb\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return localPath, basePath, remotePath
+}
+
+func TestMergeFileZdiff3MovesSharedLinesOut(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+	if !supportsZdiff3(context.Background()) {
+		t.Skip("git does not support --zdiff3")
+	}
+	localPath, basePath, remotePath := writeSharedEdgeStages(t)
+
+	got, err := MergeFile(context.Background(), StyleZdiff3, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFile error: %v", err)
+	}
+	if !bytes.HasPrefix(got, []byte("a\nshared\n<<<<<<< ")) {
+		t.Fatalf("zdiff3 output = %q, want shared line before the conflict", got)
+	}
+}
+
+func TestMergeFileZdiff3FallsBackOnOldGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+	withGitVersion(t, func(context.Context) (string, error) { return "git version 2.30.2\n", nil })
+	localPath, basePath, remotePath := writeSharedEdgeStages(t)
+
+	got, err := MergeFile(context.Background(), StyleZdiff3, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFile error: %v", err)
+	}
+	want, err := MergeFileDiff3(context.Background(), localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("fallback output = %q, want diff3 output %q", got, want)
+	}
+}
+
+func TestSupportsZdiff3AsksGitOnce(t *testing.T) {
+	calls := 0
+	withGitVersion(t, func(context.Context) (string, error) {
+		calls++
+		return "git version 2.39.5\n", nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if !supportsZdiff3(context.Background()) {
+			t.Fatalf("supportsZdiff3 = false, want true for git 2.39")
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("gitVersion called %d times, want 1", calls)
+	}
+}
+
+// withGitVersion replaces gitVersion for the test and clears the cached
+// zdiff3 support before and after it.
+func withGitVersion(t *testing.T, fn func(context.Context) (string, error)) {
+	t.Helper()
+	old := gitVersion
+	gitVersion = fn
+	zdiff3Once, zdiff3Supported = sync.Once{}, false
+	t.Cleanup(func() {
+		gitVersion = old
+		zdiff3Once, zdiff3Supported = sync.Once{}, false
+	})
+}
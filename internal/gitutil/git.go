@@ -3,24 +3,182 @@ package gitutil
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// RepoRoot returns the repository root directory for the given working directory.
+// GitlinkMode is the index mode git records for a submodule entry.
+const GitlinkMode = "160000"
+
+// RepoRoot returns the root of the work tree the given working directory
+// belongs to; for a linked worktree that is the worktree, not the main
+// checkout, so stage reads use the worktree's own index. $GIT_DIR and
+// $GIT_WORK_TREE are honored the way git honors them.
 func RepoRoot(ctx context.Context, cwd string) (string, error) {
-	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel")
-	cmd.Dir = cwd
-	output, err := cmd.Output()
+	output, err := RunGit(ctx, cwd, "rev-parse", "--show-toplevel")
+	if err == nil {
+		if root := strings.TrimSpace(string(output)); root != "" {
+			// Some git versions answer with the main checkout from inside a
+			// linked worktree; the work tree the git directory names wins.
+			if named, namedErr := namedWorkTree(ctx, cwd); namedErr == nil && named != "" && !sameDir(named, root) {
+				return named, nil
+			}
+			return root, nil
+		}
+	}
+	// --show-toplevel fails inside a git directory, e.g. when a hook runs
+	// in .git or .git/worktrees/<name>; the work tree can still be found
+	// from the git directory itself.
+	if root, gitDirErr := workTreeFromGitDir(ctx, cwd); gitDirErr == nil {
+		return root, nil
+	}
 	if err != nil {
 		return "", fmt.Errorf("git rev-parse --show-toplevel failed: %w", err)
 	}
-	root := strings.TrimSpace(string(output))
-	if root == "" {
-		return "", fmt.Errorf("git rev-parse returned empty repo root")
+	return "", fmt.Errorf("git rev-parse returned empty repo root")
+}
+
+// workTreeFromGitDir derives the work tree root from the git directory of
+// cwd: the one it names (see namedWorkTree), or else, for a main checkout,
+// the directory holding its .git directory.
+func workTreeFromGitDir(ctx context.Context, cwd string) (string, error) {
+	gitDir, _, err := gitDirs(ctx, cwd)
+	if err != nil {
+		return "", err
+	}
+	named, err := namedWorkTree(ctx, cwd)
+	if err != nil {
+		return "", err
+	}
+	if named != "" {
+		return named, nil
+	}
+	if filepath.Base(gitDir) != ".git" {
+		return "", fmt.Errorf("%s has no work tree", gitDir)
+	}
+	return filepath.Dir(gitDir), nil
+}
+
+// namedWorkTree returns the work tree the git directory of cwd names, or ""
+// when it names none. A linked worktree's git directory differs from the
+// common one and names its work tree in a gitdir file; a main checkout may
+// set core.worktree, which $GIT_WORK_TREE overrides.
+func namedWorkTree(ctx context.Context, cwd string) (string, error) {
+	gitDir, commonDir, err := gitDirs(ctx, cwd)
+	if err != nil {
+		return "", err
+	}
+	if gitDir != commonDir {
+		data, err := os.ReadFile(filepath.Join(gitDir, "gitdir"))
+		if err != nil {
+			return "", fmt.Errorf("read worktree gitdir: %w", err)
+		}
+		return filepath.Dir(strings.TrimSpace(string(data))), nil
+	}
+	if os.Getenv("GIT_WORK_TREE") != "" {
+		return "", nil
+	}
+	// git config exits 1 when the key is not set.
+	output, err := RunGit(ctx, cwd, "config", "--get", "core.worktree")
+	workTree := strings.TrimSpace(string(output))
+	if err != nil || workTree == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(workTree) {
+		workTree = filepath.Join(gitDir, workTree)
+	}
+	return filepath.Clean(workTree), nil
+}
+
+// gitDirs returns the absolute git directory of cwd and the common git
+// directory it shares with the other worktrees.
+func gitDirs(ctx context.Context, cwd string) (string, string, error) {
+	output, err := RunGit(ctx, cwd, "rev-parse", "--absolute-git-dir", "--git-common-dir")
+	if err != nil {
+		return "", "", fmt.Errorf("git rev-parse --absolute-git-dir failed: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected git rev-parse output %q", output)
+	}
+	gitDir := filepath.Clean(lines[0])
+	commonDir := lines[1]
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(cwd, commonDir)
+	}
+	return gitDir, filepath.Clean(commonDir), nil
+}
+
+// sameDir reports whether a and b name the same directory once symlinks are
+// resolved; git prints the real path, a gitdir file may not.
+func sameDir(a, b string) bool {
+	if realA, err := filepath.EvalSymlinks(a); err == nil {
+		a = realA
+	}
+	if realB, err := filepath.EvalSymlinks(b); err == nil {
+		b = realB
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// MaxAttempts is how many times RunGit runs a command that keeps failing
+// because another git process holds a lock file.
+var MaxAttempts = 3
+
+// retryBackoff is the pause before the second attempt; each further attempt
+// waits one more multiple of it.
+var retryBackoff = 100 * time.Millisecond
+
+// RunGit runs git with args in dir and returns its standard output. When git
+// fails because a lock file such as index.lock is held, which happens when
+// another git process runs at the same time, the command is retried up to
+// MaxAttempts times with a short, growing pause. Any other failure returns
+// at once. Output is returned together with the error, so callers that treat
+// some exit codes as success can still use it.
+func RunGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return runGitEnv(ctx, dir, nil, args...)
+}
+
+// runGitEnv is RunGit with env added to git's environment.
+func runGitEnv(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		output, err := cmd.Output()
+		if err != nil && ctx.Err() != nil {
+			// git was killed because the run was canceled or timed out.
+			return output, fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		if err == nil || attempt >= MaxAttempts || !isLockContention(err) {
+			return output, err
+		}
+		select {
+		case <-ctx.Done():
+			return output, err
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
 	}
-	return root, nil
+}
+
+// isLockContention reports whether err is git failing to take a lock file,
+// e.g. "fatal: Unable to create '/repo/.git/index.lock': File exists.".
+func isLockContention(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	stderr := string(exitErr.Stderr)
+	return strings.Contains(stderr, "Unable to create '") && strings.Contains(stderr, ".lock'")
 }
 
 // ListUnmergedFiles returns repo-relative paths of conflicted files under scopePathspec.
@@ -30,9 +188,7 @@ func ListUnmergedFiles(ctx context.Context, repoRoot string, scopePathspec strin
 		pathspec = "."
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "diff", "--name-only", "--diff-filter=U", "--", pathspec)
-	cmd.Dir = repoRoot
-	output, err := cmd.Output()
+	output, err := RunGit(ctx, repoRoot, "diff", "--name-only", "--diff-filter=U", "--", pathspec)
 	if err != nil {
 		return nil, fmt.Errorf("git diff --name-only --diff-filter=U failed: %w", err)
 	}
@@ -56,11 +212,193 @@ func ListUnmergedFiles(ctx context.Context, repoRoot string, scopePathspec strin
 // ShowStage reads a conflicted file content from the git index stage (1=base, 2=ours, 3=theirs).
 func ShowStage(ctx context.Context, repoRoot string, stage int, path string) ([]byte, error) {
 	ref := fmt.Sprintf(":%d:%s", stage, path)
-	cmd := exec.CommandContext(ctx, "git", "show", ref)
-	cmd.Dir = repoRoot
-	output, err := cmd.Output()
+	output, err := RunGit(ctx, repoRoot, "show", ref)
 	if err != nil {
 		return nil, fmt.Errorf("git show %s failed: %w", ref, err)
 	}
 	return output, nil
 }
+
+// StageCache remembers the index stages read through it, so an operation
+// that needs the same stage more than once runs git show once. Resolving a
+// file changes the index, so a cache should only live as long as one
+// operation, such as picking a file and preparing it. A nil *StageCache
+// reads every stage from git.
+type StageCache struct {
+	mu      sync.Mutex
+	entries map[stageKey]stageEntry
+}
+
+type stageKey struct {
+	repoRoot string
+	stage    int
+	path     string
+}
+
+type stageEntry struct {
+	data []byte
+	err  error
+}
+
+func NewStageCache() *StageCache {
+	return &StageCache{entries: make(map[stageKey]stageEntry)}
+}
+
+// ShowStage is gitutil.ShowStage, answered from the cache when the stage
+// was read before. A missing stage is remembered too; a read cut short by
+// ctx is not.
+func (c *StageCache) ShowStage(ctx context.Context, repoRoot string, stage int, path string) ([]byte, error) {
+	if c == nil {
+		return ShowStage(ctx, repoRoot, stage, path)
+	}
+	key := stageKey{repoRoot: repoRoot, stage: stage, path: path}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return entry.data, entry.err
+	}
+
+	data, err := ShowStage(ctx, repoRoot, stage, path)
+	if ctx.Err() == nil {
+		c.mu.Lock()
+		c.entries[key] = stageEntry{data: data, err: err}
+		c.mu.Unlock()
+	}
+	return data, err
+}
+
+// ShowRevFile reads path as recorded in rev (for example a commit hash or branch name).
+func ShowRevFile(ctx context.Context, repoRoot string, rev string, path string) ([]byte, error) {
+	ref := fmt.Sprintf("%s:%s", rev, path)
+	output, err := RunGit(ctx, repoRoot, "show", ref)
+	if err != nil {
+		return nil, fmt.Errorf("git show %s failed: %w", ref, err)
+	}
+	return output, nil
+}
+
+// UnmergedStageModes returns the index mode of each conflict stage
+// (1=base, 2=ours, 3=theirs) recorded for path. Stages missing from the index
+// are absent from the map.
+func UnmergedStageModes(ctx context.Context, repoRoot string, path string) (map[int]string, error) {
+	output, err := RunGit(ctx, repoRoot, "ls-files", "--unmerged", "-z", "--", path)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files --unmerged %s failed: %w", path, err)
+	}
+
+	modes := make(map[int]string)
+	for _, line := range strings.Split(string(output), "\x00") {
+		// <mode> SP <object> SP <stage> TAB <path>
+		info, entryPath, ok := strings.Cut(line, "\t")
+		if !ok || entryPath != path {
+			continue
+		}
+		fields := strings.Fields(info)
+		if len(fields) != 3 {
+			continue
+		}
+		stage, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		modes[stage] = fields[0]
+	}
+	return modes, nil
+}
+
+// HeadCommit returns the full hash of HEAD.
+func HeadCommit(ctx context.Context, repoRoot string) (string, error) {
+	output, err := RunGit(ctx, repoRoot, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse HEAD failed: %s", commandError(output, err))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// FirstCommitAfter returns the first commit on HEAD's first-parent chain after
+// base: the commit a continued merge, cherry-pick, revert or rebase made for
+// the resolved stop, even when further picks ran on top of it.
+func FirstCommitAfter(ctx context.Context, repoRoot string, base string) (string, error) {
+	output, err := RunGit(ctx, repoRoot, "rev-list", "--first-parent", "--reverse", base+"..HEAD")
+	if err != nil {
+		return "", fmt.Errorf("git rev-list %s..HEAD failed: %s", base, commandError(output, err))
+	}
+	commit, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if commit == "" {
+		return "", fmt.Errorf("no commit was made after %s", base)
+	}
+	return commit, nil
+}
+
+// AddNote attaches message as a git note on ref (for example a commit hash),
+// replacing any note the commit already has.
+func AddNote(ctx context.Context, repoRoot string, ref string, message string) error {
+	if output, err := RunGit(ctx, repoRoot, "notes", "add", "-f", "-m", message, ref); err != nil {
+		return fmt.Errorf("git notes add %s failed: %s", ref, commandError(output, err))
+	}
+	return nil
+}
+
+// AddPath stages path, which marks a conflicted file as resolved.
+func AddPath(ctx context.Context, repoRoot string, path string) error {
+	if output, err := RunGit(ctx, repoRoot, "add", "--", path); err != nil {
+		return fmt.Errorf("git add %s failed: %s", path, commandError(output, err))
+	}
+	return nil
+}
+
+// OperationInProgress reports which git command is stopped on conflicts:
+// "merge", "rebase", "cherry-pick", "revert" or "am". It returns "" when
+// none is.
+func OperationInProgress(ctx context.Context, repoRoot string) (string, error) {
+	output, err := RunGit(ctx, repoRoot, "rev-parse", "--git-dir")
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse --git-dir failed: %s", commandError(output, err))
+	}
+	gitDir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoRoot, gitDir)
+	}
+
+	// rebase-apply is shared by git am and the apply rebase backend.
+	markers := []struct {
+		path      string
+		operation string
+	}{
+		{path: "rebase-merge", operation: "rebase"},
+		{path: filepath.Join("rebase-apply", "applying"), operation: "am"},
+		{path: "rebase-apply", operation: "rebase"},
+		{path: "MERGE_HEAD", operation: "merge"},
+		{path: "CHERRY_PICK_HEAD", operation: "cherry-pick"},
+		{path: "REVERT_HEAD", operation: "revert"},
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.path)); err == nil {
+			return marker.operation, nil
+		}
+	}
+	return "", nil
+}
+
+// ContinueOperation runs git <operation> --continue. The commit message
+// editor is skipped so the prepared message is used as is.
+func ContinueOperation(ctx context.Context, repoRoot string, operation string) error {
+	if output, err := runGitEnv(ctx, repoRoot, []string{"GIT_EDITOR=true"}, operation, "--continue"); err != nil {
+		return fmt.Errorf("git %s --continue failed: %s", operation, commandError(output, err))
+	}
+	return nil
+}
+
+// commandError prefers git's own output, stdout and then stderr, over the
+// bare exit status.
+func commandError(output []byte, err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		output = append(append([]byte{}, output...), exitErr.Stderr...)
+	}
+	if msg := strings.TrimSpace(string(output)); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
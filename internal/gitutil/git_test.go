@@ -2,10 +2,12 @@ package gitutil
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRepoRootSuccess(t *testing.T) {
@@ -37,6 +39,119 @@ func TestRepoRootFailure(t *testing.T) {
 	}
 }
 
+func TestRepoRootFromLinkedWorktreeGitDir(t *testing.T) {
+	mainGitDir := filepath.Join(t.TempDir(), "main", ".git")
+	worktreeGitDir := filepath.Join(mainGitDir, "worktrees", "feature")
+	worktreeRoot := filepath.Join(t.TempDir(), "feature")
+	if err := os.MkdirAll(worktreeGitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(worktreeGitDir, "gitdir"), []byte(filepath.Join(worktreeRoot, ".git")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		gitDir    string
+		commonDir string
+		want      string
+	}{
+		{"linked worktree", worktreeGitDir, "../..", worktreeRoot},
+		{"main checkout", mainGitDir, ".", filepath.Dir(mainGitDir)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFakeGit(t, `#!/bin/sh
+if [ "$2" = "--show-toplevel" ]; then
+  echo "fatal: this operation must be run in a work tree" 1>&2
+  exit 128
+fi
+if [ "$1" = "rev-parse" ] && [ "$2" = "--absolute-git-dir" ] && [ "$3" = "--git-common-dir" ]; then
+  echo "`+tt.gitDir+`"
+  echo "`+tt.commonDir+`"
+  exit 0
+fi
+exit 1
+`)
+			root, err := RepoRoot(context.Background(), tt.gitDir)
+			if err != nil {
+				t.Fatalf("RepoRoot error: %v", err)
+			}
+			if root != tt.want {
+				t.Fatalf("RepoRoot = %q, want %q", root, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoRootPrefersWorkTreeNamedByGitDir(t *testing.T) {
+	mainRoot := t.TempDir()
+	worktreeGitDir := filepath.Join(mainRoot, ".git", "worktrees", "feature")
+	worktreeRoot := t.TempDir()
+	if err := os.MkdirAll(worktreeGitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(worktreeGitDir, "gitdir"), []byte(filepath.Join(worktreeRoot, ".git")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	configuredRoot := t.TempDir()
+
+	tests := []struct {
+		name      string
+		gitDir    string
+		commonDir string
+		worktree  string
+		want      string
+	}{
+		{"linked worktree", worktreeGitDir, filepath.Join(mainRoot, ".git"), "", worktreeRoot},
+		{"core.worktree", filepath.Join(mainRoot, ".git"), filepath.Join(mainRoot, ".git"), configuredRoot, configuredRoot},
+		{"main checkout", filepath.Join(mainRoot, ".git"), filepath.Join(mainRoot, ".git"), "", mainRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// --show-toplevel succeeds but names the main checkout.
+			withFakeGit(t, `#!/bin/sh
+if [ "$2" = "--show-toplevel" ]; then
+  echo "`+mainRoot+`"
+  exit 0
+fi
+if [ "$2" = "--absolute-git-dir" ]; then
+  echo "`+tt.gitDir+`"
+  echo "`+tt.commonDir+`"
+  exit 0
+fi
+if [ "$1" = "config" ] && [ -n "`+tt.worktree+`" ]; then
+  echo "`+tt.worktree+`"
+  exit 0
+fi
+exit 1
+`)
+			root, err := RepoRoot(context.Background(), mainRoot)
+			if err != nil {
+				t.Fatalf("RepoRoot error: %v", err)
+			}
+			if root != tt.want {
+				t.Fatalf("RepoRoot = %q, want %q", root, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoRootBareRepository(t *testing.T) {
+	bareDir := t.TempDir()
+	withFakeGit(t, `#!/bin/sh
+if [ "$2" = "--absolute-git-dir" ]; then
+  echo "`+bareDir+`"
+  echo "."
+  exit 0
+fi
+exit 128
+`)
+	if _, err := RepoRoot(context.Background(), bareDir); err == nil || !strings.Contains(err.Error(), "--show-toplevel failed") {
+		t.Fatalf("RepoRoot error = %v, want --show-toplevel failure", err)
+	}
+}
+
 func TestListUnmergedFiles(t *testing.T) {
 	withFakeGit(t, `#!/bin/sh
 if [ "$1" = "diff" ] && [ "$2" = "--name-only" ] && [ "$3" = "--diff-filter=U" ]; then
@@ -60,6 +175,35 @@ exit 1
 	}
 }
 
+func TestListUnmergedFilesScope(t *testing.T) {
+	withFakeGit(t, `#!/bin/sh
+if [ "$1" = "diff" ] && [ "$4" = "--" ]; then
+  echo "pathspec=$5"
+  exit 0
+fi
+exit 1
+`)
+
+	repoRoot := t.TempDir()
+	tests := []struct {
+		scope string
+		want  string
+	}{
+		{scope: "", want: "pathspec=."},
+		{scope: ".", want: "pathspec=."},
+		{scope: "sub/dir", want: "pathspec=sub/dir"},
+	}
+	for _, tt := range tests {
+		paths, err := ListUnmergedFiles(context.Background(), repoRoot, tt.scope)
+		if err != nil {
+			t.Fatalf("ListUnmergedFiles(%q) error: %v", tt.scope, err)
+		}
+		if len(paths) != 1 || paths[0] != tt.want {
+			t.Fatalf("ListUnmergedFiles(%q) = %v, want [%s]", tt.scope, paths, tt.want)
+		}
+	}
+}
+
 func TestListUnmergedFilesEmpty(t *testing.T) {
 	withFakeGit(t, "#!/bin/sh\nexit 0\n")
 
@@ -92,6 +236,155 @@ exit 1
 	}
 }
 
+func TestStageCache(t *testing.T) {
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, `#!/bin/sh
+echo run >> "`+countFile+`"
+if [ "$1" = "show" ] && [ "$2" = ":2:file.txt" ]; then
+  printf "content\n"
+  exit 0
+fi
+exit 1
+`)
+
+	repoRoot := t.TempDir()
+	cache := NewStageCache()
+	for i := 0; i < 2; i++ {
+		data, err := cache.ShowStage(context.Background(), repoRoot, 2, "file.txt")
+		if err != nil || string(data) != "content\n" {
+			t.Fatalf("ShowStage = %q, %v", data, err)
+		}
+		if _, err := cache.ShowStage(context.Background(), repoRoot, 1, "file.txt"); err == nil {
+			t.Fatalf("expected missing base stage error")
+		}
+	}
+	if runs := gitRuns(t, countFile); runs != 2 {
+		t.Fatalf("git ran %d times, want 2", runs)
+	}
+
+	var uncached *StageCache
+	if _, err := uncached.ShowStage(context.Background(), repoRoot, 2, "file.txt"); err != nil {
+		t.Fatalf("nil cache ShowStage error: %v", err)
+	}
+	if runs := gitRuns(t, countFile); runs != 3 {
+		t.Fatalf("git ran %d times with a nil cache, want 3", runs)
+	}
+}
+
+func TestShowRevFile(t *testing.T) {
+	withFakeGit(t, `#!/bin/sh
+if [ "$1" = "show" ] && [ "$2" = "abc123:dir/file.txt" ]; then
+  printf "base\n"
+  exit 0
+fi
+exit 1
+`)
+
+	repoRoot := t.TempDir()
+	data, err := ShowRevFile(context.Background(), repoRoot, "abc123", "dir/file.txt")
+	if err != nil {
+		t.Fatalf("ShowRevFile error: %v", err)
+	}
+	if string(data) != "base\n" {
+		t.Fatalf("ShowRevFile data = %q", string(data))
+	}
+}
+
+func TestAddNote(t *testing.T) {
+	argsPath := filepath.Join(t.TempDir(), "args")
+	withFakeGit(t, `#!/bin/sh
+for arg in "$@"; do
+  printf "%s\n" "$arg" >> "`+argsPath+`"
+done
+exit 0
+`)
+
+	summary := "ec: file.txt ours=1 theirs=2"
+	if err := AddNote(context.Background(), t.TempDir(), "abc1234", summary); err != nil {
+		t.Fatalf("AddNote error: %v", err)
+	}
+
+	data, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	want := "notes\nadd\n-f\n-m\n" + summary + "\nabc1234\n"
+	if string(data) != want {
+		t.Fatalf("git argv = %q, want %q", string(data), want)
+	}
+}
+
+func TestFirstCommitAfter(t *testing.T) {
+	// rev-list prints the resolved commit first, then the picks after it.
+	withFakeGit(t, `#!/bin/sh
+if [ "$1" = "rev-list" ] && [ "$4" = "base..HEAD" ]; then
+  printf 'resolved\npick2\npick3\n'
+  exit 0
+fi
+exit 1
+`)
+	got, err := FirstCommitAfter(context.Background(), t.TempDir(), "base")
+	if err != nil {
+		t.Fatalf("FirstCommitAfter error: %v", err)
+	}
+	if got != "resolved" {
+		t.Fatalf("FirstCommitAfter = %q, want %q", got, "resolved")
+	}
+}
+
+func TestFirstCommitAfterNoCommit(t *testing.T) {
+	withFakeGit(t, "#!/bin/sh\nexit 0\n")
+	if _, err := FirstCommitAfter(context.Background(), t.TempDir(), "base"); err == nil {
+		t.Fatalf("expected error when no commit was made")
+	}
+}
+
+func TestAddNoteFailure(t *testing.T) {
+	withFakeGit(t, "#!/bin/sh\necho 'error: note exists' >&2\nexit 1\n")
+
+	err := AddNote(context.Background(), t.TempDir(), "HEAD", "summary")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "note exists") {
+		t.Fatalf("error = %v, want git stderr", err)
+	}
+}
+
+func TestAddPath(t *testing.T) {
+	argsPath := filepath.Join(t.TempDir(), "args")
+	withFakeGit(t, `#!/bin/sh
+pwd > "`+argsPath+`"
+for arg in "$@"; do
+  printf "%s\n" "$arg" >> "`+argsPath+`"
+done
+exit 0
+`)
+
+	repoRoot := t.TempDir()
+	if err := AddPath(context.Background(), repoRoot, "-dir/file.txt"); err != nil {
+		t.Fatalf("AddPath error: %v", err)
+	}
+
+	data, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	want := repoRoot + "\nadd\n--\n-dir/file.txt\n"
+	if string(data) != want {
+		t.Fatalf("git dir and argv = %q, want %q", string(data), want)
+	}
+}
+
+func TestAddPathFailure(t *testing.T) {
+	withFakeGit(t, "#!/bin/sh\necho 'fatal: index.lock exists' >&2\nexit 128\n")
+
+	err := AddPath(context.Background(), t.TempDir(), "file.txt")
+	if err == nil || !strings.Contains(err.Error(), "git add file.txt failed: fatal: index.lock exists") {
+		t.Fatalf("AddPath error = %v, want git stderr", err)
+	}
+}
+
 func withFakeGit(t *testing.T, script string) {
 	t.Helper()
 
@@ -105,3 +398,210 @@ func withFakeGit(t *testing.T, script string) {
 	pathEnv := strings.Join([]string{dir, original}, string(os.PathListSeparator))
 	t.Setenv("PATH", pathEnv)
 }
+
+func TestUnmergedStageModes(t *testing.T) {
+	withFakeGit(t, `#!/bin/sh
+if [ "$1" = "ls-files" ] && [ "$2" = "--unmerged" ] && [ "$3" = "-z" ] && [ "$5" = "sub" ]; then
+  printf '160000 1111111111111111111111111111111111111111 1\tsub\0'
+  printf '160000 2222222222222222222222222222222222222222 2\tsub\0'
+  printf '100644 3333333333333333333333333333333333333333 3\tsub\0'
+  exit 0
+fi
+exit 1
+`)
+
+	modes, err := UnmergedStageModes(context.Background(), t.TempDir(), "sub")
+	if err != nil {
+		t.Fatalf("UnmergedStageModes error: %v", err)
+	}
+	if len(modes) != 3 || modes[1] != GitlinkMode || modes[2] != GitlinkMode || modes[3] != "100644" {
+		t.Fatalf("UnmergedStageModes = %v", modes)
+	}
+}
+
+func TestOperationInProgress(t *testing.T) {
+	repoRoot := t.TempDir()
+	gitDir := filepath.Join(repoRoot, ".git")
+	withFakeGit(t, "#!/bin/sh\necho .git\n")
+
+	tests := []struct {
+		marker string
+		want   string
+	}{
+		{marker: "", want: ""},
+		{marker: "MERGE_HEAD", want: "merge"},
+		{marker: "CHERRY_PICK_HEAD", want: "cherry-pick"},
+		{marker: "REVERT_HEAD", want: "revert"},
+		{marker: filepath.Join("rebase-merge", "done"), want: "rebase"},
+		{marker: filepath.Join("rebase-apply", "applying"), want: "am"},
+	}
+	for _, tt := range tests {
+		if err := os.RemoveAll(gitDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(gitDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if tt.marker != "" {
+			markerPath := filepath.Join(gitDir, tt.marker)
+			if err := os.MkdirAll(filepath.Dir(markerPath), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(markerPath, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := OperationInProgress(context.Background(), repoRoot)
+		if err != nil {
+			t.Fatalf("OperationInProgress error: %v", err)
+		}
+		if got != tt.want {
+			t.Fatalf("OperationInProgress with %q = %q, want %q", tt.marker, got, tt.want)
+		}
+	}
+}
+
+// lockingGitScript fails the first `fails` runs with a lock error (or with
+// another error when lockErr is false) and counts every run in countFile.
+func lockingGitScript(countFile string, fails int, lockErr bool) string {
+	msg := "fatal: Unable to create '/repo/.git/index.lock': File exists."
+	if !lockErr {
+		msg = "fatal: bad revision"
+	}
+	return fmt.Sprintf(`#!/bin/sh
+echo run >> %q
+if [ "$(wc -l < %q)" -le %d ]; then
+  echo %q >&2
+  exit 128
+fi
+printf 'content\n'
+`, countFile, countFile, fails, msg)
+}
+
+func gitRuns(t *testing.T, countFile string) int {
+	t.Helper()
+	data, err := os.ReadFile(countFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestRunGitRetriesLockContention(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = old })
+
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 2, true))
+
+	got, err := ShowStage(context.Background(), t.TempDir(), 2, "file.txt")
+	if err != nil {
+		t.Fatalf("ShowStage error: %v", err)
+	}
+	if string(got) != "content\n" {
+		t.Fatalf("ShowStage = %q", got)
+	}
+	if runs := gitRuns(t, countFile); runs != 3 {
+		t.Fatalf("git ran %d times, want 3", runs)
+	}
+}
+
+func TestAddPathRetriesLockContention(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = old })
+
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 1, true))
+
+	if err := AddPath(context.Background(), t.TempDir(), "file.txt"); err != nil {
+		t.Fatalf("AddPath error: %v", err)
+	}
+	if runs := gitRuns(t, countFile); runs != 2 {
+		t.Fatalf("git ran %d times, want 2", runs)
+	}
+
+	countFile = filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 10, true))
+	err := AddPath(context.Background(), t.TempDir(), "file.txt")
+	if err == nil || !strings.Contains(err.Error(), "index.lock': File exists.") {
+		t.Fatalf("AddPath error = %v, want git's lock error", err)
+	}
+}
+
+func TestRepoRootAndOperationRetryLockContention(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = old })
+
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 1, true))
+	root, err := RepoRoot(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("RepoRoot error: %v", err)
+	}
+	if root != "content" {
+		t.Fatalf("RepoRoot = %q, want %q", root, "content")
+	}
+	// Two tries of --show-toplevel, then the git directory check.
+	if runs := gitRuns(t, countFile); runs != 3 {
+		t.Fatalf("git ran %d times for RepoRoot, want 3", runs)
+	}
+
+	countFile = filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 1, true))
+	if _, err := OperationInProgress(context.Background(), t.TempDir()); err != nil {
+		t.Fatalf("OperationInProgress error: %v", err)
+	}
+	if runs := gitRuns(t, countFile); runs != 2 {
+		t.Fatalf("git ran %d times for OperationInProgress, want 2", runs)
+	}
+}
+
+func TestRunGitGivesUpAfterMaxAttempts(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = old })
+
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 10, true))
+
+	if _, err := ListUnmergedFiles(context.Background(), t.TempDir(), ""); err == nil {
+		t.Fatalf("ListUnmergedFiles error = nil, want lock error")
+	}
+	if runs := gitRuns(t, countFile); runs != MaxAttempts {
+		t.Fatalf("git ran %d times, want %d", runs, MaxAttempts)
+	}
+}
+
+func TestRunGitFailsFastOnOtherErrors(t *testing.T) {
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 10, false))
+
+	if _, err := ShowStage(context.Background(), t.TempDir(), 1, "file.txt"); err == nil {
+		t.Fatalf("ShowStage error = nil, want error")
+	}
+	if runs := gitRuns(t, countFile); runs != 1 {
+		t.Fatalf("git ran %d times, want 1", runs)
+	}
+}
+
+func TestRunGitStopsRetryingWhenCanceled(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Hour
+	t.Cleanup(func() { retryBackoff = old })
+
+	countFile := filepath.Join(t.TempDir(), "count")
+	withFakeGit(t, lockingGitScript(countFile, 10, true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := RunGit(ctx, t.TempDir(), "show", ":1:file.txt"); err == nil {
+		t.Fatalf("RunGit error = nil, want error")
+	}
+	if runs := gitRuns(t, countFile); runs != 1 {
+		t.Fatalf("git ran %d times, want 1", runs)
+	}
+}
@@ -0,0 +1,75 @@
+package markers
+
+import "bytes"
+
+// BothDedup merges ours and theirs like ResolutionBoth but keeps every change
+// once. Each side is diffed against base: a base line either side deleted is
+// dropped, and the lines both sides inserted at the same place are aligned on
+// their longest common subsequence so that lines they both added are written
+// once. Between two shared lines, lines only in ours come before lines only
+// in theirs, so the result is deterministic. With an empty base every line is
+// an insertion and the sides are merged as a whole.
+func BothDedup(base, ours, theirs []byte) []byte {
+	baseLines := SplitLinesKeepEOL(base)
+	oursInserted, oursKept := sideChanges(baseLines, SplitLinesKeepEOL(ours))
+	theirsInserted, theirsKept := sideChanges(baseLines, SplitLinesKeepEOL(theirs))
+
+	var out bytes.Buffer
+	for k := 0; k <= len(baseLines); k++ {
+		mergeInsertions(&out, oursInserted[k], theirsInserted[k])
+		if k < len(baseLines) && oursKept[k] && theirsKept[k] {
+			writeDedupLine(&out, baseLines[k])
+		}
+	}
+	return out.Bytes()
+}
+
+// sideChanges describes side as changes to base: inserted[k] holds the side
+// lines written before base line k, or after the last one for k == len(base),
+// and kept[k] whether side still has base line k.
+func sideChanges(base, side [][]byte) (inserted [][][]byte, kept []bool) {
+	match := MatchLines(base, side)
+	inserted = make([][][]byte, len(base)+1)
+	kept = make([]bool, len(base))
+	next := 0
+	for k, j := range match {
+		if j < 0 {
+			continue
+		}
+		inserted[k] = side[next:j]
+		kept[k] = true
+		next = j + 1
+	}
+	inserted[len(base)] = side[next:]
+	return inserted, kept
+}
+
+// mergeInsertions writes the lines ours and theirs inserted at one place,
+// writing the lines they have in common once.
+func mergeInsertions(out *bytes.Buffer, ours, theirs [][]byte) {
+	match := MatchLines(ours, theirs)
+	next := 0
+	for i, line := range ours {
+		if match[i] < 0 {
+			writeDedupLine(out, line)
+			continue
+		}
+		for _, theirsLine := range theirs[next:match[i]] {
+			writeDedupLine(out, theirsLine)
+		}
+		writeDedupLine(out, line)
+		next = match[i] + 1
+	}
+	for _, theirsLine := range theirs[next:] {
+		writeDedupLine(out, theirsLine)
+	}
+}
+
+// writeDedupLine appends line, first terminating a previous line that lacked
+// a newline so that two lines are never joined.
+func writeDedupLine(out *bytes.Buffer, line []byte) {
+	if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	out.Write(line)
+}
@@ -4,8 +4,10 @@ import "bytes"
 
 func CloneDocument(doc Document) Document {
 	cloned := Document{
-		Segments:  make([]Segment, len(doc.Segments)),
-		Conflicts: make([]ConflictRef, len(doc.Conflicts)),
+		Segments:      make([]Segment, len(doc.Segments)),
+		Conflicts:     make([]ConflictRef, len(doc.Conflicts)),
+		BOM:           doc.BOM,
+		BothSeparator: doc.BothSeparator,
 	}
 	for i, seg := range doc.Segments {
 		switch v := seg.(type) {
@@ -20,7 +22,7 @@ func CloneDocument(doc Document) Document {
 }
 
 func DocumentsEqual(left, right Document) bool {
-	if len(left.Conflicts) != len(right.Conflicts) || len(left.Segments) != len(right.Segments) {
+	if left.BOM != right.BOM || len(left.Conflicts) != len(right.Conflicts) || len(left.Segments) != len(right.Segments) {
 		return false
 	}
 	for i := range left.Conflicts {
@@ -55,3 +57,46 @@ func DocumentsEqual(left, right Document) bool {
 	}
 	return true
 }
+
+// DocumentLineEndingStats counts line endings across the text and conflict
+// side bytes of doc. Conflict marker lines are not part of the content and
+// are left out.
+func DocumentLineEndingStats(doc Document) LineEndings {
+	var stats LineEndings
+	for _, seg := range doc.Segments {
+		switch s := seg.(type) {
+		case TextSegment:
+			stats = stats.add(LineEndingStats(s.Bytes))
+		case ConflictSegment:
+			stats = stats.add(LineEndingStats(s.Ours))
+			stats = stats.add(LineEndingStats(s.Base))
+			stats = stats.add(LineEndingStats(s.Theirs))
+		}
+	}
+	return stats
+}
+
+// NormalizeDocumentEOL returns a copy of doc whose text and conflict side
+// bytes all use eol.
+func NormalizeDocumentEOL(doc Document, eol string) Document {
+	normalized := CloneDocument(doc)
+	for i, seg := range normalized.Segments {
+		switch s := seg.(type) {
+		case TextSegment:
+			s.Bytes = NormalizeLineEndings(s.Bytes, eol)
+			normalized.Segments[i] = s
+		case ConflictSegment:
+			s.Ours = NormalizeLineEndings(s.Ours, eol)
+			s.Base = NormalizeLineEndings(s.Base, eol)
+			s.Theirs = NormalizeLineEndings(s.Theirs, eol)
+			s.Markers = MarkerLines{
+				Start: NormalizeLineEndings(s.Markers.Start, eol),
+				Base:  NormalizeLineEndings(s.Markers.Base, eol),
+				Mid:   NormalizeLineEndings(s.Markers.Mid, eol),
+				End:   NormalizeLineEndings(s.Markers.End, eol),
+			}
+			normalized.Segments[i] = s
+		}
+	}
+	return normalized
+}
@@ -1,5 +1,104 @@
 package markers
 
+import (
+	"bytes"
+	"fmt"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// StripBOM removes a leading UTF-8 byte-order mark and reports whether one
+// was present.
+func StripBOM(b []byte) ([]byte, bool) {
+	if bytes.HasPrefix(b, utf8BOM) {
+		return b[len(utf8BOM):], true
+	}
+	return b, false
+}
+
+// AddBOM prefixes b with a UTF-8 byte-order mark when bom is set.
+func AddBOM(b []byte, bom bool) []byte {
+	if !bom {
+		return b
+	}
+	return append(append([]byte(nil), utf8BOM...), b...)
+}
+
+// LineEndings counts the line terminators found in some text.
+type LineEndings struct {
+	LF   int
+	CRLF int
+	CR   int // lone carriage returns
+}
+
+// Mixed reports whether more than one line-ending style occurs.
+func (e LineEndings) Mixed() bool {
+	styles := 0
+	for _, count := range []int{e.LF, e.CRLF, e.CR} {
+		if count > 0 {
+			styles++
+		}
+	}
+	return styles > 1
+}
+
+func (e LineEndings) String() string {
+	return fmt.Sprintf("%d LF, %d CRLF, %d CR", e.LF, e.CRLF, e.CR)
+}
+
+func (e LineEndings) add(other LineEndings) LineEndings {
+	return LineEndings{LF: e.LF + other.LF, CRLF: e.CRLF + other.CRLF, CR: e.CR + other.CR}
+}
+
+// LineEndingStats counts the LF, CRLF and lone CR line endings in data.
+func LineEndingStats(data []byte) LineEndings {
+	var stats LineEndings
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\n':
+			stats.LF++
+		case '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				stats.CRLF++
+				i++
+			} else {
+				stats.CR++
+			}
+		}
+	}
+	return stats
+}
+
+// NormalizeLineEndings rewrites every LF, CRLF and lone CR in b to eol.
+func NormalizeLineEndings(b []byte, eol string) []byte {
+	if b == nil {
+		return nil
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\n':
+			out = append(out, eol...)
+		case '\r':
+			if i+1 < len(b) && b[i+1] == '\n' {
+				i++
+			}
+			out = append(out, eol...)
+		default:
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+// LineEndingFor maps a --normalize-eol style name to its terminator.
+func LineEndingFor(style string) string {
+	if style == "crlf" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
 func SplitLinesKeepEOL(b []byte) [][]byte {
 	if len(b) == 0 {
 		return nil
@@ -18,3 +117,63 @@ func SplitLinesKeepEOL(b []byte) [][]byte {
 	}
 	return out
 }
+
+// MatchLines returns, for each base line, the index of the side line it is
+// paired with in a longest common subsequence, or -1 when the side changed
+// or removed it. Where several subsequences are equally long, base lines are
+// passed over before side lines, so the pairing is deterministic.
+func MatchLines(base, side [][]byte) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Common prefix and suffix are matched directly to keep the table small.
+	prefix := 0
+	for prefix < len(base) && prefix < len(side) && bytes.Equal(base[prefix], side[prefix]) {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(side)-prefix &&
+		bytes.Equal(base[len(base)-1-suffix], side[len(side)-1-suffix]) {
+		match[len(base)-1-suffix] = len(side) - 1 - suffix
+		suffix++
+	}
+
+	oldLines := base[prefix : len(base)-suffix]
+	newLines := side[prefix : len(side)-suffix]
+	n, m := len(oldLines), len(newLines)
+	if n == 0 || m == 0 {
+		return match
+	}
+
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if bytes.Equal(oldLines[i], newLines[j]) {
+				dp[i][j] = dp[i+1][j+1] + 1
+				continue
+			}
+			dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case bytes.Equal(oldLines[i], newLines[j]):
+			match[prefix+i] = prefix + j
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
@@ -20,8 +20,22 @@ var (
 //
 // It is strict: if it encounters a start marker, it requires a full, valid
 // marker structure (optionally including a diff3 base section).
+//
+// Text after a marker is tolerated on every marker line, as some tools
+// annotate the separators too. It becomes the label of the start, base and
+// end markers; after ======= it has no meaning and is only kept in Markers,
+// so the line renders back as it was.
+//
+// A conflict nested inside a side, as left by merging files that already
+// had conflicts (git's recursive merge base uses longer markers for them),
+// is kept verbatim as part of that side: only markers as long as the outer
+// start marker end its sections, so the inner block's separators do not end
+// the outer one, and a side line that merely starts with <<<<<<< stays
+// content. Rendering the outer conflict unresolved therefore reproduces the
+// input.
 func Parse(data []byte) (Document, error) {
 	var doc Document
+	data, doc.BOM = StripBOM(data)
 
 	// Normalize by working line-by-line (keeping line endings).
 	lines := SplitLinesKeepEOL(data)
@@ -39,59 +53,72 @@ func Parse(data []byte) (Document, error) {
 		line := lines[i]
 		if hasLinePrefix(line, markStart) {
 			appendText(&textBuf)
+			start := i
 			oursLabel := parseLabel(line, markStart)
+			size := markerSize(line)
 
 			// Collect ours until base/mid.
 			i++
 			var ours bytes.Buffer
+			strayEnd := -1
 			for ; i < len(lines); i++ {
-				if hasLinePrefix(lines[i], markBase) || hasLinePrefix(lines[i], markMid) {
+				if isMarker(lines[i], markBase, size) || isMarker(lines[i], markMid, size) {
 					break
 				}
+				if strayEnd == -1 && isMarker(lines[i], markEnd, size) {
+					strayEnd = i
+				}
 				ours.Write(lines[i])
 			}
 			if i >= len(lines) {
-				return Document{}, fmt.Errorf("%w: missing separator", ErrMalformedConflict)
+				if strayEnd != -1 {
+					return Document{}, malformedAt(lines, strayEnd, "before =======")
+				}
+				return Document{}, malformedAt(lines, start, "missing separator")
 			}
 
 			// Optional base section.
 			var base bytes.Buffer
 			baseLabel := ""
-			if hasLinePrefix(lines[i], markBase) {
+			var baseMarker []byte
+			if isMarker(lines[i], markBase, size) {
 				baseLabel = parseLabel(lines[i], markBase)
+				baseMarker = lines[i]
+				baseStart := i
 				i++
 				for ; i < len(lines); i++ {
-					if hasLinePrefix(lines[i], markMid) {
+					if isMarker(lines[i], markMid, size) {
 						break
 					}
 					base.Write(lines[i])
 				}
 				if i >= len(lines) {
-					return Document{}, fmt.Errorf("%w: missing ======= after base", ErrMalformedConflict)
+					return Document{}, malformedAt(lines, baseStart, "missing ======= after base")
 				}
 			}
 
 			// Must have mid.
-			if !hasLinePrefix(lines[i], markMid) {
-				return Document{}, fmt.Errorf("%w: expected =======", ErrMalformedConflict)
+			if !isMarker(lines[i], markMid, size) {
+				return Document{}, malformedAt(lines, i, "expected =======")
 			}
 
 			// Collect theirs until end.
+			mid := i
 			i++
 			var theirs bytes.Buffer
 			for ; i < len(lines); i++ {
-				if hasLinePrefix(lines[i], markEnd) {
+				if isMarker(lines[i], markEnd, size) {
 					break
 				}
 				theirs.Write(lines[i])
 			}
 			if i >= len(lines) {
-				return Document{}, fmt.Errorf("%w: missing end marker", ErrMalformedConflict)
+				return Document{}, malformedAt(lines, mid, fmt.Sprintf("missing end marker for conflict at line %d", start+1))
 			}
 			theirsLabel := parseLabel(lines[i], markEnd)
 
 			segIndex := len(doc.Segments)
-			doc.Segments = append(doc.Segments, ConflictSegment{
+			seg := ConflictSegment{
 				Ours:        ours.Bytes(),
 				Base:        base.Bytes(),
 				Theirs:      theirs.Bytes(),
@@ -99,8 +126,15 @@ func Parse(data []byte) (Document, error) {
 				BaseLabel:   baseLabel,
 				TheirsLabel: theirsLabel,
 				Resolution:  ResolutionUnset,
-			})
-			doc.Conflicts = append(doc.Conflicts, ConflictRef{SegmentIndex: segIndex})
+				Markers: MarkerLines{
+					Start: lines[start],
+					Base:  baseMarker,
+					Mid:   lines[mid],
+					End:   lines[i],
+				},
+			}
+			doc.Segments = append(doc.Segments, seg)
+			doc.Conflicts = append(doc.Conflicts, ConflictRef{SegmentIndex: segIndex, Hash: seg.Hash()})
 			continue
 		}
 
@@ -111,11 +145,35 @@ func Parse(data []byte) (Document, error) {
 	return doc, nil
 }
 
+// malformedAt wraps ErrMalformedConflict with the 1-based line number and
+// text of the marker at lines[idx].
+func malformedAt(lines [][]byte, idx int, reason string) error {
+	marker := strings.TrimRight(string(lines[idx]), "\r\n")
+	return fmt.Errorf("%w: line %d: %q: %s", ErrMalformedConflict, idx+1, marker, reason)
+}
+
+// markerSize is the length of the run of marker characters line starts with.
+func markerSize(line []byte) int {
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	return n
+}
+
+// isMarker reports whether line is a mark marker exactly size characters
+// long; git gives a nested conflict longer markers than the one around it.
+func isMarker(line, mark []byte, size int) bool {
+	return hasLinePrefix(line, mark) && markerSize(line) == size
+}
+
 func hasLinePrefix(line, prefix []byte) bool {
 	// Markers appear at line start in Git output.
 	return bytes.HasPrefix(line, prefix)
 }
 
+// parseLabel returns the text after prefix on a marker line, trimmed of
+// surrounding whitespace and the line ending.
 func parseLabel(line []byte, prefix []byte) string {
 	if !bytes.HasPrefix(line, prefix) {
 		return ""
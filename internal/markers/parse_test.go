@@ -1,9 +1,12 @@
 package markers
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -186,6 +189,9 @@ func TestParseMalformedNoMid(t *testing.T) {
 	if !errors.Is(err, ErrMalformedConflict) {
 		t.Errorf("expected ErrMalformedConflict, got %v", err)
 	}
+	if want := `line 3: ">>>>>>> branch": before =======`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want it to contain %q", err, want)
+	}
 }
 
 func TestParseMalformedNoEnd(t *testing.T) {
@@ -201,6 +207,155 @@ func TestParseMalformedNoEnd(t *testing.T) {
 	if !errors.Is(err, ErrMalformedConflict) {
 		t.Errorf("expected ErrMalformedConflict, got %v", err)
 	}
+	if want := `line 3: "=======": missing end marker for conflict at line 1`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want it to contain %q", err, want)
+	}
+}
+
+func TestParseMalformedReportsPosition(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "missing separator",
+			input: "a\n<<<<<<< HEAD\nours\n",
+			want:  `line 2: "<<<<<<< HEAD": missing separator`,
+		},
+		{
+			name:  "missing mid after base",
+			input: "<<<<<<< HEAD\nours\n||||||| base\nbase\n",
+			want:  `line 3: "||||||| base": missing ======= after base`,
+		},
+		{
+			name:  "crlf marker text",
+			input: "x\r\n<<<<<<< HEAD\r\nours\r\n=======\r\ntheirs\r\n",
+			want:  `line 4: "=======": missing end marker for conflict at line 2`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			if !errors.Is(err, ErrMalformedConflict) {
+				t.Fatalf("Parse() error = %v, want ErrMalformedConflict", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Parse() error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNested(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "nested.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(doc.Conflicts) != 1 {
+		t.Fatalf("expected 1 outer conflict, got %d", len(doc.Conflicts))
+	}
+
+	conflict := doc.Segments[doc.Conflicts[0].SegmentIndex].(ConflictSegment)
+	wantOurs := "<<<<<<<<< Temporary merge branch 1\ninner ours\n=========\ninner theirs\n>>>>>>>>> Temporary merge branch 2\n"
+	if string(conflict.Ours) != wantOurs {
+		t.Errorf("ours = %q, want %q", conflict.Ours, wantOurs)
+	}
+	wantBase := "<<<<<<<<< HEAD\nbase a\n=========\nbase b\n>>>>>>>>> topic\n"
+	if string(conflict.Base) != wantBase {
+		t.Errorf("base = %q, want %q", conflict.Base, wantBase)
+	}
+	if string(conflict.Theirs) != "outer theirs\n" || conflict.TheirsLabel != "feature" {
+		t.Errorf("theirs = %q (%q), want outer side", conflict.Theirs, conflict.TheirsLabel)
+	}
+
+	rendered, err := RenderWithUnresolved(doc)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved failed: %v", err)
+	}
+	if string(rendered) != string(data) {
+		t.Errorf("round trip mismatch:\n%s", rendered)
+	}
+
+	conflict.Resolution = ResolutionOurs
+	doc.Segments[doc.Conflicts[0].SegmentIndex] = conflict
+	resolved, err := RenderResolved(doc)
+	if err != nil {
+		t.Fatalf("RenderResolved failed: %v", err)
+	}
+	if string(resolved) != "before\n"+wantOurs+"after\n" {
+		t.Errorf("resolved = %q, want inner conflict kept", resolved)
+	}
+}
+
+func TestParseAnnotatedSeparators(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "annotated_separators.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(doc.Conflicts) != 2 {
+		t.Fatalf("expected 2 conflicts, got %d", len(doc.Conflicts))
+	}
+
+	first := doc.Segments[doc.Conflicts[0].SegmentIndex].(ConflictSegment)
+	if first.OursLabel != "HEAD (ours: main)" || first.BaseLabel != "merged common ancestors: abc123" || first.TheirsLabel != "feature/x (theirs)" {
+		t.Errorf("labels = %q, %q, %q", first.OursLabel, first.BaseLabel, first.TheirsLabel)
+	}
+	if string(first.Ours) != "ours line\n" || string(first.Base) != "base line\n" || string(first.Theirs) != "theirs line\n" {
+		t.Errorf("sides = %q, %q, %q", first.Ours, first.Base, first.Theirs)
+	}
+	if label := parseLabel(first.Markers.Mid, markMid); label != "theirs follows" {
+		t.Errorf("separator text = %q, want %q", label, "theirs follows")
+	}
+
+	second := doc.Segments[doc.Conflicts[1].SegmentIndex].(ConflictSegment)
+	if string(second.Ours) != "ours two\n" || string(second.Theirs) != "theirs two\n" || len(second.Base) != 0 {
+		t.Errorf("second conflict sides = %q, %q, %q", second.Ours, second.Base, second.Theirs)
+	}
+
+	rendered, err := RenderWithUnresolved(doc)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved failed: %v", err)
+	}
+	if string(rendered) != string(data) {
+		t.Errorf("round trip mismatch:\n%s", rendered)
+	}
+}
+
+func TestParseSideLineStartingWithStartMarker(t *testing.T) {
+	input := "<<<<<<< HEAD\n<<<<<<< quoted in a doc comment\nours\n=======\ntheirs\n<<<<<<<\n>>>>>>> feature\nafter\n"
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(doc.Conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d", len(doc.Conflicts))
+	}
+	conflict := doc.Segments[doc.Conflicts[0].SegmentIndex].(ConflictSegment)
+	if string(conflict.Ours) != "<<<<<<< quoted in a doc comment\nours\n" {
+		t.Errorf("ours = %q, want the <<<<<<< line kept as content", conflict.Ours)
+	}
+	if string(conflict.Theirs) != "theirs\n<<<<<<<\n" || conflict.TheirsLabel != "feature" {
+		t.Errorf("theirs = %q (%q), want the <<<<<<< line kept as content", conflict.Theirs, conflict.TheirsLabel)
+	}
+
+	rendered, err := RenderWithUnresolved(doc)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved failed: %v", err)
+	}
+	if string(rendered) != input {
+		t.Errorf("round trip mismatch:\n%s", rendered)
+	}
 }
 
 func TestParseCRLF(t *testing.T) {
@@ -239,3 +394,275 @@ func TestParseNoTrailingNewline(t *testing.T) {
 		t.Fatalf("expected 1 conflict, got %d", len(doc.Conflicts))
 	}
 }
+
+func TestParseBOM(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "bom.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !doc.BOM {
+		t.Fatalf("expected BOM to be recorded")
+	}
+	if len(doc.Conflicts) != 1 || doc.Conflicts[0].SegmentIndex != 0 {
+		t.Fatalf("expected conflict at segment 0 after stripping BOM, got %+v", doc.Conflicts)
+	}
+	conflict := doc.Segments[0].(ConflictSegment)
+	if conflict.OursLabel != "HEAD" {
+		t.Errorf("ours label = %q, want HEAD", conflict.OursLabel)
+	}
+}
+
+func TestLineEndingStats(t *testing.T) {
+	stats := LineEndingStats([]byte("a\nb\r\nc\rd\r\n"))
+	if stats != (LineEndings{LF: 1, CRLF: 2, CR: 1}) {
+		t.Fatalf("LineEndingStats = %+v", stats)
+	}
+	if !stats.Mixed() {
+		t.Fatalf("expected mixed line endings")
+	}
+	if LineEndingStats([]byte("a\r\nb\r\n")).Mixed() {
+		t.Fatalf("CRLF-only text reported as mixed")
+	}
+}
+
+func TestNormalizeDocumentEOL(t *testing.T) {
+	doc, err := Parse([]byte("a\r\n<<<<<<< HEAD\nours\r\n=======\ntheirs\n>>>>>>> branch\nb\rc\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if stats := DocumentLineEndingStats(doc); stats != (LineEndings{LF: 2, CRLF: 2, CR: 1}) {
+		t.Fatalf("DocumentLineEndingStats = %+v, want marker lines excluded", stats)
+	}
+
+	normalized := NormalizeDocumentEOL(doc, LineEndingFor("crlf"))
+	unresolved, err := RenderWithUnresolved(normalized)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved failed: %v", err)
+	}
+	if want := "a\r\n<<<<<<< HEAD\r\nours\r\n=======\r\ntheirs\r\n>>>>>>> branch\r\nb\r\nc\r\n"; string(unresolved) != want {
+		t.Fatalf("RenderWithUnresolved = %q, want markers normalized too", unresolved)
+	}
+	conflict := normalized.Segments[normalized.Conflicts[0].SegmentIndex].(ConflictSegment)
+	conflict.Resolution = ResolutionBoth
+	normalized.Segments[normalized.Conflicts[0].SegmentIndex] = conflict
+	out, err := RenderResolved(normalized)
+	if err != nil {
+		t.Fatalf("RenderResolved failed: %v", err)
+	}
+	if want := "a\r\nours\r\ntheirs\r\nb\r\nc\r\n"; string(out) != want {
+		t.Fatalf("RenderResolved = %q, want %q", out, want)
+	}
+
+	original := doc.Segments[doc.Conflicts[0].SegmentIndex].(ConflictSegment)
+	if string(original.Theirs) != "theirs\n" {
+		t.Fatalf("NormalizeDocumentEOL modified the input document: %q", original.Theirs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	input := "<<<<<<< HEAD\nours\n||||||| base\nbase\n=======\ntheirs\n>>>>>>> feature\n" +
+		"mid\n" +
+		"<<<<<<< HEAD\na\n=======\nb\n>>>>>>> other\n" +
+		"<<<<<<< HEAD\nx\n<<<<<<< HEAD\n||||||| base\nbase\n=======\ny\n>>>>>>> feature\n"
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	issues := Validate(doc)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, fmt.Sprintf("%d:%s", issue.Conflict, issue.Kind))
+	}
+	want := []string{"1:missing-base", "1:label-mismatch", "2:nested-markers"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("issues = %v, want %v", got, want)
+	}
+	if !strings.Contains(issues[2].Message, "ours at line 2") {
+		t.Fatalf("nested message = %q, want side and line", issues[2].Message)
+	}
+}
+
+func TestValidateReportsBrokenConflictRef(t *testing.T) {
+	doc := Document{
+		Segments:  []Segment{TextSegment{Bytes: []byte("text\n")}},
+		Conflicts: []ConflictRef{{SegmentIndex: 0}, {SegmentIndex: 3}},
+	}
+	issues := Validate(doc)
+	if len(issues) != 2 || issues[0].Kind != IssueNotConflict || issues[1].Kind != IssueNotConflict {
+		t.Fatalf("issues = %+v, want two not-conflict issues", issues)
+	}
+	if issues := Validate(Document{}); issues != nil {
+		t.Fatalf("Validate(empty) = %+v, want nil", issues)
+	}
+}
+
+func TestConflictHash(t *testing.T) {
+	first, err := Parse([]byte("a\n<<<<<<< HEAD\nx\n||||||| base\no\n=======\ny\n>>>>>>> topic\nb\n<<<<<<< HEAD\np\n=======\nq\n>>>>>>> topic\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same second conflict after the first was resolved, with other labels.
+	second, err := Parse([]byte("a\nx\nb\n<<<<<<< ours\np\n=======\nq\n>>>>>>> theirs\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range []Document{first, second} {
+		for _, ref := range doc.Conflicts {
+			seg := doc.Segments[ref.SegmentIndex].(ConflictSegment)
+			if ref.Hash == "" || ref.Hash != seg.Hash() {
+				t.Fatalf("ref hash = %q, want segment hash %q", ref.Hash, seg.Hash())
+			}
+		}
+	}
+	if first.Conflicts[1].Hash != second.Conflicts[0].Hash {
+		t.Fatalf("hash changed across re-parse: %q vs %q", first.Conflicts[1].Hash, second.Conflicts[0].Hash)
+	}
+	if first.Conflicts[0].Hash == first.Conflicts[1].Hash {
+		t.Fatalf("different conflicts share hash %q", first.Conflicts[0].Hash)
+	}
+
+	// Moving a line between sections must change the hash.
+	a := ConflictSegment{Ours: []byte("x\n"), Base: []byte("y\n")}
+	b := ConflictSegment{Ours: []byte("x\ny\n")}
+	if a.Hash() == b.Hash() {
+		t.Fatalf("hash ignores section boundaries")
+	}
+	if len(a.Hash()) != 64 {
+		t.Fatalf("hash = %q, want 64 hex characters", a.Hash())
+	}
+}
+
+func TestConflictCommonLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		seg        ConflictSegment
+		wantPrefix string
+		wantSuffix string
+	}{
+		{
+			name:       "diff3 edges",
+			seg:        ConflictSegment{Ours: []byte("a\nx\nz\n"), Base: []byte("a\no\nz\n"), Theirs: []byte("a\ny\nz\n")},
+			wantPrefix: "a\n",
+			wantSuffix: "z\n",
+		},
+		{
+			name:       "base differs",
+			seg:        ConflictSegment{Ours: []byte("a\nx\n"), Base: []byte("b\nx\n"), Theirs: []byte("a\nx\n")},
+			wantPrefix: "",
+			wantSuffix: "x\n",
+		},
+		{
+			name:       "two-way",
+			seg:        ConflictSegment{Ours: []byte("a\nb\nx\n"), Theirs: []byte("a\nb\ny\n")},
+			wantPrefix: "a\nb\n",
+			wantSuffix: "",
+		},
+		{
+			name:       "suffix does not overlap prefix",
+			seg:        ConflictSegment{Ours: []byte("a\n"), Theirs: []byte("a\na\n")},
+			wantPrefix: "a\n",
+			wantSuffix: "",
+		},
+		{
+			name:       "missing final newline",
+			seg:        ConflictSegment{Ours: []byte("a\nz"), Theirs: []byte("b\nz\n")},
+			wantPrefix: "",
+			wantSuffix: "",
+		},
+		{
+			name: "empty side",
+			seg:  ConflictSegment{Ours: []byte("a\n"), Theirs: nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(bytes.Join(tt.seg.CommonPrefixLines(), nil)); got != tt.wantPrefix {
+				t.Fatalf("CommonPrefixLines = %q, want %q", got, tt.wantPrefix)
+			}
+			if got := string(bytes.Join(tt.seg.CommonSuffixLines(), nil)); got != tt.wantSuffix {
+				t.Fatalf("CommonSuffixLines = %q, want %q", got, tt.wantSuffix)
+			}
+		})
+	}
+}
+
+func TestRenderWithUnresolvedKeepsMarkerLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"crlf markers", "<<<<<<< HEAD\r\nours\r\n=======\r\ntheirs\r\n>>>>>>> branch\r\n"},
+		{"label spacing", "<<<<<<<  HEAD \n||||||| base\t\nbase\n=======\ntheirs\n>>>>>>>\tbranch  \n"},
+		{"text after separator", "<<<<<<< HEAD\nours\n======= note\ntheirs\n>>>>>>> branch\n"},
+		{"empty unlabeled base", "<<<<<<< HEAD\nours\n|||||||\n=======\ntheirs\n>>>>>>> branch\n"},
+		{"no final newline", "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			rendered, err := RenderWithUnresolved(doc)
+			if err != nil {
+				t.Fatalf("RenderWithUnresolved failed: %v", err)
+			}
+			if string(rendered) != tt.input {
+				t.Fatalf("rendered = %q, want %q", rendered, tt.input)
+			}
+		})
+	}
+}
+
+func TestRenderWithLabelsKeepsMarkerLineEndings(t *testing.T) {
+	doc, err := Parse([]byte("<<<<<<< HEAD\r\nours\r\n=======\r\ntheirs\r\n>>>>>>> branch"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	rendered, err := RenderWithLabels(doc, Labels{Ours: "mine", Theirs: "yours"})
+	if err != nil {
+		t.Fatalf("RenderWithLabels failed: %v", err)
+	}
+	want := "<<<<<<< mine\r\nours\r\n=======\r\ntheirs\r\n>>>>>>> yours"
+	if string(rendered) != want {
+		t.Fatalf("rendered = %q, want %q", rendered, want)
+	}
+}
+
+// FuzzParseRoundTrip checks that any input Parse accepts renders back
+// unchanged while its conflicts are unresolved.
+func FuzzParseRoundTrip(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("<<<<<<< HEAD \r\nours\r\n||||||| base\r\n=======\r\ntheirs\r\n>>>>>>> branch"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := Parse(data)
+		if err != nil {
+			return
+		}
+		rendered, err := RenderWithUnresolved(doc)
+		if err != nil {
+			t.Fatalf("RenderWithUnresolved failed: %v", err)
+		}
+		if !bytes.Equal(rendered, data) {
+			t.Fatalf("round trip changed the input:\ngot  %q\nwant %q", rendered, data)
+		}
+	})
+}
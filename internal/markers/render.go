@@ -10,6 +10,9 @@ var ErrUnresolved = errors.New("unresolved")
 
 func RenderResolved(doc Document) ([]byte, error) {
 	var out bytes.Buffer
+	if doc.BOM {
+		out.Write(utf8BOM)
+	}
 
 	for _, seg := range doc.Segments {
 		switch s := seg.(type) {
@@ -23,8 +26,9 @@ func RenderResolved(doc Document) ([]byte, error) {
 			case ResolutionTheirs:
 				out.Write(s.Theirs)
 			case ResolutionBoth:
-				out.Write(s.Ours)
-				out.Write(s.Theirs)
+				out.Write(JoinBoth(s.Ours, s.Theirs, doc.BothSeparator))
+			case ResolutionBothDedup:
+				out.Write(BothDedup(s.Base, s.Ours, s.Theirs))
 			case ResolutionNone:
 				// Write nothing for this conflict.
 			default:
@@ -39,14 +43,42 @@ func RenderResolved(doc Document) ([]byte, error) {
 }
 
 func RenderWithUnresolved(doc Document) ([]byte, error) {
+	return RenderWithLabels(doc, Labels{})
+}
+
+// Labels overrides the marker labels of unresolved conflicts. An empty field
+// keeps each conflict's own label.
+type Labels struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// RenderWithLabels is RenderWithUnresolved with the marker labels replaced
+// by the non-empty fields of labels. A base label is only applied to
+// conflicts that have a base section.
+func RenderWithLabels(doc Document, labels Labels) ([]byte, error) {
 	var out bytes.Buffer
+	if doc.BOM {
+		out.Write(utf8BOM)
+	}
 
 	for _, seg := range doc.Segments {
 		switch s := seg.(type) {
 		case TextSegment:
 			out.Write(s.Bytes)
 		case ConflictSegment:
-			appendRenderedConflictSegment(&out, s, s.OursLabel, s.BaseLabel, s.TheirsLabel)
+			oursLabel, baseLabel, theirsLabel := s.OursLabel, s.BaseLabel, s.TheirsLabel
+			if labels.Ours != "" {
+				oursLabel = labels.Ours
+			}
+			if labels.Base != "" && s.hasBaseSection() {
+				baseLabel = labels.Base
+			}
+			if labels.Theirs != "" {
+				theirsLabel = labels.Theirs
+			}
+			appendRenderedConflictSegment(&out, s, oursLabel, baseLabel, theirsLabel, doc.BothSeparator)
 		default:
 			return nil, fmt.Errorf("unknown segment type %T", seg)
 		}
@@ -55,20 +87,107 @@ func RenderWithUnresolved(doc Document) ([]byte, error) {
 	return out.Bytes(), nil
 }
 
+// RenderAnnotated renders doc like RenderResolved, but instead of failing on
+// an unresolved conflict it writes both sides, each introduced by a comment
+// line: "<prefix> OURS" before ours and "<prefix> THEIRS" before theirs.
+func RenderAnnotated(doc Document, prefix string) ([]byte, error) {
+	var out bytes.Buffer
+	if doc.BOM {
+		out.Write(utf8BOM)
+	}
+	start := out.Len()
+
+	writeComment := func(label string) {
+		if out.Len() > start && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		out.WriteString(prefix)
+		out.WriteByte(' ')
+		out.WriteString(label)
+		out.WriteByte('\n')
+	}
+
+	for _, seg := range doc.Segments {
+		switch s := seg.(type) {
+		case TextSegment:
+			out.Write(s.Bytes)
+		case ConflictSegment:
+			if s.Resolution != ResolutionUnset {
+				appendRenderedConflictSegment(&out, s, "", "", "", doc.BothSeparator)
+				continue
+			}
+			writeComment("OURS")
+			out.Write(s.Ours)
+			writeComment("THEIRS")
+			out.Write(s.Theirs)
+		default:
+			return nil, fmt.Errorf("unknown segment type %T", seg)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// RenderConflictBlock renders seg with its conflict markers and labels, as
+// it reads in a file where it is unresolved, whatever its resolution.
+func RenderConflictBlock(seg ConflictSegment) []byte {
+	var out bytes.Buffer
+	seg.Resolution = ResolutionUnset
+	appendRenderedConflictSegment(&out, seg, seg.OursLabel, seg.BaseLabel, seg.TheirsLabel, "")
+	return out.Bytes()
+}
+
+// JoinBoth returns the text of a ResolutionBoth conflict: ours followed by
+// theirs. A non-empty separator goes between them on a line of its own,
+// ended like the sides' lines; it is left out when either side is empty.
+func JoinBoth(ours, theirs []byte, separator string) []byte {
+	out := append([]byte(nil), ours...)
+	if separator != "" && len(ours) > 0 && len(theirs) > 0 {
+		eol := sideLineEnding(ours, theirs)
+		if !bytes.HasSuffix(out, []byte("\n")) {
+			out = append(out, eol...)
+		}
+		out = append(out, separator...)
+		out = append(out, eol...)
+	}
+	return append(out, theirs...)
+}
+
+// sideLineEnding returns the line ending of the first side that has one,
+// CRLF or LF, defaulting to LF.
+func sideLineEnding(sides ...[]byte) string {
+	for _, side := range sides {
+		if i := bytes.IndexByte(side, '\n'); i >= 0 {
+			if i > 0 && side[i-1] == '\r' {
+				return "\r\n"
+			}
+			return "\n"
+		}
+	}
+	return "\n"
+}
+
 // AppendConflictSegment renders one conflict segment into out using the given labels.
 // It returns true when the segment remains unresolved and conflict markers were emitted.
 func AppendConflictSegment(out *bytes.Buffer, seg ConflictSegment, oursLabel, baseLabel, theirsLabel string) bool {
-	return appendRenderedConflictSegment(out, seg, oursLabel, baseLabel, theirsLabel)
+	return appendRenderedConflictSegment(out, seg, oursLabel, baseLabel, theirsLabel, "")
 }
 
-func appendRenderedConflictSegment(out *bytes.Buffer, seg ConflictSegment, oursLabel, baseLabel, theirsLabel string) bool {
-	writeMarker := func(prefix []byte, label string) {
+func appendRenderedConflictSegment(out *bytes.Buffer, seg ConflictSegment, oursLabel, baseLabel, theirsLabel, bothSeparator string) bool {
+	// A parsed marker line is written as is unless its label changed, so
+	// label spacing and line endings survive; a new label keeps only the
+	// line ending.
+	writeMarker := func(prefix []byte, label string, raw []byte) {
+		if raw != nil && parseLabel(raw, prefix) == label {
+			out.Write(raw)
+			return
+		}
 		out.Write(prefix)
 		if label != "" {
 			out.WriteByte(' ')
 			out.WriteString(label)
 		}
-		out.WriteByte('\n')
+		out.WriteString(markerLineEnding(raw))
 	}
 
 	switch seg.Resolution {
@@ -79,21 +198,46 @@ func appendRenderedConflictSegment(out *bytes.Buffer, seg ConflictSegment, oursL
 		out.Write(seg.Theirs)
 		return false
 	case ResolutionBoth:
-		out.Write(seg.Ours)
-		out.Write(seg.Theirs)
+		out.Write(JoinBoth(seg.Ours, seg.Theirs, bothSeparator))
+		return false
+	case ResolutionBothDedup:
+		out.Write(BothDedup(seg.Base, seg.Ours, seg.Theirs))
 		return false
 	case ResolutionNone:
 		return false
 	default:
-		writeMarker(markStart, oursLabel)
+		writeMarker(markStart, oursLabel, seg.Markers.Start)
 		out.Write(seg.Ours)
-		if len(seg.Base) > 0 || baseLabel != "" {
-			writeMarker(markBase, baseLabel)
+		if seg.hasBaseSection() || baseLabel != "" {
+			writeMarker(markBase, baseLabel, seg.Markers.Base)
 			out.Write(seg.Base)
 		}
-		writeMarker(markMid, "")
+		// Text after ======= is not a label; keep whatever was there.
+		writeMarker(markMid, parseLabel(seg.Markers.Mid, markMid), seg.Markers.Mid)
 		out.Write(seg.Theirs)
-		writeMarker(markEnd, theirsLabel)
+		writeMarker(markEnd, theirsLabel, seg.Markers.End)
 		return true
 	}
 }
+
+// hasBaseSection reports whether s has a ||||||| section, which a parsed
+// conflict may have even when the section is empty and unlabeled.
+func (s ConflictSegment) hasBaseSection() bool {
+	return len(s.Base) > 0 || s.BaseLabel != "" || s.Markers.Base != nil
+}
+
+// markerLineEnding returns the line ending of the marker line raw: CRLF,
+// LF, or none for a last line without one. A conflict built in code has no
+// marker lines and gets LF.
+func markerLineEnding(raw []byte) string {
+	switch {
+	case raw == nil:
+		return "\n"
+	case bytes.HasSuffix(raw, []byte("\r\n")):
+		return "\r\n"
+	case bytes.HasSuffix(raw, []byte("\n")):
+		return "\n"
+	default:
+		return ""
+	}
+}
@@ -85,6 +85,26 @@ func TestRenderResolvedBoth(t *testing.T) {
 	}
 }
 
+func TestJoinBoth(t *testing.T) {
+	tests := []struct {
+		name                          string
+		ours, theirs, separator, want string
+	}{
+		{"no separator", "a\n", "b\n", "", "a\nb\n"},
+		{"lf", "a\n", "b\n", "-- sep", "a\n-- sep\nb\n"},
+		{"crlf", "a\r\n", "b\r\n", "-- sep", "a\r\n-- sep\r\nb\r\n"},
+		{"ours without final newline", "a", "b\n", "-- sep", "a\n-- sep\nb\n"},
+		{"empty side", "", "b\n", "-- sep", "b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JoinBoth([]byte(tt.ours), []byte(tt.theirs), tt.separator); string(got) != tt.want {
+				t.Fatalf("JoinBoth = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestRenderResolvedNone(t *testing.T) {
 	data, err := os.ReadFile(filepath.Join("testdata", "2way.input"))
 	if err != nil {
@@ -161,6 +181,43 @@ func TestRenderResolvedUnknownSegment(t *testing.T) {
 	}
 }
 
+func TestRenderWithLabels(t *testing.T) {
+	doc, err := Parse([]byte("<<<<<<< ours\na\n||||||| base\no\n=======\nb\n>>>>>>> theirs\nmid\n<<<<<<< ours\nc\n=======\nd\n>>>>>>> theirs\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	rendered, err := RenderWithLabels(doc, Labels{Ours: "HEAD", Base: "BASE", Theirs: "BRANCH"})
+	if err != nil {
+		t.Fatalf("RenderWithLabels failed: %v", err)
+	}
+	want := "<<<<<<< HEAD\na\n||||||| BASE\no\n=======\nb\n>>>>>>> BRANCH\nmid\n<<<<<<< HEAD\nc\n=======\nd\n>>>>>>> BRANCH\n"
+	if string(rendered) != want {
+		t.Fatalf("rendered = %q, want %q", rendered, want)
+	}
+
+	rendered, err = RenderWithLabels(doc, Labels{Theirs: "BRANCH"})
+	if err != nil {
+		t.Fatalf("RenderWithLabels failed: %v", err)
+	}
+	if !bytes.HasPrefix(rendered, []byte("<<<<<<< ours\na\n||||||| base\n")) || !bytes.HasSuffix(rendered, []byte(">>>>>>> BRANCH\n")) {
+		t.Fatalf("rendered = %q, want only the theirs label replaced", rendered)
+	}
+}
+
+func TestRenderConflictBlock(t *testing.T) {
+	block := "<<<<<<< HEAD\na\n||||||| base\no\n=======\nb\n>>>>>>> topic\n"
+	doc, err := Parse([]byte("x\n" + block + "y\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	seg := doc.Segments[doc.Conflicts[0].SegmentIndex].(ConflictSegment)
+	seg.Resolution = ResolutionOurs
+	if got := string(RenderConflictBlock(seg)); got != block {
+		t.Fatalf("RenderConflictBlock = %q, want %q", got, block)
+	}
+}
+
 func TestRenderWithUnresolvedUnknownSegment(t *testing.T) {
 	doc := Document{Segments: []Segment{fakeSegment{}}}
 	_, err := RenderWithUnresolved(doc)
@@ -204,6 +261,7 @@ func TestRenderWithUnresolvedResolutionBranches(t *testing.T) {
 		{name: "ours", resolution: ResolutionOurs, want: "ours\n"},
 		{name: "theirs", resolution: ResolutionTheirs, want: "theirs\n"},
 		{name: "both", resolution: ResolutionBoth, want: "ours\ntheirs\n"},
+		{name: "both-dedup", resolution: ResolutionBothDedup, want: "ours\ntheirs\n"},
 		{name: "none", resolution: ResolutionNone, want: ""},
 	}
 
@@ -222,6 +280,134 @@ func TestRenderWithUnresolvedResolutionBranches(t *testing.T) {
 	}
 }
 
+func TestBothDedup(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+		want   string
+	}{
+		{
+			name:   "overlapping additions",
+			ours:   "import \"fmt\"\nimport \"os\"\n",
+			theirs: "import \"fmt\"\nimport \"strings\"\n",
+			want:   "import \"fmt\"\nimport \"os\"\nimport \"strings\"\n",
+		},
+		{
+			name:   "disjoint additions",
+			ours:   "a\nb\n",
+			theirs: "c\nd\n",
+			want:   "a\nb\nc\nd\n",
+		},
+		{
+			name:   "shared lines anchor order",
+			ours:   "one\nours\nshared\ntail\n",
+			theirs: "theirs\nshared\nextra\ntail\n",
+			want:   "one\nours\ntheirs\nshared\nextra\ntail\n",
+		},
+		{
+			name:   "identical sides",
+			ours:   "same\n",
+			theirs: "same\n",
+			want:   "same\n",
+		},
+		{
+			name:   "repeated lines kept per side",
+			ours:   "}\n}\n",
+			theirs: "}\n",
+			want:   "}\n}\n",
+		},
+		{
+			name:   "missing final newline",
+			ours:   "a",
+			theirs: "b",
+			want:   "a\nb",
+		},
+		{
+			name:   "empty ours",
+			ours:   "",
+			theirs: "t\n",
+			want:   "t\n",
+		},
+		{
+			name:   "additions to base",
+			base:   "import \"fmt\"\n",
+			ours:   "import \"fmt\"\nimport \"os\"\nimport \"io\"\n",
+			theirs: "import \"fmt\"\nimport \"os\"\nimport \"strings\"\n",
+			want:   "import \"fmt\"\nimport \"os\"\nimport \"io\"\nimport \"strings\"\n",
+		},
+		{
+			name:   "one side deletes a base line",
+			base:   "a\nb\nc\n",
+			ours:   "a\nc\n",
+			theirs: "a\nb\nc\nd\n",
+			want:   "a\nc\nd\n",
+		},
+		{
+			name:   "one side changes a base line",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nc\nd\n",
+			want:   "a\nB\nc\nd\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(BothDedup([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs)))
+			if got != tt.want {
+				t.Fatalf("BothDedup() = %q, want %q", got, tt.want)
+			}
+			if again := string(BothDedup([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs))); again != got {
+				t.Fatalf("BothDedup() not deterministic: %q then %q", got, again)
+			}
+		})
+	}
+}
+
+func TestRenderResolvedBothDedup(t *testing.T) {
+	doc := Document{Segments: []Segment{
+		TextSegment{Bytes: []byte("package main\n")},
+		ConflictSegment{
+			Ours:       []byte("import \"fmt\"\nimport \"os\"\n"),
+			Theirs:     []byte("import \"fmt\"\nimport \"io\"\n"),
+			Resolution: ResolutionBothDedup,
+		},
+	}}
+
+	got, err := RenderResolved(doc)
+	if err != nil {
+		t.Fatalf("RenderResolved error: %v", err)
+	}
+	want := "package main\nimport \"fmt\"\nimport \"os\"\nimport \"io\"\n"
+	if string(got) != want {
+		t.Fatalf("RenderResolved() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderAnnotated(t *testing.T) {
+	data := []byte("a\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> branch\nb\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\n<<<<<<< HEAD\nours3\n=======\ntheirs3\n>>>>>>> branch\n")
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	second := doc.Segments[doc.Conflicts[1].SegmentIndex].(ConflictSegment)
+	second.Resolution = ResolutionTheirs
+	doc.Segments[doc.Conflicts[1].SegmentIndex] = second
+
+	rendered, err := RenderAnnotated(doc, "//")
+	if err != nil {
+		t.Fatalf("RenderAnnotated failed: %v", err)
+	}
+
+	expected := "a\n// OURS\nours1\n// THEIRS\ntheirs1\nb\ntheirs2\n// OURS\nours3\n// THEIRS\ntheirs3\n"
+	if string(rendered) != expected {
+		t.Errorf("rendered mismatch:\ngot  %q\nwant %q", rendered, expected)
+	}
+}
+
 func TestAppendConflictSegmentUsesProvidedLabels(t *testing.T) {
 	seg := ConflictSegment{
 		Ours:       []byte("ours\n"),
@@ -370,3 +556,33 @@ func TestRenderResolvedNoTrailingNewline(t *testing.T) {
 		t.Errorf("rendered mismatch:\ngot  %q\nwant %q", rendered, expected)
 	}
 }
+
+func TestRenderEmitsBOMOnce(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "bom.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	unresolved, err := RenderWithUnresolved(doc)
+	if err != nil {
+		t.Fatalf("RenderWithUnresolved failed: %v", err)
+	}
+	if !bytes.Equal(unresolved, data) {
+		t.Fatalf("RenderWithUnresolved = %q, want round trip %q", unresolved, data)
+	}
+
+	conflict := doc.Segments[0].(ConflictSegment)
+	conflict.Resolution = ResolutionTheirs
+	doc.Segments[0] = conflict
+	rendered, err := RenderResolved(doc)
+	if err != nil {
+		t.Fatalf("RenderResolved failed: %v", err)
+	}
+	if want := "\xef\xbb\xbftheirs\nafter\n"; string(rendered) != want {
+		t.Fatalf("RenderResolved = %q, want %q", rendered, want)
+	}
+}
@@ -1,5 +1,12 @@
 package markers
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
 type Resolution string
 
 const (
@@ -8,11 +15,23 @@ const (
 	ResolutionTheirs Resolution = "theirs"
 	ResolutionBoth   Resolution = "both"
 	ResolutionNone   Resolution = "none"
+
+	// ResolutionBothDedup keeps both sides but writes their shared lines once
+	// (see BothDedup).
+	ResolutionBothDedup Resolution = "both-dedup"
 )
 
 type Document struct {
 	Segments  []Segment
 	Conflicts []ConflictRef
+
+	// BOM records a leading UTF-8 byte-order mark. Parse strips it from the
+	// segments and the render functions write it back once at the start.
+	BOM bool
+
+	// BothSeparator is a line the render functions put between ours and
+	// theirs of ResolutionBoth conflicts (see JoinBoth); empty adds none.
+	BothSeparator string
 }
 
 type Segment interface{ isSegment() }
@@ -32,13 +51,102 @@ type ConflictSegment struct {
 
 	// For future: labels (e.g., HEAD, branch name)
 	Resolution Resolution
+
+	// Markers keeps the marker lines as parsed so an unresolved conflict
+	// renders back byte for byte.
+	Markers MarkerLines
 }
 
 func (ConflictSegment) isSegment() {}
 
+// MarkerLines are the raw marker lines of a parsed conflict, line endings
+// included. Base is nil when the conflict has no base section. Conflicts
+// built in code leave them nil and get markers ended with LF.
+type MarkerLines struct {
+	Start []byte
+	Base  []byte
+	Mid   []byte
+	End   []byte
+}
+
+// Hash identifies the conflict by its content: the hex SHA-256 of its ours,
+// base and theirs sections. Unlike the conflict's index it does not change
+// when other conflicts are resolved, and labels and resolution are ignored.
+func (s ConflictSegment) Hash() string {
+	h := sha256.New()
+	for _, part := range [][]byte{s.Ours, s.Base, s.Theirs} {
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CommonPrefixLines returns the leading lines, end-of-line bytes included,
+// that ours, theirs and base (when present) all start with.
+func (s ConflictSegment) CommonPrefixLines() [][]byte {
+	sides := s.sideLines()
+	prefix, _ := commonEdges(sides)
+	return sides[0][:prefix]
+}
+
+// CommonSuffixLines returns the trailing lines that ours, theirs and base
+// (when present) all end with. Lines already counted by CommonPrefixLines are
+// left out, so trimming both never overlaps.
+func (s ConflictSegment) CommonSuffixLines() [][]byte {
+	sides := s.sideLines()
+	_, suffix := commonEdges(sides)
+	return sides[0][len(sides[0])-suffix:]
+}
+
+func (s ConflictSegment) sideLines() [][][]byte {
+	sides := [][][]byte{SplitLinesKeepEOL(s.Ours), SplitLinesKeepEOL(s.Theirs)}
+	if s.Base != nil {
+		sides = append(sides, SplitLinesKeepEOL(s.Base))
+	}
+	return sides
+}
+
+// commonEdges counts the lines shared at the start and then at the end of
+// every side.
+func commonEdges(sides [][][]byte) (prefix, suffix int) {
+	shortest := len(sides[0])
+	for _, lines := range sides[1:] {
+		shortest = min(shortest, len(lines))
+	}
+	for prefix < shortest && sameLineFromStart(sides, prefix) {
+		prefix++
+	}
+	for suffix < shortest-prefix && sameLineFromEnd(sides, suffix) {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+func sameLineFromStart(sides [][][]byte, i int) bool {
+	for _, lines := range sides[1:] {
+		if !bytes.Equal(lines[i], sides[0][i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLineFromEnd(sides [][][]byte, i int) bool {
+	first := sides[0][len(sides[0])-1-i]
+	for _, lines := range sides[1:] {
+		if !bytes.Equal(lines[len(lines)-1-i], first) {
+			return false
+		}
+	}
+	return true
+}
+
 // ConflictRef points to a conflict segment inside Document.Segments.
 //
 // We keep an index list for convenient iteration and stable ordering.
 type ConflictRef struct {
 	SegmentIndex int
+	// Hash is the segment's Hash as of parsing, for keying conflicts across
+	// re-parses.
+	Hash string
 }
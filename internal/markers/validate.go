@@ -0,0 +1,85 @@
+package markers
+
+import "fmt"
+
+// IssueKind classifies a ValidationIssue.
+type IssueKind string
+
+const (
+	// IssueNotConflict means a ConflictRef does not point at a
+	// ConflictSegment; it indicates a bug in whatever built the document.
+	IssueNotConflict IssueKind = "not-conflict"
+	// IssueMissingBase means a conflict has no diff3 base section.
+	IssueMissingBase IssueKind = "missing-base"
+	// IssueNestedMarkers means a conflict side contains marker lines, as
+	// left behind by resolving a file that still had conflicts in it.
+	IssueNestedMarkers IssueKind = "nested-markers"
+	// IssueLabelMismatch means a conflict's ours or theirs label differs
+	// from the first conflict's, e.g. after concatenating two merges.
+	IssueLabelMismatch IssueKind = "label-mismatch"
+)
+
+// ValidationIssue describes one problem found by Validate. Conflict is the
+// 0-based index into Document.Conflicts.
+type ValidationIssue struct {
+	Kind     IssueKind
+	Conflict int
+	Message  string
+}
+
+func (i ValidationIssue) Error() string {
+	return i.Message
+}
+
+// Validate reports every problem it finds in doc's conflicts, in conflict
+// order. A document without issues returns nil.
+func Validate(doc Document) []ValidationIssue {
+	var issues []ValidationIssue
+	var first *ConflictSegment
+	firstIndex := 0
+	for i, ref := range doc.Conflicts {
+		if ref.SegmentIndex < 0 || ref.SegmentIndex >= len(doc.Segments) {
+			issues = append(issues, ValidationIssue{IssueNotConflict, i, fmt.Sprintf("internal: conflict %d is not a ConflictSegment", i)})
+			continue
+		}
+		seg, ok := doc.Segments[ref.SegmentIndex].(ConflictSegment)
+		if !ok {
+			issues = append(issues, ValidationIssue{IssueNotConflict, i, fmt.Sprintf("internal: conflict %d is not a ConflictSegment", i)})
+			continue
+		}
+
+		if len(seg.Base) == 0 && seg.BaseLabel == "" {
+			issues = append(issues, ValidationIssue{IssueMissingBase, i, fmt.Sprintf("conflict %d is missing base chunk (base completeness requires exact base for all conflicts)", i)})
+		}
+		for _, side := range []struct {
+			name string
+			data []byte
+		}{{"ours", seg.Ours}, {"base", seg.Base}, {"theirs", seg.Theirs}} {
+			if line, ok := markerLine(side.data); ok {
+				issues = append(issues, ValidationIssue{IssueNestedMarkers, i, fmt.Sprintf("conflict %d has a nested marker in %s at line %d", i, side.name, line)})
+			}
+		}
+
+		if first == nil {
+			first, firstIndex = &seg, i
+			continue
+		}
+		if seg.OursLabel != first.OursLabel || seg.TheirsLabel != first.TheirsLabel {
+			issues = append(issues, ValidationIssue{IssueLabelMismatch, i, fmt.Sprintf("conflict %d is labelled %q/%q but conflict %d is labelled %q/%q",
+				i, seg.OursLabel, seg.TheirsLabel, firstIndex, first.OursLabel, first.TheirsLabel)})
+		}
+	}
+	return issues
+}
+
+// markerLine returns the 1-based line of the first conflict marker in data.
+func markerLine(data []byte) (int, bool) {
+	for n, line := range SplitLinesKeepEOL(data) {
+		for _, mark := range [][]byte{markStart, markBase, markMid, markEnd} {
+			if hasLinePrefix(line, mark) {
+				return n + 1, true
+			}
+		}
+	}
+	return 0, false
+}
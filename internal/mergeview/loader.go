@@ -3,7 +3,9 @@ package mergeview
 import (
 	"context"
 	"fmt"
+	"os"
 
+	"github.com/chojs23/ec/internal/charset"
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/gitmerge"
 	"github.com/chojs23/ec/internal/markers"
@@ -12,8 +14,16 @@ import (
 // LoadCanonicalDocument builds the canonical conflict document from the explicit
 // base/local/remote inputs. This keeps conflict structure anchored to the stage
 // files instead of the merged working copy.
+//
+// Without stage files the merged file's own markers are the only record of
+// the conflicts, so they are parsed as they are. Either way the document
+// carries opts.BothSeparator for rendering.
 func LoadCanonicalDocument(ctx context.Context, opts cli.Options) (markers.Document, error) {
-	diff3Bytes, err := gitmerge.MergeFileDiff3(ctx, opts.LocalPath, opts.BasePath, opts.RemotePath)
+	if opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" {
+		return loadMergedDocument(opts)
+	}
+
+	diff3Bytes, err := gitmerge.MergeFile(ctx, opts.ConflictStyle, opts.LocalPath, opts.BasePath, opts.RemotePath)
 	if err != nil {
 		return markers.Document{}, fmt.Errorf("generate diff3 view: %w", err)
 	}
@@ -23,5 +33,31 @@ func LoadCanonicalDocument(ctx context.Context, opts cli.Options) (markers.Docum
 		return markers.Document{}, fmt.Errorf("parse diff3 view: %w", err)
 	}
 
+	doc, err = charset.DecodeDocument(opts.Encoding, doc)
+	if err != nil {
+		return markers.Document{}, fmt.Errorf("decode diff3 view: %w", err)
+	}
+	doc.BothSeparator = opts.BothSeparator
+
+	return doc, nil
+}
+
+func loadMergedDocument(opts cli.Options) (markers.Document, error) {
+	mergedBytes, err := os.ReadFile(opts.MergedPath)
+	if err != nil {
+		return markers.Document{}, fmt.Errorf("read merged: %w", err)
+	}
+
+	doc, err := markers.Parse(mergedBytes)
+	if err != nil {
+		return markers.Document{}, fmt.Errorf("parse merged: %w", err)
+	}
+
+	doc, err = charset.DecodeDocument(opts.Encoding, doc)
+	if err != nil {
+		return markers.Document{}, fmt.Errorf("decode merged: %w", err)
+	}
+	doc.BothSeparator = opts.BothSeparator
+
 	return doc, nil
 }
@@ -0,0 +1,143 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
+	"github.com/chojs23/ec/internal/tui"
+)
+
+// isDir reports whether path names an existing directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// resolveDirectory opens the resolver on each conflicted file under the
+// MERGED directory in turn, pairing it by relative path with the files of
+// the BASE, LOCAL and REMOTE directories. q moves on to the next file and
+// ctrl+c stops. Files that cannot be paired are reported and skipped.
+func resolveDirectory(ctx context.Context, opts cli.Options) (int, error) {
+	files, skipped, err := pairDirectoryFiles(opts)
+	if err != nil {
+		return fail(err)
+	}
+	for _, msg := range skipped {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	if len(files) == 0 {
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "No conflicted files found in %s\n", opts.MergedPath)
+		}
+		return 0, nil
+	}
+
+	var errs []error
+	for i, fileOpts := range files {
+		var next []string
+		for _, later := range files[i+1:] {
+			next = append(next, later.MergedPath)
+		}
+		result, err := tui.RunBatch(ctx, fileOpts, tui.RepoFile{NextFiles: next})
+		printResultSummary(opts, result)
+		switch {
+		case err == nil:
+			// Quit with ctrl+c: leave the remaining files alone.
+			return exitCode(errs)
+		case errors.Is(err, tui.ErrBackToSelector), errors.Is(err, tui.ErrNextFile):
+		default:
+			errs = append(errs, reportFileError(fileOpts.MergedPath, err))
+		}
+	}
+	return exitCode(errs)
+}
+
+// fail prints err and returns it with exit code 2.
+func fail(err error) (int, error) {
+	fmt.Fprintln(os.Stderr, err)
+	return 2, err
+}
+
+// reportFileError prints err for one file of a file-by-file run and returns
+// it for the run's error.
+func reportFileError(path string, err error) error {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// exitCode is 2, with the joined errors, when any file failed and 0 otherwise.
+func exitCode(errs []error) (int, error) {
+	if len(errs) > 0 {
+		return 2, errors.Join(errs...)
+	}
+	return 0, nil
+}
+
+// pairDirectoryFiles lists the files under the MERGED directory that have
+// conflict markers, each with the options to resolve it. Without LOCAL and
+// REMOTE each file resolves from its own markers; otherwise a file missing
+// from LOCAL or REMOTE is skipped with a message, and one missing from BASE
+// is resolved without a base. Binary files and .git are not searched.
+func pairDirectoryFiles(opts cli.Options) ([]cli.Options, []string, error) {
+	sides := opts.LocalPath != "" || opts.RemotePath != "" || opts.BasePath != ""
+	if sides {
+		for _, dir := range []string{opts.BasePath, opts.LocalPath, opts.RemotePath} {
+			if !isDir(dir) {
+				return nil, nil, fmt.Errorf("%s is not a directory; with a directory MERGED, BASE, LOCAL and REMOTE must be directories too", dir)
+			}
+		}
+	}
+
+	paths, err := walkCheckDir(opts.MergedPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []cli.Options
+	var skipped []string
+	for _, path := range paths {
+		rel, err := filepath.Rel(opts.MergedPath, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read merged: %w", err)
+		}
+		doc, err := markers.Parse(data)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: skipped: %v", rel, err))
+			continue
+		}
+		if len(doc.Conflicts) == 0 {
+			continue
+		}
+
+		fileOpts := opts
+		fileOpts.MergedPath = path
+		if sides {
+			fileOpts.BasePath = filepath.Join(opts.BasePath, rel)
+			fileOpts.LocalPath = filepath.Join(opts.LocalPath, rel)
+			fileOpts.RemotePath = filepath.Join(opts.RemotePath, rel)
+			if !fileExists(fileOpts.LocalPath) || !fileExists(fileOpts.RemotePath) {
+				skipped = append(skipped, fmt.Sprintf("%s: skipped: not in both LOCAL and REMOTE", rel))
+				continue
+			}
+			if !fileExists(fileOpts.BasePath) {
+				fileOpts.BasePath = os.DevNull
+			}
+		}
+		files = append(files, fileOpts)
+	}
+	return files, skipped, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -1,74 +1,587 @@
 package run
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/engine"
+	"github.com/chojs23/ec/internal/gitutil"
+	"github.com/chojs23/ec/internal/markers"
 	"github.com/chojs23/ec/internal/tui"
 )
 
-func Run(ctx context.Context, opts cli.Options) int {
+const conflictPreviewWidth = 40
+
+// Run runs ec with opts and returns its exit code. A failing run also returns
+// the error behind it, already printed to stderr, so the caller can tell why
+// it failed, e.g. that --timeout expired; a file-by-file run joins the errors
+// of the files that failed.
+func Run(ctx context.Context, opts cli.Options) (int, error) {
+	if opts.Check && opts.MergedPath == "" {
+		return checkFiles(ctx, opts)
+	}
 	if opts.Check {
-		resolved, err := engine.CheckResolvedFile(opts.MergedPath)
+		resolved, doc, err := engine.CheckResolvedFileDocument(opts.MergedPath)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return 2
+			return fail(err)
 		}
 		if resolved {
-			return 0
+			return 0, nil
+		}
+		if opts.Verbose {
+			fmt.Fprint(os.Stderr, formatConflictList(opts.MergedPath, doc))
+		}
+		return 1, nil
+	}
+
+	if opts.RestoreBackup {
+		if err := engine.RestoreBackup(opts.MergedPath, opts); err != nil {
+			return fail(err)
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "Restored %s from %s\n", opts.MergedPath, engine.BackupPath(opts.MergedPath, opts))
+		}
+		return 0, nil
+	}
+
+	if opts.Report && opts.MergedPath == "" {
+		return reportFiles(ctx, opts)
+	}
+	if opts.Report {
+		if err := engine.WriteReport(opts, os.Stdout); err != nil {
+			return fail(err)
 		}
-		return 1
+		return 0, nil
+	}
+
+	if opts.EmitPlan {
+		if err := engine.WritePlan(ctx, opts, os.Stdout); err != nil {
+			return fail(err)
+		}
+		return 0, nil
+	}
+
+	if opts.PrintResolved != "" {
+		if err := engine.PrintResolved(ctx, opts, os.Stdout); err != nil {
+			return fail(err)
+		}
+		return 0, nil
+	}
+
+	if opts.ApplyAll == "none" && !opts.Quiet && !opts.Patch && !opts.ExportWordDiff && !opts.DryRun && !opts.Stdout {
+		warnApplyAllNone(opts)
+	}
+
+	if opts.ApplyAll != "" && opts.MergedPath == "" {
+		return applyAllToRepo(ctx, opts)
 	}
 
-	if opts.ApplyAll != "" {
+	if opts.ApplyAll != "" || opts.Annotate != "" || opts.Plan != "" || opts.PreferBranch != "" {
+		if opts.NormalizeEOL == "" && !opts.Quiet {
+			warnMixedLineEndings(opts.MergedPath, opts)
+		}
 		if err := engine.ApplyAllAndWrite(ctx, opts); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return 2
+			var unmatched *engine.UnmatchedBranchError
+			if errors.As(err, &unmatched) {
+				fmt.Fprintln(os.Stderr, err)
+				return 1, err
+			}
+			return fail(err)
 		}
-		return 0
+		return 0, nil
 	}
 
 	// Interactive TUI
 	if opts.BasePath == "" && opts.LocalPath == "" && opts.RemotePath == "" && opts.MergedPath == "" {
 		baseOpts := opts
+		preferred := ""
+		editPath := opts.EditPath
+		// written holds the last write of each file since the last
+		// continue, for --record-notes.
+		var written []tui.Result
 		for {
 			opts = baseOpts
-			cleanup, err := prepareInteractiveFromRepo(ctx, &opts)
+			var file interactiveFile
+			var cleanup func()
+			var err error
+			if editPath != "" {
+				file, cleanup, err = prepareInteractiveForPath(ctx, &opts, editPath)
+				editPath = ""
+			} else {
+				file, cleanup, err = prepareInteractiveFromRepo(ctx, &opts, preferred)
+			}
+			preferred = ""
 			if err != nil {
 				if errors.Is(err, errNoConflicts) {
-					fmt.Fprintln(os.Stdout, "No conflicted files found in the current directory.")
-					return 0
+					if !opts.Quiet {
+						fmt.Fprintln(os.Stdout, "No conflicted files found in the current directory.")
+					}
+					return 0, nil
 				}
 				if errors.Is(err, tui.ErrSelectorQuit) {
-					return 0
+					return 0, nil
 				}
-				fmt.Fprintln(os.Stderr, err)
-				return 2
+				return fail(err)
+			}
+
+			// A file resolved by hand but not yet staged is still listed;
+			// there is nothing left to resolve, so move on to the next one.
+			if alreadyResolved(opts.MergedPath) {
+				cleanup()
+				reportAlreadyResolved(opts, file.selected)
+				if next := nextUnresolvedFiles(file); len(next) > 0 {
+					preferred = next[0]
+					continue
+				}
+				if opts.Watch && opts.EditPath == "" {
+					continue
+				}
+				return 0, nil
+			}
+
+			if opts.PerFileTool != "" {
+				resolved, err := runPerFileTool(ctx, opts)
+				cleanup()
+				if err != nil {
+					return fail(err)
+				}
+				if !resolved && !opts.Quiet {
+					fmt.Fprintf(os.Stderr, "%s still contains conflict markers\n", file.selected)
+				}
+				if isInteractiveTTY() && opts.EditPath == "" {
+					continue
+				}
+				if resolved {
+					return 0, nil
+				}
+				return 1, nil
 			}
 
-			err = tui.Run(ctx, opts)
+			result, err := tui.RunBatch(ctx, opts, tui.RepoFile{
+				RepoRoot:  file.repoRoot,
+				Path:      file.selected,
+				NextFiles: nextUnresolvedFiles(file),
+			})
 			cleanup()
+			printResultSummary(opts, result)
+			if opts.Stage && result.Written {
+				stageResolved(ctx, opts, file.repoRoot, file.selected, opts.MergedPath)
+			}
+			if result.Written {
+				written = addWrittenResult(written, file.selected, result)
+			}
+			if opts.RecordNotes && result.Continued != "" {
+				recordResolutionNote(ctx, opts, file.repoRoot, result.Commit, written)
+				written = nil
+			}
 			if err != nil {
 				if errors.Is(err, tui.ErrBackToSelector) {
 					continue
 				}
-				fmt.Fprintln(os.Stderr, err)
-				return 2
+				if errors.Is(err, tui.ErrNextFile) {
+					if next := nextUnresolvedFiles(file); len(next) > 0 {
+						preferred = next[0]
+					}
+					continue
+				}
+				return fail(err)
+			}
+			// --watch goes back to the list until no conflicts remain.
+			if opts.Watch {
+				continue
 			}
-			return 0
+			return 0, nil
 		}
 	}
 
-	if err := tui.Run(ctx, opts); err != nil {
+	if isDir(opts.MergedPath) {
+		return resolveDirectory(ctx, opts)
+	}
+
+	// The resolver rebuilds the conflicts from BASE, LOCAL and REMOTE, so it
+	// would show conflicts already resolved in $MERGED.
+	if alreadyResolved(opts.MergedPath) {
+		reportAlreadyResolved(opts, opts.MergedPath)
+		return 0, nil
+	}
+
+	result, err := tui.Run(ctx, opts)
+	printResultSummary(opts, result)
+	if err != nil {
 		if errors.Is(err, tui.ErrBackToSelector) {
-			return 0
+			return 0, nil
 		}
+		return fail(err)
+	}
+	return 0, nil
+}
+
+// alreadyResolved reports whether the merged file at path exists and has no
+// conflict markers left.
+func alreadyResolved(path string) bool {
+	resolved, err := engine.CheckResolvedFile(path)
+	return err == nil && resolved
+}
+
+func reportAlreadyResolved(opts cli.Options, path string) {
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "%s is already resolved (no conflict markers); git add it to mark it resolved\n", path)
+	}
+}
+
+// stageResolved marks path, relative to repoRoot, resolved with git add
+// once mergedPath has no conflict markers left. A failure is only reported:
+// the resolution has already been written.
+func stageResolved(ctx context.Context, opts cli.Options, repoRoot string, path string, mergedPath string) {
+	if !alreadyResolved(mergedPath) {
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "%s still has conflicts; not staging\n", path)
+		}
+		return
+	}
+	if err := gitutil.AddPath(ctx, repoRoot, path); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return 2
+		return
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "Staged %s\n", path)
+	}
+}
+
+// addWrittenResult records result as the last write of path, relative to the
+// repository root, replacing an earlier write of the same file.
+func addWrittenResult(results []tui.Result, path string, result tui.Result) []tui.Result {
+	result.Path = path
+	for i := range results {
+		if results[i].Path == path {
+			results[i] = result
+			return results
+		}
+	}
+	return append(results, result)
+}
+
+// recordResolutionNote adds a git note to commit, the one W's continue made
+// for the resolved stop, with a line per file written. A failure is only
+// reported: the commit has already been made.
+func recordResolutionNote(ctx context.Context, opts cli.Options, repoRoot string, commit string, results []tui.Result) {
+	if len(results) == 0 {
+		return
+	}
+	if commit == "" {
+		fmt.Fprintln(os.Stderr, "Could not find the commit made by the continue; no note recorded")
+		return
+	}
+	if err := gitutil.AddNote(ctx, repoRoot, commit, resolutionNote(results)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "Recorded the resolutions in a git note on %s\n", shortCommit(commit))
+	}
+}
+
+// shortCommit abbreviates a full commit hash for messages.
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// resolutionNote is the --record-notes message: a heading and the summary of
+// each file's resolutions.
+func resolutionNote(results []tui.Result) string {
+	var b strings.Builder
+	b.WriteString("Conflicts resolved with ec:\n\n")
+	for _, result := range results {
+		b.WriteString(result.Summary() + "\n")
+	}
+	return b.String()
+}
+
+// applyAllToRepo runs --apply-all on every conflicted file of the repository,
+// rebuilding each one's stage files first. A failing file is reported and
+// skipped; the exit code is 2 when any file failed.
+func applyAllToRepo(ctx context.Context, opts cli.Options) (int, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fail(fmt.Errorf("get working directory: %w", err))
+	}
+	repoRoot, err := gitutil.RepoRoot(ctx, cwd)
+	if err != nil {
+		return fail(err)
 	}
-	return 0
+	paths, err := gitutil.ListUnmergedFiles(ctx, repoRoot, ".")
+	if err != nil {
+		return fail(err)
+	}
+	paths = filterPaths(paths, opts.Only, opts.Exclude)
+	if len(paths) == 0 {
+		if !opts.Quiet {
+			fmt.Fprintln(os.Stdout, "No conflicted files found in the repository.")
+		}
+		return 0, nil
+	}
+
+	var errs []error
+	for _, path := range paths {
+		fileOpts := opts
+		cleanup, err := prepareInteractiveFile(ctx, repoRoot, path, &fileOpts, nil)
+		if err == nil {
+			if fileOpts.NormalizeEOL == "" && !fileOpts.Quiet {
+				warnMixedLineEndings(fileOpts.MergedPath, fileOpts)
+			}
+			err = engine.ApplyAllAndWrite(ctx, fileOpts)
+			cleanup()
+		}
+		if err != nil {
+			errs = append(errs, reportFileError(path, err))
+			continue
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "%s: applied %s\n", path, opts.ApplyAll)
+		}
+		if opts.Stage {
+			stageResolved(ctx, opts, repoRoot, path, fileOpts.MergedPath)
+		}
+	}
+
+	failed := len(errs)
+	if !opts.Quiet || failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d conflicted file(s) resolved, %d failed\n", len(paths)-failed, len(paths), failed)
+	}
+	return exitCode(errs)
+}
+
+// checkFiles runs --check on every file under opts.CheckDir, or on every
+// conflicted file of the repository with --all, printing each file that still
+// has conflict markers. It returns 1 when any does and 2 when a file could not
+// be checked.
+func checkFiles(ctx context.Context, opts cli.Options) (int, error) {
+	var paths []string
+	if opts.CheckDir != "" {
+		var err error
+		paths, err = walkCheckDir(opts.CheckDir)
+		if err != nil {
+			return fail(err)
+		}
+	} else {
+		var err error
+		paths, err = repoConflictedFiles(ctx, opts)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	unresolved := 0
+	var errs []error
+	for _, path := range paths {
+		resolved, doc, err := engine.CheckResolvedFileDocument(path)
+		if err != nil {
+			errs = append(errs, reportFileError(path, err))
+			continue
+		}
+		if resolved {
+			continue
+		}
+		unresolved++
+		fmt.Fprintln(os.Stdout, path)
+		if opts.Verbose {
+			fmt.Fprint(os.Stderr, formatConflictList(path, doc))
+		}
+	}
+
+	switch {
+	case len(errs) > 0:
+		return exitCode(errs)
+	case unresolved > 0:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// repoConflictedFiles lists the absolute paths of the conflicted files in
+// the repository around the working directory, narrowed by --only and
+// --exclude.
+func repoConflictedFiles(ctx context.Context, opts cli.Options) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("get working directory: %w", err)
+	}
+	repoRoot, err := gitutil.RepoRoot(ctx, cwd)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := gitutil.ListUnmergedFiles(ctx, repoRoot, ".")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range filterPaths(listed, opts.Only, opts.Exclude) {
+		paths = append(paths, filepath.Join(repoRoot, path))
+	}
+	return paths, nil
+}
+
+// reportFiles prints the conflict report of every conflicted file in the
+// repository, one after another, for --report --all. A file that cannot be
+// read or parsed is reported on stderr and makes the exit code 2.
+func reportFiles(ctx context.Context, opts cli.Options) (int, error) {
+	paths, err := repoConflictedFiles(ctx, opts)
+	if err != nil {
+		return fail(err)
+	}
+	var errs []error
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		fileOpts := opts
+		fileOpts.MergedPath = path
+		if err := engine.WriteReport(fileOpts, os.Stdout); err != nil {
+			errs = append(errs, reportFileError(path, err))
+		}
+	}
+	return exitCode(errs)
+}
+
+// walkCheckDir lists the files under dir that --check <dir> looks at: every
+// regular file outside .git directories that does not look binary.
+func walkCheckDir(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		binary, err := looksBinary(path)
+		if err != nil {
+			return err
+		}
+		if !binary {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", dir, err)
+	}
+	return paths, nil
+}
+
+// looksBinary reports whether the start of the file at path has a NUL byte,
+// the test git uses to tell binary files from text.
+func looksBinary(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, 8000)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// printResultSummary reports a file written by the resolver on stderr so a
+// session over many files leaves a trace of each one. --quiet drops it.
+func printResultSummary(opts cli.Options, result tui.Result) {
+	if !result.Written || opts.Quiet {
+		return
+	}
+	fmt.Fprintln(os.Stderr, result.Summary())
+}
+
+// formatConflictList renders one line per conflict in doc with a short preview
+// of each side, for --check --verbose.
+func formatConflictList(path string, doc markers.Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d unresolved conflict(s)\n", path, len(doc.Conflicts))
+	for i, ref := range doc.Conflicts {
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "  %d) ours: %s | theirs: %s\n", i+1, conflictPreview(seg.Ours), conflictPreview(seg.Theirs))
+	}
+	return b.String()
+}
+
+// conflictPreview returns the first non-blank line of side, truncated.
+func conflictPreview(side []byte) string {
+	for _, line := range strings.Split(string(side), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if runes := []rune(line); len(runes) > conflictPreviewWidth {
+			return string(runes[:conflictPreviewWidth-3]) + "..."
+		}
+		return line
+	}
+	return "(empty)"
+}
+
+// warnMixedLineEndings prints a warning when the content of path mixes line
+// ending styles, since the resolution would carry the mix over unchanged.
+// Read and parse errors are left for the caller's own handling.
+func warnMixedLineEndings(path string, opts cli.Options) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	doc, err := markers.Parse(data)
+	if err != nil {
+		return
+	}
+	if stats := markers.DocumentLineEndingStats(doc); stats.Mixed() {
+		fmt.Fprintf(os.Stderr, "%s%s mixes line endings (%s); use --normalize-eol lf|crlf to unify\n", engine.WarningPrefix(os.Stderr, opts), path, stats)
+	}
+}
+
+// warnApplyAllNone prints a warning that --apply-all none keeps neither
+// side, so every conflicting region is deleted from the written file.
+func warnApplyAllNone(opts cli.Options) {
+	fmt.Fprintf(os.Stderr, "%s--apply-all none deletes every conflicting region, keeping neither side; use --dry-run to preview or --backup to keep a copy\n", engine.WarningPrefix(os.Stderr, opts))
+}
+
+// runPerFileTool runs the --per-file-tool command with mergetool-style
+// BASE LOCAL REMOTE MERGED arguments and reports whether MERGED is resolved
+// afterwards.
+func runPerFileTool(ctx context.Context, opts cli.Options) (bool, error) {
+	fields := strings.Fields(opts.PerFileTool)
+	if len(fields) == 0 {
+		return false, errors.New("--per-file-tool command is empty")
+	}
+	args := append(fields[1:], opts.BasePath, opts.LocalPath, opts.RemotePath, opts.MergedPath)
+	cmd := exec.CommandContext(ctx, fields[0], args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("per-file tool failed: %w", err)
+	}
+
+	return engine.CheckResolvedFile(opts.MergedPath)
 }
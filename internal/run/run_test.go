@@ -2,13 +2,17 @@ package run
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/gitmerge"
+	"github.com/chojs23/ec/internal/tui"
 )
 
 func TestRunCheckResolvedExitCodes(t *testing.T) {
@@ -19,7 +23,7 @@ func TestRunCheckResolvedExitCodes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	code := Run(context.Background(), cli.Options{Check: true, MergedPath: resolvedPath})
+	code, _ := Run(context.Background(), cli.Options{Check: true, MergedPath: resolvedPath})
 	if code != 0 {
 		t.Fatalf("resolved check exit code = %d, want 0", code)
 	}
@@ -29,12 +33,39 @@ func TestRunCheckResolvedExitCodes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	code = Run(context.Background(), cli.Options{Check: true, MergedPath: unresolvedPath})
+	code, _ = Run(context.Background(), cli.Options{Check: true, MergedPath: unresolvedPath})
 	if code != 1 {
 		t.Fatalf("unresolved check exit code = %d, want 1", code)
 	}
 }
 
+func TestRunSkipsAlreadyResolvedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+	if err := os.WriteFile(mergedPath, []byte("resolved by hand\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stages do not exist, so reaching the resolver would fail.
+	opts := cli.Options{
+		BasePath:   filepath.Join(tmpDir, "base"),
+		LocalPath:  filepath.Join(tmpDir, "local"),
+		RemotePath: filepath.Join(tmpDir, "remote"),
+		MergedPath: mergedPath,
+		Quiet:      true,
+	}
+	if code, _ := Run(context.Background(), opts); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "resolved by hand\n" {
+		t.Fatalf("merged = %q, want it left alone", data)
+	}
+}
+
 func TestRunApplyAllExitCodes(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration-style test in short mode")
@@ -73,7 +104,7 @@ func TestRunApplyAllExitCodes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	code := Run(ctx, cli.Options{
+	code, _ := Run(ctx, cli.Options{
 		BasePath:   basePath,
 		LocalPath:  localPath,
 		RemotePath: remotePath,
@@ -92,7 +123,7 @@ func TestRunApplyAllExitCodes(t *testing.T) {
 		t.Fatalf("resolved content mismatch: %q", string(data))
 	}
 
-	code = Run(ctx, cli.Options{
+	code, _ = Run(ctx, cli.Options{
 		BasePath:   basePath,
 		LocalPath:  localPath,
 		RemotePath: remotePath,
@@ -102,4 +133,481 @@ func TestRunApplyAllExitCodes(t *testing.T) {
 	if code != 2 {
 		t.Fatalf("apply-all error exit code = %d, want 2", code)
 	}
+
+	// The merged file is resolved by now; start again from the conflict.
+	if err := os.WriteFile(mergedPath, mergeView, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	code, err = Run(expired, cli.Options{
+		BasePath:   basePath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		MergedPath: mergedPath,
+		ApplyAll:   "ours",
+	})
+	if code != 2 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("apply-all after the deadline = %d, %v; want 2 and context.DeadlineExceeded", code, err)
+	}
+}
+
+func TestRunCheckVerboseListsConflicts(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "unresolved.txt")
+	content := "start\n<<<<<<< HEAD\nours one\n=======\ntheirs one\n>>>>>>> branch\nmid\n<<<<<<< HEAD\n=======\n  theirs two\n>>>>>>> branch\nend\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr, err := os.CreateTemp(tmpDir, "stderr-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = stderr
+	code, _ := Run(context.Background(), cli.Options{Check: true, Verbose: true, MergedPath: path})
+	os.Stderr = oldStderr
+	stderr.Close()
+
+	if code != 1 {
+		t.Fatalf("check exit code = %d, want 1", code)
+	}
+	got, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := path + ": 2 unresolved conflict(s)\n" +
+		"  1) ours: ours one | theirs: theirs one\n" +
+		"  2) ours: (empty) | theirs: theirs two\n"
+	if string(got) != want {
+		t.Fatalf("stderr = %q, want %q", string(got), want)
+	}
+}
+
+func TestRunCheckDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"clean.txt":          "ok\n",
+		"sub/unresolved.txt": "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n",
+		"heading.md":         "Title\n=======\n",
+		"blob.bin":           "\x00<<<<<<< HEAD\n",
+		".git/MERGE_MSG":     "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout := captureStdout(t, func() {
+		if code, _ := Run(context.Background(), cli.Options{Check: true, CheckDir: dir}); code != 1 {
+			t.Fatalf("check dir exit code = %d, want 1", code)
+		}
+	})
+	if want := filepath.Join(dir, "sub", "unresolved.txt") + "\n"; stdout != want {
+		t.Fatalf("stdout = %q, want %q", stdout, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "sub", "unresolved.txt"), []byte("ours\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := Run(context.Background(), cli.Options{Check: true, CheckDir: dir}); code != 0 {
+		t.Fatalf("check dir exit code after resolving = %d, want 0", code)
+	}
+}
+
+func TestPairDirectoryFiles(t *testing.T) {
+	root := t.TempDir()
+	conflict := "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n"
+	for name, content := range map[string]string{
+		"merged/a.txt":     conflict,
+		"merged/clean.txt": "ok\n",
+		"merged/sub/b.txt": conflict,
+		"merged/added.txt": conflict,
+		"merged/blob.bin":  "\x00" + conflict,
+		"base/a.txt":       "base\n",
+		"base/sub/b.txt":   "base\n",
+		"local/a.txt":      "ours\n",
+		"local/sub/b.txt":  "ours\n",
+		"local/added.txt":  "ours\n",
+		"remote/a.txt":     "theirs\n",
+		"remote/added.txt": "theirs\n",
+		"remote/clean.txt": "ok\n",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := cli.Options{
+		BasePath:   filepath.Join(root, "base"),
+		LocalPath:  filepath.Join(root, "local"),
+		RemotePath: filepath.Join(root, "remote"),
+		MergedPath: filepath.Join(root, "merged"),
+	}
+	files, skipped, err := pairDirectoryFiles(opts)
+	if err != nil {
+		t.Fatalf("pairDirectoryFiles error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %+v, want a.txt and added.txt", files)
+	}
+	if files[0].MergedPath != filepath.Join(root, "merged", "a.txt") || files[0].BasePath != filepath.Join(root, "base", "a.txt") || files[0].RemotePath != filepath.Join(root, "remote", "a.txt") {
+		t.Fatalf("a.txt paired as %+v", files[0])
+	}
+	if files[1].MergedPath != filepath.Join(root, "merged", "added.txt") || files[1].BasePath != os.DevNull {
+		t.Fatalf("added.txt paired as %+v, want no base", files[1])
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0], filepath.Join("sub", "b.txt")) {
+		t.Fatalf("skipped = %q, want sub/b.txt", skipped)
+	}
+
+	opts.LocalPath = filepath.Join(root, "local", "a.txt")
+	if _, _, err := pairDirectoryFiles(opts); err == nil || !strings.Contains(err.Error(), "must be directories") {
+		t.Fatalf("pairDirectoryFiles with a file LOCAL error = %v", err)
+	}
+
+	files, _, err = pairDirectoryFiles(cli.Options{MergedPath: opts.MergedPath})
+	if err != nil || len(files) != 3 || files[0].LocalPath != "" {
+		t.Fatalf("merged-only pairing = %+v, %v; want three files resolved from their markers", files, err)
+	}
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = f
+	fn()
+	os.Stdout = old
+	f.Close()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunApplyAllWarnsOnMixedLineEndings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration-style test in short mode")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	basePath := filepath.Join(tmpDir, "base.txt")
+	localPath := filepath.Join(tmpDir, "local.txt")
+	remotePath := filepath.Join(tmpDir, "remote.txt")
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	for path, content := range map[string]string{
+		basePath:   "line1\nbase\nline3\n",
+		localPath:  "line1\nlocal\r\nline3\n",
+		remotePath: "line1\nremote\nline3\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mergeView, err := gitmerge.MergeFileDiff3(ctx, localPath, basePath, remotePath)
+	if err != nil {
+		t.Fatalf("MergeFileDiff3 failed: %v", err)
+	}
+
+	runApplyAll := func(normalize string, quiet bool) (int, string) {
+		if err := os.WriteFile(mergedPath, mergeView, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stderr, err := os.CreateTemp(tmpDir, "stderr-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldStderr := os.Stderr
+		os.Stderr = stderr
+		code, _ := Run(ctx, cli.Options{
+			BasePath:     basePath,
+			LocalPath:    localPath,
+			RemotePath:   remotePath,
+			MergedPath:   mergedPath,
+			ApplyAll:     "both",
+			NormalizeEOL: normalize,
+			Quiet:        quiet,
+		})
+		os.Stderr = oldStderr
+		stderr.Close()
+		got, err := os.ReadFile(stderr.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, string(got)
+	}
+
+	code, warning := runApplyAll("", false)
+	if code != 0 {
+		t.Fatalf("apply-all exit code = %d, want 0", code)
+	}
+	if !strings.Contains(warning, "mixes line endings") {
+		t.Fatalf("stderr = %q, want mixed line ending warning", warning)
+	}
+
+	code, warning = runApplyAll("", true)
+	if code != 0 {
+		t.Fatalf("apply-all exit code = %d, want 0", code)
+	}
+	if warning != "" {
+		t.Fatalf("stderr = %q, want no warning with --quiet", warning)
+	}
+
+	code, warning = runApplyAll("lf", false)
+	if code != 0 {
+		t.Fatalf("apply-all exit code = %d, want 0", code)
+	}
+	if warning != "" {
+		t.Fatalf("stderr = %q, want no warning with --normalize-eol", warning)
+	}
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line1\nlocal\nremote\nline3\n" {
+		t.Fatalf("resolved content = %q, want LF-only", string(data))
+	}
+}
+
+func TestRunApplyAllNoneWarns(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := map[string]string{
+		"base.txt":   "line1\nbase\nline3\n",
+		"local.txt":  "line1\nlocal\nline3\n",
+		"remote.txt": "line1\nremote\nline3\n",
+	}
+	for name, content := range paths {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+
+	runApplyNone := func(dryRun bool) string {
+		if err := os.WriteFile(mergedPath, []byte("line1\n<<<<<<< ours\nlocal\n=======\nremote\n>>>>>>> theirs\nline3\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stderr, err := os.CreateTemp(tmpDir, "stderr-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldStderr := os.Stderr
+		os.Stderr = stderr
+		captureStdout(t, func() {
+			if code, _ := Run(context.Background(), cli.Options{
+				BasePath:   filepath.Join(tmpDir, "base.txt"),
+				LocalPath:  filepath.Join(tmpDir, "local.txt"),
+				RemotePath: filepath.Join(tmpDir, "remote.txt"),
+				MergedPath: mergedPath,
+				ApplyAll:   "none",
+				DryRun:     dryRun,
+			}); code != 0 {
+				t.Errorf("apply-all none exit code = %d, want 0", code)
+			}
+		})
+		os.Stderr = oldStderr
+		stderr.Close()
+		got, err := os.ReadFile(stderr.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(got)
+	}
+
+	if warning := runApplyNone(false); !strings.Contains(warning, "--apply-all none deletes every conflicting region") {
+		t.Fatalf("stderr = %q, want a warning that none deletes the conflicts", warning)
+	}
+	if data, err := os.ReadFile(mergedPath); err != nil || string(data) != "line1\nline3\n" {
+		t.Fatalf("merged content = %q, %v; want the conflict removed", data, err)
+	}
+	if warning := runApplyNone(true); warning != "" {
+		t.Fatalf("stderr = %q, want no warning with --dry-run", warning)
+	}
+}
+
+func TestRunPerFileToolMarksSelectorCandidateResolved(t *testing.T) {
+	repoRoot := t.TempDir()
+	mergedPath := filepath.Join(repoRoot, "conflict.txt")
+	if err := os.WriteFile(mergedPath, []byte("<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	toolPath := filepath.Join(t.TempDir(), "tool.sh")
+	script := "#!/bin/sh\nprintf 'resolved by %s\\n' \"$1\" > \"$5\"\n"
+	if err := os.WriteFile(toolPath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := buildFileCandidates(context.Background(), repoRoot, []string{"conflict.txt"}, nil)
+	if err != nil {
+		t.Fatalf("buildFileCandidates error: %v", err)
+	}
+	if candidates[0].Resolved {
+		t.Fatalf("expected candidate unresolved before running tool")
+	}
+
+	opts := cli.Options{
+		BasePath:    "base",
+		LocalPath:   "local",
+		RemotePath:  "remote",
+		MergedPath:  mergedPath,
+		PerFileTool: toolPath + " tool-arg",
+	}
+	resolved, err := runPerFileTool(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("runPerFileTool error: %v", err)
+	}
+	if !resolved {
+		t.Fatalf("runPerFileTool resolved = false, want true")
+	}
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "resolved by tool-arg\n" {
+		t.Fatalf("merged = %q, want tool output with args in mergetool order", string(data))
+	}
+
+	candidates, err = buildFileCandidates(context.Background(), repoRoot, []string{"conflict.txt"}, nil)
+	if err != nil {
+		t.Fatalf("buildFileCandidates error: %v", err)
+	}
+	if !candidates[0].Resolved {
+		t.Fatalf("expected selector candidate resolved after tool")
+	}
+}
+
+func TestRunApplyAllToRepo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping git integration test in short mode")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init")
+	runGit(t, repoDir, "config", "user.email", "test@example.com")
+	runGit(t, repoDir, "config", "user.name", "Test User")
+	writeAll := func(content string) {
+		t.Helper()
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if err := os.WriteFile(filepath.Join(repoDir, name), []byte(name+" "+content+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		runGit(t, repoDir, "add", ".")
+		runGit(t, repoDir, "commit", "-m", content)
+	}
+	writeAll("base")
+	runGit(t, repoDir, "checkout", "-b", "feature")
+	writeAll("theirs")
+	runGit(t, repoDir, "checkout", "-")
+	writeAll("ours")
+	mergeCmd := exec.Command("git", "merge", "feature")
+	mergeCmd.Dir = repoDir
+	if output, err := mergeCmd.CombinedOutput(); err == nil {
+		t.Fatalf("expected merge conflict, got success: %s", string(output))
+	}
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd error: %v", err)
+	}
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("chdir error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Fatalf("restore cwd error: %v", err)
+		}
+	})
+
+	var code int
+	report := captureStdout(t, func() {
+		code, _ = Run(context.Background(), cli.Options{Report: true, AllFiles: true, Exclude: []string{"b.txt"}})
+	})
+	if code != 0 || !strings.Contains(report, "a.txt: 1 conflict(s)") || strings.Contains(report, "b.txt") {
+		t.Fatalf("--report --all exit code = %d, report:\n%s", code, report)
+	}
+
+	opts := cli.Options{ApplyAll: "theirs", AllFiles: true, Exclude: []string{"b.txt"}, Stage: true, Quiet: true, ConflictStyle: "diff3"}
+	if code, _ := Run(context.Background(), opts); code != 0 {
+		t.Fatalf("Run exit code = %d, want 0", code)
+	}
+	for name, want := range map[string]string{"a.txt": "a.txt theirs\n", "b.txt": "<<<<<<<"} {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), want) {
+			t.Fatalf("%s = %q, want prefix %q", name, data, want)
+		}
+	}
+	unmerged := exec.Command("git", "diff", "--name-only", "--diff-filter=U")
+	unmerged.Dir = repoDir
+	output, err := unmerged.Output()
+	if err != nil {
+		t.Fatalf("git diff error: %v", err)
+	}
+	if string(output) != "b.txt\n" {
+		t.Fatalf("unmerged after --stage = %q, want only b.txt", output)
+	}
+	stdout := captureStdout(t, func() {
+		if code, _ := Run(context.Background(), cli.Options{Check: true, AllFiles: true}); code != 1 {
+			t.Fatalf("check --all exit code = %d, want 1", code)
+		}
+	})
+	if !strings.HasSuffix(stdout, "/b.txt\n") || strings.Contains(stdout, "a.txt") {
+		t.Fatalf("check --all stdout = %q, want only b.txt", stdout)
+	}
+}
+
+func TestRecordResolutionNoteAddsNoteToCommit(t *testing.T) {
+	argsPath := filepath.Join(t.TempDir(), "args")
+	withFakeGit(t, `#!/bin/sh
+for arg in "$@"; do
+  printf "%s\n" "$arg" >> "`+argsPath+`"
+done
+exit 0
+`)
+
+	var written []tui.Result
+	written = addWrittenResult(written, "a.go", tui.Result{Path: "/tmp/a.go", Written: true, Conflicts: 2, Ours: 2})
+	written = addWrittenResult(written, "b.go", tui.Result{Written: true, Conflicts: 1, Theirs: 1})
+	written = addWrittenResult(written, "a.go", tui.Result{Written: true, Conflicts: 2, Ours: 1, Both: 1, Continued: "merge"})
+	recordResolutionNote(context.Background(), cli.Options{Quiet: true}, t.TempDir(), "abc1234", written)
+
+	data, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	summary := "Conflicts resolved with ec:\n\n" +
+		"a.go: 2 conflict(s) - ours 1, theirs 0, both 1, none 0, manual 0\n" +
+		"b.go: 1 conflict(s) - ours 0, theirs 1, both 0, none 0, manual 0\n"
+	want := "notes\nadd\n-f\n-m\n" + summary + "\nabc1234\n"
+	if string(data) != want {
+		t.Fatalf("git argv = %q, want %q", data, want)
+	}
 }
@@ -6,47 +6,211 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/engine"
+	"github.com/chojs23/ec/internal/gitmerge"
 	"github.com/chojs23/ec/internal/gitutil"
 	"github.com/chojs23/ec/internal/tui"
 )
 
 var errNoConflicts = errors.New("no conflicted files found")
 
-func prepareInteractiveFromRepo(ctx context.Context, opts *cli.Options) (func(), error) {
+var errSubmoduleConflict = errors.New("submodule conflict not supported")
+
+// interactiveFile describes the file picked in no-args mode along with the
+// conflicted files it was picked from.
+type interactiveFile struct {
+	repoRoot string
+	paths    []string
+	selected string
+}
+
+// prepareInteractiveFromRepo lists conflicted files, picks one and fills opts
+// with its stage files. When preferred is one of the conflicted paths it is
+// opened directly instead of prompting.
+func prepareInteractiveFromRepo(ctx context.Context, opts *cli.Options, preferred string) (interactiveFile, func(), error) {
 	cwd, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("get working directory: %w", err)
+		return interactiveFile{}, nil, fmt.Errorf("get working directory: %w", err)
 	}
 
 	repoRoot, err := gitutil.RepoRoot(ctx, cwd)
 	if err != nil {
-		return nil, err
+		return interactiveFile{}, nil, err
+	}
+
+	// --all lists every conflict in the repository; by default only those
+	// under the current directory are offered.
+	scope := "."
+	if !opts.AllFiles {
+		if rel, err := filepath.Rel(repoRoot, cwd); err == nil {
+			scope = filepath.ToSlash(rel)
+		}
+	}
+
+	listPaths := func() ([]string, error) {
+		paths, err := gitutil.ListUnmergedFiles(ctx, repoRoot, scope)
+		if err != nil {
+			return nil, err
+		}
+		return filterPaths(paths, opts.Only, opts.Exclude), nil
+	}
+	paths, err := listPaths()
+	if err != nil {
+		return interactiveFile{}, nil, err
+	}
+	if len(paths) == 0 && !opts.KeepWatching {
+		return interactiveFile{}, nil, errNoConflicts
+	}
+
+	// The selector preview and preparing the chosen file read the same
+	// stages; the index cannot change in between.
+	stages := gitutil.NewStageCache()
+	selected := ""
+	if preferred != "" && slices.Contains(paths, preferred) {
+		selected = preferred
+	} else if opts.Watch {
+		selected, paths, err = watchPathInteractive(ctx, *opts, repoRoot, paths, listPaths)
+		if err != nil {
+			return interactiveFile{}, nil, err
+		}
+	} else {
+		selected, err = selectPathInteractive(ctx, *opts, repoRoot, paths, stages)
+		if err != nil {
+			return interactiveFile{}, nil, err
+		}
 	}
 
-	scope, err := filepath.Rel(repoRoot, cwd)
+	cleanup, err := prepareInteractiveFile(ctx, repoRoot, selected, opts, stages)
 	if err != nil {
-		scope = "."
+		return interactiveFile{}, nil, err
 	}
-	scope = filepath.ToSlash(scope)
+	return interactiveFile{repoRoot: repoRoot, paths: paths, selected: selected}, cleanup, nil
+}
 
-	paths, err := gitutil.ListUnmergedFiles(ctx, repoRoot, scope)
+// prepareInteractiveForPath fills opts with the stage files of the conflicted
+// file at target, a path relative to the current directory, without showing
+// the selector. It fails when target is not an unmerged file.
+func prepareInteractiveForPath(ctx context.Context, opts *cli.Options, target string) (interactiveFile, func(), error) {
+	cwd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return interactiveFile{}, nil, fmt.Errorf("get working directory: %w", err)
+	}
+
+	repoRoot, err := gitutil.RepoRoot(ctx, cwd)
+	if err != nil {
+		return interactiveFile{}, nil, err
+	}
+
+	absPath := target
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(cwd, target)
+	}
+	rel, err := filepath.Rel(repoRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return interactiveFile{}, nil, fmt.Errorf("%s is outside the repository %s", target, repoRoot)
 	}
-	if len(paths) == 0 {
-		return nil, errNoConflicts
+	selected := filepath.ToSlash(rel)
+
+	paths, err := gitutil.ListUnmergedFiles(ctx, repoRoot, ".")
+	if err != nil {
+		return interactiveFile{}, nil, err
+	}
+	if !slices.Contains(paths, selected) {
+		return interactiveFile{}, nil, fmt.Errorf("%s is not an unmerged file", target)
 	}
 
-	selected, err := selectPathInteractive(ctx, repoRoot, paths)
+	cleanup, err := prepareInteractiveFile(ctx, repoRoot, selected, opts, nil)
+	if err != nil {
+		return interactiveFile{}, nil, err
+	}
+	return interactiveFile{repoRoot: repoRoot, paths: paths, selected: selected}, cleanup, nil
+}
+
+// filterPaths keeps the repo-relative paths matching at least one of only
+// (every path when only is empty) and none of exclude.
+func filterPaths(paths []string, only []string, exclude []string) []string {
+	if len(only) == 0 && len(exclude) == 0 {
+		return paths
+	}
+	matchesAny := func(patterns []string, name string) bool {
+		for _, pattern := range patterns {
+			if matchGlob(pattern, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	filtered := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if len(only) > 0 && !matchesAny(only, p) {
+			continue
+		}
+		if matchesAny(exclude, p) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// matchGlob matches a slash-separated path against pattern. A pattern without
+// a slash is matched against the file name alone, so "*.go" matches Go files
+// in any directory. Otherwise the pattern is matched segment by segment with
+// path.Match, and a "**" segment matches any number of directories.
+func matchGlob(pattern string, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// prepareInteractiveFile writes the stages of the conflicted file selected to
+// temporary files and points opts at them. Stages are read through stages,
+// which may be nil.
+func prepareInteractiveFile(ctx context.Context, repoRoot string, selected string, opts *cli.Options, stages *gitutil.StageCache) (func(), error) {
+	// Submodule conflicts record commits (gitlinks) in the stages, not file
+	// content, so there is nothing to show or write.
+	modes, err := gitutil.UnmergedStageModes(ctx, repoRoot, selected)
 	if err != nil {
 		return nil, err
 	}
+	for _, mode := range modes {
+		if mode == gitutil.GitlinkMode {
+			return nil, fmt.Errorf("%s: %w; check out the wanted commit in the submodule and git add it", selected, errSubmoduleConflict)
+		}
+	}
 
 	mergedPath := selected
 	if !filepath.IsAbs(mergedPath) {
@@ -56,21 +220,28 @@ func prepareInteractiveFromRepo(ctx context.Context, opts *cli.Options) (func(),
 		return nil, fmt.Errorf("cannot access merged file %s: %w", selected, err)
 	}
 
-	localBytes, err := gitutil.ShowStage(ctx, repoRoot, 2, selected)
+	localBytes, err := stages.ShowStage(ctx, repoRoot, 2, selected)
 	if err != nil {
 		return nil, fmt.Errorf("missing ours stage for %s: %w", selected, err)
 	}
-	remoteBytes, err := gitutil.ShowStage(ctx, repoRoot, 3, selected)
+	remoteBytes, err := stages.ShowStage(ctx, repoRoot, 3, selected)
 	if err != nil {
 		return nil, fmt.Errorf("missing theirs stage for %s: %w", selected, err)
 	}
 
-	baseBytes, err := gitutil.ShowStage(ctx, repoRoot, 1, selected)
 	allowMissingBase := false
-	if err != nil {
+	var baseBytes []byte
+	if opts.BaseRev != "" {
+		baseBytes, err = gitutil.ShowRevFile(ctx, repoRoot, opts.BaseRev, selected)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read base for %s from %s: %w", selected, opts.BaseRev, err)
+		}
+	} else if baseBytes, err = stages.ShowStage(ctx, repoRoot, 1, selected); err != nil {
 		allowMissingBase = true
 		baseBytes = nil
-		fmt.Fprintf(os.Stderr, "Warning: base stage missing for %s; continuing without base view.\n", selected)
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "%sbase stage missing for %s; continuing without base view.\n", engine.WarningPrefix(os.Stderr, *opts), selected)
+		}
 	}
 
 	basePath, localPath, remotePath, cleanup, err := writeTempStages(baseBytes, localBytes, remoteBytes)
@@ -87,6 +258,25 @@ func prepareInteractiveFromRepo(ctx context.Context, opts *cli.Options) (func(),
 	return cleanup, nil
 }
 
+// nextUnresolvedFiles returns the conflicted paths that follow file.selected,
+// wrapping around, whose merged file still contains conflict markers.
+func nextUnresolvedFiles(file interactiveFile) []string {
+	start := slices.Index(file.paths, file.selected)
+	var next []string
+	for offset := 1; offset < len(file.paths); offset++ {
+		path := file.paths[(start+offset)%len(file.paths)]
+		mergedPath := path
+		if !filepath.IsAbs(mergedPath) {
+			mergedPath = filepath.Join(file.repoRoot, path)
+		}
+		if resolved, err := engine.CheckResolvedFile(mergedPath); err == nil && resolved {
+			continue
+		}
+		next = append(next, path)
+	}
+	return next
+}
+
 func selectPath(paths []string) (string, error) {
 	if len(paths) == 1 {
 		return paths[0], nil
@@ -119,17 +309,56 @@ func selectPath(paths []string) (string, error) {
 	return "", fmt.Errorf("invalid selection")
 }
 
-func selectPathInteractive(ctx context.Context, repoRoot string, paths []string) (string, error) {
+func selectPathInteractive(ctx context.Context, opts cli.Options, repoRoot string, paths []string, stages *gitutil.StageCache) (string, error) {
 	if isInteractiveTTY() {
-		candidates, err := buildFileCandidates(repoRoot, paths)
+		candidates, err := buildFileCandidates(ctx, repoRoot, paths, stages)
 		if err != nil {
 			return "", err
 		}
-		return tui.SelectFile(ctx, candidates)
+		return tui.SelectFile(ctx, opts, candidates)
 	}
 	return selectPath(paths)
 }
 
+// watchInterval is how often --watch re-lists the conflicted files.
+const watchInterval = 2 * time.Second
+
+var errWatchNeedsTTY = errors.New("--watch needs an interactive terminal")
+
+// watchPathInteractive shows the selector with a list that listPaths keeps
+// up to date, and returns the chosen path with the list it was picked from.
+// Once no unresolved file remains it returns errNoConflicts unless
+// --keep-watching is set.
+func watchPathInteractive(ctx context.Context, opts cli.Options, repoRoot string, paths []string, listPaths func() ([]string, error)) (string, []string, error) {
+	if !isInteractiveTTY() {
+		return "", nil, errWatchNeedsTTY
+	}
+	candidates, err := buildFileCandidates(ctx, repoRoot, paths, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	refresh := func() ([]tui.FileCandidate, error) {
+		latest, err := listPaths()
+		if err != nil {
+			return nil, err
+		}
+		return buildFileCandidates(ctx, repoRoot, latest, nil)
+	}
+	selected, err := tui.WatchFile(ctx, opts, candidates, tui.Watch{Interval: watchInterval, Refresh: refresh, KeepOpen: opts.KeepWatching})
+	if errors.Is(err, tui.ErrNoConflictsLeft) {
+		return "", nil, errNoConflicts
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	// The list may have changed since it was first read; the caller wants
+	// the one the file was picked from.
+	if latest, err := listPaths(); err == nil && slices.Contains(latest, selected) {
+		paths = latest
+	}
+	return selected, paths, nil
+}
+
 func isInteractiveTTY() bool {
 	return isTTY(os.Stdin) && isTTY(os.Stdout)
 }
@@ -142,7 +371,9 @@ func isTTY(file *os.File) bool {
 	return (info.Mode() & os.ModeCharDevice) != 0
 }
 
-func buildFileCandidates(repoRoot string, paths []string) ([]tui.FileCandidate, error) {
+// buildFileCandidates describes paths for the selector. Previews read the
+// stages through stages, which may be nil.
+func buildFileCandidates(ctx context.Context, repoRoot string, paths []string, stages *gitutil.StageCache) ([]tui.FileCandidate, error) {
 	candidates := make([]tui.FileCandidate, 0, len(paths))
 	for _, path := range paths {
 		mergedPath := path
@@ -150,15 +381,41 @@ func buildFileCandidates(repoRoot string, paths []string) ([]tui.FileCandidate,
 			mergedPath = filepath.Join(repoRoot, path)
 		}
 
-		resolved, err := engine.CheckResolvedFile(mergedPath)
+		resolved, doc, err := engine.CheckResolvedFileDocument(mergedPath)
 		if err != nil {
 			resolved = false
 		}
-		candidates = append(candidates, tui.FileCandidate{Path: path, Resolved: resolved})
+		candidates = append(candidates, tui.FileCandidate{
+			Path:          path,
+			Resolved:      resolved,
+			ConflictCount: len(doc.Conflicts),
+			Preview:       stagePreview(ctx, repoRoot, path, stages),
+		})
 	}
 	return candidates, nil
 }
 
+// stagePreview returns a loader that merges the index stages of path into a
+// diff3 view for the selector preview. Stages are only read when the loader
+// is called, so listing many conflicted files stays cheap.
+func stagePreview(ctx context.Context, repoRoot string, path string, stages *gitutil.StageCache) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		localBytes, err := stages.ShowStage(ctx, repoRoot, 2, path)
+		if err != nil {
+			return nil, fmt.Errorf("missing ours stage for %s: %w", path, err)
+		}
+		remoteBytes, err := stages.ShowStage(ctx, repoRoot, 3, path)
+		if err != nil {
+			return nil, fmt.Errorf("missing theirs stage for %s: %w", path, err)
+		}
+		baseBytes, err := stages.ShowStage(ctx, repoRoot, 1, path)
+		if err != nil {
+			baseBytes = nil
+		}
+		return gitmerge.Diff3(localBytes, baseBytes, remoteBytes, "ours", "base", "theirs"), nil
+	}
+}
+
 func writeTempStages(base, local, remote []byte) (string, string, string, func(), error) {
 	baseFile, err := os.CreateTemp("", "ec-base-*")
 	if err != nil {
@@ -3,9 +3,12 @@ package run
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/chojs23/ec/internal/cli"
@@ -116,7 +119,7 @@ func TestBuildFileCandidates(t *testing.T) {
 		t.Fatalf("write unresolved: %v", err)
 	}
 
-	candidates, err := buildFileCandidates(tmpDir, []string{"resolved.txt", "unresolved.txt"})
+	candidates, err := buildFileCandidates(context.Background(), tmpDir, []string{"resolved.txt", "unresolved.txt"}, nil)
 	if err != nil {
 		t.Fatalf("buildFileCandidates error: %v", err)
 	}
@@ -129,6 +132,9 @@ func TestBuildFileCandidates(t *testing.T) {
 	if candidates[1].Resolved {
 		t.Fatalf("expected marker-containing file to be unresolved")
 	}
+	if candidates[0].ConflictCount != 0 || candidates[1].ConflictCount != 1 {
+		t.Fatalf("conflict counts = %d, %d, want 0, 1", candidates[0].ConflictCount, candidates[1].ConflictCount)
+	}
 }
 
 func TestBuildFileCandidatesDoesNotFailOnMalformedMergedFile(t *testing.T) {
@@ -175,7 +181,7 @@ func TestBuildFileCandidatesDoesNotFailOnMalformedMergedFile(t *testing.T) {
 		t.Fatalf("write malformed conflict file: %v", err)
 	}
 
-	candidates, err := buildFileCandidates(repoDir, []string{"conflict.txt"})
+	candidates, err := buildFileCandidates(context.Background(), repoDir, []string{"conflict.txt"}, nil)
 	if err != nil {
 		t.Fatalf("buildFileCandidates error: %v", err)
 	}
@@ -229,7 +235,7 @@ func TestBuildFileCandidatesResolvedFromMergedContentWithoutGitAdd(t *testing.T)
 		t.Fatalf("write resolved content: %v", err)
 	}
 
-	candidates, err := buildFileCandidates(repoDir, []string{"conflict.txt"})
+	candidates, err := buildFileCandidates(context.Background(), repoDir, []string{"conflict.txt"}, nil)
 	if err != nil {
 		t.Fatalf("buildFileCandidates error: %v", err)
 	}
@@ -239,6 +245,36 @@ func TestBuildFileCandidatesResolvedFromMergedContentWithoutGitAdd(t *testing.T)
 	if !candidates[0].Resolved {
 		t.Fatalf("expected resolved merged content to be shown as resolved without git add")
 	}
+
+	preview, err := candidates[0].Preview()
+	if err != nil {
+		t.Fatalf("Preview error: %v", err)
+	}
+	if !bytes.Contains(preview, []byte("<<<<<<< ours\nX\n")) || !bytes.Contains(preview, []byte("=======\nY\n")) {
+		t.Fatalf("preview = %q, want conflict rebuilt from the index stages", preview)
+	}
+}
+
+func TestNextUnresolvedFilesWrapsAndSkipsResolved(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"a.txt": "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> branch\n",
+		"b.txt": "resolved\n",
+		"c.txt": "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> branch\n",
+		"d.txt": "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> branch\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := interactiveFile{repoRoot: repoRoot, paths: []string{"a.txt", "b.txt", "c.txt", "d.txt"}, selected: "c.txt"}
+	got := nextUnresolvedFiles(file)
+	want := []string{"d.txt", "a.txt"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("nextUnresolvedFiles = %v, want %v", got, want)
+	}
 }
 
 func TestWriteTempStages(t *testing.T) {
@@ -295,7 +331,7 @@ func TestIsInteractiveTTYFalse(t *testing.T) {
 func TestSelectPathInteractiveNonTTY(t *testing.T) {
 	withStdout(t, func() {
 		withStdin(t, "2\n", func() {
-			selected, err := selectPathInteractive(context.Background(), "repo", []string{"a.txt", "b.txt"})
+			selected, err := selectPathInteractive(context.Background(), cli.Options{}, "repo", []string{"a.txt", "b.txt"}, nil)
 			if err != nil {
 				t.Fatalf("selectPathInteractive error: %v", err)
 			}
@@ -363,7 +399,7 @@ func TestPrepareInteractiveFromRepoPopulatesOptions(t *testing.T) {
 	var cleanup func()
 	withStdout(t, func() {
 		withStdin(t, "", func() {
-			cleanup, err = prepareInteractiveFromRepo(context.Background(), &opts)
+			_, cleanup, err = prepareInteractiveFromRepo(context.Background(), &opts, "")
 		})
 	})
 	if err != nil {
@@ -404,6 +440,331 @@ func TestPrepareInteractiveFromRepoPopulatesOptions(t *testing.T) {
 	}
 }
 
+func TestPrepareInteractiveFromRepoRejectsSubmoduleConflict(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repoDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	showLog := filepath.Join(t.TempDir(), "show.log")
+	withFakeGit(t, `#!/bin/sh
+case "$1" in
+rev-parse)
+  echo "`+repoDir+`"
+  ;;
+diff)
+  echo "sub"
+  ;;
+ls-files)
+  printf '160000 1111111111111111111111111111111111111111 1\tsub\0'
+  printf '160000 2222222222222222222222222222222222222222 2\tsub\0'
+  printf '160000 3333333333333333333333333333333333333333 3\tsub\0'
+  ;;
+show)
+  echo "$2" >> "`+showLog+`"
+  echo "Subproject commit 2222222222222222222222222222222222222222"
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`)
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd error: %v", err)
+	}
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("chdir error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Fatalf("restore cwd error: %v", err)
+		}
+	})
+
+	var opts cli.Options
+	_, _, err = prepareInteractiveFromRepo(context.Background(), &opts, "sub")
+	if !errors.Is(err, errSubmoduleConflict) {
+		t.Fatalf("prepareInteractiveFromRepo error = %v, want submodule conflict", err)
+	}
+	if !strings.Contains(err.Error(), "submodule conflict not supported") {
+		t.Fatalf("error = %q, want clear submodule message", err)
+	}
+	if _, statErr := os.Stat(showLog); statErr == nil {
+		t.Fatalf("expected no git show calls for a submodule conflict")
+	}
+	if opts.MergedPath != "" {
+		t.Fatalf("MergedPath = %q, want options untouched", opts.MergedPath)
+	}
+}
+
+func TestPrepareInteractiveFileReadsBaseFromBaseRev(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repoDir, "file.txt"), []byte("merged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withFakeGit(t, `#!/bin/sh
+case "$1 $2" in
+"show :1:file.txt")
+  echo "stage base"
+  ;;
+"show :2:file.txt")
+  echo "ours"
+  ;;
+"show :3:file.txt")
+  echo "theirs"
+  ;;
+"show HEAD~2:file.txt")
+  echo "rev base"
+  ;;
+ls-files*)
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`)
+
+	opts := cli.Options{BaseRev: "HEAD~2"}
+	cleanup, err := prepareInteractiveFile(context.Background(), repoDir, "file.txt", &opts, nil)
+	if err != nil {
+		t.Fatalf("prepareInteractiveFile error: %v", err)
+	}
+	t.Cleanup(cleanup)
+
+	baseBytes, err := os.ReadFile(opts.BasePath)
+	if err != nil {
+		t.Fatalf("read base temp file: %v", err)
+	}
+	if string(baseBytes) != "rev base\n" {
+		t.Fatalf("base temp content = %q, want rev base", string(baseBytes))
+	}
+
+	opts = cli.Options{BaseRev: "missing"}
+	if _, err := prepareInteractiveFile(context.Background(), repoDir, "file.txt", &opts, nil); err == nil {
+		t.Fatalf("prepareInteractiveFile error = nil, want error for unknown base rev")
+	}
+}
+
+func TestPrepareInteractiveFromRepoScope(t *testing.T) {
+	repoDir := t.TempDir()
+	subDir := filepath.Join(repoDir, "sub", "dir")
+	if err := os.MkdirAll(subDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	scopeLog := filepath.Join(t.TempDir(), "scope.log")
+	withFakeGit(t, `#!/bin/sh
+case "$1" in
+rev-parse)
+  echo "`+repoDir+`"
+  ;;
+diff)
+  echo "$5" >> "`+scopeLog+`"
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`)
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd error: %v", err)
+	}
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatalf("chdir error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Fatalf("restore cwd error: %v", err)
+		}
+	})
+
+	for _, allFiles := range []bool{false, true} {
+		opts := cli.Options{AllFiles: allFiles}
+		if _, _, err := prepareInteractiveFromRepo(context.Background(), &opts, ""); !errors.Is(err, errNoConflicts) {
+			t.Fatalf("prepareInteractiveFromRepo(AllFiles=%v) error = %v, want errNoConflicts", allFiles, err)
+		}
+	}
+
+	data, err := os.ReadFile(scopeLog)
+	if err != nil {
+		t.Fatalf("read scope log: %v", err)
+	}
+	if got, want := string(data), "sub/dir\n.\n"; got != want {
+		t.Fatalf("pathspecs = %q, want %q", got, want)
+	}
+}
+
+func TestPrepareInteractiveForPath(t *testing.T) {
+	repoDir := t.TempDir()
+	subDir := filepath.Join(repoDir, "sub")
+	if err := os.MkdirAll(subDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subDir, "a.go"), []byte("merged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withFakeGit(t, `#!/bin/sh
+case "$1" in
+rev-parse)
+  echo "`+repoDir+`"
+  ;;
+diff)
+  echo "sub/a.go"
+  ;;
+ls-files)
+  ;;
+show)
+  echo "stage $2"
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`)
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd error: %v", err)
+	}
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatalf("chdir error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Fatalf("restore cwd error: %v", err)
+		}
+	})
+
+	var opts cli.Options
+	file, cleanup, err := prepareInteractiveForPath(context.Background(), &opts, "a.go")
+	if err != nil {
+		t.Fatalf("prepareInteractiveForPath error: %v", err)
+	}
+	t.Cleanup(cleanup)
+	if file.selected != "sub/a.go" || file.repoRoot != repoDir {
+		t.Fatalf("file = %+v, want sub/a.go in %s", file, repoDir)
+	}
+	if opts.MergedPath != filepath.Join(subDir, "a.go") {
+		t.Fatalf("MergedPath = %q", opts.MergedPath)
+	}
+	localBytes, err := os.ReadFile(opts.LocalPath)
+	if err != nil {
+		t.Fatalf("read local temp file: %v", err)
+	}
+	if string(localBytes) != "stage :2:sub/a.go\n" {
+		t.Fatalf("local temp content = %q", localBytes)
+	}
+
+	for path, want := range map[string]string{
+		"b.go":                         "b.go is not an unmerged file",
+		filepath.Join("..", "..", "x"): "is outside the repository",
+	} {
+		if _, _, err := prepareInteractiveForPath(context.Background(), &opts, path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("prepareInteractiveForPath(%q) error = %v, want %q", path, err, want)
+		}
+	}
+}
+
+func TestWatchPathInteractiveNeedsTTY(t *testing.T) {
+	_, _, err := watchPathInteractive(context.Background(), cli.Options{}, t.TempDir(), []string{"a.txt"}, func() ([]string, error) {
+		return []string{"a.txt"}, nil
+	})
+	if !errors.Is(err, errWatchNeedsTTY) {
+		t.Fatalf("watchPathInteractive error = %v, want errWatchNeedsTTY", err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.go", name: "main.go", want: true},
+		{pattern: "*.go", name: "internal/run/run.go", want: true},
+		{pattern: "*.go", name: "go.mod", want: false},
+		{pattern: "internal/*.go", name: "internal/a.go", want: true},
+		{pattern: "internal/*.go", name: "internal/run/a.go", want: false},
+		{pattern: "internal/**/*.go", name: "internal/a.go", want: true},
+		{pattern: "internal/**/*.go", name: "internal/run/deep/a.go", want: true},
+		{pattern: "**/testdata/**", name: "pkg/testdata/x/y.txt", want: true},
+		{pattern: "./docs/*", name: "docs/readme.md", want: true},
+		{pattern: "docs/*", name: "other/docs/readme.md", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterPaths(t *testing.T) {
+	paths := []string{"a.go", "a_test.go", "docs/b.md", "internal/c.go"}
+
+	got := filterPaths(paths, []string{"*.go"}, []string{"*_test.go"})
+	want := []string{"a.go", "internal/c.go"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("filterPaths = %v, want %v", got, want)
+	}
+
+	if got := filterPaths(paths, nil, []string{"docs/**"}); !slices.Equal(got, []string{"a.go", "a_test.go", "internal/c.go"}) {
+		t.Fatalf("filterPaths exclude only = %v", got)
+	}
+	if got := filterPaths(paths, nil, nil); !slices.Equal(got, paths) {
+		t.Fatalf("filterPaths without patterns = %v, want %v", got, paths)
+	}
+}
+
+func TestPrepareInteractiveFromRepoFilterLeavesNoFiles(t *testing.T) {
+	repoDir := t.TempDir()
+	withFakeGit(t, `#!/bin/sh
+case "$1" in
+rev-parse)
+  echo "`+repoDir+`"
+  ;;
+diff)
+  printf 'a.go\ndocs/b.md\n'
+  ;;
+*)
+  exit 1
+  ;;
+esac
+`)
+
+	oldWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd error: %v", err)
+	}
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatalf("chdir error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Fatalf("restore cwd error: %v", err)
+		}
+	})
+
+	opts := cli.Options{Only: []string{"*.txt"}}
+	if _, _, err := prepareInteractiveFromRepo(context.Background(), &opts, ""); !errors.Is(err, errNoConflicts) {
+		t.Fatalf("prepareInteractiveFromRepo error = %v, want errNoConflicts", err)
+	}
+}
+
+func withFakeGit(t *testing.T, script string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "git")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake git: %v", err)
+	}
+
+	original := os.Getenv("PATH")
+	t.Setenv("PATH", strings.Join([]string{dir, original}, string(os.PathListSeparator)))
+}
+
 func runGit(t *testing.T, dir string, args ...string) {
 	t.Helper()
 	cmd := exec.Command("git", args...)
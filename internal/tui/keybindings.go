@@ -0,0 +1,229 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const keyConfigFileName = "config.json"
+
+type KeyConfig struct {
+	KeyBindings map[string]KeyList `json:"keybindings"`
+}
+
+// KeyList holds the keys bound to one action. In JSON it may be written as a
+// single string or a list of strings.
+type KeyList []string
+
+func (l *KeyList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = KeyList{single}
+		return nil
+	}
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("keys must be a string or a list of strings")
+	}
+	*l = keys
+	return nil
+}
+
+type resolverAction struct {
+	name    string
+	handler keyAction
+	keys    []string
+}
+
+// resolverActions lists every remappable resolver action with its default
+// keys. gg, G, zz, zw, za, zi, zn, zu, zs and zo are key sequences handled
+// directly in Update.
+var resolverActions = []resolverAction{
+	{name: "quit", handler: (*model).handleQuit, keys: []string{keyQuit}},
+	{name: "force_quit", handler: (*model).handleCtrlC, keys: []string{keyCtrlC}},
+	{name: "next", handler: (*model).handleNextConflict, keys: []string{keyNextConflict}},
+	{name: "prev", handler: (*model).handlePrevConflict, keys: []string{keyPrevConflict}},
+	{name: "ours", handler: (*model).handleSelectOurs, keys: []string{keySelectOurs}},
+	{name: "theirs", handler: (*model).handleSelectTheirs, keys: []string{keySelectTheirs}},
+	{name: "scroll_down", handler: (*model).handleScrollDown, keys: []string{keyScrollDown, keyArrowDown}},
+	{name: "scroll_up", handler: (*model).handleScrollUp, keys: []string{keyScrollUp, keyArrowUp}},
+	{name: "half_page_up", handler: (*model).handleHalfPageUp, keys: []string{keyCtrlU}},
+	{name: "half_page_down", handler: (*model).handleHalfPageDown, keys: []string{keyCtrlD}},
+	{name: "scroll_left", handler: (*model).handleScrollLeft, keys: []string{keyScrollLeft, keyArrowLeft}},
+	{name: "scroll_right", handler: (*model).handleScrollRight, keys: []string{keyScrollRight, keyArrowRight}},
+	{name: "context_more", handler: (*model).handleContextMore, keys: []string{keyContextMore}},
+	{name: "context_less", handler: (*model).handleContextLess, keys: []string{keyContextLess}},
+	{name: "next_change", handler: (*model).handleNextChange, keys: []string{keyNextChange}},
+	{name: "prev_change", handler: (*model).handlePrevChange, keys: []string{keyPrevChange}},
+	{name: "filter", handler: (*model).handleFilter, keys: []string{keyFilter}},
+	{name: "toggle_reviewed", handler: (*model).handleToggleReviewed, keys: []string{keyToggleReviewed}},
+	{name: "next_unreviewed", handler: (*model).handleNextUnreviewed, keys: []string{keyNextUnreviewed}},
+	{name: "apply_ours", handler: (*model).handleApplyOurs, keys: []string{keyApplyOurs}},
+	{name: "apply_theirs", handler: (*model).handleApplyTheirs, keys: []string{keyApplyTheirs}},
+	{name: "apply_ours_all", handler: (*model).handleApplyOursAll, keys: []string{keyApplyOursAll}},
+	{name: "apply_theirs_all", handler: (*model).handleApplyTheirsAll, keys: []string{keyApplyTheirsAll}},
+	{name: "accept", handler: (*model).handleAccept, keys: []string{keyAccept, keyAcceptSpace}},
+	{name: "accept_next", handler: (*model).handleAcceptAndAdvance, keys: []string{keyAcceptAdvance}},
+	{name: "discard", handler: (*model).handleDiscard, keys: []string{keyDiscard}},
+	{name: "apply_both", handler: (*model).handleApplyBoth, keys: []string{keyApplyBoth}},
+	{name: "apply_both_dedup", handler: (*model).handleApplyBothDedup, keys: []string{keyApplyBothDedup}},
+	{name: "apply_none", handler: (*model).handleApplyNone, keys: []string{keyApplyNone}},
+	{name: "cycle", handler: (*model).handleCycleResolution, keys: []string{keyCycle}},
+	{name: "undo", handler: (*model).handleUndo, keys: []string{keyUndo}},
+	{name: "redo", handler: (*model).handleRedo, keys: []string{keyRedo}},
+	{name: "revert", handler: (*model).handleRevert, keys: []string{keyRevert}},
+	{name: "restore_backup", handler: (*model).handleRestoreBackup, keys: []string{keyRestoreBackup}},
+	{name: "write", handler: (*model).handleWrite, keys: []string{keyWrite, keyCtrlS}},
+	{name: "write_continue", handler: (*model).handleWriteAndContinue, keys: []string{keyWriteContinue}},
+	{name: "review_write", handler: (*model).handleReviewWrite, keys: []string{keyReviewWrite}},
+	{name: "edit", handler: (*model).handleEdit, keys: []string{keyEdit}},
+	{name: "edit_conflict", handler: (*model).handleEditConflict, keys: []string{keyEditConflict}},
+	{name: "view_base", handler: (*model).handleViewBase, keys: []string{keyViewBase}},
+	{name: "view_raw", handler: (*model).handleViewRaw, keys: []string{keyViewRaw}},
+	{name: "next_file", handler: (*model).handleNextFile, keys: []string{keyNextFile}},
+	{name: "toggle_whitespace", handler: (*model).handleToggleWhitespace, keys: []string{keyToggleWhitespace}},
+	{name: "toggle_history", handler: (*model).handleToggleHistory, keys: []string{keyToggleHistory}},
+	{name: "help", handler: (*model).handleToggleHelp, keys: []string{keyHelp}},
+}
+
+// reservedKeys start the built-in key sequences and cannot be rebound.
+var reservedKeys = map[string]bool{
+	keyGoTop:    true,
+	keyRecenter: true,
+	keyGoBottom: true,
+}
+
+var (
+	resolverKeyBindings map[string][]string
+	resolverKeyActions  map[string]keyAction
+
+	keyBindingsOnce sync.Once
+	keyBindingsErr  error
+)
+
+func init() {
+	applyKeyBindings(defaultKeyBindings())
+}
+
+func ensureKeyBindingsLoaded() error {
+	keyBindingsOnce.Do(func() {
+		bindings, err := loadKeyBindingsFromConfig()
+		if err != nil {
+			keyBindingsErr = err
+			return
+		}
+		applyKeyBindings(bindings)
+	})
+	return keyBindingsErr
+}
+
+func defaultKeyBindings() map[string][]string {
+	bindings := make(map[string][]string, len(resolverActions))
+	for _, action := range resolverActions {
+		bindings[action.name] = append([]string(nil), action.keys...)
+	}
+	return bindings
+}
+
+// loadKeyBindingsFromConfig merges the keybindings section of config.json
+// over the defaults. Actions left out keep their default keys.
+func loadKeyBindingsFromConfig() (map[string][]string, error) {
+	bindings := defaultKeyBindings()
+	configPath, err := configFilePath(keyConfigFileName)
+	if err != nil {
+		return bindings, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return bindings, nil
+		}
+		return nil, fmt.Errorf("read key config: %w", err)
+	}
+
+	var cfg KeyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse key config: %w", err)
+	}
+
+	for name, keys := range cfg.KeyBindings {
+		if _, ok := bindings[name]; !ok {
+			return nil, fmt.Errorf("unknown keybinding action %q in %s", name, configPath)
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("keybinding %q in %s has no keys", name, configPath)
+		}
+		for _, key := range keys {
+			if key == "" {
+				return nil, fmt.Errorf("keybinding %q in %s has an empty key", name, configPath)
+			}
+			if reservedKeys[key] {
+				return nil, fmt.Errorf("keybinding %q in %s uses reserved key %q", name, configPath, key)
+			}
+		}
+		bindings[name] = []string(keys)
+	}
+
+	if err := validateKeyBindings(bindings); err != nil {
+		return nil, fmt.Errorf("%w in %s", err, configPath)
+	}
+	return bindings, nil
+}
+
+// validateKeyBindings rejects a key bound to more than one action.
+func validateKeyBindings(bindings map[string][]string) error {
+	owners := make(map[string]string)
+	for _, action := range resolverActions {
+		for _, key := range bindings[action.name] {
+			if owner, ok := owners[key]; ok && owner != action.name {
+				return fmt.Errorf("key %q is bound to both %q and %q", key, owner, action.name)
+			}
+			owners[key] = action.name
+		}
+	}
+	return nil
+}
+
+func applyKeyBindings(bindings map[string][]string) {
+	actions := make(map[string]keyAction)
+	for _, action := range resolverActions {
+		for _, key := range bindings[action.name] {
+			actions[key] = action.handler
+		}
+	}
+	resolverKeyBindings = bindings
+	resolverKeyActions = actions
+}
+
+// keyBoundTo reports whether key is one of the keys bound to the named
+// action, for views that reuse resolver keys without running their handlers.
+func keyBoundTo(key string, action string) bool {
+	for _, bound := range resolverKeyBindings[action] {
+		if bound == key {
+			return true
+		}
+	}
+	return false
+}
+
+// label returns the keys shown for the entry in the footer.
+func (e keyHelpEntry) label() string {
+	if len(e.actions) == 0 {
+		return e.key
+	}
+	var keys []string
+	for _, name := range e.actions {
+		for _, key := range resolverKeyBindings[name] {
+			if key == " " {
+				key = "<space>"
+			}
+			keys = append(keys, key)
+		}
+	}
+	return strings.Join(keys, "/")
+}
@@ -0,0 +1,200 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestDefaultKeyBindingsHaveNoConflicts(t *testing.T) {
+	if err := validateKeyBindings(defaultKeyBindings()); err != nil {
+		t.Fatalf("validateKeyBindings(defaults) error = %v", err)
+	}
+}
+
+func TestLoadKeyBindingsFromConfigMissingFileUsesDefaults(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	bindings, err := loadKeyBindingsFromConfig()
+	if err != nil {
+		t.Fatalf("loadKeyBindingsFromConfig() error = %v", err)
+	}
+	if got := bindings["write"]; len(got) != 2 || got[0] != "w" || got[1] != "ctrl+s" {
+		t.Fatalf("write keys = %q, want [w ctrl+s]", got)
+	}
+}
+
+func TestLoadKeyBindingsFromConfigMergesOverrides(t *testing.T) {
+	writeKeyConfigForTest(t, `{
+  "keybindings": {
+    "next": ["ctrl+n", ">"],
+    "prev": "<"
+  }
+}`)
+
+	bindings, err := loadKeyBindingsFromConfig()
+	if err != nil {
+		t.Fatalf("loadKeyBindingsFromConfig() error = %v", err)
+	}
+	if got := strings.Join(bindings["next"], ","); got != "ctrl+n,>" {
+		t.Fatalf("next keys = %q, want ctrl+n,>", got)
+	}
+	if got := strings.Join(bindings["prev"], ","); got != "<" {
+		t.Fatalf("prev keys = %q, want <", got)
+	}
+	if got := strings.Join(bindings["undo"], ","); got != "u" {
+		t.Fatalf("undo keys = %q, want default u", got)
+	}
+}
+
+func TestLoadKeyBindingsFromConfigRejectsInvalidBindings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "conflict", config: `{"keybindings": {"next": "u"}}`, want: `key "u" is bound to both`},
+		{name: "unknown action", config: `{"keybindings": {"explode": "x"}}`, want: `unknown keybinding action "explode"`},
+		{name: "reserved key", config: `{"keybindings": {"next": "g"}}`, want: `reserved key "g"`},
+		{name: "no keys", config: `{"keybindings": {"next": []}}`, want: "has no keys"},
+		{name: "bad json", config: `{"keybindings": {"next": 1}}`, want: "parse key config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeKeyConfigForTest(t, tt.config)
+			_, err := loadKeyBindingsFromConfig()
+			if err == nil {
+				t.Fatalf("loadKeyBindingsFromConfig() error = nil, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureKeyBindingsLoadedRemapsActionsAndHelp(t *testing.T) {
+	resetKeyBindingsForTest()
+	t.Cleanup(resetKeyBindingsForTest)
+
+	writeKeyConfigForTest(t, `{"keybindings": {"next": ">", "prev": "<"}}`)
+	if err := ensureKeyBindingsLoaded(); err != nil {
+		t.Fatalf("ensureKeyBindingsLoaded() error = %v", err)
+	}
+
+	doc := parseMultiConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if got := updated.(model).currentConflict; got != 0 {
+		t.Fatalf("currentConflict after n = %d, want 0 once next is remapped", got)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'>'}})
+	if got := updated.(model).currentConflict; got != 1 {
+		t.Fatalf("currentConflict after > = %d, want 1", got)
+	}
+
+	if help := resolverFooterKeyMapText(); !strings.Contains(help, ">: next | <: prev") {
+		t.Fatalf("footer help = %q, want remapped keys", help)
+	}
+}
+
+func writeKeyConfigForTest(t *testing.T, config string) {
+	t.Helper()
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+
+	configPath := filepath.Join(configDir, "ec", keyConfigFileName)
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resetKeyBindingsForTest() {
+	keyBindingsOnce = sync.Once{}
+	keyBindingsErr = nil
+	applyKeyBindings(defaultKeyBindings())
+}
+
+func TestReviewScrollsWithRemappedKeys(t *testing.T) {
+	resetKeyBindingsForTest()
+	t.Cleanup(resetKeyBindingsForTest)
+
+	writeKeyConfigForTest(t, `{"keybindings": {"scroll_down": "ctrl+e", "scroll_up": "ctrl+y"}}`)
+	if err := ensureKeyBindingsLoaded(); err != nil {
+		t.Fatalf("ensureKeyBindingsLoaded() error = %v", err)
+	}
+
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.width, m.height = 80, 10
+	m.reviewing = true
+	m.reviewViewport = viewport.New(1, 1)
+	m.reviewViewport.SetContent(strings.Repeat("line\n", 50))
+	m.resizeReview()
+
+	press := func(key tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(key)
+		m = updated.(model)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	if m.reviewViewport.YOffset != 0 {
+		t.Fatalf("YOffset after j = %d, want 0 once scroll_down is remapped", m.reviewViewport.YOffset)
+	}
+	press(tea.KeyMsg{Type: tea.KeyCtrlE})
+	if m.reviewViewport.YOffset != 1 {
+		t.Fatalf("YOffset after ctrl+e = %d, want 1", m.reviewViewport.YOffset)
+	}
+	press(tea.KeyMsg{Type: tea.KeyCtrlY})
+	if m.reviewViewport.YOffset != 0 {
+		t.Fatalf("YOffset after ctrl+y = %d, want 0", m.reviewViewport.YOffset)
+	}
+	if view := m.renderReview(); !strings.Contains(view, "ctrl+e/ctrl+y: scroll") {
+		t.Fatalf("review footer does not show the remapped scroll keys")
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if m.reviewing {
+		t.Fatalf("reviewing = true after n, want the review cancelled")
+	}
+}
+
+func TestToggleHistoryKeyIsNotBackspace(t *testing.T) {
+	resetKeyBindingsForTest()
+	t.Cleanup(resetKeyBindingsForTest)
+
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	press := func(key tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(key)
+		m = updated.(model)
+	}
+	// Many terminals send ctrl+h for Backspace.
+	press(tea.KeyMsg{Type: tea.KeyCtrlH})
+	press(tea.KeyMsg{Type: tea.KeyBackspace})
+	if m.showHistory {
+		t.Fatalf("showHistory = true after backspace, want false")
+	}
+
+	resetKeyBindingsForTest()
+	writeKeyConfigForTest(t, `{"keybindings": {"toggle_history": "ctrl+t"}}`)
+	if err := ensureKeyBindingsLoaded(); err != nil {
+		t.Fatalf("ensureKeyBindingsLoaded() error = %v", err)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'Y'}})
+	if m.showHistory {
+		t.Fatalf("showHistory = true after Y, want false once toggle_history is remapped")
+	}
+	press(tea.KeyMsg{Type: tea.KeyCtrlT})
+	if !m.showHistory {
+		t.Fatalf("showHistory = false after ctrl+t, want the remapped key to toggle it")
+	}
+}
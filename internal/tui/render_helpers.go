@@ -16,6 +16,81 @@ type lineInfo struct {
 	underline bool
 	dim       bool
 	connector string
+	// whitespace is set once tabs and trailing spaces in text have been
+	// replaced by visible markers.
+	whitespace bool
+	// baseLine is the 1-based base line this line matches or replaces, or 0
+	// when it has no counterpart in base. alignPaneLines lines panes up on it.
+	baseLine int
+	// filler marks a blank row inserted by alignPaneLines.
+	filler bool
+	// label marks a row describing the content, such as an empty conflict,
+	// rather than a line of the file; folded is the number of file lines a
+	// fold placeholder stands for, and foldStart the index of the first of
+	// them in the unfolded lines.
+	label     bool
+	folded    int
+	foldStart int
+	// conflict is the 1-based index of the conflict a result pane line
+	// belongs to, or 0 outside conflicts.
+	conflict int
+}
+
+// lineNumberMode selects the numbers shown in the pane gutters.
+type lineNumberMode int
+
+const (
+	// lineNumbersFile numbers each line with its line in the file the pane
+	// shows, leaving removed base lines, markers and labels unnumbered.
+	lineNumbersFile lineNumberMode = iota
+	// lineNumbersPosition numbers the rows of the pane in order.
+	lineNumbersPosition
+	lineNumbersOff
+)
+
+func (mode lineNumberMode) String() string {
+	switch mode {
+	case lineNumbersPosition:
+		return "pane position"
+	case lineNumbersOff:
+		return "off"
+	default:
+		return "file"
+	}
+}
+
+// lineNumbers returns the number shown next to each of lines, 0 for none.
+func lineNumbers(lines []lineInfo, mode lineNumberMode) []int {
+	numbers := make([]int, len(lines))
+	next := 1
+	for i, line := range lines {
+		switch {
+		case mode == lineNumbersOff || line.filler:
+		case mode == lineNumbersPosition:
+			numbers[i] = next
+			next++
+		case line.folded > 0:
+			next += line.folded
+		case line.label || line.category == categoryRemoved || line.category == categoryInsertMarker:
+		default:
+			numbers[i] = next
+			next++
+		}
+	}
+	return numbers
+}
+
+// numberColumnWidth returns the width of the widest of numbers, or 0 when
+// none is shown.
+func numberColumnWidth(numbers []int) int {
+	widest := 0
+	for _, number := range numbers {
+		widest = max(widest, number)
+	}
+	if widest == 0 {
+		return 0
+	}
+	return len(fmt.Sprintf("%d", widest))
 }
 
 type lineCategory int
@@ -60,21 +135,27 @@ func renderLines(
 	selectedStyles map[lineCategory]lipgloss.Style,
 	connectorStyles map[lineCategory]lipgloss.Style,
 	useWhiteDim bool,
+	wrapWidth int,
+	numberMode lineNumberMode,
 ) string {
 	if len(lines) == 0 {
 		return ""
 	}
 
-	width := len(fmt.Sprintf("%d", len(lines)))
+	numbers := lineNumbers(lines, numberMode)
+	width := numberColumnWidth(numbers)
+	textWidth := wrapTextWidth(width, wrapWidth)
 	var b strings.Builder
 	for i, line := range lines {
-		lineNumber := i + 1
 		connector := line.connector
 		if connector == "" {
 			connector = " "
 		}
 
-		numberText := fmt.Sprintf("%*d", width, lineNumber)
+		numberText := strings.Repeat(" ", width)
+		if numbers[i] > 0 {
+			numberText = fmt.Sprintf("%*d", width, numbers[i])
+		}
 
 		style := styleForCategory(baseStyles, line.category, lipgloss.NewStyle())
 		if line.highlight {
@@ -106,9 +187,34 @@ func renderLines(
 			connectorStyle = styleForCategory(selectedStyles, line.category, connectorStyle)
 		}
 
-		prefix := numberStyle.Render(numberText) + " " + connectorStyle.Render(connector+" ")
+		gutter := ""
+		if width > 0 {
+			gutter = " "
+		}
+		prefix := numberStyle.Render(numberText) + gutter + connectorStyle.Render(connector+" ")
+
+		renderText := style.Render
+		if line.whitespace {
+			renderText = func(text ...string) string {
+				return renderWhitespaceMarkers(strings.Join(text, ""), style)
+			}
+		}
 
-		b.WriteString(prefix + style.Render(line.text))
+		if textWidth <= 0 {
+			b.WriteString(prefix + renderText(line.text))
+		} else {
+			// Continuation rows keep the connector column but leave the
+			// line number blank so numbering stays aligned with file lines.
+			continuation := strings.Repeat(" ", width) + gutter + connectorStyle.Render(connector+" ")
+			for row, text := range wrapDisplayWidth(line.text, textWidth) {
+				if row > 0 {
+					b.WriteString("\n" + continuation)
+				} else {
+					b.WriteString(prefix)
+				}
+				b.WriteString(renderText(text))
+			}
+		}
 		if i < len(lines)-1 {
 			b.WriteByte('\n')
 		}
@@ -117,6 +223,322 @@ func renderLines(
 	return b.String()
 }
 
+const (
+	whitespaceTabMarker   = "→"
+	whitespaceSpaceMarker = "·"
+	// defaultTabWidth matches lipgloss, which renders a tab as four spaces.
+	defaultTabWidth = 4
+)
+
+// expandTabs replaces each tab in text with the cells up to the next tab
+// stop, tabWidth display columns apart, drawing the first of them as marker
+// and the rest as spaces. Wide characters count as two columns.
+func expandTabs(text string, tabWidth int, marker string) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range text {
+		if r != '\t' {
+			b.WriteRune(r)
+			column += lipgloss.Width(string(r))
+			continue
+		}
+		cells := tabWidth - column%tabWidth
+		b.WriteString(marker + strings.Repeat(" ", cells-1))
+		column += cells
+	}
+	return b.String()
+}
+
+// expandLineTabs returns lines with their tabs expanded to spaces (see
+// expandTabs), leaving lines without tabs untouched.
+func expandLineTabs(lines []lineInfo, tabWidth int) []lineInfo {
+	expanded := make([]lineInfo, len(lines))
+	for i, line := range lines {
+		expanded[i] = line
+		expanded[i].text = expandTabs(line.text, tabWidth, " ")
+	}
+	return expanded
+}
+
+// showWhitespaceMarkers replaces tabs with → and trailing spaces with · so
+// whitespace-only differences are visible. A marked tab keeps the cells up to
+// its tab stop, so horizontal offsets line up with the unmarked view.
+func showWhitespaceMarkers(lines []lineInfo, tabWidth int) []lineInfo {
+	marked := make([]lineInfo, len(lines))
+	for i, line := range lines {
+		marked[i] = line
+		if !strings.ContainsAny(line.text, "\t ") {
+			continue
+		}
+		content := strings.TrimRight(line.text, " ")
+		text := expandTabs(content, tabWidth, whitespaceTabMarker)
+		text += strings.Repeat(whitespaceSpaceMarker, len(line.text)-len(content))
+		marked[i].text = text
+		marked[i].whitespace = true
+	}
+	return marked
+}
+
+// renderWhitespaceMarkers renders text with style, fainting the whitespace
+// markers so the real content stays legible.
+func renderWhitespaceMarkers(text string, style lipgloss.Style) string {
+	markerStyle := style.Copy().Faint(true)
+	var b strings.Builder
+	var run strings.Builder
+	runIsMarker := false
+	flush := func() {
+		if run.Len() == 0 {
+			return
+		}
+		if runIsMarker {
+			b.WriteString(markerStyle.Render(run.String()))
+		} else {
+			b.WriteString(style.Render(run.String()))
+		}
+		run.Reset()
+	}
+	for _, r := range text {
+		isMarker := string(r) == whitespaceTabMarker || string(r) == whitespaceSpaceMarker
+		if isMarker != runIsMarker {
+			flush()
+			runIsMarker = isMarker
+		}
+		run.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
+
+// wrapTextWidth returns the width available for line text when wrapping to
+// wrapWidth next to a numberWidth wide number column, or 0 when wrapping is
+// disabled.
+func wrapTextWidth(numberWidth int, wrapWidth int) int {
+	if wrapWidth <= 0 {
+		return 0
+	}
+	gutterWidth := 2
+	if numberWidth > 0 {
+		gutterWidth += numberWidth + 1
+	}
+	return max(wrapWidth-gutterWidth, 1)
+}
+
+// wrapDisplayWidth splits value into rows no wider than maxWidth cells.
+func wrapDisplayWidth(value string, maxWidth int) []string {
+	if maxWidth <= 0 || lipgloss.Width(value) <= maxWidth {
+		return []string{value}
+	}
+
+	var rows []string
+	var b strings.Builder
+	currentWidth := 0
+	for _, r := range value {
+		runeWidth := lipgloss.Width(string(r))
+		if currentWidth+runeWidth > maxWidth && currentWidth > 0 {
+			rows = append(rows, b.String())
+			b.Reset()
+			currentWidth = 0
+		}
+		b.WriteRune(r)
+		currentWidth += runeWidth
+	}
+	return append(rows, b.String())
+}
+
+// visualRowOffset returns the rendered row at which lines[index] starts once
+// wrapping to wrapWidth is applied.
+func visualRowOffset(lines []lineInfo, index int, wrapWidth int, numberMode lineNumberMode) int {
+	textWidth := wrapTextWidth(numberColumnWidth(lineNumbers(lines, numberMode)), wrapWidth)
+	if textWidth <= 0 {
+		return index
+	}
+	rows := 0
+	for i := 0; i < index && i < len(lines); i++ {
+		rows += len(wrapDisplayWidth(lines[i].text, textWidth))
+	}
+	return rows
+}
+
+// nextChangeRow returns the visual row where the first run of changed lines
+// after (direction 1) or before (direction -1) row from starts. Changed lines
+// are those drawn with a category other than categoryDefault; filler rows
+// are skipped.
+func nextChangeRow(lines []lineInfo, wrapWidth int, numberMode lineNumberMode, row int, direction int) (int, bool) {
+	textWidth := wrapTextWidth(numberColumnWidth(lineNumbers(lines, numberMode)), wrapWidth)
+	var starts []int
+	inChange := false
+	visual := 0
+	for _, line := range lines {
+		changed := line.category != categoryDefault && !line.filler
+		if changed && !inChange {
+			starts = append(starts, visual)
+		}
+		inChange = changed
+		if textWidth <= 0 {
+			visual++
+		} else {
+			visual += len(wrapDisplayWidth(line.text, textWidth))
+		}
+	}
+	if direction > 0 {
+		for _, start := range starts {
+			if start > row {
+				return start, true
+			}
+		}
+		return 0, false
+	}
+	for i := len(starts) - 1; i >= 0; i-- {
+		if starts[i] < row {
+			return starts[i], true
+		}
+	}
+	return 0, false
+}
+
+// alignPaneLines pads panes with filler rows so lines matching the same base
+// line share a visual row. Lines without a base counterpart between two
+// matched lines are grouped and padded to the tallest group. starts holds
+// one index per pane and is remapped to the aligned slices.
+func alignPaneLines(panes [][]lineInfo, starts []int) ([][]lineInfo, []int) {
+	aligned := make([][]lineInfo, len(panes))
+	newStarts := make([]int, len(panes))
+	pos := make([]int, len(panes))
+	for i, lines := range panes {
+		if starts[i] >= len(lines) {
+			newStarts[i] = -1
+		}
+	}
+
+	take := func(pane int) {
+		if pos[pane] == starts[pane] {
+			newStarts[pane] = len(aligned[pane])
+		}
+		aligned[pane] = append(aligned[pane], panes[pane][pos[pane]])
+		pos[pane]++
+	}
+	pad := func(pane int, n int) {
+		for ; n > 0; n-- {
+			aligned[pane] = append(aligned[pane], lineInfo{filler: true})
+		}
+	}
+
+	for {
+		runs := make([]int, len(panes))
+		tallest := 0
+		for i, lines := range panes {
+			for p := pos[i]; p < len(lines) && lines[p].baseLine == 0; p++ {
+				runs[i]++
+			}
+			tallest = max(tallest, runs[i])
+		}
+		for i := range panes {
+			for n := runs[i]; n > 0; n-- {
+				take(i)
+			}
+			pad(i, tallest-runs[i])
+		}
+
+		next := 0
+		for i, lines := range panes {
+			if pos[i] < len(lines) && (next == 0 || lines[pos[i]].baseLine < next) {
+				next = lines[pos[i]].baseLine
+			}
+		}
+		if next == 0 {
+			break
+		}
+		for i, lines := range panes {
+			if pos[i] < len(lines) && lines[pos[i]].baseLine == next {
+				take(i)
+			} else {
+				pad(i, 1)
+			}
+		}
+	}
+
+	for i := range panes {
+		if newStarts[i] < 0 {
+			newStarts[i] = len(aligned[i])
+		}
+	}
+	return aligned, newStarts
+}
+
+// foldContextLines collapses runs of unchanged lines further than contextLines
+// away from any highlighted or selected line into a single placeholder row.
+// Runs whose first index is in open are left unfolded. A contextLines of 0
+// disables folding. The returned start index is remapped to the folded slice.
+func foldContextLines(lines []lineInfo, start int, contextLines int, open map[int]bool) ([]lineInfo, int) {
+	if contextLines <= 0 || len(lines) == 0 {
+		return lines, start
+	}
+
+	keep := make([]bool, len(lines))
+	last := -1
+	for i, line := range lines {
+		if isFoldAnchor(line) {
+			last = i
+		}
+		if last >= 0 && i-last <= contextLines {
+			keep[i] = true
+		}
+	}
+	next := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if isFoldAnchor(lines[i]) {
+			next = i
+		}
+		if next >= 0 && next-i <= contextLines {
+			keep[i] = true
+		}
+	}
+
+	folded := make([]lineInfo, 0, len(lines))
+	newStart := 0
+	for i := 0; i < len(lines); {
+		if keep[i] {
+			if i == start {
+				newStart = len(folded)
+			}
+			folded = append(folded, lines[i])
+			i++
+			continue
+		}
+		runEnd := i
+		for runEnd < len(lines) && !keep[runEnd] {
+			runEnd++
+		}
+		if runEnd-i == 1 || open[i] {
+			if start >= i && start < runEnd {
+				newStart = len(folded) + start - i
+			}
+			folded = append(folded, lines[i:runEnd]...)
+		} else {
+			if start >= i && start < runEnd {
+				newStart = len(folded)
+			}
+			folded = append(folded, lineInfo{
+				text:      fmt.Sprintf("... %d lines folded ...", runEnd-i),
+				category:  categoryDefault,
+				dim:       true,
+				label:     true,
+				folded:    runEnd - i,
+				foldStart: i,
+			})
+		}
+		i = runEnd
+	}
+	return folded, newStart
+}
+
+func isFoldAnchor(line lineInfo) bool {
+	return line.category != categoryDefault || line.selected || line.connector != ""
+}
+
 func styleForCategory(styles map[lineCategory]lipgloss.Style, category lineCategory, fallback lipgloss.Style) lipgloss.Style {
 	if style, ok := styles[category]; ok {
 		return style
@@ -154,6 +576,8 @@ type resultRange struct {
 	start    int
 	end      int
 	resolved bool
+	// sources holds the source of each line from start on when resolved.
+	sources []lineSource
 }
 
 func buildPaneLinesFromDoc(doc markers.Document, side paneSide, highlightConflict int, selectedSide selectionSide) ([]lineInfo, int) {
@@ -174,11 +598,14 @@ func buildPaneLinesFromDoc(doc markers.Document, side paneSide, highlightConflic
 			selected := conflictIndex == highlightConflict
 			oursEntries, theirsEntries := conflictEntries(s)
 			var entries []lineEntry
+			var sideBytes, otherBytes []byte
 			switch side {
 			case paneOurs:
 				entries = oursEntries
+				sideBytes, otherBytes = s.Ours, s.Theirs
 			case paneTheirs:
 				entries = theirsEntries
+				sideBytes, otherBytes = s.Theirs, s.Ours
 			}
 
 			if selected && selectedSideMatchesPane(selectedSide, side) {
@@ -221,6 +648,19 @@ func buildPaneLinesFromDoc(doc markers.Document, side paneSide, highlightConflic
 				})
 			}
 
+			// A side that deleted the region says so instead of showing
+			// nothing, so add/delete conflicts read naturally.
+			if len(sideBytes) == 0 && len(otherBytes) > 0 {
+				lines = append(lines, lineInfo{
+					text:      strings.ToUpper(sideLabel(side)) + ": (deleted)",
+					category:  categoryRemoved,
+					highlight: true,
+					selected:  selected,
+					dim:       true,
+					connector: connector,
+				})
+			}
+
 			if selected && selectedSideMatchesPane(selectedSide, side) {
 				lines = append(lines, lineInfo{
 					text:      ">> selected hunk end >>",
@@ -340,6 +780,7 @@ func buildPaneLinesFromEntries(doc markers.Document, side paneSide, highlightCon
 			underline: false,
 			dim:       dim,
 			connector: lineConnector,
+			baseLine:  entry.baseIndex + 1,
 		})
 
 		if entry.category != categoryRemoved {
@@ -496,7 +937,8 @@ func buildResultLines(doc markers.Document, highlightConflict int, selectedSide
 						selected:  selected,
 						underline: underline,
 						dim:       false,
-						connector: connectorForResult(true, selected),
+						connector: connectorForResult(sourceManual, selected),
+						conflict:  conflictIndex + 1,
 					})
 				}
 				continue
@@ -515,8 +957,9 @@ func buildResultLines(doc markers.Document, highlightConflict int, selectedSide
 			case markers.ResolutionTheirs:
 				entries = theirsEntries
 			case markers.ResolutionBoth:
-				entries = append(entries, oursEntries...)
-				entries = append(entries, theirsEntries...)
+				entries = bothEntries(s, oursEntries, theirsEntries, doc.BothSeparator)
+			case markers.ResolutionBothDedup:
+				entries = bothDedupEntries(s)
 			case markers.ResolutionNone:
 				entries = nil
 			default:
@@ -533,32 +976,44 @@ func buildResultLines(doc markers.Document, highlightConflict int, selectedSide
 						text:      "[unresolved conflict]",
 						category:  categoryConflicted,
 						dim:       true,
-						connector: connectorForResult(false, selected),
+						label:     true,
+						connector: connectorForResult(sourceUnresolved, selected),
+						conflict:  conflictIndex + 1,
 					})
 				} else if effectiveResolution == markers.ResolutionNone && selected {
 					lines = append(lines, lineInfo{
 						text:      "[resolved: none]",
 						category:  categoryResolved,
+						label:     true,
 						highlight: true,
 						selected:  selected,
 						underline: underline,
 						dim:       false,
-						connector: connectorForResult(true, selected),
+						connector: connectorForResult(sourceResolved, selected),
+						conflict:  conflictIndex + 1,
 					})
 				}
 				continue
 			}
 
 			resolved := !preview
+			var sources []lineSource
+			if resolved {
+				sources = resolutionSources(s, effectiveResolution, doc.BothSeparator)
+			}
+			lineIndex := 0
 			for _, entry := range entries {
 				if entry.category == categoryRemoved {
 					continue
 				}
 				highlight := entry.category != categoryDefault
 				category := entry.category
+				source := sourceUnresolved
 				if resolved {
 					category = categoryResolved
+					source = sourceAt(sources, lineIndex)
 				}
+				lineIndex++
 				lines = append(lines, lineInfo{
 					text:      entry.text,
 					category:  category,
@@ -566,7 +1021,8 @@ func buildResultLines(doc markers.Document, highlightConflict int, selectedSide
 					selected:  selected,
 					underline: underline,
 					dim:       preview,
-					connector: connectorForResult(resolved, selected),
+					connector: connectorForResult(source, selected),
+					conflict:  conflictIndex + 1,
 				})
 			}
 
@@ -613,7 +1069,7 @@ func buildResultPreviewLines(doc markers.Document, selectedSide selectionSide, m
 
 			if manualBytes, ok := manualResolved[conflictIndex]; ok {
 				appendLines(splitLines(manualBytes))
-				ranges = append(ranges, resultRange{start: start, end: len(lines), resolved: true})
+				ranges = append(ranges, resultRange{start: start, end: len(lines), resolved: true, sources: repeatSource(sourceManual, len(lines)-start)})
 				continue
 			}
 
@@ -630,7 +1086,12 @@ func buildResultPreviewLines(doc markers.Document, selectedSide selectionSide, m
 				appendLines(splitLines(s.Theirs))
 			case markers.ResolutionBoth:
 				appendLines(splitLines(s.Ours))
+				if showsBothSeparator(s, doc.BothSeparator) {
+					appendLines([]string{doc.BothSeparator})
+				}
 				appendLines(splitLines(s.Theirs))
+			case markers.ResolutionBothDedup:
+				appendLines(splitLines(markers.BothDedup(s.Base, s.Ours, s.Theirs)))
 			case markers.ResolutionNone:
 				if !resolved {
 					placeholder := "[unresolved conflict]"
@@ -643,7 +1104,11 @@ func buildResultPreviewLines(doc markers.Document, selectedSide selectionSide, m
 				}
 			}
 
-			ranges = append(ranges, resultRange{start: start, end: len(lines), resolved: resolved})
+			var sources []lineSource
+			if resolved {
+				sources = resolutionSources(s, resolution, doc.BothSeparator)
+			}
+			ranges = append(ranges, resultRange{start: start, end: len(lines), resolved: resolved, sources: sources})
 		}
 		appendBoundary(segIndex + 1)
 	}
@@ -702,9 +1167,15 @@ func buildResultLinesFromEntries(entries []lineEntry, resultRanges []resultRange
 
 		connector := ""
 		resolved := false
+		conflict := 0
 		if resultLineIndex >= activeRange.start && resultLineIndex < activeRange.end {
+			conflict = rangeIndex + 1
 			resolved = activeRange.resolved
-			connector = connectorForResult(resolved, selected)
+			source := sourceUnresolved
+			if resolved {
+				source = sourceAt(activeRange.sources, resultLineIndex-activeRange.start)
+			}
+			connector = connectorForResult(source, selected)
 		}
 
 		category := entry.category
@@ -727,6 +1198,8 @@ func buildResultLinesFromEntries(entries []lineEntry, resultRanges []resultRange
 			underline: underline,
 			dim:       dim,
 			connector: connector,
+			baseLine:  entry.baseIndex + 1,
+			conflict:  conflict,
 		})
 
 		resultLineIndex++
@@ -768,6 +1241,17 @@ func conflictEntries(seg markers.ConflictSegment) ([]lineEntry, []lineEntry) {
 	oursLines := splitLines(seg.Ours)
 	theirsLines := splitLines(seg.Theirs)
 
+	// Without a base, a side next to an empty one simply added its lines;
+	// there is nothing on the empty side for them to conflict with.
+	if len(seg.Base) == 0 {
+		switch {
+		case len(seg.Theirs) == 0 && len(seg.Ours) > 0:
+			return entriesFromLines(oursLines, categoryAdded), nil
+		case len(seg.Ours) == 0 && len(seg.Theirs) > 0:
+			return nil, entriesFromLines(theirsLines, categoryAdded)
+		}
+	}
+
 	if len(baseLines) == 0 {
 		return entriesFromLines(oursLines, categoryConflicted), entriesFromLines(theirsLines, categoryConflicted)
 	}
@@ -778,6 +1262,227 @@ func conflictEntries(seg markers.ConflictSegment) ([]lineEntry, []lineEntry) {
 	return oursEntries, theirsEntries
 }
 
+// conflictDiffStat summarizes how much each side of seg changed, e.g.
+// "+3 −1 (ours)  +2 −2 (theirs)". Added and modified lines count as added,
+// removed and replaced base lines as removed. Without a base there is
+// nothing to compare, so the sides' line counts are shown instead.
+func conflictDiffStat(seg markers.ConflictSegment) string {
+	oursLines := splitLines(seg.Ours)
+	theirsLines := splitLines(seg.Theirs)
+	if len(seg.Base) == 0 {
+		return fmt.Sprintf("%d line(s) (ours)  %d line(s) (theirs)", len(oursLines), len(theirsLines))
+	}
+
+	baseLines := splitLines(seg.Base)
+	stat := func(sideLines []string) (added int, removed int) {
+		for _, entry := range diffEntries(baseLines, sideLines) {
+			switch entry.category {
+			case categoryAdded, categoryModified:
+				added++
+			case categoryRemoved:
+				removed++
+			}
+		}
+		return added, removed
+	}
+	oursAdded, oursRemoved := stat(oursLines)
+	theirsAdded, theirsRemoved := stat(theirsLines)
+	return fmt.Sprintf("+%d −%d (ours)  +%d −%d (theirs)", oursAdded, oursRemoved, theirsAdded, theirsRemoved)
+}
+
+// bothEntries returns the lines of a both resolution categorized as one
+// result against the conflict's base, so a base line kept by either side is
+// not reported as a conflict. Without a base the sides' own entries are
+// concatenated.
+func bothEntries(seg markers.ConflictSegment, oursEntries []lineEntry, theirsEntries []lineEntry, separator string) []lineEntry {
+	showSeparator := showsBothSeparator(seg, separator)
+	if len(seg.Base) == 0 {
+		entries := append([]lineEntry(nil), oursEntries...)
+		if showSeparator {
+			entries = append(entries, lineEntry{text: separator, category: categoryAdded, baseIndex: -1})
+		}
+		return append(entries, theirsEntries...)
+	}
+	lines := splitLines(seg.Ours)
+	if showSeparator {
+		lines = append(lines, separator)
+	}
+	lines = append(lines, splitLines(seg.Theirs)...)
+	return diffEntries(splitLines(seg.Base), lines)
+}
+
+// buildUnifiedLines renders doc for the unified layout: text between
+// conflicts as context, and each conflict as an ours and a theirs hunk of
+// lines removed (-) and added (+) relative to base. The header of a side the
+// resolution keeps, or of the selected side while unresolved, is marked >,
+// and the lines of sides left out are dimmed. Swapped puts the theirs hunk
+// first. It returns the lines and the index of the highlighted conflict's
+// first line.
+func buildUnifiedLines(doc markers.Document, highlightConflict int, selectedSide selectionSide, manualResolved map[int][]byte, swapped bool) ([]lineInfo, int) {
+	var lines []lineInfo
+	conflictIndex := -1
+	currentStart := 0
+
+	for _, seg := range doc.Segments {
+		switch s := seg.(type) {
+		case markers.TextSegment:
+			lines = append(lines, makeLineInfos(splitLines(s.Bytes), categoryDefault, false, false, false, false, "")...)
+		case markers.ConflictSegment:
+			conflictIndex++
+			selected := conflictIndex == highlightConflict
+			if selected {
+				currentStart = len(lines)
+			}
+			if manualBytes, ok := manualResolved[conflictIndex]; ok {
+				lines = append(lines, unifiedHunkHeader("manual edit", true, categoryResolved, selected))
+				for _, line := range splitLines(manualBytes) {
+					lines = append(lines, lineInfo{text: line, category: categoryResolved, selected: selected, connector: connectorForResult(sourceManual, false)})
+				}
+				continue
+			}
+
+			resolved := s.Resolution != markers.ResolutionUnset
+			resolution := s.Resolution
+			if !resolved {
+				resolution = resolutionFromSelection(selectedSide)
+			}
+			headerCategory := categoryConflicted
+			if resolved {
+				headerCategory = categoryResolved
+			}
+			oursEntries, theirsEntries := conflictEntries(s)
+			type unifiedSide struct {
+				pane    paneSide
+				name    string
+				label   string
+				entries []lineEntry
+			}
+			sides := []unifiedSide{
+				{paneOurs, "ours", s.OursLabel, oursEntries},
+				{paneTheirs, "theirs", s.TheirsLabel, theirsEntries},
+			}
+			if swapped {
+				sides[0], sides[1] = sides[1], sides[0]
+			}
+			for _, side := range sides {
+				title := side.name
+				if label := formatLabel(side.label); label != "" {
+					title = fmt.Sprintf("%s (%s)", side.name, label)
+				}
+				kept := resolutionIncludes(resolution, side.pane)
+				lines = append(lines, unifiedHunkHeader(title, kept, headerCategory, selected))
+				for _, entry := range side.entries {
+					// Without a base there is no line to remove; the
+					// removed entry only stands for the empty base.
+					if len(s.Base) == 0 && entry.category == categoryRemoved {
+						continue
+					}
+					lines = append(lines, lineInfo{
+						text:      entry.text,
+						category:  entry.category,
+						highlight: entry.category != categoryDefault,
+						selected:  selected,
+						dim:       !kept,
+						connector: unifiedConnector(entry.category),
+					})
+				}
+			}
+		}
+	}
+	return lines, currentStart
+}
+
+// unifiedHunkHeader returns the "@@ title @@" row that starts a hunk of the
+// unified layout, marked > when its lines are kept.
+func unifiedHunkHeader(title string, kept bool, category lineCategory, selected bool) lineInfo {
+	connector := " "
+	if kept {
+		connector = ">"
+	}
+	return lineInfo{
+		text:      "@@ " + title + " @@",
+		category:  category,
+		highlight: true,
+		selected:  selected,
+		underline: selected,
+		label:     true,
+		connector: connector,
+	}
+}
+
+// unifiedConnector returns the diff prefix of a unified hunk line: - for
+// base lines the side removed, + for lines it added or changed.
+func unifiedConnector(category lineCategory) string {
+	switch category {
+	case categoryRemoved:
+		return "-"
+	case categoryDefault:
+		return " "
+	default:
+		return "+"
+	}
+}
+
+// minimapRows places the conflicts of the result pane lines on a gauge of
+// height rows, scaling the visual row where each conflict starts. It
+// returns the gauge row of each conflict by index, -1 for conflicts that
+// have no lines (resolved to none), and the gauge rows the view covers when
+// the lines do not all fit, as [first, end).
+func minimapRows(lines []lineInfo, conflicts int, wrapWidth int, numberMode lineNumberMode, height int, yOffset int) ([]int, [2]int) {
+	rows := make([]int, conflicts)
+	for i := range rows {
+		rows[i] = -1
+	}
+	if height <= 0 {
+		return rows, [2]int{}
+	}
+	textWidth := wrapTextWidth(numberColumnWidth(lineNumbers(lines, numberMode)), wrapWidth)
+	starts := make([]int, conflicts)
+	total := 0
+	for _, line := range lines {
+		if index := line.conflict - 1; index >= 0 && index < conflicts && rows[index] == -1 {
+			rows[index] = 0
+			starts[index] = total
+		}
+		if textWidth <= 0 {
+			total++
+		} else {
+			total += len(wrapDisplayWidth(line.text, textWidth))
+		}
+	}
+	scale := func(row int) int {
+		return min(row*height/max(total, 1), height-1)
+	}
+	for i := range rows {
+		if rows[i] != -1 {
+			rows[i] = scale(starts[i])
+		}
+	}
+	if total <= height {
+		return rows, [2]int{}
+	}
+	first := scale(yOffset)
+	end := max(scale(min(yOffset+height, total)-1)+1, first+1)
+	return rows, [2]int{first, end}
+}
+
+// showsBothSeparator reports whether a both resolution of seg has the
+// separator line between its sides, as markers.JoinBoth writes it.
+func showsBothSeparator(seg markers.ConflictSegment, separator string) bool {
+	return separator != "" && len(seg.Ours) > 0 && len(seg.Theirs) > 0
+}
+
+// bothDedupEntries returns the lines of a both-dedup resolution categorized
+// against the conflict's base.
+func bothDedupEntries(seg markers.ConflictSegment) []lineEntry {
+	lines := splitLines(markers.BothDedup(seg.Base, seg.Ours, seg.Theirs))
+	baseLines := splitLines(seg.Base)
+	if len(baseLines) == 0 {
+		return entriesFromLines(lines, categoryConflicted)
+	}
+	return diffEntries(baseLines, lines)
+}
+
 func entriesFromLines(lines []string, category lineCategory) []lineEntry {
 	entries := make([]lineEntry, 0, len(lines))
 	for _, line := range lines {
@@ -814,6 +1519,88 @@ func diffEntries(baseLines []string, sideLines []string) []lineEntry {
 	return entries
 }
 
+// diffWindow pairs a changed region of base with the matching region of a
+// side. Outside its windows the side is expected to equal base line for line.
+type diffWindow struct {
+	baseStart int
+	baseEnd   int
+	sideStart int
+	sideEnd   int
+}
+
+func conflictWindows(ranges []conflictRange, side paneSide) []diffWindow {
+	windows := make([]diffWindow, 0, len(ranges))
+	for _, r := range ranges {
+		start, end := r.sideRange(side)
+		windows = append(windows, diffWindow{baseStart: r.baseStart, baseEnd: r.baseEnd, sideStart: start, sideEnd: end})
+	}
+	return windows
+}
+
+func resultWindows(ranges []conflictRange, resultRanges []resultRange) []diffWindow {
+	if len(ranges) != len(resultRanges) {
+		return nil
+	}
+	windows := make([]diffWindow, 0, len(ranges))
+	for i, r := range ranges {
+		windows = append(windows, diffWindow{baseStart: r.baseStart, baseEnd: r.baseEnd, sideStart: resultRanges[i].start, sideEnd: resultRanges[i].end})
+	}
+	return windows
+}
+
+// diffEntriesWithContext is diffEntries limited to contextLines around each
+// window: only those slices are diffed and the lines between them are taken
+// as unchanged. A contextLines of 0, or sides that differ outside the
+// windows, fall back to diffing the whole files.
+func diffEntriesWithContext(baseLines []string, sideLines []string, windows []diffWindow, contextLines int) []lineEntry {
+	if contextLines <= 0 || len(windows) == 0 {
+		return diffEntries(baseLines, sideLines)
+	}
+
+	entries := make([]lineEntry, 0, len(sideLines))
+	basePos, sidePos := 0, 0
+	appendUnchanged := func(baseEnd int, sideEnd int) bool {
+		if baseEnd-basePos != sideEnd-sidePos {
+			return false
+		}
+		for ; basePos < baseEnd; basePos, sidePos = basePos+1, sidePos+1 {
+			if baseLines[basePos] != sideLines[sidePos] {
+				return false
+			}
+			entries = append(entries, lineEntry{text: baseLines[basePos], category: categoryDefault, baseIndex: basePos})
+		}
+		return true
+	}
+
+	for i := 0; i < len(windows); {
+		w := windows[i]
+		lead := min(contextLines, w.baseStart-basePos, w.sideStart-sidePos)
+		baseStart, sideStart := w.baseStart-lead, w.sideStart-lead
+		baseEnd, sideEnd := w.baseEnd, w.sideEnd
+		// Merge the following windows whose context overlaps this one.
+		for i++; i < len(windows) && windows[i].baseStart-baseEnd <= 2*contextLines; i++ {
+			baseEnd, sideEnd = windows[i].baseEnd, windows[i].sideEnd
+		}
+		trail := min(contextLines, len(baseLines)-baseEnd, len(sideLines)-sideEnd)
+		baseEnd, sideEnd = baseEnd+trail, sideEnd+trail
+
+		if lead < 0 || sideStart < sidePos || !appendUnchanged(baseStart, sideStart) {
+			return diffEntries(baseLines, sideLines)
+		}
+		for _, entry := range diffEntries(baseLines[baseStart:baseEnd], sideLines[sideStart:sideEnd]) {
+			if entry.baseIndex >= 0 {
+				entry.baseIndex += baseStart
+			}
+			entries = append(entries, entry)
+		}
+		basePos, sidePos = baseEnd, sideEnd
+	}
+	if !appendUnchanged(len(baseLines), len(sideLines)) {
+		return diffEntries(baseLines, sideLines)
+	}
+	return entries
+}
+
 func diffOps(baseLines []string, sideLines []string) []diffOp {
 	if len(baseLines) == 0 && len(sideLines) == 0 {
 		return nil
@@ -957,7 +1744,7 @@ func resolutionIncludes(resolution markers.Resolution, side paneSide) bool {
 		return side == paneOurs
 	case markers.ResolutionTheirs:
 		return side == paneTheirs
-	case markers.ResolutionBoth:
+	case markers.ResolutionBoth, markers.ResolutionBothDedup:
 		return true
 	default:
 		return false
@@ -982,8 +1769,35 @@ func connectorForSide(side paneSide) string {
 	}
 }
 
-func connectorForResult(resolved bool, selected bool) string {
-	if resolved {
+// lineSource is where a result line came from, shown in the result pane's
+// connector column once its conflict is resolved.
+type lineSource int
+
+const (
+	sourceUnresolved lineSource = iota
+	sourceOurs
+	sourceTheirs
+	sourceBoth
+	sourceManual
+	// sourceResolved marks resolved lines taken from neither side, such as
+	// the [resolved: none] placeholder.
+	sourceResolved
+)
+
+// connectorForResult returns the connector of a result line: o, t, b or m
+// for resolved lines taken from ours, theirs, both sides or a manual edit,
+// v for other resolved lines, and | for the selected unresolved conflict.
+func connectorForResult(source lineSource, selected bool) string {
+	switch source {
+	case sourceOurs:
+		return "o"
+	case sourceTheirs:
+		return "t"
+	case sourceBoth:
+		return "b"
+	case sourceManual:
+		return "m"
+	case sourceResolved:
 		return "v"
 	}
 	if selected {
@@ -992,6 +1806,48 @@ func connectorForResult(resolved bool, selected bool) string {
 	return " "
 }
 
+// resolutionSources returns the source of each line resolution writes for
+// seg, in order. Both takes ours then theirs; both-dedup interleaves the
+// sides, so its lines are all marked as both.
+func resolutionSources(seg markers.ConflictSegment, resolution markers.Resolution, bothSeparator string) []lineSource {
+	repeat := func(source lineSource, content []byte) []lineSource {
+		return repeatSource(source, len(splitLines(content)))
+	}
+	switch resolution {
+	case markers.ResolutionOurs:
+		return repeat(sourceOurs, seg.Ours)
+	case markers.ResolutionTheirs:
+		return repeat(sourceTheirs, seg.Theirs)
+	case markers.ResolutionBoth:
+		sources := repeat(sourceOurs, seg.Ours)
+		if showsBothSeparator(seg, bothSeparator) {
+			sources = append(sources, sourceBoth)
+		}
+		return append(sources, repeat(sourceTheirs, seg.Theirs)...)
+	case markers.ResolutionBothDedup:
+		return repeat(sourceBoth, markers.BothDedup(seg.Base, seg.Ours, seg.Theirs))
+	default:
+		return nil
+	}
+}
+
+func repeatSource(source lineSource, n int) []lineSource {
+	sources := make([]lineSource, n)
+	for i := range sources {
+		sources[i] = source
+	}
+	return sources
+}
+
+// sourceAt returns the source of sources[index], or sourceResolved when
+// the line has none recorded.
+func sourceAt(sources []lineSource, index int) lineSource {
+	if index < 0 || index >= len(sources) {
+		return sourceResolved
+	}
+	return sources[index]
+}
+
 func selectedSideMatchesPane(selectedSide selectionSide, side paneSide) bool {
 	if selectedSide == selectedTheirs {
 		return side == paneTheirs
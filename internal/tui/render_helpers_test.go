@@ -2,20 +2,31 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/charmbracelet/lipgloss"
 	"github.com/chojs23/ec/internal/markers"
 )
 
 func TestConnectorForResult(t *testing.T) {
-	if got := connectorForResult(true, false); got != "v" {
-		t.Fatalf("connectorForResult(resolved=true) = %q, want v", got)
-	}
-	if got := connectorForResult(false, true); got != "|" {
-		t.Fatalf("connectorForResult(selected=true) = %q, want |", got)
+	tests := []struct {
+		source   lineSource
+		selected bool
+		want     string
+	}{
+		{sourceOurs, false, "o"},
+		{sourceTheirs, true, "t"},
+		{sourceBoth, false, "b"},
+		{sourceManual, false, "m"},
+		{sourceResolved, false, "v"},
+		{sourceUnresolved, true, "|"},
+		{sourceUnresolved, false, " "},
 	}
-	if got := connectorForResult(false, false); got != " " {
-		t.Fatalf("connectorForResult(default) = %q, want space", got)
+	for _, tt := range tests {
+		if got := connectorForResult(tt.source, tt.selected); got != tt.want {
+			t.Fatalf("connectorForResult(%d, %v) = %q, want %q", tt.source, tt.selected, got, tt.want)
+		}
 	}
 }
 
@@ -34,8 +45,8 @@ func TestBuildResultLinesManualResolved(t *testing.T) {
 	for _, line := range lines {
 		if line.category == categoryResolved {
 			found = true
-			if line.connector != "v" {
-				t.Fatalf("connector = %q, want v", line.connector)
+			if line.connector != "m" {
+				t.Fatalf("connector = %q, want m", line.connector)
 			}
 			break
 		}
@@ -45,6 +56,52 @@ func TestBuildResultLinesManualResolved(t *testing.T) {
 	}
 }
 
+func TestBuildUnifiedLinesMarksKeptSide(t *testing.T) {
+	input := []byte("start\n<<<<<<< HEAD\nours\n||||||| base\nbase\n=======\ntheirs\n>>>>>>> branch\nend\n")
+	doc, err := markers.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	lines, start := buildUnifiedLines(doc, 0, selectedTheirs, nil, false)
+	var got []string
+	for _, line := range lines {
+		got = append(got, line.connector+line.text)
+	}
+	want := []string{"start", " @@ ours (HEAD) @@", "-base", "+ours", ">@@ theirs (branch) @@", "-base", "+theirs", "end"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if start != 1 {
+		t.Fatalf("start = %d, want 1", start)
+	}
+	if !lines[2].dim || lines[5].dim {
+		t.Fatalf("dim = %v/%v, want only the ours hunk dimmed", lines[2].dim, lines[5].dim)
+	}
+}
+
+func TestMinimapRows(t *testing.T) {
+	var lines []lineInfo
+	for i := 0; i < 20; i++ {
+		lines = append(lines, lineInfo{text: "text"})
+	}
+	lines[0].conflict = 1
+	lines[1].conflict = 1
+	lines[10].conflict = 3
+	lines[19].conflict = 4
+
+	rows, thumb := minimapRows(lines, 4, 0, lineNumbersOff, 5, 8)
+	if want := []int{0, -1, 2, 4}; fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+	if thumb != [2]int{2, 4} {
+		t.Fatalf("thumb = %v, want [2 4]", thumb)
+	}
+
+	if _, thumb := minimapRows(lines, 4, 0, lineNumbersOff, 30, 0); thumb != [2]int{} {
+		t.Fatalf("thumb = %v, want none when every line fits", thumb)
+	}
+}
+
 func TestBuildResultLinesSkipsEmptyBoundarySlots(t *testing.T) {
 	doc := markers.Document{
 		Segments: []markers.Segment{
@@ -64,6 +121,31 @@ func TestBuildResultLinesSkipsEmptyBoundarySlots(t *testing.T) {
 	}
 }
 
+func TestBuildResultLinesBothDiffsAgainstBase(t *testing.T) {
+	doc := markers.Document{
+		Segments: []markers.Segment{
+			markers.ConflictSegment{
+				Ours:       []byte("keep\nours\n"),
+				Base:       []byte("keep\nold\n"),
+				Theirs:     []byte("keep\ntheirs\n"),
+				Resolution: markers.ResolutionBoth,
+			},
+		},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 0}},
+	}
+
+	lines, _ := buildResultLines(doc, 0, selectedOurs, nil, nil)
+	var got []string
+	for _, line := range lines {
+		got = append(got, fmt.Sprintf("%s:%t:%s", line.text, line.highlight, line.connector))
+	}
+	// The first "keep" is the base line; the second one is a new copy of it.
+	want := []string{"keep:false:o", "ours:true:o", "keep:true:t", "theirs:true:t"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", got, want)
+	}
+}
+
 func TestDiffEntriesCategories(t *testing.T) {
 	base := []string{"line1", "line2"}
 	side := []string{"line1", "line2-mod"}
@@ -92,6 +174,75 @@ func TestDiffEntriesCategories(t *testing.T) {
 	}
 }
 
+func TestConflictDiffStat(t *testing.T) {
+	seg := markers.ConflictSegment{
+		Base:   []byte("a\nb\nc\n"),
+		Ours:   []byte("a\nb2\nc\nd\ne\n"),
+		Theirs: []byte("c\n"),
+	}
+	if got, want := conflictDiffStat(seg), "+3 −1 (ours)  +0 −2 (theirs)"; got != want {
+		t.Fatalf("conflictDiffStat = %q, want %q", got, want)
+	}
+
+	seg.Base = nil
+	if got, want := conflictDiffStat(seg), "5 line(s) (ours)  1 line(s) (theirs)"; got != want {
+		t.Fatalf("conflictDiffStat without base = %q, want %q", got, want)
+	}
+}
+
+func TestConflictEntriesEmptySide(t *testing.T) {
+	ours, theirs := conflictEntries(markers.ConflictSegment{Ours: []byte("added1\nadded2\n")})
+	if len(theirs) != 0 {
+		t.Fatalf("theirs entries = %+v, want none", theirs)
+	}
+	if len(ours) != 2 || ours[0].category != categoryAdded || ours[1].category != categoryAdded {
+		t.Fatalf("ours entries = %+v, want two added lines", ours)
+	}
+
+	ours, theirs = conflictEntries(markers.ConflictSegment{Theirs: []byte("added\n")})
+	if len(ours) != 0 {
+		t.Fatalf("ours entries = %+v, want none", ours)
+	}
+	if len(theirs) != 1 || theirs[0].category != categoryAdded {
+		t.Fatalf("theirs entries = %+v, want one added line", theirs)
+	}
+
+	ours, theirs = conflictEntries(markers.ConflictSegment{Ours: []byte("a\n"), Theirs: []byte("b\n")})
+	if ours[len(ours)-1].category != categoryConflicted || theirs[len(theirs)-1].category != categoryConflicted {
+		t.Fatalf("entries = %+v / %+v, want conflicted when both sides added", ours, theirs)
+	}
+}
+
+func TestBuildPaneLinesFromDocLabelsDeletedSide(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		seg         markers.ConflictSegment
+		deletedSide paneSide
+		addedSide   paneSide
+		label       string
+	}{
+		{name: "empty theirs", seg: markers.ConflictSegment{Ours: []byte("kept\n")}, deletedSide: paneTheirs, addedSide: paneOurs, label: "THEIRS: (deleted)"},
+		{name: "empty ours", seg: markers.ConflictSegment{Theirs: []byte("kept\n")}, deletedSide: paneOurs, addedSide: paneTheirs, label: "OURS: (deleted)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := markers.Document{
+				Segments:  []markers.Segment{tt.seg},
+				Conflicts: []markers.ConflictRef{{SegmentIndex: 0}},
+			}
+
+			deleted, _ := buildPaneLinesFromDoc(doc, tt.deletedSide, -1, selectedOurs)
+			if len(deleted) != 1 || deleted[0].text != tt.label || deleted[0].category != categoryRemoved {
+				t.Fatalf("deleted side lines = %+v, want %q placeholder", deleted, tt.label)
+			}
+
+			added, _ := buildPaneLinesFromDoc(doc, tt.addedSide, -1, selectedOurs)
+			if len(added) != 1 || added[0].text != "kept" || added[0].category != categoryAdded {
+				t.Fatalf("added side lines = %+v, want kept as an added line", added)
+			}
+		})
+	}
+}
+
 func TestMarkConflictedInRanges(t *testing.T) {
 	ours := []lineEntry{{text: "same", category: categoryDefault, baseIndex: 0}, {text: "ours", category: categoryDefault, baseIndex: 1}}
 	theirs := []lineEntry{{text: "same", category: categoryDefault, baseIndex: 0}, {text: "theirs", category: categoryDefault, baseIndex: 1}}
@@ -439,6 +590,31 @@ func TestBuildResultPreviewLinesUsesSelection(t *testing.T) {
 	}
 }
 
+func TestBuildResultLinesFromEntriesMarksSources(t *testing.T) {
+	doc := markers.Document{
+		Segments: []markers.Segment{
+			markers.TextSegment{Bytes: []byte("start\n")},
+			markers.ConflictSegment{Ours: []byte("o1\n"), Base: []byte("b1\n"), Theirs: []byte("t1\n"), Resolution: markers.ResolutionBoth},
+			markers.ConflictSegment{Ours: []byte("o2\n"), Base: []byte("b2\n"), Theirs: []byte("t2\n")},
+			markers.ConflictSegment{Ours: []byte("o3\n"), Base: []byte("b3\n"), Theirs: []byte("t3\n")},
+		},
+		Conflicts: []markers.ConflictRef{{SegmentIndex: 1}, {SegmentIndex: 2}, {SegmentIndex: 3}},
+	}
+	manual := map[int][]byte{1: []byte("edited\n")}
+
+	previewLines, forced, ranges := buildResultPreviewLines(doc, selectedTheirs, manual, 2, nil)
+	entries := diffEntries([]string{"start", "b1", "b2", "b3"}, previewLines)
+	lines, _ := buildResultLinesFromEntries(entries, ranges, 2, forced)
+	var got []string
+	for _, line := range lines {
+		got = append(got, line.text+":"+line.connector)
+	}
+	want := []string{"start:", "o1:o", "t1:t", "edited:m", "t3:|"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", got, want)
+	}
+}
+
 func TestBuildResultPreviewLinesSkipsEmptyBoundarySlots(t *testing.T) {
 	doc := markers.Document{
 		Segments: []markers.Segment{
@@ -534,3 +710,207 @@ func TestEntriesFromLines(t *testing.T) {
 		t.Fatalf("entry 1 text = %q, want b", entries[1].text)
 	}
 }
+
+func TestWrapDisplayWidth(t *testing.T) {
+	rows := wrapDisplayWidth("abcdefgh", 3)
+	want := []string{"abc", "def", "gh"}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("wrapDisplayWidth = %q, want %q", rows, want)
+	}
+	if rows := wrapDisplayWidth("short", 10); len(rows) != 1 || rows[0] != "short" {
+		t.Fatalf("wrapDisplayWidth(short) = %q, want single row", rows)
+	}
+	if rows := wrapDisplayWidth("", 3); len(rows) != 1 || rows[0] != "" {
+		t.Fatalf("wrapDisplayWidth(empty) = %q, want one empty row", rows)
+	}
+}
+
+func TestLineNumbersModes(t *testing.T) {
+	lines := []lineInfo{
+		{text: "a"},
+		{text: "... 3 lines folded ...", label: true, folded: 3},
+		{text: ">> selected hunk start (ours) >>", category: categoryInsertMarker},
+		{text: "- base", category: categoryRemoved},
+		{text: "ours", category: categoryAdded},
+		{filler: true},
+		{text: "z"},
+	}
+	tests := []struct {
+		mode lineNumberMode
+		want []int
+	}{
+		{lineNumbersFile, []int{1, 0, 0, 0, 5, 0, 6}},
+		{lineNumbersPosition, []int{1, 2, 3, 4, 5, 0, 6}},
+		{lineNumbersOff, []int{0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		if got := lineNumbers(lines, tt.mode); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Fatalf("lineNumbers(%s) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+
+	style := lipgloss.NewStyle()
+	styles := map[lineCategory]lipgloss.Style{}
+	if got := renderLines(lines[:1], style, styles, styles, styles, styles, false, 0, lineNumbersOff); got != "  a" {
+		t.Fatalf("renderLines without numbers = %q, want %q", got, "  a")
+	}
+}
+
+func TestRenderLinesWrapsContinuationRowsWithoutLineNumbers(t *testing.T) {
+	lines := []lineInfo{{text: "abcdefgh"}, {text: "ij"}}
+	style := lipgloss.NewStyle()
+	styles := map[lineCategory]lipgloss.Style{}
+
+	rendered := renderLines(lines, style, styles, styles, styles, styles, false, 7, lineNumbersPosition)
+	got := strings.Split(rendered, "\n")
+	want := []string{"1   abc", "    def", "    gh", "2   ij"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("renderLines wrapped = %q, want %q", got, want)
+	}
+
+	if offset := visualRowOffset(lines, 1, 7, lineNumbersPosition); offset != 3 {
+		t.Fatalf("visualRowOffset = %d, want 3", offset)
+	}
+	if offset := visualRowOffset(lines, 1, 0, lineNumbersPosition); offset != 1 {
+		t.Fatalf("visualRowOffset without wrap = %d, want 1", offset)
+	}
+}
+
+func TestShowWhitespaceMarkers(t *testing.T) {
+	lines := []lineInfo{{text: "\tfoo  "}, {text: "a b"}, {text: "plain"}}
+
+	marked := showWhitespaceMarkers(lines, defaultTabWidth)
+	want := []string{"→   foo··", "a b", "plain"}
+	for i, line := range marked {
+		if line.text != want[i] {
+			t.Fatalf("line %d text = %q, want %q", i, line.text, want[i])
+		}
+	}
+	if !marked[0].whitespace || marked[2].whitespace {
+		t.Fatalf("whitespace flags = %v/%v, want true/false", marked[0].whitespace, marked[2].whitespace)
+	}
+	if lines[0].text != "\tfoo  " {
+		t.Fatalf("input line modified: %q", lines[0].text)
+	}
+
+	// A marked tab keeps the width of the expanded tab.
+	style := lipgloss.NewStyle()
+	if got, want := lipgloss.Width(renderWhitespaceMarkers(marked[0].text, style)), lipgloss.Width(expandTabs(lines[0].text, defaultTabWidth, " ")); got != want {
+		t.Fatalf("marked width = %d, want %d", got, want)
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		text     string
+		tabWidth int
+		want     string
+	}{
+		{"\tfoo", 4, "    foo"},
+		{"a\tb", 4, "a   b"},
+		{"abcd\tx", 4, "abcd    x"},
+		{"\tx", 8, "        x"},
+		{"界\tx", 4, "界  x"},
+		{"plain", 4, "plain"},
+	}
+	for _, tt := range tests {
+		if got := expandTabs(tt.text, tt.tabWidth, " "); got != tt.want {
+			t.Errorf("expandTabs(%q, %d) = %q, want %q", tt.text, tt.tabWidth, got, tt.want)
+		}
+	}
+
+	// Wrapping counts the expanded cells, which a raw tab would not.
+	lines := expandLineTabs([]lineInfo{{text: "\t\tabcdef"}, {text: "x"}}, 4)
+	if offset := visualRowOffset(lines, 1, 12, lineNumbersOff); offset != 2 {
+		t.Fatalf("visualRowOffset after a tabbed line = %d, want 2", offset)
+	}
+}
+
+func TestDiffEntriesWithContextMatchesFullDiff(t *testing.T) {
+	var base []string
+	for i := 0; i < 20; i++ {
+		base = append(base, fmt.Sprintf("l%d", i))
+	}
+	ours := append([]string(nil), base[:5]...)
+	ours = append(ours, "o5")
+	ours = append(ours, base[6:14]...)
+	ours = append(ours, "o14a", "o14b")
+	ours = append(ours, base[15:]...)
+	windows := []diffWindow{
+		{baseStart: 5, baseEnd: 6, sideStart: 5, sideEnd: 6},
+		{baseStart: 14, baseEnd: 15, sideStart: 14, sideEnd: 16},
+	}
+
+	want := fmt.Sprint(diffEntries(base, ours))
+	for _, contextLines := range []int{1, 2, 4, 100} {
+		if got := fmt.Sprint(diffEntriesWithContext(base, ours, windows, contextLines)); got != want {
+			t.Fatalf("context %d entries = %s, want %s", contextLines, got, want)
+		}
+	}
+
+	// A change outside the windows falls back to the full diff.
+	changed := append([]string(nil), ours...)
+	changed[0] = "outside"
+	if got, want := fmt.Sprint(diffEntriesWithContext(base, changed, windows, 1)), fmt.Sprint(diffEntries(base, changed)); got != want {
+		t.Fatalf("fallback entries = %s, want %s", got, want)
+	}
+}
+
+func TestNextChangeRow(t *testing.T) {
+	lines := []lineInfo{
+		{text: "a"},
+		{text: "b", category: categoryModified},
+		{text: "c", category: categoryModified},
+		{text: "d"},
+		{filler: true, category: categoryAdded},
+		{text: "e", category: categoryAdded},
+		{text: "f"},
+	}
+	tests := []struct {
+		row       int
+		direction int
+		want      int
+		wantOK    bool
+	}{
+		{row: 0, direction: 1, want: 1, wantOK: true},
+		{row: 1, direction: 1, want: 5, wantOK: true},
+		{row: 5, direction: 1, wantOK: false},
+		{row: 6, direction: -1, want: 5, wantOK: true},
+		{row: 5, direction: -1, want: 1, wantOK: true},
+		{row: 1, direction: -1, wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := nextChangeRow(lines, 0, lineNumbersFile, tt.row, tt.direction)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Fatalf("nextChangeRow(row %d, direction %d) = %d, %v; want %d, %v", tt.row, tt.direction, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAlignPaneLines(t *testing.T) {
+	ours := []lineInfo{{text: "a", baseLine: 1}, {text: "- b", baseLine: 2}, {text: "c", baseLine: 3}}
+	result := []lineInfo{{text: "a", baseLine: 1}, {text: "b", baseLine: 2}, {text: "new1"}, {text: "new2"}, {text: "c", baseLine: 3}}
+	theirs := []lineInfo{{text: "a", baseLine: 1}, {text: "b", baseLine: 2}, {text: "new1"}, {text: "c", baseLine: 3}}
+
+	panes, starts := alignPaneLines([][]lineInfo{ours, result, theirs}, []int{2, 2, 3})
+	want := [][]string{
+		{"a", "- b", "", "", "c"},
+		{"a", "b", "new1", "new2", "c"},
+		{"a", "b", "new1", "", "c"},
+	}
+	for i, lines := range panes {
+		var got []string
+		for _, line := range lines {
+			got = append(got, line.text)
+		}
+		if strings.Join(got, "|") != strings.Join(want[i], "|") {
+			t.Fatalf("pane %d = %q, want %q", i, got, want[i])
+		}
+	}
+	if !panes[0][2].filler || panes[1][2].filler {
+		t.Fatalf("filler flags = %v/%v, want true/false", panes[0][2].filler, panes[1][2].filler)
+	}
+	if starts[0] != 4 || starts[1] != 2 || starts[2] != 4 {
+		t.Fatalf("starts = %v, want [4 2 4]", starts)
+	}
+}
@@ -4,20 +4,45 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/chojs23/ec/internal/markers"
 )
 
 type FileCandidate struct {
 	Path     string
 	Resolved bool
+	// ConflictCount is the number of conflict blocks left in the merged
+	// file, shown next to unresolved files.
+	ConflictCount int
+	// Preview returns the conflicted content shown next to the list while
+	// the file is highlighted. It is called lazily, at most once per file.
+	Preview func() ([]byte, error)
 }
 
 type fileItem struct {
-	path     string
-	resolved bool
+	path      string
+	resolved  bool
+	conflicts int
+	preview   func() ([]byte, error)
+}
+
+// label returns the status shown before the path, with the number of
+// remaining conflicts for unresolved files.
+func (f fileItem) label() string {
+	if f.resolved {
+		return "resolved"
+	}
+	if f.conflicts > 0 {
+		return fmt.Sprintf("unresolved (%d)", f.conflicts)
+	}
+	return "unresolved"
 }
 
 func (f fileItem) Title() string {
@@ -32,7 +57,11 @@ func (f fileItem) FilterValue() string {
 	return f.path
 }
 
-type fileItemDelegate struct{}
+// fileItemDelegate renders one file per line. labelWidth pads the status
+// labels to a common width so the paths line up.
+type fileItemDelegate struct {
+	labelWidth int
+}
 
 type programRunner interface {
 	Run() (tea.Model, error)
@@ -41,8 +70,8 @@ type programRunner interface {
 var (
 	resolvedLabelStyle   lipgloss.Style
 	unresolvedLabelStyle lipgloss.Style
-	selectProgram        = func(model tea.Model, ctx context.Context) programRunner {
-		return tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+	selectProgram        = func(model tea.Model, ctx context.Context, opts cli.Options) programRunner {
+		return tea.NewProgram(model, programOptions(opts, tea.WithContext(ctx))...)
 	}
 )
 
@@ -67,43 +96,85 @@ func (d fileItemDelegate) Render(w io.Writer, m list.Model, index int, item list
 	if index == m.Index() {
 		cursor = "> "
 	}
-	label := "unresolved"
+	label := file.label()
 	labelStyle := unresolvedLabelStyle
 	if file.resolved {
-		label = "resolved"
 		labelStyle = resolvedLabelStyle
 	}
-	labelWidth := len("unresolved")
+	labelWidth := max(d.labelWidth, len("unresolved"))
 	labelText := fmt.Sprintf("%*s", labelWidth, label)
 	fmt.Fprint(w, cursor+labelStyle.Render(labelText)+"  "+file.path)
 }
 
 type fileSelectModel struct {
 	list     list.Model
+	preview  viewport.Model
+	previews map[string]string
+	// previewPath is the file whose preview the viewport currently shows.
+	previewPath string
+	// watch, when set, re-reads the candidates periodically; watchErr is
+	// the error of the last failed refresh, shown under the list.
+	watch    *Watch
+	watchErr error
 	selected string
 	err      error
+	// inline is set with --no-altscreen; the list is then cleared on exit
+	// instead of being left in the scrollback.
+	inline bool
 }
 
 var ErrSelectorQuit = fmt.Errorf("selector quit")
 
+// ErrNoConflictsLeft is returned by WatchFile once no unresolved file remains.
+var ErrNoConflictsLeft = fmt.Errorf("no conflicts left")
+
+// Watch makes the selector re-read its candidates every Interval so files
+// show up and drop out as a rebase or merge elsewhere moves along.
+type Watch struct {
+	Interval time.Duration
+	Refresh  func() ([]FileCandidate, error)
+	// KeepOpen keeps watching when no unresolved file remains instead of
+	// returning ErrNoConflictsLeft.
+	KeepOpen bool
+}
+
+type watchTickMsg struct{}
+
+type watchRefreshMsg struct {
+	candidates []FileCandidate
+	err        error
+}
+
 // SelectFile opens a TUI selector and returns the chosen repo-relative path.
-func SelectFile(ctx context.Context, candidates []FileCandidate) (string, error) {
+func SelectFile(ctx context.Context, opts cli.Options, candidates []FileCandidate) (string, error) {
+	return selectFile(ctx, opts, candidates, nil)
+}
+
+// WatchFile is SelectFile with a list kept up to date by watch.
+func WatchFile(ctx context.Context, opts cli.Options, candidates []FileCandidate, watch Watch) (string, error) {
+	return selectFile(ctx, opts, candidates, &watch)
+}
+
+func selectFile(ctx context.Context, opts cli.Options, candidates []FileCandidate, watch *Watch) (string, error) {
 	if err := ensureThemeLoaded(); err != nil {
 		return "", err
 	}
-	items := make([]list.Item, 0, len(candidates))
-	for _, candidate := range candidates {
-		items = append(items, fileItem{path: candidate.Path, resolved: candidate.Resolved})
+	applyColorOption(opts)
+	items, delegate := fileItems(candidates)
+	model := fileSelectModel{
+		list:     list.New(items, delegate, 0, 0),
+		preview:  viewport.New(0, 0),
+		previews: make(map[string]string),
+		watch:    watch,
+		inline:   opts.NoAltScreen,
 	}
-
-	model := fileSelectModel{list: list.New(items, fileItemDelegate{}, 0, 0)}
 	model.list.Title = "Select conflicted file"
 	model.list.SetShowHelp(false)
 	model.list.SetShowStatusBar(false)
 	model.list.SetShowPagination(false)
 	model.list.SetFilteringEnabled(false)
 
-	program := selectProgram(model, ctx)
+	program := selectProgram(model, ctx, opts)
 	finalModel, err := program.Run()
 	if err != nil {
 		return "", fmt.Errorf("file selector TUI error: %w", err)
@@ -122,12 +193,82 @@ func SelectFile(ctx context.Context, candidates []FileCandidate) (string, error)
 	return result.selected, nil
 }
 
+// fileItems turns candidates into list items and a delegate wide enough for
+// their labels.
+func fileItems(candidates []FileCandidate) ([]list.Item, fileItemDelegate) {
+	items := make([]list.Item, 0, len(candidates))
+	delegate := fileItemDelegate{}
+	for _, candidate := range candidates {
+		item := fileItem{
+			path:      candidate.Path,
+			resolved:  candidate.Resolved,
+			conflicts: candidate.ConflictCount,
+			preview:   candidate.Preview,
+		}
+		delegate.labelWidth = max(delegate.labelWidth, len(item.label()))
+		items = append(items, item)
+	}
+	return items, delegate
+}
+
 func (m fileSelectModel) Init() tea.Cmd {
-	return nil
+	if m.watch == nil {
+		return nil
+	}
+	return m.watchTick()
+}
+
+func (m fileSelectModel) watchTick() tea.Cmd {
+	return tea.Tick(m.watch.Interval, func(time.Time) tea.Msg {
+		return watchTickMsg{}
+	})
+}
+
+// applyRefresh replaces the list with candidates, keeping the cursor on the
+// same file when it is still listed, and drops cached previews since the
+// files may have changed.
+func (m *fileSelectModel) applyRefresh(candidates []FileCandidate) {
+	current := ""
+	if item, ok := m.list.SelectedItem().(fileItem); ok {
+		current = item.path
+	}
+	index := m.list.Index()
+
+	items, delegate := fileItems(candidates)
+	m.list.SetDelegate(delegate)
+	m.list.SetItems(items)
+	for i, item := range items {
+		if item.(fileItem).path == current {
+			index = i
+			break
+		}
+	}
+	m.list.Select(min(index, max(len(items)-1, 0)))
+
+	m.previews = make(map[string]string)
+	m.previewPath = ""
+	m.preview.SetContent("")
 }
 
 func (m fileSelectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case watchTickMsg:
+		refresh := m.watch.Refresh
+		return m, func() tea.Msg {
+			candidates, err := refresh()
+			return watchRefreshMsg{candidates: candidates, err: err}
+		}
+	case watchRefreshMsg:
+		m.watchErr = msg.err
+		if msg.err == nil {
+			m.applyRefresh(msg.candidates)
+			if !m.watch.KeepOpen && !hasUnresolved(msg.candidates) {
+				m.err = ErrNoConflictsLeft
+				return m, tea.Quit
+			}
+			m.refreshPreview()
+		}
+		return m, m.watchTick()
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "ctrl+c":
@@ -145,14 +286,111 @@ func (m fileSelectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if height < 5 {
 			height = 5
 		}
-		m.list.SetSize(width, height-2)
+		listWidth := width
+		if width >= selectorPreviewMinWidth {
+			listWidth = width * 2 / 5
+			m.preview.Width = width - listWidth - 1
+		} else {
+			m.preview.Width = 0
+		}
+		m.preview.Height = height - 2
+		m.list.SetSize(listWidth, height-2)
 	}
 
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
+	m.refreshPreview()
 	return m, cmd
 }
 
 func (m fileSelectModel) View() string {
-	return m.list.View() + "\n" + "up/down: move, enter: select, q: quit"
+	if m.inline && (m.selected != "" || m.err != nil) {
+		return ""
+	}
+	body := m.list.View()
+	if m.preview.Width > 0 {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, body, " ", m.preview.View())
+	}
+	footer := "up/down: move, enter: select, q: quit"
+	if m.watch != nil {
+		footer += " (watching for conflicts)"
+		if m.watchErr != nil {
+			footer += fmt.Sprintf("\nrefresh failed: %v", m.watchErr)
+		}
+	}
+	return body + "\n" + footer
+}
+
+// hasUnresolved reports whether any candidate still has conflict markers.
+func hasUnresolved(candidates []FileCandidate) bool {
+	for _, candidate := range candidates {
+		if !candidate.Resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorPreviewMinWidth is the terminal width below which the selector
+// shows only the file list.
+const selectorPreviewMinWidth = 60
+
+// refreshPreview loads the preview of the highlighted file into the viewport
+// when the highlight moved to another file.
+func (m *fileSelectModel) refreshPreview() {
+	item, ok := m.list.SelectedItem().(fileItem)
+	if !ok || item.path == m.previewPath {
+		return
+	}
+	if m.previews == nil {
+		m.previews = make(map[string]string)
+	}
+	content, ok := m.previews[item.path]
+	if !ok {
+		content = loadFilePreview(item)
+		m.previews[item.path] = content
+	}
+	m.previewPath = item.path
+	m.preview.SetContent(content)
+	m.preview.GotoTop()
+}
+
+// loadFilePreview renders the first conflict of item's content, or a short
+// note when there is nothing to show.
+func loadFilePreview(item fileItem) string {
+	if item.preview == nil {
+		return "(no preview)"
+	}
+	data, err := item.preview()
+	if err != nil {
+		return fmt.Sprintf("(preview unavailable: %v)", err)
+	}
+	doc, err := markers.Parse(data)
+	if err != nil {
+		return fmt.Sprintf("(preview unavailable: %v)", err)
+	}
+	if len(doc.Conflicts) == 0 {
+		return "(no conflicts)"
+	}
+	seg, ok := doc.Segments[doc.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	if !ok {
+		return "(no conflicts)"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "conflict 1 of %d\n\n", len(doc.Conflicts))
+	b.WriteString(oursHighlightStyle.Render("ours") + "\n")
+	b.WriteString(previewSide(seg.Ours))
+	b.WriteString(theirsHighlightStyle.Render("theirs") + "\n")
+	b.WriteString(previewSide(seg.Theirs))
+	return b.String()
+}
+
+// previewSide returns the lines of one conflict side, ending in a newline.
+func previewSide(side []byte) string {
+	if len(side) == 0 {
+		return "  (empty)\n"
+	}
+	text := strings.TrimSuffix(strings.ReplaceAll(string(side), "\r\n", "\n"), "\n")
+	return "  " + strings.ReplaceAll(text, "\n", "\n  ") + "\n"
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/chojs23/ec/internal/cli"
 )
 
 type stubProgram struct {
@@ -20,7 +21,7 @@ func (s stubProgram) Run() (tea.Model, error) {
 	return s.model, s.err
 }
 
-func withSelectProgram(t *testing.T, fn func(model tea.Model, ctx context.Context) programRunner, run func()) {
+func withSelectProgram(t *testing.T, fn func(model tea.Model, ctx context.Context, opts cli.Options) programRunner, run func()) {
 	t.Helper()
 	old := selectProgram
 	selectProgram = fn
@@ -96,6 +97,28 @@ func TestFileItemDelegateRender(t *testing.T) {
 	}
 }
 
+func TestFileItemDelegateRenderConflictCount(t *testing.T) {
+	items := []list.Item{
+		fileItem{path: "a.txt", conflicts: 12},
+		fileItem{path: "b.txt", resolved: true, conflicts: 0},
+	}
+	delegate := fileItemDelegate{labelWidth: len("unresolved (12)")}
+	model := list.New(items, delegate, 0, 0)
+
+	var first, second bytes.Buffer
+	delegate.Render(&first, model, 0, items[0])
+	delegate.Render(&second, model, 1, items[1])
+	if !strings.Contains(first.String(), "unresolved (12)  a.txt") {
+		t.Fatalf("output = %q, want conflict count", first.String())
+	}
+	if strings.Contains(second.String(), "(") {
+		t.Fatalf("output = %q, want no count for resolved file", second.String())
+	}
+	if strings.Index(first.String(), "a.txt") != strings.Index(second.String(), "b.txt") {
+		t.Fatalf("paths not aligned:\n%q\n%q", first.String(), second.String())
+	}
+}
+
 func TestFileSelectModelUpdateEnter(t *testing.T) {
 	items := []list.Item{fileItem{path: "a.txt", resolved: false}}
 	model := fileSelectModel{list: list.New(items, fileItemDelegate{}, 0, 0)}
@@ -141,6 +164,55 @@ func TestFileSelectModelView(t *testing.T) {
 	}
 }
 
+func TestFileSelectModelPreviewLoadsHighlightedFileOnce(t *testing.T) {
+	calls := map[string]int{}
+	loader := func(path string, data string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			calls[path]++
+			return []byte(data), nil
+		}
+	}
+	items := []list.Item{
+		fileItem{path: "a.txt", preview: loader("a.txt", "<<<<<<< ours\nalpha\n=======\nbeta\n>>>>>>> theirs\n")},
+		fileItem{path: "b.txt", preview: loader("b.txt", "clean\n")},
+	}
+	model := fileSelectModel{list: list.New(items, fileItemDelegate{}, 0, 0)}
+
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	model = updated.(fileSelectModel)
+	view := model.View()
+	if !strings.Contains(view, "alpha") || !strings.Contains(view, "beta") {
+		t.Fatalf("view = %q, want preview of first conflict", view)
+	}
+	if calls["b.txt"] != 0 {
+		t.Fatalf("b.txt preview loaded before it was highlighted")
+	}
+
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model = updated.(fileSelectModel)
+	if !strings.Contains(model.View(), "(no conflicts)") {
+		t.Fatalf("view = %q, want no conflicts note", model.View())
+	}
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyUp})
+	model = updated.(fileSelectModel)
+	if calls["a.txt"] != 1 || calls["b.txt"] != 1 {
+		t.Fatalf("calls = %v, want each preview loaded once", calls)
+	}
+}
+
+func TestFileSelectModelNarrowWindowHidesPreview(t *testing.T) {
+	items := []list.Item{fileItem{path: "a.txt", preview: func() ([]byte, error) {
+		return []byte("<<<<<<< ours\nalpha\n=======\nbeta\n>>>>>>> theirs\n"), nil
+	}}}
+	model := fileSelectModel{list: list.New(items, fileItemDelegate{}, 0, 0)}
+
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 40, Height: 20})
+	result := updated.(fileSelectModel)
+	if strings.Contains(result.View(), "alpha") {
+		t.Fatalf("view = %q, want no preview on a narrow terminal", result.View())
+	}
+}
+
 func TestFileSelectModelInitReturnsNil(t *testing.T) {
 	model := fileSelectModel{}
 	if cmd := model.Init(); cmd != nil {
@@ -148,11 +220,72 @@ func TestFileSelectModelInitReturnsNil(t *testing.T) {
 	}
 }
 
+func TestFileSelectModelWatchRefreshKeepsCursor(t *testing.T) {
+	watch := &Watch{Refresh: func() ([]FileCandidate, error) {
+		return []FileCandidate{{Path: "new.txt"}, {Path: "a.txt"}, {Path: "b.txt"}}, nil
+	}}
+	items, delegate := fileItems([]FileCandidate{{Path: "a.txt"}, {Path: "b.txt"}})
+	model := fileSelectModel{list: list.New(items, delegate, 0, 0), watch: watch}
+	model.list.Select(1)
+
+	if model.Init() == nil {
+		t.Fatalf("Init() = nil, want a watch tick")
+	}
+	updated, cmd := model.Update(watchTickMsg{})
+	model = updated.(fileSelectModel)
+	if cmd == nil {
+		t.Fatalf("watch tick returned no refresh command")
+	}
+	updated, cmd = model.Update(cmd())
+	model = updated.(fileSelectModel)
+	if cmd == nil {
+		t.Fatalf("refresh did not schedule the next tick")
+	}
+	if got := len(model.list.Items()); got != 3 {
+		t.Fatalf("items = %d, want 3", got)
+	}
+	if item := model.list.SelectedItem().(fileItem); item.path != "b.txt" {
+		t.Fatalf("selected = %q, want b.txt kept under the cursor", item.path)
+	}
+	if !strings.Contains(model.View(), "watching for conflicts") {
+		t.Fatalf("view = %q, want watch note", model.View())
+	}
+}
+
+func TestFileSelectModelWatchQuitsWhenResolved(t *testing.T) {
+	items, delegate := fileItems([]FileCandidate{{Path: "a.txt"}})
+	resolved := []FileCandidate{{Path: "a.txt", Resolved: true}}
+	for _, keepOpen := range []bool{false, true} {
+		model := fileSelectModel{list: list.New(items, delegate, 0, 0), watch: &Watch{KeepOpen: keepOpen}}
+		updated, _ := model.Update(watchRefreshMsg{candidates: resolved})
+		model = updated.(fileSelectModel)
+		if keepOpen && model.err != nil {
+			t.Fatalf("KeepOpen: err = %v, want the selector to stay open", model.err)
+		}
+		if !keepOpen && !errors.Is(model.err, ErrNoConflictsLeft) {
+			t.Fatalf("err = %v, want ErrNoConflictsLeft", model.err)
+		}
+	}
+}
+
+func TestFileSelectModelWatchRefreshError(t *testing.T) {
+	items, delegate := fileItems([]FileCandidate{{Path: "a.txt"}})
+	model := fileSelectModel{list: list.New(items, delegate, 0, 0), watch: &Watch{}}
+	updated, _ := model.Update(watchRefreshMsg{err: errors.New("git failed")})
+	model = updated.(fileSelectModel)
+	if model.err != nil || len(model.list.Items()) != 1 {
+		t.Fatalf("err = %v, items = %d; want the old list kept", model.err, len(model.list.Items()))
+	}
+	if !strings.Contains(model.View(), "refresh failed: git failed") {
+		t.Fatalf("view = %q, want refresh error", model.View())
+	}
+}
+
 func TestSelectFileReturnsSelected(t *testing.T) {
-	withSelectProgram(t, func(model tea.Model, ctx context.Context) programRunner {
+	withSelectProgram(t, func(model tea.Model, ctx context.Context, opts cli.Options) programRunner {
 		return stubProgram{model: fileSelectModel{selected: "picked.txt"}}
 	}, func() {
-		selected, err := SelectFile(context.Background(), []FileCandidate{{Path: "picked.txt"}})
+		selected, err := SelectFile(context.Background(), cli.Options{}, []FileCandidate{{Path: "picked.txt"}})
 		if err != nil {
 			t.Fatalf("SelectFile error = %v", err)
 		}
@@ -162,11 +295,33 @@ func TestSelectFileReturnsSelected(t *testing.T) {
 	})
 }
 
+func TestSelectFileNoAltScreen(t *testing.T) {
+	withSelectProgram(t, func(model tea.Model, ctx context.Context, opts cli.Options) programRunner {
+		if len(programOptions(opts)) != 0 {
+			t.Fatalf("programOptions with --no-altscreen = %d option(s), want none", len(programOptions(opts)))
+		}
+		selector := model.(fileSelectModel)
+		selector.selected = "picked.txt"
+		if view := selector.View(); view != "" {
+			t.Fatalf("inline View after selecting = %q, want empty", view)
+		}
+		return stubProgram{model: selector}
+	}, func() {
+		selected, err := SelectFile(context.Background(), cli.Options{NoAltScreen: true}, []FileCandidate{{Path: "picked.txt"}})
+		if err != nil || selected != "picked.txt" {
+			t.Fatalf("SelectFile = %q, %v; want picked.txt", selected, err)
+		}
+	})
+	if len(programOptions(cli.Options{})) != 1 {
+		t.Fatalf("programOptions without --no-altscreen should enable the alternate screen")
+	}
+}
+
 func TestSelectFileReturnsProgramError(t *testing.T) {
-	withSelectProgram(t, func(model tea.Model, ctx context.Context) programRunner {
+	withSelectProgram(t, func(model tea.Model, ctx context.Context, opts cli.Options) programRunner {
 		return stubProgram{err: errors.New("boom")}
 	}, func() {
-		_, err := SelectFile(context.Background(), []FileCandidate{{Path: "picked.txt"}})
+		_, err := SelectFile(context.Background(), cli.Options{}, []FileCandidate{{Path: "picked.txt"}})
 		if err == nil {
 			t.Fatalf("SelectFile error = nil, want error")
 		}
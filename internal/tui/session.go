@@ -2,8 +2,10 @@ package tui
 
 import (
 	"context"
+	"fmt"
 	"os"
 
+	"github.com/chojs23/ec/internal/charset"
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/engine"
 	"github.com/chojs23/ec/internal/markers"
@@ -38,6 +40,10 @@ func loadResolverDocumentState(ctx context.Context, opts cli.Options) (resolverD
 	if len(mergedBytes) == 0 && canonicalDocHasText(canonicalDoc) {
 		return state, nil
 	}
+	mergedBytes, err = charset.Decode(opts.Encoding, mergedBytes)
+	if err != nil {
+		return resolverDocumentState{}, fmt.Errorf("read merged: %w", err)
+	}
 
 	if err := runtimeState.ImportMerged(mergedBytes); err != nil {
 		return resolverDocumentState{}, err
@@ -10,15 +10,39 @@ import (
 	"sync"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/chojs23/ec/internal/cli"
+	"github.com/muesli/termenv"
 )
 
 const themeConfigFileName = "themes.json"
 
 type ThemeConfig struct {
-	Default string           `json:"default"`
-	Themes  map[string]Theme `json:"themes"`
+	Default       string           `json:"default"`
+	ScrollAnchor  string           `json:"scroll_anchor"`
+	BothSeparator string           `json:"both_separator"`
+	TabWidth      int              `json:"tab_width"`
+	Themes        map[string]Theme `json:"themes"`
 }
 
+// themeSettings are the top-level settings of themes.json besides the
+// colors.
+type themeSettings struct {
+	scrollAnchor scrollAnchor
+	// bothSeparator is the default of --both-separator.
+	bothSeparator string
+	// tabWidth is the default of --tab-width; 0 leaves it at 4.
+	tabWidth int
+}
+
+// scrollAnchor is where ensureVisible puts the current conflict in a pane.
+type scrollAnchor string
+
+const (
+	scrollAnchorCenter scrollAnchor = "center"
+	scrollAnchorTop    scrollAnchor = "top"
+	scrollAnchorThird  scrollAnchor = "third"
+)
+
 type Theme struct {
 	TitleFg                string `json:"title_fg"`
 	PaneBorder             string `json:"pane_border"`
@@ -51,11 +75,13 @@ type Theme struct {
 	SelectedHunkBg         string `json:"selected_hunk_bg"`
 	StatusResolvedFg       string `json:"status_resolved_fg"`
 	StatusUnresolvedFg     string `json:"status_unresolved_fg"`
+	StatusReviewedFg       string `json:"status_reviewed_fg"`
 	ResultResolvedFg       string `json:"result_resolved_marker_fg"`
 	ResultResolvedBorder   string `json:"result_resolved_border"`
 	ResultUnresolvedBorder string `json:"result_unresolved_border"`
 	ToastBg                string `json:"toast_bg"`
 	ToastFg                string `json:"toast_fg"`
+	ToastWarningBg         string `json:"toast_warning_bg"`
 	SelectorResolvedFg     string `json:"selector_resolved_fg"`
 	SelectorUnresolvedFg   string `json:"selector_unresolved_fg"`
 	DimForegroundLight     string `json:"dim_foreground_light"`
@@ -66,6 +92,10 @@ type Theme struct {
 var (
 	themeOnce sync.Once
 	themeErr  error
+
+	// configuredSettings holds the settings of themes.json, read along with
+	// the theme.
+	configuredSettings = themeSettings{scrollAnchor: scrollAnchorCenter}
 )
 
 func init() {
@@ -74,62 +104,106 @@ func init() {
 
 func ensureThemeLoaded() error {
 	themeOnce.Do(func() {
-		theme, err := loadThemeFromConfig()
+		theme, settings, err := loadThemeFromConfig()
 		if err != nil {
 			themeErr = err
 			return
 		}
 		applyTheme(theme)
+		configuredSettings = settings
 	})
 	return themeErr
 }
 
-func loadThemeFromConfig() (Theme, error) {
+// applyColorOption drops all color for --no-color. lipgloss already does so
+// on its own for NO_COLOR and output that is not a terminal.
+func applyColorOption(opts cli.Options) {
+	if opts.NoColor {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+}
+
+func loadThemeFromConfig() (Theme, themeSettings, error) {
 	fallback := defaultTheme()
+	defaults := themeSettings{scrollAnchor: scrollAnchorCenter}
 	configPath, err := themeConfigPath()
 	if err != nil {
-		return fallback, nil
+		return fallback, defaults, nil
 	}
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return fallback, nil
+			return fallback, defaults, nil
 		}
-		return Theme{}, fmt.Errorf("read theme config: %w", err)
+		return Theme{}, themeSettings{}, fmt.Errorf("read theme config: %w", err)
 	}
 
 	var cfg ThemeConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return Theme{}, fmt.Errorf("parse theme config: %w", err)
+		return Theme{}, themeSettings{}, fmt.Errorf("parse theme config: %w", err)
+	}
+
+	anchor, err := parseScrollAnchor(cfg.ScrollAnchor)
+	if err != nil {
+		return Theme{}, themeSettings{}, err
 	}
+	if strings.ContainsAny(cfg.BothSeparator, "\r\n") {
+		return Theme{}, themeSettings{}, fmt.Errorf("both_separator must be a single line, got %q", cfg.BothSeparator)
+	}
+	if cfg.TabWidth < 0 {
+		return Theme{}, themeSettings{}, fmt.Errorf("tab_width must be a positive number, got %d", cfg.TabWidth)
+	}
+	settings := themeSettings{scrollAnchor: anchor, bothSeparator: cfg.BothSeparator, tabWidth: cfg.TabWidth}
 
 	themeName := strings.TrimSpace(cfg.Default)
 	if themeName == "" {
+		// A file that only sets scroll_anchor, both_separator or tab_width
+		// keeps the built-in colors.
+		if len(cfg.Themes) == 0 {
+			return fallback, settings, nil
+		}
 		themeName = "default"
 	}
 
 	theme, ok := cfg.Themes[themeName]
 	if !ok {
-		return Theme{}, fmt.Errorf("theme %q not found in %s", themeName, configPath)
+		return Theme{}, themeSettings{}, fmt.Errorf("theme %q not found in %s", themeName, configPath)
+	}
+	return mergeTheme(fallback, theme), settings, nil
+}
+
+// parseScrollAnchor reads the scroll_anchor setting; empty means center.
+func parseScrollAnchor(value string) (scrollAnchor, error) {
+	switch anchor := scrollAnchor(strings.TrimSpace(value)); anchor {
+	case "":
+		return scrollAnchorCenter, nil
+	case scrollAnchorCenter, scrollAnchorTop, scrollAnchorThird:
+		return anchor, nil
+	default:
+		return "", fmt.Errorf("scroll_anchor must be center, top or third, got %q", value)
 	}
-	return mergeTheme(fallback, theme), nil
 }
 
 func themeConfigPath() (string, error) {
+	return configFilePath(themeConfigFileName)
+}
+
+// configFilePath returns the path of name inside ec's config directory.
+func configFilePath(name string) (string, error) {
 	xdgConfigDir := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME"))
 	if xdgConfigDir != "" {
 		if !filepath.IsAbs(xdgConfigDir) {
 			return "", fmt.Errorf("XDG_CONFIG_HOME must be an absolute path")
 		}
-		return filepath.Join(xdgConfigDir, "ec", themeConfigFileName), nil
+		return filepath.Join(xdgConfigDir, "ec", name), nil
 	}
 
 	configDir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(configDir, "ec", themeConfigFileName), nil
+	return filepath.Join(configDir, "ec", name), nil
 }
 
 func defaultTheme() Theme {
@@ -165,11 +239,13 @@ func defaultTheme() Theme {
 		SelectedHunkBg:         "236",
 		StatusResolvedFg:       "42",
 		StatusUnresolvedFg:     "196",
+		StatusReviewedFg:       "214",
 		ResultResolvedFg:       "42",
 		ResultResolvedBorder:   "42",
 		ResultUnresolvedBorder: "196",
 		ToastBg:                "22",
 		ToastFg:                "230",
+		ToastWarningBg:         "130",
 		SelectorResolvedFg:     "42",
 		SelectorUnresolvedFg:   "196",
 		DimForegroundLight:     "231",
@@ -211,11 +287,13 @@ func mergeTheme(base Theme, override Theme) Theme {
 		SelectedHunkBg:         pickColor(base.SelectedHunkBg, override.SelectedHunkBg),
 		StatusResolvedFg:       pickColor(base.StatusResolvedFg, override.StatusResolvedFg),
 		StatusUnresolvedFg:     pickColor(base.StatusUnresolvedFg, override.StatusUnresolvedFg),
+		StatusReviewedFg:       pickColor(base.StatusReviewedFg, override.StatusReviewedFg),
 		ResultResolvedFg:       pickColor(base.ResultResolvedFg, override.ResultResolvedFg),
 		ResultResolvedBorder:   pickColor(base.ResultResolvedBorder, override.ResultResolvedBorder),
 		ResultUnresolvedBorder: pickColor(base.ResultUnresolvedBorder, override.ResultUnresolvedBorder),
 		ToastBg:                pickColor(base.ToastBg, override.ToastBg),
 		ToastFg:                pickColor(base.ToastFg, override.ToastFg),
+		ToastWarningBg:         pickColor(base.ToastWarningBg, override.ToastWarningBg),
 		SelectorResolvedFg:     pickColor(base.SelectorResolvedFg, override.SelectorResolvedFg),
 		SelectorUnresolvedFg:   pickColor(base.SelectorUnresolvedFg, override.SelectorUnresolvedFg),
 		DimForegroundLight:     pickColor(base.DimForegroundLight, override.DimForegroundLight),
@@ -326,6 +404,10 @@ func applyTheme(theme Theme) {
 		Foreground(lipgloss.Color(theme.StatusUnresolvedFg)).
 		Bold(true)
 
+	statusReviewedStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.StatusReviewedFg)).
+		Bold(true)
+
 	resultResolvedMarkerStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color(theme.ResultResolvedFg)).
 		Bold(true)
@@ -345,6 +427,9 @@ func applyTheme(theme Theme) {
 		Foreground(lipgloss.Color(theme.ToastFg)).
 		Padding(0, 1)
 
+	toastWarningStyle = toastStyle.
+		Background(lipgloss.Color(theme.ToastWarningBg))
+
 	toastLineStyle = lipgloss.NewStyle().
 		Align(lipgloss.Right).
 		Padding(0, 2)
@@ -355,6 +440,9 @@ func applyTheme(theme Theme) {
 		Foreground(lipgloss.Color(theme.HeaderFg)).
 		Padding(0, 2)
 
+	panePositionStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.DimForegroundMuted))
+
 	resolvedLabelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(theme.SelectorResolvedFg))
 	unresolvedLabelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(theme.SelectorUnresolvedFg))
 
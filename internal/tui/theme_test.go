@@ -13,7 +13,7 @@ import (
 func TestLoadThemeFromConfigMissingFileUsesDefault(t *testing.T) {
 	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 
-	theme, err := loadThemeFromConfig()
+	theme, _, err := loadThemeFromConfig()
 	if err != nil {
 		t.Fatalf("loadThemeFromConfig() error = %v", err)
 	}
@@ -44,7 +44,7 @@ func TestLoadThemeFromConfigMergesOverrides(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	theme, err := loadThemeFromConfig()
+	theme, _, err := loadThemeFromConfig()
 	if err != nil {
 		t.Fatalf("loadThemeFromConfig() error = %v", err)
 	}
@@ -80,7 +80,7 @@ func TestLoadThemeFromConfigMissingThemeReturnsError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := loadThemeFromConfig()
+	_, _, err := loadThemeFromConfig()
 	if err == nil {
 		t.Fatal("loadThemeFromConfig() error = nil, want error")
 	}
@@ -102,12 +102,56 @@ func TestLoadThemeFromConfigInvalidJSONReturnsError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := loadThemeFromConfig()
+	_, _, err := loadThemeFromConfig()
 	if err == nil {
 		t.Fatal("loadThemeFromConfig() error = nil, want error")
 	}
 }
 
+func TestLoadThemeFromConfigScrollAnchor(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+
+	configPath := filepath.Join(configDir, "ec", themeConfigFileName)
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"scroll_anchor": "third", "both_separator": "// ---", "tab_width": 8}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	theme, settings, err := loadThemeFromConfig()
+	if err != nil {
+		t.Fatalf("loadThemeFromConfig() error = %v", err)
+	}
+	if settings.scrollAnchor != scrollAnchorThird {
+		t.Fatalf("scroll anchor = %q, want third", settings.scrollAnchor)
+	}
+	if settings.bothSeparator != "// ---" {
+		t.Fatalf("both separator = %q, want // ---", settings.bothSeparator)
+	}
+	if settings.tabWidth != 8 {
+		t.Fatalf("tab width = %d, want 8", settings.tabWidth)
+	}
+	if theme.HeaderBg != "62" {
+		t.Fatalf("header_bg = %q, want default 62", theme.HeaderBg)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"scroll_anchor": "bottom"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadThemeFromConfig(); err == nil || !strings.Contains(err.Error(), "scroll_anchor") {
+		t.Fatalf("loadThemeFromConfig() error = %v, want scroll_anchor error", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"tab_width": -2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadThemeFromConfig(); err == nil || !strings.Contains(err.Error(), "tab_width") {
+		t.Fatalf("loadThemeFromConfig() error = %v, want tab_width error", err)
+	}
+}
+
 func TestApplyThemeUpdatesDimColors(t *testing.T) {
 	resetThemeForTest()
 	t.Cleanup(resetThemeForTest)
@@ -8,12 +8,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/chojs23/ec/internal/charset"
 	"github.com/chojs23/ec/internal/cli"
 	"github.com/chojs23/ec/internal/engine"
 	"github.com/chojs23/ec/internal/gitutil"
@@ -21,7 +23,6 @@ import (
 )
 
 const (
-	maxUndoSize           = 100
 	keySeqTimeoutDuration = 350 * time.Millisecond
 	keyQuit               = "q"
 	keyCtrlC              = "ctrl+c"
@@ -49,77 +50,136 @@ const (
 	keyApplyTheirsAll     = "T"
 	keyAccept             = "a"
 	keyAcceptSpace        = " "
+	keyAcceptAdvance      = "enter"
 	keyDiscard            = "d"
 	keyApplyBoth          = "b"
+	keyApplyBothDedup     = "B"
 	keyApplyNone          = "x"
 	keyUndo               = "u"
 	keyRedo               = "ctrl+r"
 	keyWrite              = "w"
 	keyEdit               = "e"
+	keyEditConflict       = "i"
+	keyToggleWrap         = "w"
+	keyToggleAlign        = "a"
+	keyIgnoreWhitespace   = "i"
+	keyLineNumbers        = "n"
+	keyToggleLayout       = "u"
+	keySwapSides          = "s"
+	keyOpenFolds          = "o"
+	keyContextMore        = "+"
+	keyContextLess        = "-"
+	keyNextFile           = "N"
+	keyCycle              = "c"
+	keyViewBase           = "v"
+	keyHelp               = "?"
+	keyWriteContinue      = "W"
+	keyToggleWhitespace   = "ctrl+w"
+	keyToggleHistory      = "Y"
+	keyNextChange         = "]"
+	keyPrevChange         = "["
+	keyRevert             = "R"
+	keyRestoreBackup      = "U"
+	keyReviewWrite        = "D"
+	keyReviewConfirm      = "y"
+	keyReviewCancel       = "esc"
+	keyReviewDecline      = "n"
+	keyReviewClose        = "q"
+	keyOverwriteConfirm   = "y"
+	keyOverwriteCancel    = "n"
+	keyFilter             = "f"
+	keyToggleReviewed     = "m"
+	keyNextUnreviewed     = "M"
+	keyViewRaw            = "r"
+	keyFilterApply        = "enter"
+	keyFilterClear        = "esc"
+	defaultFoldContext    = 5
 )
 
+// keyHelpEntry describes one footer hint. Entries naming actions show the
+// keys currently bound to them; key is used for the fixed key sequences.
 type keyHelpEntry struct {
 	key         string
+	actions     []string
 	description string
 }
 
 type keyAction func(*model) (tea.Cmd, error)
 
 var resolverKeyHelp = []keyHelpEntry{
-	{key: "n", description: "next"},
-	{key: "p", description: "prev"},
+	{actions: []string{"next"}, description: "next"},
+	{actions: []string{"prev"}, description: "prev"},
 	{key: "gg/G", description: "top/bottom"},
 	{key: "zz", description: "recenter hunk"},
-	{key: "j/k/up/down", description: "scroll"},
-	{key: "ctrl+u/ctrl+d", description: "half-page"},
-	{key: "H/L/left/right", description: "scroll"},
-	{key: "h", description: "ours"},
-	{key: "l", description: "theirs"},
-	{key: "a/<space>", description: "accept"},
-	{key: "o/O", description: "ours/ours all"},
-	{key: "t/T", description: "theirs/theirs all"},
-	{key: "b", description: "both"},
-	{key: "x", description: "none"},
-	{key: "d", description: "discard"},
-	{key: "u", description: "undo"},
-	{key: "ctrl+r", description: "redo"},
-	{key: "e", description: "editor"},
-	{key: "w/ctrl+s", description: "write"},
-	{key: "q", description: "back to selector"},
-}
-
-var resolverKeyActions = map[string]keyAction{
-	keyQuit:           (*model).handleQuit,
-	keyCtrlC:          (*model).handleCtrlC,
-	keyNextConflict:   (*model).handleNextConflict,
-	keyPrevConflict:   (*model).handlePrevConflict,
-	keySelectOurs:     (*model).handleSelectOurs,
-	keySelectTheirs:   (*model).handleSelectTheirs,
-	keyScrollLeft:     (*model).handleScrollLeft,
-	keyScrollRight:    (*model).handleScrollRight,
-	keyScrollDown:     (*model).handleScrollDown,
-	keyScrollUp:       (*model).handleScrollUp,
-	keyArrowLeft:      (*model).handleScrollLeft,
-	keyCtrlU:          (*model).handleHalfPageUp,
-	keyCtrlD:          (*model).handleHalfPageDown,
-	keyArrowRight:     (*model).handleScrollRight,
-	keyArrowDown:      (*model).handleScrollDown,
-	keyArrowUp:        (*model).handleScrollUp,
-	keyApplyOurs:      (*model).handleApplyOurs,
-	keyApplyTheirs:    (*model).handleApplyTheirs,
-	keyApplyOursAll:   (*model).handleApplyOursAll,
-	keyApplyTheirsAll: (*model).handleApplyTheirsAll,
-	keyAccept:         (*model).handleAccept,
-	keyAcceptSpace:    (*model).handleAccept,
-	keyDiscard:        (*model).handleDiscard,
-	keyApplyBoth:      (*model).handleApplyBoth,
-	keyApplyNone:      (*model).handleApplyNone,
-	keyUndo:           (*model).handleUndo,
-	keyRedo:           (*model).handleRedo,
-	keyWrite:          (*model).handleWrite,
-	keyCtrlS:          (*model).handleWrite,
-	keyEdit:           (*model).handleEdit,
-}
+	{key: "zw", description: "wrap"},
+	{key: "za", description: "align"},
+	{key: "zi", description: "ignore whitespace"},
+	{key: "zn", description: "line numbers"},
+	{key: "zu", description: "unified layout"},
+	{key: "zs", description: "swap sides"},
+	{key: "zo", description: "open folds in view"},
+	{actions: []string{"toggle_whitespace"}, description: "whitespace"},
+	{actions: []string{"scroll_down", "scroll_up"}, description: "scroll"},
+	{actions: []string{"half_page_up", "half_page_down"}, description: "half-page"},
+	{actions: []string{"scroll_left", "scroll_right"}, description: "scroll"},
+	{actions: []string{"context_more", "context_less"}, description: "context"},
+	{actions: []string{"next_change", "prev_change"}, description: "next/prev change"},
+	{actions: []string{"filter"}, description: "filter conflicts"},
+	{actions: []string{"toggle_reviewed"}, description: "mark reviewed"},
+	{actions: []string{"next_unreviewed"}, description: "next unreviewed"},
+	{actions: []string{"ours"}, description: "ours"},
+	{actions: []string{"theirs"}, description: "theirs"},
+	{actions: []string{"accept"}, description: "accept"},
+	{actions: []string{"accept_next"}, description: "accept+next"},
+	{actions: []string{"apply_ours", "apply_ours_all"}, description: "ours/ours all"},
+	{actions: []string{"apply_theirs", "apply_theirs_all"}, description: "theirs/theirs all"},
+	{actions: []string{"apply_both"}, description: "both"},
+	{actions: []string{"apply_both_dedup"}, description: "both, shared lines once"},
+	{actions: []string{"apply_none"}, description: "none"},
+	{actions: []string{"cycle"}, description: "cycle"},
+	{actions: []string{"discard"}, description: "discard"},
+	{actions: []string{"undo"}, description: "undo"},
+	{actions: []string{"redo"}, description: "redo"},
+	{actions: []string{"revert"}, description: "revert file"},
+	{actions: []string{"restore_backup"}, description: "restore backup"},
+	{actions: []string{"toggle_history"}, description: "history"},
+	{actions: []string{"edit"}, description: "editor"},
+	{actions: []string{"edit_conflict"}, description: "edit hunk"},
+	{actions: []string{"view_base"}, description: "view base"},
+	{actions: []string{"view_raw"}, description: "raw conflict"},
+	{actions: []string{"write"}, description: "write"},
+	{actions: []string{"write_continue"}, description: "write+stage+continue"},
+	{actions: []string{"review_write"}, description: "review write"},
+	{actions: []string{"next_file"}, description: "next file"},
+	{actions: []string{"quit"}, description: "back to selector"},
+	{actions: []string{"help"}, description: "hide help"},
+}
+
+// The minibar replaces the full key list with the keys that matter for the
+// current conflict; ? toggles between the two.
+var (
+	minibarUnresolvedHelp = []keyHelpEntry{
+		{actions: []string{"ours", "theirs"}, description: "pick side"},
+		{actions: []string{"accept", "accept_next"}, description: "accept"},
+		{actions: []string{"apply_ours", "apply_theirs", "apply_both", "apply_none"}, description: "ours/theirs/both/none"},
+		{actions: []string{"edit"}, description: "editor"},
+		{actions: []string{"next", "prev"}, description: "next/prev"},
+		{actions: []string{"help"}, description: "help"},
+	}
+	minibarResolvedHelp = []keyHelpEntry{
+		{actions: []string{"next", "prev"}, description: "next/prev"},
+		{actions: []string{"cycle"}, description: "cycle"},
+		{actions: []string{"discard"}, description: "discard"},
+		{actions: []string{"undo"}, description: "undo"},
+		{actions: []string{"help"}, description: "help"},
+	}
+	minibarDoneHelp = []keyHelpEntry{
+		{actions: []string{"write"}, description: "write"},
+		{actions: []string{"undo"}, description: "undo"},
+		{actions: []string{"quit"}, description: "back to selector"},
+		{actions: []string{"help"}, description: "help"},
+	}
+)
 
 var (
 	titleStyle                lipgloss.Style
@@ -144,12 +204,15 @@ var (
 	selectedHunkBackground    lipgloss.Color
 	statusResolvedStyle       lipgloss.Style
 	statusUnresolvedStyle     lipgloss.Style
+	statusReviewedStyle       lipgloss.Style
 	resultResolvedMarkerStyle lipgloss.Style
 	resultResolvedPaneStyle   lipgloss.Style
 	resultUnresolvedPaneStyle lipgloss.Style
 	toastStyle                lipgloss.Style
+	toastWarningStyle         lipgloss.Style
 	toastLineStyle            lipgloss.Style
 	resultTitleStyle          lipgloss.Style
+	panePositionStyle         lipgloss.Style
 
 	dimForegroundLight lipgloss.Color
 	dimForegroundDark  lipgloss.Color
@@ -158,6 +221,29 @@ var (
 
 var ErrBackToSelector = fmt.Errorf("back to selector")
 
+// ErrNextFile is returned when the resolver should move on to the next
+// unresolved file of a multi-file session.
+var ErrNextFile = fmt.Errorf("next file")
+
+// errMergedChanged is returned by checkMergedStamp, and so by writeResolved,
+// when $MERGED changed on disk since the resolver read or last wrote it.
+var errMergedChanged = fmt.Errorf("file changed on disk since open")
+
+// fileStamp is the modification time and size of a file, enough to notice
+// another program rewriting it.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
 type model struct {
 	ctx              context.Context
 	opts             cli.Options
@@ -168,57 +254,229 @@ type model struct {
 	theirsLines      []string
 	conflictRanges   []conflictRange
 	useFullDiff      bool
+	wrap             bool
+	showWhitespace   bool
+	alignPanes       bool
+	lineNumberMode   lineNumberMode
+	ignoreWhitespace bool
+	showHistory      bool
+	scrollAnchor     scrollAnchor
+	result           Result
+	showHelp         bool
+	lineEndings      markers.LineEndings
+	contextLines     int
+	nextFiles        []string
+	repoRoot         string
+	repoPath         string
 	currentConflict  int
 	selectedSide     selectionSide
 	mergedLabels     []conflictLabels
 	mergedLabelKnown []bool
 	resultBoundaries [][]byte
 	manualResolved   map[int][]byte
-	resolverUndo     []resolverSnapshot
-	resolverRedo     []resolverSnapshot
-	pendingScroll    bool
-	keySeq           string
-	keySeqTimeout    int
-	viewportOurs     viewport.Model
-	viewportResult   viewport.Model
-	viewportTheirs   viewport.Model
-	ready            bool
-	width            int
-	height           int
-	quitting         bool
-	toastMessage     string
-	toastSeq         int
-	err              error
+	// reviewed marks conflicts looked at but deferred; it only shows while
+	// the conflict is unresolved.
+	reviewed        map[int]bool
+	pendingScroll   bool
+	conflictOffsets map[int]int
+	// oursAnchor, resultAnchor and theirsAnchor record where the current
+	// conflict starts in each pane as of the last updateViewports.
+	oursAnchor   paneAnchor
+	resultAnchor paneAnchor
+	theirsAnchor paneAnchor
+	// oursPaneLines and theirsPaneLines are the lines last rendered into
+	// the side panes, for ] and [ to find changes in.
+	oursPaneLines   []lineInfo
+	theirsPaneLines []lineInfo
+	resultPaneLines []lineInfo
+	// oursOpenFolds, resultOpenFolds and theirsOpenFolds hold the
+	// foldStart of each fold zo opened in that pane, until the amount of
+	// context changes.
+	oursOpenFolds   map[int]bool
+	resultOpenFolds map[int]bool
+	theirsOpenFolds map[int]bool
+	keySeq          string
+	keySeqTimeout   int
+	viewportOurs    viewport.Model
+	viewportResult  viewport.Model
+	viewportTheirs  viewport.Model
+	ready           bool
+	width           int
+	height          int
+	// tooSmall is set while the terminal cannot fit the three panes.
+	tooSmall     bool
+	quitting     bool
+	toastMessage string
+	toastWarning bool // draw toastMessage in toastWarningStyle
+	toastSeq     int
+	err          error
+	// whitespaceResolved lists the conflicts --ignore-whitespace or zi
+	// resolved; turning it off returns them to unresolved.
+	whitespaceResolved []int
+	// reviewing is set while the write review shows the diff to disk in
+	// reviewViewport; y writes and esc goes back to the panes.
+	reviewing      bool
+	reviewViewport viewport.Model
+	// showingRaw is set while rawViewport shows the current conflict with
+	// its markers; any key closes it.
+	showingRaw  bool
+	rawViewport viewport.Model
+	// pristine is the state as the resolver first showed it, which R
+	// returns to.
+	pristine *engine.State
+	// filterText limits n and p to conflicts whose ours or theirs contains
+	// it; filtering is set while f reads it into filterInput.
+	filterText  string
+	filtering   bool
+	filterInput string
+	// layout picks the three panes or the single viewportUnified;
+	// unifiedLines are the lines last rendered into it.
+	layout          paneLayout
+	viewportUnified viewport.Model
+	unifiedAnchor   paneAnchor
+	unifiedLines    []lineInfo
+	// swapped shows theirs on the left and ours on the right, as a rebase
+	// reads; only the view changes, never the resolutions.
+	swapped bool
+	// mergedStamp is $MERGED as the resolver last read or wrote it; the
+	// zero value, before anything was recorded, skips the check.
+	mergedStamp fileStamp
+	// overwrite is set while the resolver asks whether to write over a
+	// $MERGED that changed on disk.
+	overwrite *overwritePrompt
+}
+
+// overwritePrompt holds the action that found $MERGED changed on disk: y
+// runs write again over the file, n runs skip, or just cancels when skip is
+// nil.
+type overwritePrompt struct {
+	write keyAction
+	skip  keyAction
+}
+
+// paneLayout is how the resolver lays out the conflicts.
+type paneLayout int
+
+const (
+	// layoutPanes shows ours, the result and theirs side by side.
+	layoutPanes paneLayout = iota
+	// layoutUnified shows one column with each conflict as a unified diff
+	// of both sides against base, for narrow terminals.
+	layoutUnified
+)
+
+func (layout paneLayout) String() string {
+	if layout == layoutUnified {
+		return "unified"
+	}
+	return "panes"
 }
 
 type selectionSide int
 
+// paneAnchor is the visual row the current conflict starts on in a pane and
+// the pane's total number of rows.
+type paneAnchor struct {
+	start int
+	total int
+}
+
 type conflictLabels struct {
 	OursLabel   string
 	BaseLabel   string
 	TheirsLabel string
 }
 
-type resolverSnapshot struct {
-	state *engine.State
-}
-
 const (
 	selectedOurs selectionSide = iota
 	selectedTheirs
 )
 
-// Run starts the TUI for interactive conflict resolution.
-func Run(ctx context.Context, opts cli.Options) error {
+// screenPane identifies one of the three panes by screen position. The
+// left pane shows ours and the right one theirs unless the sides are
+// swapped (see sideOn).
+type screenPane int
+
+const (
+	screenLeft screenPane = iota
+	screenResult
+	screenRight
+)
+
+// RepoFile places the file being resolved inside a repository in no-args
+// mode. The zero value means ec was given explicit paths.
+type RepoFile struct {
+	RepoRoot string
+	Path     string // relative to RepoRoot
+
+	// NextFiles lists the still-unresolved files that follow this one.
+	NextFiles []string
+}
+
+// Result summarizes how the conflicts of a file stood when it was last
+// written. Written is false when the resolver exited without writing.
+type Result struct {
+	Path      string
+	Written   bool
+	Conflicts int
+	Ours      int
+	Theirs    int
+	Both      int // includes both-dedup
+	None      int
+	Manual    int
+	// Unresolved counts conflicts written back with their markers.
+	Unresolved int
+	// Continued is the git operation W staged the file for and continued,
+	// e.g. "merge", or "" when it did not.
+	Continued string
+	// Commit is the commit the continue made for this stop, looked up only
+	// for --record-notes. A rebase may have picked more commits on top, so
+	// it can differ from HEAD.
+	Commit string
+}
+
+// Summary returns a one-line description of r for printing after exit.
+func (r Result) Summary() string {
+	summary := fmt.Sprintf("%s: %d conflict(s) - ours %d, theirs %d, both %d, none %d, manual %d",
+		r.Path, r.Conflicts, r.Ours, r.Theirs, r.Both, r.None, r.Manual)
+	if r.Unresolved > 0 {
+		summary += fmt.Sprintf(", unresolved %d", r.Unresolved)
+	}
+	return summary
+}
+
+// Run starts the TUI for interactive conflict resolution. The Result
+// describes the last write, if any.
+func Run(ctx context.Context, opts cli.Options) (Result, error) {
+	return RunBatch(ctx, opts, RepoFile{})
+}
+
+// RunBatch is Run for one file of a multi-file session. When file.NextFiles
+// is non-empty the resolver can end with ErrNextFile.
+func RunBatch(ctx context.Context, opts cli.Options, file RepoFile) (Result, error) {
 	if err := ensureThemeLoaded(); err != nil {
-		return err
+		return Result{}, err
+	}
+	applyColorOption(opts)
+	if opts.BothSeparator == "" {
+		opts.BothSeparator = configuredSettings.bothSeparator
+	}
+	if opts.TabWidth == 0 {
+		opts.TabWidth = configuredSettings.tabWidth
+	}
+	if err := ensureKeyBindingsLoaded(); err != nil {
+		return Result{}, err
 	}
 	resolverState, err := loadResolverDocumentState(ctx, opts)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 
 	doc := resolverState.doc
+	mergedStamp, err := statFile(opts.MergedPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("stat merged: %w", err)
+	}
 
 	// Validate base completeness unless explicitly allowed to proceed without it.
 	if !opts.AllowMissingBase {
@@ -226,13 +484,20 @@ func Run(ctx context.Context, opts cli.Options) error {
 			if shouldAllowMissingBaseFallback(ctx, opts, err) {
 				opts.AllowMissingBase = true
 			} else {
-				return fmt.Errorf("base validation failed: %w", err)
+				return Result{}, fmt.Errorf("base validation failed: %w", err)
 			}
 		}
 	}
 
-	// Initialize state
-	baseLines, oursLines, theirsLines, ranges, useFullDiff := prepareFullDiff(doc, opts)
+	// Initialize state. Diffing the whole files of a heavily conflicted
+	// merge is slow, so past --full-diff-limit each conflict shows alone.
+	var baseLines, oursLines, theirsLines []string
+	var ranges []conflictRange
+	var useFullDiff bool
+	overLimit := exceedsFullDiffLimit(doc, opts)
+	if !overLimit {
+		baseLines, oursLines, theirsLines, ranges, useFullDiff = prepareFullDiff(doc, opts)
+	}
 
 	m := model{
 		ctx:              ctx,
@@ -250,31 +515,69 @@ func Run(ctx context.Context, opts cli.Options) error {
 		mergedLabelKnown: resolverState.mergedLabelKnown,
 		resultBoundaries: resolverState.boundaryText,
 		manualResolved:   resolverState.manualResolved,
+		nextFiles:        file.NextFiles,
+		repoRoot:         file.RepoRoot,
+		repoPath:         file.Path,
 		pendingScroll:    true,
+		lineEndings:      markers.DocumentLineEndingStats(doc),
+		scrollAnchor:     configuredSettings.scrollAnchor,
+		mergedStamp:      mergedStamp,
+	}
+
+	if err := m.collapseIdenticalAdds(); err != nil {
+		return Result{}, err
+	}
+	if opts.IgnoreWhitespace {
+		if _, err := m.setIgnoreWhitespace(true); err != nil {
+			return Result{}, err
+		}
+	}
+	if opts.Unified {
+		m.layout = layoutUnified
+	}
+	m.swapped = opts.Swap
+	m.pristine = m.state.Clone()
+	if overLimit {
+		m.showToast(fmt.Sprintf("%d conflicts exceed --full-diff-limit %d: full-file diff skipped; e opens $EDITOR", len(doc.Conflicts), opts.FullDiffLimit), 5)
 	}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	p := tea.NewProgram(m, programOptions(opts, tea.WithMouseCellMotion())...)
 	finalModel, err := p.Run()
 	if err != nil {
-		return fmt.Errorf("TUI error: %w", err)
+		return Result{}, fmt.Errorf("TUI error: %w", err)
 	}
 
 	// Check for errors from the model
 	if m, ok := finalModel.(model); ok {
-		return m.err
+		return m.result, m.err
 	}
 
-	return nil
+	return Result{}, nil
 }
 
 func (m model) Init() tea.Cmd {
-	return nil
+	if m.toastMessage == "" {
+		return nil
+	}
+	return toastExpiry(m.toastSeq, 3)
 }
 
 type editorFinishedMsg struct {
 	err error
 }
 
+// conflictEditFinishedMsg reports the editor opened by i closing; path holds
+// the edited text of conflict index.
+type conflictEditFinishedMsg struct {
+	index int
+	path  string
+	err   error
+}
+
+type baseViewerFinishedMsg struct {
+	err error
+}
+
 type toastExpiredMsg struct {
 	id int
 }
@@ -283,21 +586,133 @@ type keySeqExpiredMsg struct {
 	id int
 }
 
+// programOptions returns extra preceded by the alternate screen, which
+// --no-altscreen leaves out so the TUI draws inline, e.g. in a tmux popup.
+func programOptions(opts cli.Options, extra ...tea.ProgramOption) []tea.ProgramOption {
+	if opts.NoAltScreen {
+		return extra
+	}
+	return append([]tea.ProgramOption{tea.WithAltScreen()}, extra...)
+}
+
 func (m *model) showToast(message string, duration time.Duration) tea.Cmd {
 	m.toastMessage = message
+	m.toastWarning = false
 	m.toastSeq++
-	seq := m.toastSeq
+	return toastExpiry(m.toastSeq, duration)
+}
+
+// showWarningToast shows message like showToast, drawn in the warning style.
+func (m *model) showWarningToast(message string, duration time.Duration) tea.Cmd {
+	cmd := m.showToast(message, duration)
+	m.toastWarning = true
+	return cmd
+}
+
+func toastExpiry(seq int, duration time.Duration) tea.Cmd {
 	return tea.Tick(duration*time.Second, func(time.Time) tea.Msg {
 		return toastExpiredMsg{id: seq}
 	})
 }
 
-func (m *model) openEditor() tea.Cmd {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "vi"
+// collapseIdenticalAdds resolves add/add conflicts whose sides are identical
+// to a single copy as one undoable step. The toast it shows is expired by Init.
+func (m *model) collapseIdenticalAdds() error {
+	indices := m.state.IdenticalAddConflicts()
+	if len(indices) == 0 {
+		return nil
+	}
+	err := m.applyResolverMutation("collapse identical adds", func() error {
+		for _, idx := range indices {
+			if err := m.state.ApplyResolution(idx, markers.ResolutionOurs); err != nil {
+				return err
+			}
+		}
+		m.refreshResolverCaches()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("collapse identical additions: %w", err)
+	}
+	m.showToast(fmt.Sprintf("Collapsed %d identical add/add conflict(s) (u to undo)", len(indices)), 3)
+	return nil
+}
+
+// setIgnoreWhitespace turns ignoring whitespace on or off. Turning it on
+// resolves the unresolved whitespace-only conflicts to --whitespace-side as
+// one undoable step; turning it off returns the ones that still hold that
+// resolution to unresolved. The chosen side's bytes are written unchanged.
+func (m *model) setIgnoreWhitespace(on bool) (tea.Cmd, error) {
+	m.ignoreWhitespace = on
+	side := m.whitespaceSide()
+	var indices []int
+	if on {
+		indices = m.state.WhitespaceOnlyConflicts()
+	} else {
+		for _, idx := range m.whitespaceResolved {
+			if _, manual := m.manualResolved[idx]; manual || idx >= len(m.doc.Conflicts) {
+				continue
+			}
+			if seg, ok := m.doc.Segments[m.doc.Conflicts[idx].SegmentIndex].(markers.ConflictSegment); ok && seg.Resolution == side {
+				indices = append(indices, idx)
+			}
+		}
+	}
+	if len(indices) == 0 {
+		if on {
+			return m.showToast("Ignoring whitespace: no whitespace-only conflicts left", 2), nil
+		}
+		m.whitespaceResolved = nil
+		return m.showToast("No longer ignoring whitespace", 2), nil
+	}
+
+	label := "unresolve whitespace-only conflicts"
+	if on {
+		label = "resolve whitespace-only conflicts"
+	}
+	err := m.applyResolverMutation(label, func() error {
+		for _, idx := range indices {
+			var err error
+			if on {
+				err = m.state.ApplyResolution(idx, side)
+			} else {
+				err = m.state.ResetResolution(idx)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		m.refreshResolverCaches()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
 	}
+	if !on {
+		m.whitespaceResolved = nil
+		return m.showToast(fmt.Sprintf("Returned %d whitespace-only conflict(s) to unresolved", len(indices)), 3), nil
+	}
+	m.whitespaceResolved = indices
+	return m.showToast(fmt.Sprintf("Resolved %d whitespace-only conflict(s) to %s (u to undo)", len(indices), side), 3), nil
+}
+
+// reviewKeyHelp lists the keys that scroll the write review.
+var reviewKeyHelp = []keyHelpEntry{
+	{actions: []string{"scroll_down", "scroll_up"}, description: "scroll"},
+	{actions: []string{"half_page_down", "half_page_up"}, description: "half-page"},
+	{key: "g/G", description: "top/bottom"},
+}
 
+// whitespaceSide is the resolution whitespace-only conflicts take.
+func (m *model) whitespaceSide() markers.Resolution {
+	if m.opts.WhitespaceSide == "theirs" {
+		return markers.ResolutionTheirs
+	}
+	return markers.ResolutionOurs
+}
+
+func (m *model) openEditor() tea.Cmd {
+	editor := os.Getenv("EDITOR")
 	if editor == "true" {
 		return func() tea.Msg {
 			return editorFinishedMsg{err: nil}
@@ -311,14 +726,16 @@ func (m *model) openEditor() tea.Cmd {
 		}
 	}
 
-	resolved := m.state.RenderMerged()
+	resolved, err := charset.Encode(m.opts.Encoding, m.state.RenderMerged())
+	if err != nil {
+		return func() tea.Msg {
+			return editorFinishedMsg{err: fmt.Errorf("encode merged before editor: %w", err)}
+		}
+	}
 
-	if m.opts.Backup {
-		bak := m.opts.MergedPath + ".ec.bak"
-		if err := os.WriteFile(bak, mergedBytes, 0o644); err != nil {
-			return func() tea.Msg {
-				return editorFinishedMsg{err: fmt.Errorf("write backup %s: %w", filepath.Base(bak), err)}
-			}
+	if err := engine.WriteBackup(m.opts.MergedPath, mergedBytes, m.opts); err != nil {
+		return func() tea.Msg {
+			return editorFinishedMsg{err: err}
 		}
 	}
 
@@ -330,7 +747,8 @@ func (m *model) openEditor() tea.Cmd {
 		}
 	}
 
-	cmd := exec.Command(editor, m.opts.MergedPath)
+	args := engine.EditorArgs(editor, m.opts.MergedPath)
+	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -343,11 +761,18 @@ func (m *model) openEditor() tea.Cmd {
 	})
 }
 
-func (m *model) reloadFromFile() error {
+// reloadFromFile re-reads $MERGED into the resolver as one undoable step
+// named label.
+func (m *model) reloadFromFile(label string) error {
 	mergedBytes, err := os.ReadFile(m.opts.MergedPath)
 	if err != nil {
 		return err
 	}
+	m.recordMergedStamp()
+	mergedBytes, err = charset.Decode(m.opts.Encoding, mergedBytes)
+	if err != nil {
+		return err
+	}
 	nextState := m.state.Clone()
 	if err := nextState.ImportMerged(mergedBytes); err != nil {
 		return err
@@ -365,8 +790,8 @@ func (m *model) reloadFromFile() error {
 		}
 	}
 
-	return m.applyResolverMutation(func() error {
-		m.state = nextState
+	return m.applyResolverMutation(label, func() error {
+		m.state.Restore(nextState)
 		m.refreshResolverCaches()
 
 		if m.currentConflict >= len(m.doc.Conflicts) {
@@ -379,6 +804,12 @@ func (m *model) reloadFromFile() error {
 	})
 }
 
+// exceedsFullDiffLimit reports whether doc has more conflicts than
+// opts.FullDiffLimit allows for the full-file diff.
+func exceedsFullDiffLimit(doc markers.Document, opts cli.Options) bool {
+	return opts.FullDiffLimit > 0 && len(doc.Conflicts) > opts.FullDiffLimit
+}
+
 func prepareFullDiff(doc markers.Document, opts cli.Options) ([]string, []string, []string, []conflictRange, bool) {
 	if opts.AllowMissingBase {
 		return nil, nil, nil, nil, false
@@ -387,15 +818,15 @@ func prepareFullDiff(doc markers.Document, opts cli.Options) ([]string, []string
 		return nil, nil, nil, nil, false
 	}
 
-	baseLines, err := loadLines(opts.BasePath)
+	baseLines, err := loadLines(opts.BasePath, opts.Encoding)
 	if err != nil {
 		return nil, nil, nil, nil, false
 	}
-	oursLines, err := loadLines(opts.LocalPath)
+	oursLines, err := loadLines(opts.LocalPath, opts.Encoding)
 	if err != nil {
 		return nil, nil, nil, nil, false
 	}
-	theirsLines, err := loadLines(opts.RemotePath)
+	theirsLines, err := loadLines(opts.RemotePath, opts.Encoding)
 	if err != nil {
 		return nil, nil, nil, nil, false
 	}
@@ -485,11 +916,18 @@ func isTrulyMissingBaseStage(ctx context.Context, mergedPath string) (bool, bool
 	return false, true
 }
 
-func loadLines(path string) ([]string, error) {
+// loadLines reads path as lines of UTF-8 text, decoding it from encoding
+// when one is set.
+func loadLines(path string, encoding string) ([]string, error) {
 	bytes, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	bytes, _ = markers.StripBOM(bytes)
+	bytes, err = charset.Decode(encoding, bytes)
+	if err != nil {
+		return nil, err
+	}
 	return splitLines(bytes), nil
 }
 
@@ -505,14 +943,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
-		if err := m.reloadFromFile(); err != nil {
-			m.err = fmt.Errorf("reload after editor failed: %w", err)
-			m.quitting = true
-			return m, tea.Quit
+		// A failed reload leaves the previous state untouched, so report it
+		// and let the next e rewrite the file from that state.
+		before := m.resolutionResult().Unresolved
+		if err := m.reloadFromFile("edit in editor"); err != nil {
+			return m, m.showToast(fmt.Sprintf("Reload after editor failed, kept previous state: %v", err), 5)
+		}
+		if after := m.resolutionResult().Unresolved; after != before {
+			return m, m.showToast(fmt.Sprintf("Unresolved conflicts: %d → %d after edit", before, after), 3)
 		}
 
 		return m, nil
 
+	case conflictEditFinishedMsg:
+		return m, m.finishConflictEdit(msg)
+
+	case baseViewerFinishedMsg:
+		if msg.err != nil {
+			return m, m.showToast(fmt.Sprintf("Base viewer failed: %v", msg.err), 3)
+		}
+		return m, nil
+
 	case toastExpiredMsg:
 		if msg.id == m.toastSeq {
 			m.toastMessage = ""
@@ -527,6 +978,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tea.KeyMsg:
 		key := msg.String()
+		if m.overwrite != nil {
+			return m.updateOverwrite(key)
+		}
+		if m.reviewing {
+			return m.updateReview(key)
+		}
+		if m.showingRaw {
+			m.showingRaw = false
+			return m, nil
+		}
+		if m.filtering {
+			return m.updateFilter(msg)
+		}
+		if key == keyFilterClear && m.filterText != "" {
+			m.filterText = ""
+			return m, m.showToast("Filter cleared", 2)
+		}
 		if key == keyGoTop {
 			if m.keySeq == keyGoTop {
 				m.keySeq = ""
@@ -543,7 +1011,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if key == keyRecenter {
 			if m.keySeq == keyRecenter {
 				m.keySeq = ""
-				m.scrollToSelectedHunkStart()
+				m.recenter()
 				return m, nil
 			}
 			m.keySeq = keyRecenter
@@ -553,63 +1021,64 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return keySeqExpiredMsg{id: id}
 			})
 		}
-		if key == keyGoBottom {
+		if key == keyToggleWrap && m.keySeq == keyRecenter {
 			m.keySeq = ""
-			m.scrollToBottom()
+			m.toggleWrap()
 			return m, nil
 		}
-		if m.keySeq != "" {
+		if key == keyToggleAlign && m.keySeq == keyRecenter {
 			m.keySeq = ""
+			return m, m.toggleAlign()
 		}
-		if action, ok := resolverKeyActions[key]; ok {
-			actionCmd, err := action(&m)
+		if key == keyLineNumbers && m.keySeq == keyRecenter {
+			m.keySeq = ""
+			return m, m.cycleLineNumbers()
+		}
+		if key == keyToggleLayout && m.keySeq == keyRecenter {
+			m.keySeq = ""
+			return m, m.toggleLayout()
+		}
+		if key == keySwapSides && m.keySeq == keyRecenter {
+			m.keySeq = ""
+			return m, m.toggleSwap()
+		}
+		if key == keyOpenFolds && m.keySeq == keyRecenter {
+			m.keySeq = ""
+			return m, m.openVisibleFolds()
+		}
+		if key == keyIgnoreWhitespace && m.keySeq == keyRecenter {
+			m.keySeq = ""
+			cmd, err := m.setIgnoreWhitespace(!m.ignoreWhitespace)
 			if err != nil {
 				m.err = err
 				m.quitting = true
 				return m, tea.Quit
 			}
-			if actionCmd != nil {
-				return m, actionCmd
-			}
+			return m, cmd
+		}
+		if key == keyGoBottom {
+			m.keySeq = ""
+			m.scrollToBottom()
+			return m, nil
+		}
+		if m.keySeq != "" {
+			m.keySeq = ""
+		}
+		if action, ok := resolverKeyActions[key]; ok {
+			return m.runAction(action)
 		}
 
-	case tea.WindowSizeMsg:
-		if !m.ready {
-			m.width = msg.Width
-			m.height = msg.Height
-
-			// Calculate pane dimensions
-			headerHeight := 2
-			footerHeight := 3
-			contentHeight := m.height - headerHeight - footerHeight - 6 // borders + padding
-
-			paneWidth := (m.width - 12) / 3 // 3 panes with borders
-
-			m.viewportOurs = viewport.New(paneWidth, contentHeight)
-			m.viewportResult = viewport.New(paneWidth, contentHeight)
-			m.viewportTheirs = viewport.New(paneWidth, contentHeight)
-
-			m.ready = true
-			m.updateViewports()
-		} else {
-			m.width = msg.Width
-			m.height = msg.Height
-
-			headerHeight := 2
-			footerHeight := 3
-			contentHeight := m.height - headerHeight - footerHeight - 6
-
-			paneWidth := (m.width - 12) / 3
-
-			m.viewportOurs.Width = paneWidth
-			m.viewportOurs.Height = contentHeight
-			m.viewportResult.Width = paneWidth
-			m.viewportResult.Height = contentHeight
-			m.viewportTheirs.Width = paneWidth
-			m.viewportTheirs.Height = contentHeight
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
 
-			m.updateViewports()
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.sizeViewports()
+		if m.reviewing || m.showingRaw {
+			m.resizeReview()
 		}
+		m.updateViewports()
 	}
 
 	if _, ok := msg.(tea.KeyMsg); ok {
@@ -623,28 +1092,146 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	cmds = append(cmds, cmd)
 	m.viewportTheirs, cmd = m.viewportTheirs.Update(msg)
 	cmds = append(cmds, cmd)
+	m.viewportUnified, cmd = m.viewportUnified.Update(msg)
+	cmds = append(cmds, cmd)
 
 	return m, tea.Batch(cmds...)
 }
 
+// handleMouse scrolls the pane under the wheel and lets a left click on the
+// left or right pane select the side shown there, the same as h/l.
+func (m model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.layout == layoutUnified {
+		if !tea.MouseEvent(msg).IsWheel() {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.viewportUnified, cmd = m.viewportUnified.Update(msg)
+		return m, cmd
+	}
+	pane, ok := m.paneAt(msg.X, msg.Y)
+	if !ok {
+		return m, nil
+	}
+
+	if msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft {
+		if row, ok := m.minimapRowAt(msg.X, msg.Y); ok {
+			if index, found := m.conflictNearMinimapRow(row); found {
+				m.switchConflict(index)
+			}
+			return m, nil
+		}
+		if pane != screenResult {
+			m.selectedSide = m.sideOn(pane)
+			m.updateViewports()
+		}
+		return m, nil
+	}
+	if !tea.MouseEvent(msg).IsWheel() {
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	switch {
+	case pane == screenResult:
+		m.viewportResult, cmd = m.viewportResult.Update(msg)
+	case m.sideOn(pane) == selectedOurs:
+		m.viewportOurs, cmd = m.viewportOurs.Update(msg)
+	default:
+		m.viewportTheirs, cmd = m.viewportTheirs.Update(msg)
+	}
+	return m, cmd
+}
+
+// sideOn returns the side shown in the left or right pane.
+func (m model) sideOn(pane screenPane) selectionSide {
+	if (pane == screenLeft) != m.swapped {
+		return selectedOurs
+	}
+	return selectedTheirs
+}
+
+// paneAt maps a terminal cell to the pane View draws there. The panes sit
+// side by side below the one-line header, each as wide as its viewport plus
+// its border and padding.
+func (m model) paneAt(x int, y int) (screenPane, bool) {
+	if !m.ready {
+		return 0, false
+	}
+	top := lipgloss.Height(headerStyle.Render(""))
+	height := m.viewportOurs.Height + 1 + oursPaneStyle.GetVerticalFrameSize()
+	if x < 0 || y < top || y >= top+height {
+		return 0, false
+	}
+
+	widths := []int{
+		m.viewportOurs.Width + oursPaneStyle.GetHorizontalFrameSize(),
+		m.viewportResult.Width + minimapWidth + resultUnresolvedPaneStyle.GetHorizontalFrameSize(),
+		m.viewportTheirs.Width + theirsPaneStyle.GetHorizontalFrameSize(),
+	}
+	left := 0
+	for i, width := range widths {
+		if x < left+width {
+			return screenPane(i), true
+		}
+		left += width
+	}
+	return 0, false
+}
+
 func (m model) View() string {
 	if !m.ready {
 		return "\n  Initializing..."
 	}
+	if m.tooSmall && !m.quitting {
+		minWidth := minTerminalWidth
+		if m.layout == layoutUnified {
+			minWidth = minUnifiedTerminalWidth
+		}
+		return fmt.Sprintf("\n  Terminal too small (%dx%d); resize to at least %dx%d or press q to quit.\n",
+			m.width, m.height, minWidth, minTerminalHeight)
+	}
 
 	if m.quitting {
+		// Drawn inline, the final frame stays on the terminal; leave
+		// nothing behind and let the caller report the outcome.
+		if m.opts.NoAltScreen {
+			return ""
+		}
 		if m.err != nil {
 			if errors.Is(m.err, ErrBackToSelector) {
 				return "\n  Returning to selector...\n"
 			}
+			if errors.Is(m.err, ErrNextFile) {
+				return "\n  Opening next file...\n"
+			}
 			return fmt.Sprintf("\n  Error: %v\n", m.err)
 		}
+		if m.result.Continued != "" {
+			return fmt.Sprintf("\n  Resolved! Staged and ran git %s --continue.\n", m.result.Continued)
+		}
 		return "\n  Resolved! File written.\n"
 	}
 
+	if m.reviewing {
+		return m.renderReview()
+	}
+	if m.showingRaw {
+		return m.renderRawBlock()
+	}
+
 	// Header
 	fileName := m.opts.MergedPath
 	conflictStatus := fmt.Sprintf("Conflict %d/%d", m.currentConflict+1, len(m.doc.Conflicts))
+	if m.filterText != "" {
+		conflictStatus += fmt.Sprintf(" (filtered: %d matches)", len(m.filteredConflicts(m.filterText)))
+	}
+	if count := m.reviewedCount(); count > 0 {
+		conflictStatus += fmt.Sprintf(" (%d reviewed)", count)
+	}
+	if m.lineEndings.Mixed() && m.opts.NormalizeEOL == "" {
+		conflictStatus += fmt.Sprintf(" - mixed line endings (%s)", m.lineEndings)
+	}
 	header := headerStyle.Render(fmt.Sprintf("%s - %s", fileName, conflictStatus))
 
 	// Get current conflict
@@ -658,6 +1245,8 @@ func (m model) View() string {
 		return "\n  Internal error: invalid conflict segment.\n"
 	}
 
+	header += panePositionStyle.Render("  " + conflictDiffStat(seg))
+
 	// Resolution status
 	statusText := "Unresolved"
 	statusStyle := statusUnresolvedStyle
@@ -667,9 +1256,51 @@ func (m model) View() string {
 	} else if seg.Resolution != markers.ResolutionUnset {
 		statusText = fmt.Sprintf("Resolved: %s", seg.Resolution)
 		statusStyle = statusResolvedStyle
+	} else if m.reviewed[m.currentConflict] {
+		statusText = "Unresolved (reviewed)"
+		statusStyle = statusReviewedStyle
+	}
+	if m.state.IsWhitespaceOnly(m.currentConflict) {
+		statusText += " (whitespace only)"
+	}
+
+	var panes string
+	if m.layout == layoutUnified {
+		panes = m.renderUnifiedPane(statusText, statusStyle)
+	} else {
+		panes = m.renderThreePanes(statusText, statusStyle)
+	}
+
+	// Footer
+	undoInfo := ""
+	if m.canUndo() {
+		undoInfo = fmt.Sprintf(" | Undo available: %d", m.undoDepth())
+	}
+	redoInfo := ""
+	if m.canRedo() {
+		redoInfo = fmt.Sprintf(" | Redo available: %d", m.redoDepth())
+	}
+
+	keyText, style := m.footerKeyText()
+	if m.filtering {
+		keyText = fmt.Sprintf("Filter: %s_ (enter: apply, esc: clear)", m.filterInput)
+	}
+	if m.overwrite != nil {
+		keyText = fmt.Sprintf("%s changed on disk since open - overwrite? [y/n]", filepath.Base(m.opts.MergedPath))
+		style = footerStyle.Foreground(toastWarningStyle.GetForeground()).Bold(true)
+		undoInfo, redoInfo = "", ""
 	}
+	footerText := style.Width(m.width).Render(
+		fmt.Sprintf("%s%s%s", keyText, undoInfo, redoInfo),
+	)
+	footer := lipgloss.JoinVertical(lipgloss.Left, footerText, m.renderToastLine())
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, panes, footer)
+}
 
-	// Render panes
+// renderThreePanes lays ours, the result and theirs side by side, or
+// theirs first when the sides are swapped.
+func (m model) renderThreePanes(statusText string, statusStyle lipgloss.Style) string {
 	oursStyle := oursPaneStyle
 	if m.selectedSide == selectedOurs {
 		oursStyle = selectedSidePaneStyle
@@ -681,7 +1312,7 @@ func (m model) View() string {
 		}
 	}
 	oursPane := oursStyle.Render(
-		renderPaneTitle(oursTitle, m.viewportOurs.Width, titleStyle) + "\n" +
+		renderPaneTitleWithPosition(oursTitle, m.viewportOurs, titleStyle) + "\n" +
 			m.viewportOurs.View(),
 	)
 
@@ -689,10 +1320,11 @@ func (m model) View() string {
 	if allResolved(m.doc, m.manualResolved) {
 		resultStyle = resultResolvedPaneStyle
 	}
-	resultTitle := renderResultPaneTitle(statusText, m.viewportResult.Width, resultTitleStyle, statusStyle)
+	resultPosition := panePosition(m.viewportResult)
+	resultTitle := renderResultPaneTitle(statusText, m.viewportResult.Width+minimapWidth-lipgloss.Width(resultPosition), resultTitleStyle, statusStyle) + resultPosition
 	resultPane := resultStyle.Render(
 		resultTitle + "\n" +
-			m.viewportResult.View(),
+			lipgloss.JoinHorizontal(lipgloss.Top, m.viewportResult.View(), m.renderMinimap()),
 	)
 
 	theirsStyle := theirsPaneStyle
@@ -706,44 +1338,204 @@ func (m model) View() string {
 		}
 	}
 	theirsPane := theirsStyle.Render(
-		renderPaneTitle(theirsTitle, m.viewportTheirs.Width, titleStyle) + "\n" +
+		renderPaneTitleWithPosition(theirsTitle, m.viewportTheirs, titleStyle) + "\n" +
 			m.viewportTheirs.View(),
 	)
 
-	panes := lipgloss.JoinHorizontal(lipgloss.Top, oursPane, resultPane, theirsPane)
-
-	// Footer
-	undoInfo := ""
-	if m.undoDepth() > 0 {
-		undoInfo = fmt.Sprintf(" | Undo available: %d", m.undoDepth())
+	leftPane, rightPane := oursPane, theirsPane
+	if m.swapped {
+		leftPane, rightPane = theirsPane, oursPane
 	}
-	redoInfo := ""
-	if m.redoDepth() > 0 {
-		redoInfo = fmt.Sprintf(" | Redo available: %d", m.redoDepth())
+	if m.showHistory {
+		rightPane = m.renderHistoryPanel(m.viewportTheirs)
 	}
 
-	footerText := footerStyle.Width(m.width).Render(
-		fmt.Sprintf("%s%s%s", resolverFooterKeyMapText(), undoInfo, redoInfo),
-	)
-	footer := lipgloss.JoinVertical(lipgloss.Left, footerText, m.renderToastLine())
-
-	return lipgloss.JoinVertical(lipgloss.Left, header, panes, footer)
+	return lipgloss.JoinHorizontal(lipgloss.Top, leftPane, resultPane, rightPane)
 }
 
-func (m model) renderToastLine() string {
-	content := ""
-	if m.toastMessage != "" {
-		content = toastStyle.Render(m.toastMessage)
+// renderUnifiedPane draws the single column of the unified layout, titled
+// and bordered like the result pane.
+func (m model) renderUnifiedPane(statusText string, statusStyle lipgloss.Style) string {
+	style := resultUnresolvedPaneStyle
+	if allResolved(m.doc, m.manualResolved) {
+		style = resultResolvedPaneStyle
+	}
+	position := panePosition(m.viewportUnified)
+	title := renderResultPaneTitle(statusText, m.viewportUnified.Width-lipgloss.Width(position), resultTitleStyle, statusStyle) + position
+	return style.Render(title + "\n" + m.viewportUnified.View())
+}
+
+// minimap returns the gauge row of each conflict and the rows the result
+// pane's view covers (see minimapRows).
+func (m model) minimap() ([]int, [2]int) {
+	return minimapRows(m.resultPaneLines, len(m.doc.Conflicts), m.wrapWidth(m.viewportResult), m.lineNumberMode, m.viewportResult.Height, m.viewportResult.YOffset)
+}
+
+// renderMinimap draws the column beside the result pane marking where each
+// conflict sits in it: the current conflict as ◆, the others as ● in the
+// resolved, unresolved or reviewed status color, over a thumb showing the
+// rows in view. A row shared by several conflicts shows the current one
+// first, then any unresolved one not yet reviewed.
+func (m model) renderMinimap() string {
+	rows, thumb := m.minimap()
+	height := m.viewportResult.Height
+	shown := make([]int, height)
+	for i := range shown {
+		shown[i] = -1
+	}
+	rank := func(index int) int {
+		switch {
+		case index == m.currentConflict:
+			return 3
+		case m.conflictResolved(index):
+			return 0
+		case m.reviewed[index]:
+			return 1
+		}
+		return 2
 	}
-	return toastLineStyle.Width(m.width).Render(content)
+	for index, row := range rows {
+		if row < 0 || row >= height {
+			continue
+		}
+		if shown[row] == -1 || rank(index) > rank(shown[row]) {
+			shown[row] = index
+		}
+	}
+
+	cells := make([]string, height)
+	for row, index := range shown {
+		switch {
+		case index == -1 && row >= thumb[0] && row < thumb[1]:
+			cells[row] = panePositionStyle.Render("│")
+		case index == -1:
+			cells[row] = " "
+		default:
+			style := m.conflictStatusStyle(index)
+			mark := "●"
+			if index == m.currentConflict {
+				mark = "◆"
+			}
+			cells[row] = style.Render(mark)
+		}
+	}
+	return strings.Join(cells, "\n")
 }
 
-func resolverFooterKeyMapText() string {
-	parts := make([]string, 0, len(resolverKeyHelp))
-	for _, entry := range resolverKeyHelp {
-		parts = append(parts, fmt.Sprintf("%s: %s", entry.key, entry.description))
+// minimapRowAt maps a terminal cell to a row of the minimap, which sits
+// right of the result pane's text below its title.
+func (m model) minimapRowAt(x int, y int) (int, bool) {
+	if !m.ready || m.layout == layoutUnified {
+		return 0, false
 	}
-	return strings.Join(parts, " | ")
+	left := m.viewportOurs.Width + oursPaneStyle.GetHorizontalFrameSize() +
+		resultUnresolvedPaneStyle.GetBorderLeftSize() + resultUnresolvedPaneStyle.GetPaddingLeft() + m.viewportResult.Width
+	top := lipgloss.Height(headerStyle.Render("")) + resultUnresolvedPaneStyle.GetBorderTopSize() + 1
+	if x < left || x >= left+minimapWidth || y < top || y >= top+m.viewportResult.Height {
+		return 0, false
+	}
+	return y - top, true
+}
+
+// conflictNearMinimapRow returns the conflict drawn closest to row of the
+// minimap.
+func (m model) conflictNearMinimapRow(row int) (int, bool) {
+	rows, _ := m.minimap()
+	best, found := 0, false
+	for index, at := range rows {
+		if at < 0 {
+			continue
+		}
+		if !found || distance(at, row) < distance(rows[best], row) {
+			best, found = index, true
+		}
+	}
+	return best, found
+}
+
+func distance(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// conflictResolved reports whether conflict index has a resolution or a
+// manual edit.
+func (m model) conflictResolved(index int) bool {
+	if _, ok := m.manualResolved[index]; ok {
+		return true
+	}
+	seg, ok := m.doc.Segments[m.doc.Conflicts[index].SegmentIndex].(markers.ConflictSegment)
+	return ok && seg.Resolution != markers.ResolutionUnset
+}
+
+// conflictStatusStyle returns the status color of conflict index: resolved,
+// reviewed while unresolved, or unresolved.
+func (m model) conflictStatusStyle(index int) lipgloss.Style {
+	switch {
+	case m.conflictResolved(index):
+		return statusResolvedStyle
+	case m.reviewed[index]:
+		return statusReviewedStyle
+	}
+	return statusUnresolvedStyle
+}
+
+// reviewedCount counts the unresolved conflicts marked reviewed.
+func (m model) reviewedCount() int {
+	count := 0
+	for index := range m.reviewed {
+		if !m.conflictResolved(index) {
+			count++
+		}
+	}
+	return count
+}
+
+func (m model) renderToastLine() string {
+	content := ""
+	if m.toastMessage != "" {
+		style := toastStyle
+		if m.toastWarning {
+			style = toastWarningStyle
+		}
+		content = style.Render(m.toastMessage)
+	}
+	return toastLineStyle.Width(m.width).Render(content)
+}
+
+// footerKeyText picks the full key list when help is shown, otherwise the
+// minibar for the current state. Once every conflict is resolved the minibar
+// leads with w and is drawn in the resolved status color.
+func (m model) footerKeyText() (string, lipgloss.Style) {
+	if m.showHelp {
+		return resolverFooterKeyMapText(), footerStyle
+	}
+	if allResolved(m.doc, m.manualResolved) {
+		style := footerStyle.Foreground(statusResolvedStyle.GetForeground()).Bold(true)
+		return "All conflicts resolved - " + formatKeyHelp(minibarDoneHelp), style
+	}
+	if m.currentConflictResolved() {
+		return formatKeyHelp(minibarResolvedHelp), footerStyle
+	}
+	return formatKeyHelp(minibarUnresolvedHelp), footerStyle
+}
+
+func (m model) currentConflictResolved() bool {
+	return m.currentConflict < len(m.doc.Conflicts) && m.conflictResolved(m.currentConflict)
+}
+
+func resolverFooterKeyMapText() string {
+	return formatKeyHelp(resolverKeyHelp)
+}
+
+func formatKeyHelp(entries []keyHelpEntry) string {
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		parts = append(parts, fmt.Sprintf("%s: %s", entry.label(), entry.description))
+	}
+	return strings.Join(parts, " | ")
 }
 
 func (m *model) applySelectedSide() error {
@@ -751,7 +1543,7 @@ func (m *model) applySelectedSide() error {
 	if m.selectedSide == selectedTheirs {
 		resolution = markers.ResolutionTheirs
 	}
-	return m.applyResolverMutation(func() error {
+	return m.applyResolverMutation(conflictHistoryLabel(m.currentConflict, string(resolution)), func() error {
 		if err := m.state.ApplyResolution(m.currentConflict, resolution); err != nil {
 			return err
 		}
@@ -761,7 +1553,7 @@ func (m *model) applySelectedSide() error {
 }
 
 func (m *model) applyResolution(resolution markers.Resolution) error {
-	return m.applyResolverMutation(func() error {
+	return m.applyResolverMutation(conflictHistoryLabel(m.currentConflict, string(resolution)), func() error {
 		if err := m.state.ApplyResolution(m.currentConflict, resolution); err != nil {
 			return err
 		}
@@ -771,7 +1563,7 @@ func (m *model) applyResolution(resolution markers.Resolution) error {
 }
 
 func (m *model) applyAll(resolution markers.Resolution) error {
-	return m.applyResolverMutation(func() error {
+	return m.applyResolverMutation("apply-all: "+string(resolution), func() error {
 		if err := m.state.ApplyAll(resolution); err != nil {
 			return err
 		}
@@ -781,42 +1573,252 @@ func (m *model) applyAll(resolution markers.Resolution) error {
 }
 
 func (m *model) handleQuit() (tea.Cmd, error) {
+	if err := m.autoWriteOnExit(); err != nil {
+		return m.promptExitOverwrite((*model).handleQuit, err)
+	}
 	m.err = ErrBackToSelector
 	m.quitting = true
 	return tea.Quit, nil
 }
 
 func (m *model) handleCtrlC() (tea.Cmd, error) {
+	if err := m.autoWriteOnExit(); err != nil {
+		return m.promptExitOverwrite((*model).handleCtrlC, err)
+	}
 	m.quitting = true
 	return tea.Quit, nil
 }
 
+// autoWriteOnExit writes the result before quitting under --auto-write. With
+// conflicts left unresolved nothing is written, as without the flag.
+func (m *model) autoWriteOnExit() error {
+	if !m.opts.AutoWrite || !allResolved(m.doc, m.manualResolved) {
+		return nil
+	}
+	if _, err := m.writeResolved(); err != nil {
+		return fmt.Errorf("failed to write resolved: %w", err)
+	}
+	return nil
+}
+
+// promptExitOverwrite asks before exit writes over a $MERGED that changed on
+// disk; n still exits, leaving the file as the other program wrote it.
+// Other errors from the auto-write are returned as they are.
+func (m *model) promptExitOverwrite(exit keyAction, err error) (tea.Cmd, error) {
+	if !errors.Is(err, errMergedChanged) {
+		return nil, err
+	}
+	m.overwrite = &overwritePrompt{
+		write: exit,
+		skip: func(m *model) (tea.Cmd, error) {
+			m.opts.AutoWrite = false
+			return exit(m)
+		},
+	}
+	return nil, nil
+}
+
+// runAction runs a resolver action. When it stopped because $MERGED changed
+// on disk, the overwrite prompt opens to run it again on y.
+func (m model) runAction(action keyAction) (tea.Model, tea.Cmd) {
+	cmd, err := action(&m)
+	if errors.Is(err, errMergedChanged) {
+		m.overwrite = &overwritePrompt{write: action}
+		return m, nil
+	}
+	if err != nil {
+		m.err = err
+		m.quitting = true
+		return m, tea.Quit
+	}
+	return m, cmd
+}
+
+// updateOverwrite handles keys while the resolver asks whether to write over
+// a $MERGED that changed on disk: y writes, n or esc keeps the file on disk,
+// and other keys are ignored.
+func (m model) updateOverwrite(key string) (tea.Model, tea.Cmd) {
+	prompt := m.overwrite
+	switch key {
+	case keyOverwriteConfirm:
+		m.overwrite = nil
+		stamp, err := statFile(m.opts.MergedPath)
+		if err != nil {
+			m.err = fmt.Errorf("stat merged: %w", err)
+			m.quitting = true
+			return m, tea.Quit
+		}
+		m.mergedStamp = stamp
+		return m.runAction(prompt.write)
+	case keyOverwriteCancel, keyReviewCancel:
+		m.overwrite = nil
+		if prompt.skip != nil {
+			return m.runAction(prompt.skip)
+		}
+		return m, m.showToast("Write cancelled: "+filepath.Base(m.opts.MergedPath)+" changed on disk", 3)
+	}
+	return m, nil
+}
+
 func (m *model) handleNextConflict() (tea.Cmd, error) {
+	if m.filterText != "" {
+		for _, index := range m.filteredConflicts(m.filterText) {
+			if index > m.currentConflict {
+				m.switchConflict(index)
+				break
+			}
+		}
+		return nil, nil
+	}
 	if m.currentConflict < len(m.doc.Conflicts)-1 {
-		m.currentConflict++
-		m.pendingScroll = true
-		m.updateViewports()
+		m.switchConflict(m.currentConflict + 1)
 	}
 	return nil, nil
 }
 
 func (m *model) handlePrevConflict() (tea.Cmd, error) {
+	if m.filterText != "" {
+		matches := m.filteredConflicts(m.filterText)
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i] < m.currentConflict {
+				m.switchConflict(matches[i])
+				break
+			}
+		}
+		return nil, nil
+	}
 	if m.currentConflict > 0 {
-		m.currentConflict--
-		m.pendingScroll = true
-		m.updateViewports()
+		m.switchConflict(m.currentConflict - 1)
+	}
+	return nil, nil
+}
+
+func (m *model) handleToggleReviewed() (tea.Cmd, error) {
+	if len(m.doc.Conflicts) == 0 {
+		return nil, nil
+	}
+	if m.reviewed[m.currentConflict] {
+		delete(m.reviewed, m.currentConflict)
+		return m.showToast(fmt.Sprintf("Conflict %d no longer marked reviewed", m.currentConflict+1), 2), nil
+	}
+	if m.reviewed == nil {
+		m.reviewed = make(map[int]bool)
+	}
+	m.reviewed[m.currentConflict] = true
+	return m.showToast(fmt.Sprintf("Conflict %d marked reviewed", m.currentConflict+1), 2), nil
+}
+
+// handleNextUnreviewed moves to the next unresolved conflict not marked
+// reviewed, wrapping around to the first.
+func (m *model) handleNextUnreviewed() (tea.Cmd, error) {
+	count := len(m.doc.Conflicts)
+	for step := 1; step <= count; step++ {
+		index := (m.currentConflict + step) % count
+		if !m.conflictResolved(index) && !m.reviewed[index] {
+			if index != m.currentConflict {
+				m.switchConflict(index)
+			}
+			return nil, nil
+		}
 	}
+	return m.showToast("No unresolved conflicts left to review", 2), nil
+}
+
+// filteredConflicts lists the conflicts whose ours or theirs contains text,
+// ignoring case.
+func (m model) filteredConflicts(text string) []int {
+	needle := bytes.ToLower([]byte(text))
+	var matches []int
+	for i, ref := range m.doc.Conflicts {
+		seg, ok := m.doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		if bytes.Contains(bytes.ToLower(seg.Ours), needle) || bytes.Contains(bytes.ToLower(seg.Theirs), needle) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func (m *model) handleFilter() (tea.Cmd, error) {
+	m.filtering = true
+	m.filterInput = m.filterText
 	return nil, nil
 }
 
+// updateFilter reads the filter text typed after f. enter applies it and
+// moves to the first match from the current conflict on; esc clears it.
+func (m model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case keyFilterApply:
+		m.filtering = false
+		if m.filterInput == "" {
+			m.filterText = ""
+			return m, nil
+		}
+		matches := m.filteredConflicts(m.filterInput)
+		if len(matches) == 0 {
+			return m, m.showToast(fmt.Sprintf("No conflicts match %q", m.filterInput), 3)
+		}
+		m.filterText = m.filterInput
+		if !slices.Contains(matches, m.currentConflict) {
+			target := matches[0]
+			for _, index := range matches {
+				if index > m.currentConflict {
+					target = index
+					break
+				}
+			}
+			m.switchConflict(target)
+		}
+		return m, nil
+	case keyFilterClear:
+		m.filtering = false
+		m.filterText = ""
+		m.filterInput = ""
+		return m, nil
+	case "backspace":
+		if input := []rune(m.filterInput); len(input) > 0 {
+			m.filterInput = string(input[:len(input)-1])
+		}
+	case keyCtrlU:
+		m.filterInput = ""
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.filterInput += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+// switchConflict moves to conflict index, remembering how far the panes were
+// scrolled on the conflict being left. A conflict is centered on its first
+// visit; returning to it restores the saved result pane offset and shifts the
+// side panes by the same amount so they stay aligned.
+func (m *model) switchConflict(index int) {
+	if m.conflictOffsets == nil {
+		m.conflictOffsets = make(map[int]int)
+	}
+	m.conflictOffsets[m.currentConflict] = m.viewportResult.YOffset
+	m.currentConflict = index
+	m.pendingScroll = true
+	m.updateViewports()
+	if offset, ok := m.conflictOffsets[index]; ok {
+		m.scrollVertical(offset - m.viewportResult.YOffset)
+	}
+}
+
+// handleSelectOurs and handleSelectTheirs select the side in the left and
+// right pane, which are theirs and ours once the sides are swapped.
 func (m *model) handleSelectOurs() (tea.Cmd, error) {
-	m.selectedSide = selectedOurs
+	m.selectedSide = m.sideOn(screenLeft)
 	m.updateViewports()
 	return nil, nil
 }
 
 func (m *model) handleSelectTheirs() (tea.Cmd, error) {
-	m.selectedSide = selectedTheirs
+	m.selectedSide = m.sideOn(screenRight)
 	m.updateViewports()
 	return nil, nil
 }
@@ -851,6 +1853,71 @@ func (m *model) handleHalfPageUp() (tea.Cmd, error) {
 	return nil, nil
 }
 
+// handleRevert discards every resolution and edit made since the resolver
+// opened the file, as one step u can undo.
+func (m *model) handleRevert() (tea.Cmd, error) {
+	if m.pristine == nil || m.state.Equal(m.pristine) {
+		return m.showToast("Nothing to revert", 2), nil
+	}
+	err := m.applyResolverMutation("revert file", func() error {
+		m.state.Restore(m.pristine)
+		m.refreshResolverCaches()
+		m.currentConflict = min(m.currentConflict, max(len(m.doc.Conflicts)-1, 0))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.showToast("Reverted to the conflicts as opened (u to undo)", 3), nil
+}
+
+// handleRestoreBackup undoes the last write: it copies the backup of $MERGED
+// back over it and reloads the resolver from it, as one step u can undo. Like w,
+// it asks before overwriting outside changes.
+func (m *model) handleRestoreBackup() (tea.Cmd, error) {
+	if err := m.checkMergedStamp(); err != nil {
+		return nil, err
+	}
+	if err := engine.RestoreBackup(m.opts.MergedPath, m.opts); err != nil {
+		return m.showToast(fmt.Sprintf("Restore failed: %v", err), 4), nil
+	}
+	m.recordMergedStamp()
+	if err := m.reloadFromFile("restore backup"); err != nil {
+		return m.showToast(fmt.Sprintf("Restored the backup but reload failed, kept previous state: %v", err), 5), nil
+	}
+	return m.showToast("Restored "+filepath.Base(engine.BackupPath(m.opts.MergedPath, m.opts)), 3), nil
+}
+
+func (m *model) handleNextChange() (tea.Cmd, error) {
+	return m.jumpToChange(1), nil
+}
+
+func (m *model) handlePrevChange() (tea.Cmd, error) {
+	return m.jumpToChange(-1), nil
+}
+
+// jumpToChange scrolls the panes so the next (direction 1) or previous
+// (direction -1) run of changed lines in the selected side's pane starts at
+// the top, relative to that pane's current offset.
+func (m *model) jumpToChange(direction int) tea.Cmd {
+	lines, vp, numberMode := m.oursPaneLines, m.viewportOurs, m.lineNumberMode
+	switch {
+	case m.layout == layoutUnified:
+		lines, vp, numberMode = m.unifiedLines, m.viewportUnified, m.unifiedNumberMode()
+	case m.selectedSide == selectedTheirs:
+		lines, vp = m.theirsPaneLines, m.viewportTheirs
+	}
+	row, ok := nextChangeRow(lines, m.wrapWidth(vp), numberMode, vp.YOffset, direction)
+	if !ok {
+		if direction > 0 {
+			return m.showToast("No next change", 2)
+		}
+		return m.showToast("No previous change", 2)
+	}
+	m.scrollVertical(row - vp.YOffset)
+	return nil
+}
+
 func (m *model) handleApplyOurs() (tea.Cmd, error) {
 	if err := m.applyResolution(markers.ResolutionOurs); err != nil {
 		return nil, fmt.Errorf("failed to apply ours: %w", err)
@@ -886,6 +1953,16 @@ func (m *model) handleAccept() (tea.Cmd, error) {
 	return nil, nil
 }
 
+func (m *model) handleAcceptAndAdvance() (tea.Cmd, error) {
+	if err := m.applySelectedSide(); err != nil {
+		return nil, fmt.Errorf("failed to apply selection: %w", err)
+	}
+	if m.currentConflict >= len(m.doc.Conflicts)-1 {
+		return m.showToast("Last conflict - press w to write", 2), nil
+	}
+	return m.handleNextConflict()
+}
+
 func (m *model) handleDiscard() (tea.Cmd, error) {
 	if err := m.applyResolution(markers.ResolutionNone); err != nil {
 		return nil, fmt.Errorf("failed to discard selection: %w", err)
@@ -900,6 +1977,13 @@ func (m *model) handleApplyBoth() (tea.Cmd, error) {
 	return nil, nil
 }
 
+func (m *model) handleApplyBothDedup() (tea.Cmd, error) {
+	if err := m.applyResolution(markers.ResolutionBothDedup); err != nil {
+		return nil, fmt.Errorf("failed to apply both (dedup): %w", err)
+	}
+	return nil, nil
+}
+
 func (m *model) handleApplyNone() (tea.Cmd, error) {
 	if err := m.applyResolution(markers.ResolutionNone); err != nil {
 		return nil, fmt.Errorf("failed to apply none: %w", err)
@@ -907,45 +1991,444 @@ func (m *model) handleApplyNone() (tea.Cmd, error) {
 	return nil, nil
 }
 
+func (m *model) handleCycleResolution() (tea.Cmd, error) {
+	err := m.applyResolverMutation(conflictHistoryLabel(m.currentConflict, "cycle"), func() error {
+		if err := m.state.CycleResolution(m.currentConflict); err != nil {
+			return err
+		}
+		m.refreshResolverCaches()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cycle resolution: %w", err)
+	}
+	return nil, nil
+}
+
 func (m *model) handleUndo() (tea.Cmd, error) {
-	if m.undoDepth() == 0 {
+	if !m.state.Undo() {
 		return nil, nil
 	}
-	current := m.captureResolverSnapshot()
-	snapshot := m.resolverUndo[len(m.resolverUndo)-1]
-	m.resolverUndo = m.resolverUndo[:len(m.resolverUndo)-1]
-	m.resolverRedo = append(m.resolverRedo, current)
-	m.restoreResolverSnapshot(snapshot)
+	m.refreshResolverCaches()
 	m.updateViewports()
 	return nil, nil
 }
 
 func (m *model) handleRedo() (tea.Cmd, error) {
-	if m.redoDepth() == 0 {
+	if !m.state.Redo() {
 		return nil, nil
 	}
-	current := m.captureResolverSnapshot()
-	snapshot := m.resolverRedo[len(m.resolverRedo)-1]
-	m.resolverRedo = m.resolverRedo[:len(m.resolverRedo)-1]
-	m.resolverUndo = append(m.resolverUndo, current)
-	m.restoreResolverSnapshot(snapshot)
+	m.refreshResolverCaches()
 	m.updateViewports()
 	return nil, nil
 }
 
 func (m *model) handleWrite() (tea.Cmd, error) {
-	if err := m.writeResolved(); err != nil {
+	remaining, err := m.writeResolved()
+	if err != nil {
 		return nil, fmt.Errorf("failed to write resolved: %w", err)
 	}
 	m.refreshResolverCaches()
 	m.updateViewports()
+	if m.opts.Batch && len(m.nextFiles) > 0 && !m.state.HasUnresolvedConflicts() {
+		m.err = ErrNextFile
+		m.quitting = true
+		return tea.Quit, nil
+	}
+	if remaining > 0 {
+		return m.showWarningToast(fmt.Sprintf("Saved (%d conflict(s) remaining)", remaining), 3), nil
+	}
 	return m.showToast("Saved", 2), nil
 }
 
+// handleWriteAndContinue writes the file, stages it and continues the merge,
+// rebase or other operation that stopped on it. It only runs in repo mode on
+// the last unresolved file, and stays a toast-only no-op otherwise.
+func (m *model) handleWriteAndContinue() (tea.Cmd, error) {
+	if m.repoRoot == "" {
+		return m.showToast("Stage and continue needs repo mode (run ec without paths)", 3), nil
+	}
+	if m.state.HasUnresolvedConflicts() {
+		return m.showToast("Resolve all conflicts before continuing", 3), nil
+	}
+	if len(m.nextFiles) > 0 {
+		return m.showToast(fmt.Sprintf("%d more unresolved file(s) before continuing", len(m.nextFiles)), 3), nil
+	}
+
+	if _, err := m.writeResolved(); err != nil {
+		return nil, fmt.Errorf("failed to write resolved: %w", err)
+	}
+	m.refreshResolverCaches()
+	m.updateViewports()
+
+	if err := gitutil.AddPath(m.ctx, m.repoRoot, m.repoPath); err != nil {
+		return m.showToast(err.Error(), 5), nil
+	}
+	operation, err := gitutil.OperationInProgress(m.ctx, m.repoRoot)
+	if err != nil {
+		return m.showToast(err.Error(), 5), nil
+	}
+	if operation == "" {
+		return m.showToast("Staged; no merge or rebase in progress", 3), nil
+	}
+	var head string
+	if m.opts.RecordNotes {
+		if head, err = gitutil.HeadCommit(m.ctx, m.repoRoot); err != nil {
+			return m.showToast(err.Error(), 5), nil
+		}
+	}
+	if err := gitutil.ContinueOperation(m.ctx, m.repoRoot, operation); err != nil {
+		return m.showToast(err.Error(), 5), nil
+	}
+
+	m.result.Continued = operation
+	if head != "" {
+		// A failed lookup leaves Commit empty; run reports the note as skipped.
+		m.result.Commit, _ = gitutil.FirstCommitAfter(m.ctx, m.repoRoot, head)
+	}
+	m.quitting = true
+	return tea.Quit, nil
+}
+
+func (m *model) handleNextFile() (tea.Cmd, error) {
+	if len(m.nextFiles) == 0 {
+		return m.showToast("No more unresolved files", 2), nil
+	}
+	m.err = ErrNextFile
+	m.quitting = true
+	return tea.Quit, nil
+}
+
+// handleContextMore shows one more line of unchanged context around changes.
+// It is a no-op while folding is off.
+func (m *model) handleContextMore() (tea.Cmd, error) {
+	if m.contextLines == 0 {
+		return nil, nil
+	}
+	m.contextLines++
+	m.closeFolds()
+	m.pendingScroll = true
+	m.updateViewports()
+	return m.showToast(fmt.Sprintf("Context: %d lines", m.contextLines), 1), nil
+}
+
+// handleContextLess folds unchanged text, starting at defaultFoldContext lines
+// of context and shrinking by one line per press.
+func (m *model) handleContextLess() (tea.Cmd, error) {
+	switch {
+	case m.contextLines == 0:
+		m.contextLines = defaultFoldContext
+	case m.contextLines > 1:
+		m.contextLines--
+	default:
+		return nil, nil
+	}
+	m.closeFolds()
+	m.pendingScroll = true
+	m.updateViewports()
+	return m.showToast(fmt.Sprintf("Context: %d lines", m.contextLines), 1), nil
+}
+
+// openVisibleFolds unfolds every fold placeholder shown in the panes'
+// visible rows, keeping the panes where they are.
+func (m *model) openVisibleFolds() tea.Cmd {
+	opened := 0
+	for _, pane := range []struct {
+		lines []lineInfo
+		vp    viewport.Model
+		open  *map[int]bool
+	}{
+		{m.oursPaneLines, m.viewportOurs, &m.oursOpenFolds},
+		{m.resultPaneLines, m.viewportResult, &m.resultOpenFolds},
+		{m.theirsPaneLines, m.viewportTheirs, &m.theirsOpenFolds},
+	} {
+		for i, line := range pane.lines {
+			if line.folded == 0 {
+				continue
+			}
+			row := visualRowOffset(pane.lines, i, m.wrapWidth(pane.vp), m.lineNumberMode)
+			if row < pane.vp.YOffset || row >= pane.vp.YOffset+pane.vp.Height {
+				continue
+			}
+			if *pane.open == nil {
+				*pane.open = map[int]bool{}
+			}
+			(*pane.open)[line.foldStart] = true
+			opened++
+		}
+	}
+	if opened == 0 {
+		return m.showToast("No folded lines in view", 2)
+	}
+	m.updateViewports()
+	return m.showToast(fmt.Sprintf("Opened %d fold(s)", opened), 2)
+}
+
+// closeFolds folds again what zo opened; the folds move once the amount of
+// context changes.
+func (m *model) closeFolds() {
+	m.oursOpenFolds, m.resultOpenFolds, m.theirsOpenFolds = nil, nil, nil
+}
+
+// handleEdit opens $EDITOR on the result, which is first written over
+// $MERGED, so it asks before overwriting outside changes as w does.
 func (m *model) handleEdit() (tea.Cmd, error) {
+	if err := m.checkMergedStamp(); err != nil {
+		return nil, err
+	}
 	return m.openEditor(), nil
 }
 
+// handleEditConflict opens $EDITOR on just the current conflict, starting
+// from conflictEditSeed. Saving stores the text as a manual resolution.
+func (m *model) handleEditConflict() (tea.Cmd, error) {
+	if m.currentConflict >= len(m.doc.Conflicts) {
+		return nil, nil
+	}
+	index := m.currentConflict
+	seed, err := m.conflictEditSeed(index)
+	if err != nil {
+		return nil, err
+	}
+	seed, err = charset.Encode(m.opts.Encoding, seed)
+	if err != nil {
+		return nil, fmt.Errorf("encode conflict for editor: %w", err)
+	}
+
+	tmp, err := os.CreateTemp("", "ec-conflict-*"+filepath.Ext(m.opts.MergedPath))
+	if err != nil {
+		return nil, fmt.Errorf("create conflict file: %w", err)
+	}
+	_, err = tmp.Write(seed)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("write conflict file: %w", err)
+	}
+
+	args := engine.EditorArgs(os.Getenv("EDITOR"), tmp.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return conflictEditFinishedMsg{index: index, path: tmp.Name(), err: err}
+	}), nil
+}
+
+// finishConflictEdit stores the text saved by the editor opened with i as
+// one undoable step and removes the temporary file.
+// conflictEditSeed is the text i starts editing conflict index from: the
+// earlier edit when it was changed by hand, the text of its resolution when
+// it has one, so resolving to both first starts from both sides, and
+// otherwise the selected side.
+func (m *model) conflictEditSeed(index int) ([]byte, error) {
+	if seed, ok := m.state.ManualResolved()[index]; ok {
+		return seed, nil
+	}
+	resolution := markers.ResolutionOurs
+	if m.selectedSide == selectedTheirs {
+		resolution = markers.ResolutionTheirs
+	}
+	if seg, ok := m.doc.Segments[m.doc.Conflicts[index].SegmentIndex].(markers.ConflictSegment); ok && seg.Resolution != markers.ResolutionUnset {
+		resolution = seg.Resolution
+	}
+	return m.state.StartManualFrom(index, resolution)
+}
+
+func (m *model) finishConflictEdit(msg conflictEditFinishedMsg) tea.Cmd {
+	defer os.Remove(msg.path)
+	if msg.err != nil {
+		return m.showToast(fmt.Sprintf("Editor failed, conflict unchanged: %v", msg.err), 5)
+	}
+	edited, err := os.ReadFile(msg.path)
+	if err == nil {
+		edited, err = charset.Decode(m.opts.Encoding, edited)
+	}
+	if err != nil {
+		return m.showToast(fmt.Sprintf("Reading the edit failed, conflict unchanged: %v", err), 5)
+	}
+	err = m.applyResolverMutation(conflictHistoryLabel(msg.index, "edit"), func() error {
+		if err := m.state.SetManualResolution(msg.index, edited); err != nil {
+			return err
+		}
+		m.refreshResolverCaches()
+		return nil
+	})
+	if err != nil {
+		return m.showToast(fmt.Sprintf("Edit not applied: %v", err), 5)
+	}
+	return nil
+}
+
+func (m *model) handleToggleWhitespace() (tea.Cmd, error) {
+	m.showWhitespace = !m.showWhitespace
+	m.updateViewports()
+	return nil, nil
+}
+
+func (m *model) handleToggleHistory() (tea.Cmd, error) {
+	m.showHistory = !m.showHistory
+	return nil, nil
+}
+
+// handleReviewWrite shows a unified diff from the merged file on disk to
+// what w would write, so a mass change can be caught before it lands.
+func (m *model) handleReviewWrite() (tea.Cmd, error) {
+	resolved, err := m.resolvedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render resolved: %w", err)
+	}
+	onDisk, err := os.ReadFile(m.opts.MergedPath)
+	if err != nil {
+		return nil, fmt.Errorf("read merged: %w", err)
+	}
+	patch := engine.UnifiedPatch(m.opts.MergedPath, onDisk, resolved)
+	if patch == nil {
+		return m.showToast("Nothing to write: file on disk is unchanged", 2), nil
+	}
+
+	m.reviewViewport = viewport.New(1, 1)
+	m.reviewViewport.SetContent(renderReviewPatch(patch))
+	m.resizeReview()
+	m.reviewing = true
+	return nil, nil
+}
+
+// updateReview handles keys while the write review is shown: y writes, esc,
+// n or q go back without writing, and the keys bound to scrolling scroll the
+// diff.
+func (m model) updateReview(key string) (tea.Model, tea.Cmd) {
+	switch {
+	case key == keyReviewConfirm:
+		m.reviewing = false
+		return m.runAction((*model).handleWrite)
+	case key == keyReviewCancel, key == keyReviewDecline, key == keyReviewClose:
+		m.reviewing = false
+		return m, m.showToast("Write cancelled", 2)
+	case key == keyGoTop:
+		m.reviewViewport.GotoTop()
+	case key == keyGoBottom:
+		m.reviewViewport.GotoBottom()
+	case keyBoundTo(key, "scroll_down"):
+		m.reviewViewport.ScrollDown(1)
+	case keyBoundTo(key, "scroll_up"):
+		m.reviewViewport.ScrollUp(1)
+	case keyBoundTo(key, "half_page_down"):
+		m.reviewViewport.HalfPageDown()
+	case keyBoundTo(key, "half_page_up"):
+		m.reviewViewport.HalfPageUp()
+	}
+	return m, nil
+}
+
+// resizeReview fits the review and raw conflict viewports to a single pane
+// spanning the terminal.
+func (m *model) resizeReview() {
+	for _, vp := range []*viewport.Model{&m.reviewViewport, &m.rawViewport} {
+		vp.Width = max(m.width-paneChromeWidth/3, 1)
+		vp.Height = max(m.height-paneChromeHeight, 1)
+	}
+}
+
+// handleViewRaw shows the current conflict as it reads with its conflict
+// markers and labels, for when the panes abstract too much.
+func (m *model) handleViewRaw() (tea.Cmd, error) {
+	if m.currentConflict >= len(m.doc.Conflicts) {
+		return nil, nil
+	}
+	seg, ok := m.doc.Segments[m.doc.Conflicts[m.currentConflict].SegmentIndex].(markers.ConflictSegment)
+	if !ok {
+		return nil, fmt.Errorf("internal: conflict %d is not a conflict segment", m.currentConflict)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(markers.RenderConflictBlock(seg)), "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		lines[i] = line
+		if isConflictMarkerLine(line) {
+			lines[i] = titleStyle.Render(line)
+		}
+	}
+	m.rawViewport = viewport.New(1, 1)
+	m.rawViewport.SetContent(strings.Join(lines, "\n"))
+	m.resizeReview()
+	m.showingRaw = true
+	return nil, nil
+}
+
+func isConflictMarkerLine(line string) bool {
+	for _, marker := range []string{"<<<<<<<", "|||||||", "=======", ">>>>>>>"} {
+		if strings.HasPrefix(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m model) renderRawBlock() string {
+	header := headerStyle.Render(fmt.Sprintf("%s - raw conflict %d/%d", m.opts.MergedPath, m.currentConflict+1, len(m.doc.Conflicts)))
+	pane := paneStyle.Render(
+		renderPaneTitleWithPosition("RAW CONFLICT", m.rawViewport, titleStyle) + "\n" +
+			m.rawViewport.View(),
+	)
+	footerText := footerStyle.Width(m.width).Render("any key: close")
+	footer := lipgloss.JoinVertical(lipgloss.Left, footerText, m.renderToastLine())
+	return lipgloss.JoinVertical(lipgloss.Left, header, pane, footer)
+}
+
+func (m model) renderReview() string {
+	header := headerStyle.Render(fmt.Sprintf("%s - review before write", m.opts.MergedPath))
+	pane := paneStyle.Render(
+		renderPaneTitleWithPosition("DIFF TO DISK", m.reviewViewport, titleStyle) + "\n" +
+			m.reviewViewport.View(),
+	)
+	footerText := footerStyle.Width(m.width).Render("y: write | esc/n/q: cancel | " + formatKeyHelp(reviewKeyHelp))
+	footer := lipgloss.JoinVertical(lipgloss.Left, footerText, m.renderToastLine())
+	return lipgloss.JoinVertical(lipgloss.Left, header, pane, footer)
+}
+
+// renderReviewPatch colors the added and removed lines of a unified patch.
+func renderReviewPatch(patch []byte) string {
+	lines := strings.Split(strings.TrimSuffix(string(patch), "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		lines[i] = line
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = titleStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = panePositionStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = addedLineStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = removedLineStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) handleToggleHelp() (tea.Cmd, error) {
+	m.showHelp = !m.showHelp
+	return nil, nil
+}
+
+// handleViewBase suspends the resolver to show the whole BASE file. Viewer
+// failures are reported as a toast since the resolution state is untouched.
+func (m *model) handleViewBase() (tea.Cmd, error) {
+	if m.opts.AllowMissingBase {
+		return m.showToast("No base file for this conflict", 3), nil
+	}
+	cmd, err := engine.OpenBaseFile(m.opts.BasePath)
+	if err != nil {
+		return m.showToast(fmt.Sprintf("Cannot open base: %v", err), 3), nil
+	}
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return baseViewerFinishedMsg{err: err}
+	}), nil
+}
+
 func (m *model) updateViewports() {
 	if m.currentConflict >= len(m.doc.Conflicts) {
 		return
@@ -990,8 +2473,8 @@ func (m *model) updateViewports() {
 	}
 
 	if useFullDiff {
-		oursEntries := diffEntries(m.baseLines, m.oursLines)
-		theirsEntries := diffEntries(m.baseLines, m.theirsLines)
+		oursEntries := diffEntriesWithContext(m.baseLines, m.oursLines, conflictWindows(m.conflictRanges, paneOurs), m.opts.DiffContext)
+		theirsEntries := diffEntriesWithContext(m.baseLines, m.theirsLines, conflictWindows(m.conflictRanges, paneTheirs), m.opts.DiffContext)
 		markConflictedInRanges(&oursEntries, &theirsEntries, m.conflictRanges)
 		oursLines, oursStart = buildPaneLinesFromEntries(m.doc, paneOurs, m.currentConflict, m.selectedSide, oursEntries, m.conflictRanges)
 		theirsLines, theirsStart = buildPaneLinesFromEntries(m.doc, paneTheirs, m.currentConflict, m.selectedSide, theirsEntries, m.conflictRanges)
@@ -999,40 +2482,226 @@ func (m *model) updateViewports() {
 		oursLines, oursStart = buildPaneLinesFromDoc(m.doc, paneOurs, m.currentConflict, m.selectedSide)
 		theirsLines, theirsStart = buildPaneLinesFromDoc(m.doc, paneTheirs, m.currentConflict, m.selectedSide)
 	}
-	oursContent := renderLines(oursLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, false)
-	m.viewportOurs.SetContent(oursContent)
-	if m.pendingScroll {
-		ensureVisible(&m.viewportOurs, oursStart, len(oursLines))
-	}
-
-	// Update theirs pane (full file, highlight conflicts)
-	theirsContent := renderLines(theirsLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, false)
-	m.viewportTheirs.SetContent(theirsContent)
-	if m.pendingScroll {
-		ensureVisible(&m.viewportTheirs, theirsStart, len(theirsLines))
-	}
+	oursLines, oursStart = foldContextLines(oursLines, oursStart, m.contextLines, m.oursOpenFolds)
+	theirsLines, theirsStart = foldContextLines(theirsLines, theirsStart, m.contextLines, m.theirsOpenFolds)
 
 	// Update result pane with full resolved preview
 	var resultLines []lineInfo
 	var resultStart int
 	if useFullDiff {
 		previewLines, forced, resultRanges := buildResultPreviewLines(m.doc, m.selectedSide, m.manualResolved, m.currentConflict, m.resultBoundaries)
-		resultEntries := diffEntries(m.baseLines, previewLines)
+		resultEntries := diffEntriesWithContext(m.baseLines, previewLines, resultWindows(m.conflictRanges, resultRanges), m.opts.DiffContext)
 		resultLines, resultStart = buildResultLinesFromEntries(resultEntries, resultRanges, m.currentConflict, forced)
 	} else {
 		resultLines, resultStart = buildResultLines(m.doc, m.currentConflict, m.selectedSide, m.manualResolved, m.resultBoundaries)
 	}
-	resultContent := renderLines(resultLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, true)
+	resultLines, resultStart = foldContextLines(resultLines, resultStart, m.contextLines, m.resultOpenFolds)
+
+	// Aligning needs base line numbers, which only the full diff provides.
+	if m.alignPanes && useFullDiff {
+		panes, starts := alignPaneLines([][]lineInfo{oursLines, resultLines, theirsLines}, []int{oursStart, resultStart, theirsStart})
+		oursLines, resultLines, theirsLines = panes[0], panes[1], panes[2]
+		oursStart, resultStart, theirsStart = starts[0], starts[1], starts[2]
+	}
+	oursLines, theirsLines, resultLines = m.displayLines(oursLines), m.displayLines(theirsLines), m.displayLines(resultLines)
+
+	m.oursPaneLines, m.theirsPaneLines, m.resultPaneLines = oursLines, theirsLines, resultLines
+
+	oursWrap := m.wrapWidth(m.viewportOurs)
+	oursContent := renderLines(oursLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, false, oursWrap, m.lineNumberMode)
+	m.viewportOurs.SetContent(oursContent)
+	m.oursAnchor = paneAnchor{visualRowOffset(oursLines, oursStart, oursWrap, m.lineNumberMode), visualRowOffset(oursLines, len(oursLines), oursWrap, m.lineNumberMode)}
+
+	theirsWrap := m.wrapWidth(m.viewportTheirs)
+	theirsContent := renderLines(theirsLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, false, theirsWrap, m.lineNumberMode)
+	m.viewportTheirs.SetContent(theirsContent)
+	m.theirsAnchor = paneAnchor{visualRowOffset(theirsLines, theirsStart, theirsWrap, m.lineNumberMode), visualRowOffset(theirsLines, len(theirsLines), theirsWrap, m.lineNumberMode)}
+
+	resultWrap := m.wrapWidth(m.viewportResult)
+	resultContent := renderLines(resultLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, true, resultWrap, m.lineNumberMode)
 	m.viewportResult.SetContent(resultContent)
-	if m.pendingScroll {
-		ensureVisible(&m.viewportResult, resultStart, len(resultLines))
+	m.resultAnchor = paneAnchor{visualRowOffset(resultLines, resultStart, resultWrap, m.lineNumberMode), visualRowOffset(resultLines, len(resultLines), resultWrap, m.lineNumberMode)}
+
+	if m.layout == layoutUnified {
+		unifiedLines, unifiedStart := buildUnifiedLines(m.doc, m.currentConflict, m.selectedSide, m.manualResolved, m.swapped)
+		unifiedLines = m.displayLines(unifiedLines)
+		m.unifiedLines = unifiedLines
+		unifiedWrap := m.wrapWidth(m.viewportUnified)
+		numberMode := m.unifiedNumberMode()
+		m.viewportUnified.SetContent(renderLines(unifiedLines, lineNumberStyle, baseStyles, highlightStyles, selectedStyles, connectorStyles, false, unifiedWrap, numberMode))
+		m.unifiedAnchor = paneAnchor{visualRowOffset(unifiedLines, unifiedStart, unifiedWrap, numberMode), visualRowOffset(unifiedLines, len(unifiedLines), unifiedWrap, numberMode)}
 	}
 	if m.pendingScroll {
+		m.recenter()
 		m.pendingScroll = false
 	}
 }
 
-func ensureVisible(viewportModel *viewport.Model, start int, total int) {
+const (
+	// paneChromeWidth is the columns taken by the borders and padding of
+	// the three panes; paneChromeHeight the rows taken by the header,
+	// footer, borders and padding.
+	paneChromeWidth  = 12
+	paneChromeHeight = 2 + 3 + 6
+
+	minPaneWidth      = 8
+	minContentHeight  = 3
+	minTerminalWidth  = paneChromeWidth + 3*minPaneWidth
+	minTerminalHeight = paneChromeHeight + minContentHeight
+
+	// minimapWidth is the column the conflict minimap takes beside the
+	// result pane's text.
+	minimapWidth = 1
+
+	// unifiedChromeWidth is the columns taken by the border and padding of
+	// the single pane of the unified layout.
+	unifiedChromeWidth      = paneChromeWidth / 3
+	minUnifiedTerminalWidth = unifiedChromeWidth + minPaneWidth
+)
+
+// sizeViewports fits the viewports of both layouts to the terminal and
+// records whether the current layout fits at all.
+func (m *model) sizeViewports() {
+	paneWidth, contentHeight, fits := paneDimensions(m.width, m.height)
+	unifiedWidth := m.width - unifiedChromeWidth
+	if m.layout == layoutUnified {
+		fits = unifiedWidth >= minPaneWidth && contentHeight >= minContentHeight
+	}
+	m.tooSmall = !fits
+	unifiedWidth = max(unifiedWidth, 1)
+	if !m.ready {
+		m.viewportOurs = viewport.New(paneWidth, contentHeight)
+		m.viewportResult = viewport.New(max(paneWidth-minimapWidth, 1), contentHeight)
+		m.viewportTheirs = viewport.New(paneWidth, contentHeight)
+		m.viewportUnified = viewport.New(unifiedWidth, contentHeight)
+		m.ready = true
+		return
+	}
+	for _, vp := range []*viewport.Model{&m.viewportOurs, &m.viewportResult, &m.viewportTheirs} {
+		vp.Width = paneWidth
+		vp.Height = contentHeight
+	}
+	m.viewportResult.Width = max(paneWidth-minimapWidth, 1)
+	m.viewportUnified.Width = unifiedWidth
+	m.viewportUnified.Height = contentHeight
+}
+
+// toggleLayout switches between the three panes and the unified layout.
+func (m *model) toggleLayout() tea.Cmd {
+	if m.layout == layoutUnified {
+		m.layout = layoutPanes
+	} else {
+		m.layout = layoutUnified
+	}
+	if m.ready {
+		m.sizeViewports()
+	}
+	m.pendingScroll = true
+	m.updateViewports()
+	return m.showToast("Layout: "+m.layout.String(), 2)
+}
+
+// toggleSwap swaps which side the left and right panes show.
+func (m *model) toggleSwap() tea.Cmd {
+	m.swapped = !m.swapped
+	m.updateViewports()
+	if m.swapped {
+		return m.showToast("Sides: theirs left, ours right", 2)
+	}
+	return m.showToast("Sides: ours left, theirs right", 2)
+}
+
+// unifiedNumberMode is the line number mode of the unified layout, which
+// mixes the lines of both sides and so numbers rows by position rather
+// than by file line.
+func (m *model) unifiedNumberMode() lineNumberMode {
+	if m.lineNumberMode == lineNumbersFile {
+		return lineNumbersPosition
+	}
+	return m.lineNumberMode
+}
+
+// paneDimensions returns the width and height of each of the three panes on
+// a width x height terminal, never below 1 so the viewports stay valid, and
+// whether the terminal is large enough to show the panes at all.
+func paneDimensions(width, height int) (int, int, bool) {
+	paneWidth := (width - paneChromeWidth) / 3
+	contentHeight := height - paneChromeHeight
+	fits := paneWidth >= minPaneWidth && contentHeight >= minContentHeight
+	return max(paneWidth, 1), max(contentHeight, 1), fits
+}
+
+// recenter centers the current conflict in all three panes using the
+// anchors from the last updateViewports, without rebuilding their content.
+func (m *model) recenter() {
+	ensureVisible(&m.viewportOurs, m.oursAnchor.start, m.oursAnchor.total, m.scrollAnchor)
+	ensureVisible(&m.viewportResult, m.resultAnchor.start, m.resultAnchor.total, m.scrollAnchor)
+	ensureVisible(&m.viewportTheirs, m.theirsAnchor.start, m.theirsAnchor.total, m.scrollAnchor)
+	ensureVisible(&m.viewportUnified, m.unifiedAnchor.start, m.unifiedAnchor.total, m.scrollAnchor)
+}
+
+// displayLines expands the tabs of lines to the tab width, marking them and
+// trailing spaces when whitespace is shown, so wrapping and horizontal
+// scrolling count the cells the terminal draws.
+func (m *model) displayLines(lines []lineInfo) []lineInfo {
+	if m.showWhitespace {
+		return showWhitespaceMarkers(lines, m.tabWidth())
+	}
+	return expandLineTabs(lines, m.tabWidth())
+}
+
+// tabWidth returns the columns between tab stops, defaulting to
+// defaultTabWidth.
+func (m *model) tabWidth() int {
+	if m.opts.TabWidth > 0 {
+		return m.opts.TabWidth
+	}
+	return defaultTabWidth
+}
+
+// wrapWidth returns the width pane content should wrap to, or 0 when
+// wrapping is off.
+func (m *model) wrapWidth(viewportModel viewport.Model) int {
+	if !m.wrap {
+		return 0
+	}
+	return viewportModel.Width
+}
+
+func (m *model) toggleWrap() {
+	m.wrap = !m.wrap
+	if m.wrap {
+		m.viewportOurs.SetXOffset(0)
+		m.viewportResult.SetXOffset(0)
+		m.viewportTheirs.SetXOffset(0)
+		m.viewportUnified.SetXOffset(0)
+	}
+	m.pendingScroll = true
+	m.updateViewports()
+}
+
+// toggleAlign switches between scrolling each pane independently and keeping
+// lines that share a base line on the same row across all three panes.
+func (m *model) toggleAlign() tea.Cmd {
+	m.alignPanes = !m.alignPanes
+	m.pendingScroll = true
+	m.updateViewports()
+	if m.alignPanes && !m.useFullDiff {
+		return m.showToast("Alignment needs a base; panes stay independent", 2)
+	}
+	return nil
+}
+
+// cycleLineNumbers steps the gutters through file line numbers, pane
+// positions and no numbers.
+func (m *model) cycleLineNumbers() tea.Cmd {
+	m.lineNumberMode = (m.lineNumberMode + 1) % (lineNumbersOff + 1)
+	m.pendingScroll = true
+	m.updateViewports()
+	return m.showToast("Line numbers: "+m.lineNumberMode.String(), 2)
+}
+
+func ensureVisible(viewportModel *viewport.Model, start int, total int, anchor scrollAnchor) {
 	if viewportModel.Height <= 0 {
 		return
 	}
@@ -1046,35 +2715,36 @@ func ensureVisible(viewportModel *viewport.Model, start int, total int) {
 		maxOffset = 0
 	}
 
-	centerOffset := start - (viewportModel.Height / 2)
-	if centerOffset < 0 {
-		centerOffset = 0
+	var offset int
+	switch anchor {
+	case scrollAnchorTop:
+		offset = start
+	case scrollAnchorThird:
+		offset = start - (viewportModel.Height / 3)
+	default:
+		offset = start - (viewportModel.Height / 2)
 	}
-	if centerOffset > maxOffset {
-		centerOffset = maxOffset
+	if offset < 0 {
+		offset = 0
 	}
-	viewportModel.YOffset = centerOffset
+	if offset > maxOffset {
+		offset = maxOffset
+	}
+	viewportModel.YOffset = offset
 }
 
 func (m *model) scrollToTop() {
 	m.viewportOurs.GotoTop()
 	m.viewportResult.GotoTop()
 	m.viewportTheirs.GotoTop()
-}
-
-func (m *model) scrollToSelectedHunkStart() {
-	if m.currentConflict >= len(m.doc.Conflicts) {
-		m.pendingScroll = false
-		return
-	}
-	m.pendingScroll = true
-	m.updateViewports()
+	m.viewportUnified.GotoTop()
 }
 
 func (m *model) scrollToBottom() {
 	m.viewportOurs.GotoBottom()
 	m.viewportResult.GotoBottom()
 	m.viewportTheirs.GotoBottom()
+	m.viewportUnified.GotoBottom()
 }
 
 func (m *model) scrollHorizontal(delta int) {
@@ -1090,6 +2760,7 @@ func (m *model) scrollHorizontal(delta int) {
 	apply(&m.viewportOurs)
 	apply(&m.viewportResult)
 	apply(&m.viewportTheirs)
+	apply(&m.viewportUnified)
 }
 
 func (m *model) halfPageScrollDelta() int {
@@ -1114,45 +2785,134 @@ func (m *model) scrollVertical(delta int) {
 	apply(&m.viewportOurs)
 	apply(&m.viewportResult)
 	apply(&m.viewportTheirs)
+	apply(&m.viewportUnified)
 }
 
-func (m *model) writeResolved() error {
+// resolutionResult counts how each conflict is currently resolved.
+func (m *model) resolutionResult() Result {
+	doc := m.state.Document()
+	manual := m.state.ManualResolved()
+	result := Result{Path: m.opts.MergedPath, Written: true, Conflicts: len(doc.Conflicts)}
+	for i, ref := range doc.Conflicts {
+		if _, ok := manual[i]; ok {
+			result.Manual++
+			continue
+		}
+		seg, ok := doc.Segments[ref.SegmentIndex].(markers.ConflictSegment)
+		if !ok {
+			continue
+		}
+		switch seg.Resolution {
+		case markers.ResolutionOurs:
+			result.Ours++
+		case markers.ResolutionTheirs:
+			result.Theirs++
+		case markers.ResolutionBoth, markers.ResolutionBothDedup:
+			result.Both++
+		case markers.ResolutionNone:
+			result.None++
+		default:
+			result.Unresolved++
+		}
+	}
+	return result
+}
+
+// resolvedOutput returns the bytes a write would put on disk: the rendered
+// document with the line-ending, final-newline and encoding options applied.
+func (m *model) resolvedOutput() ([]byte, error) {
 	resolved := m.state.RenderMerged()
+	if m.opts.NormalizeEOL != "" {
+		resolved = markers.NormalizeLineEndings(resolved, markers.LineEndingFor(m.opts.NormalizeEOL))
+	}
+	if m.opts.NormalizeEOF && !m.state.HasUnresolvedConflicts() && m.opts.LocalPath != "" {
+		var err error
+		resolved, err = engine.NormalizeFinalNewlineFromFiles(resolved, m.opts.LocalPath, m.opts.RemotePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resolved, err := charset.Encode(m.opts.Encoding, resolved)
+	if err != nil {
+		return nil, fmt.Errorf("encode merged: %w", err)
+	}
+	return resolved, nil
+}
+
+// writeResolved writes the result to $MERGED, after the backup when enabled,
+// and returns how many conflicts the written file still has.
+// It writes nothing when checkMergedStamp fails.
+func (m *model) writeResolved() (int, error) {
 	allowUnresolved := m.state.HasUnresolvedConflicts()
+	resolved, err := m.resolvedOutput()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.checkMergedStamp(); err != nil {
+		return 0, err
+	}
 
 	// Read original merged file for backup
 	mergedBytes, err := os.ReadFile(m.opts.MergedPath)
 	if err != nil {
-		return fmt.Errorf("read merged for backup: %w", err)
+		return 0, fmt.Errorf("read merged for backup: %w", err)
 	}
 
 	// Write backup if enabled
-	if m.opts.Backup {
-		bak := m.opts.MergedPath + ".ec.bak"
-		if err := os.WriteFile(bak, mergedBytes, 0o644); err != nil {
-			return fmt.Errorf("write backup %s: %w", filepath.Base(bak), err)
-		}
+	if err := engine.WriteBackup(m.opts.MergedPath, mergedBytes, m.opts); err != nil {
+		return 0, err
 	}
 
 	// Write resolved file
 	if err := os.WriteFile(m.opts.MergedPath, resolved, 0o644); err != nil {
-		return fmt.Errorf("write merged: %w", err)
+		return 0, fmt.Errorf("write merged: %w", err)
 	}
+	m.recordMergedStamp()
 
-	// Verify no conflict markers remain
-	if !allowUnresolved {
-		postDoc, err := markers.Parse(resolved)
-		if err != nil {
-			return fmt.Errorf("post-parse merged: %w", err)
-		}
-		if len(postDoc.Conflicts) != 0 {
-			return fmt.Errorf("resolution output still contains conflict markers")
+	m.result = m.resolutionResult()
+
+	// Count the conflicts left in the written file; none may remain unless
+	// some were left unresolved on purpose.
+	postDoc, err := markers.Parse(resolved)
+	if err != nil {
+		if !allowUnresolved {
+			return 0, fmt.Errorf("post-parse merged: %w", err)
 		}
+		return m.result.Unresolved, nil
+	}
+	if !allowUnresolved && len(postDoc.Conflicts) != 0 {
+		return 0, fmt.Errorf("resolution output still contains conflict markers")
 	}
 
+	return len(postDoc.Conflicts), nil
+}
+
+// checkMergedStamp returns errMergedChanged when $MERGED no longer matches
+// mergedStamp, so another program changed it since the resolver read or
+// wrote it. --force skips the check.
+func (m *model) checkMergedStamp() error {
+	if m.opts.Force || m.mergedStamp.modTime.IsZero() {
+		return nil
+	}
+	stamp, err := statFile(m.opts.MergedPath)
+	if err != nil {
+		return fmt.Errorf("stat merged: %w", err)
+	}
+	if !stamp.modTime.Equal(m.mergedStamp.modTime) || stamp.size != m.mergedStamp.size {
+		return errMergedChanged
+	}
 	return nil
 }
 
+// recordMergedStamp takes $MERGED as it is on disk now as the version the
+// resolver knows, after ec itself wrote or read it.
+func (m *model) recordMergedStamp() {
+	if stamp, err := statFile(m.opts.MergedPath); err == nil {
+		m.mergedStamp = stamp
+	}
+}
+
 func allResolved(doc markers.Document, manualResolved map[int][]byte) bool {
 	for idx, ref := range doc.Conflicts {
 		if _, ok := manualResolved[idx]; ok {
@@ -1198,6 +2958,23 @@ func renderPaneTitle(title string, paneWidth int, style lipgloss.Style) string {
 	return style.Render(trimmed)
 }
 
+// renderPaneTitleWithPosition renders a pane title followed by the pane's
+// scroll position, keeping the line within the viewport width.
+func renderPaneTitleWithPosition(title string, vp viewport.Model, style lipgloss.Style) string {
+	position := panePosition(vp)
+	return renderPaneTitle(title, vp.Width-lipgloss.Width(position), style) + position
+}
+
+// panePosition returns a dim "[34%]" scroll indicator for vp, or "" when the
+// whole content fits or the pane is too narrow to spare the room.
+func panePosition(vp viewport.Model) string {
+	const minPaneWidth = 20
+	if vp.Width < minPaneWidth || vp.TotalLineCount() <= vp.Height {
+		return ""
+	}
+	return panePositionStyle.Render(fmt.Sprintf(" [%d%%]", int(vp.ScrollPercent()*100+0.5)))
+}
+
 func renderResultPaneTitle(statusText string, paneWidth int, titleStyle lipgloss.Style, statusStyle lipgloss.Style) string {
 	const prefix = "RESULT "
 	statusSegment := "(" + statusText + ")"
@@ -1311,59 +3088,80 @@ func isHexByte(b byte) bool {
 	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
 }
 
-func resolverSnapshotsEqual(left resolverSnapshot, right resolverSnapshot) bool {
-	if left.state == nil || right.state == nil {
-		return left.state == nil && right.state == nil
-	}
-	leftLabels, leftKnown := left.state.MergedLabels()
-	rightLabels, rightKnown := right.state.MergedLabels()
-	if len(leftLabels) != len(rightLabels) || len(leftKnown) != len(rightKnown) {
-		return false
-	}
-	for i := range leftLabels {
-		if leftLabels[i] != rightLabels[i] || leftKnown[i] != rightKnown[i] {
-			return false
-		}
+// applyResolverMutation runs mutator as one undoable step described by label
+// in the history panel.
+func (m *model) applyResolverMutation(label string, mutator func() error) error {
+	if err := m.state.Do(label, mutator); err != nil {
+		return err
 	}
-	return markers.DocumentsEqual(left.state.Document(), right.state.Document()) && bytes.Equal(left.state.RenderMerged(), right.state.RenderMerged())
+	m.updateViewports()
+	return nil
 }
 
-func (m *model) captureResolverSnapshot() resolverSnapshot {
-	return resolverSnapshot{
-		state: m.state.Clone(),
-	}
+func (m model) undoDepth() int {
+	return m.state.UndoDepth()
 }
 
-func (m *model) restoreResolverSnapshot(snapshot resolverSnapshot) {
-	m.state = snapshot.state.Clone()
-	m.refreshResolverCaches()
+func (m model) redoDepth() int {
+	return m.state.RedoDepth()
 }
 
-func (m *model) pushResolverUndo(snapshot resolverSnapshot) {
-	m.resolverUndo = append(m.resolverUndo, snapshot)
-	if len(m.resolverUndo) > maxUndoSize {
-		m.resolverUndo = m.resolverUndo[1:]
-	}
+func (m model) canUndo() bool {
+	return m.state.CanUndo()
 }
 
-func (m *model) applyResolverMutation(mutator func() error) error {
-	before := m.captureResolverSnapshot()
-	if err := mutator(); err != nil {
-		return err
-	}
-	after := m.captureResolverSnapshot()
-	if !resolverSnapshotsEqual(before, after) {
-		m.pushResolverUndo(before)
-		m.resolverRedo = nil
-	}
-	m.updateViewports()
-	return nil
+func (m model) canRedo() bool {
+	return m.state.CanRedo()
 }
 
-func (m model) undoDepth() int {
-	return len(m.resolverUndo)
+func conflictHistoryLabel(conflictIndex int, action string) string {
+	return fmt.Sprintf("conflict %d: %s", conflictIndex+1, action)
 }
 
-func (m model) redoDepth() int {
-	return len(m.resolverRedo)
+// history lists the undoable steps oldest first followed by the redoable
+// ones, and returns how many of them are applied: entries before current
+// are in effect, entries from current on were undone.
+func (m model) history() (entries []string, current int) {
+	return m.state.History()
+}
+
+// renderHistoryPanel draws the undo history in a pane the size of vp. The
+// last applied step is marked with ">" and undone steps are dimmed; the list
+// scrolls to keep the marked step in view.
+func (m model) renderHistoryPanel(vp viewport.Model) string {
+	entries, current := m.history()
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, "(start)")
+	lines = append(lines, entries...)
+
+	height := max(vp.Height, 1)
+	start := 0
+	if len(lines) > height {
+		start = min(max(current-height/2, 0), len(lines)-height)
+	}
+	end := min(start+height, len(lines))
+
+	rendered := make([]string, 0, height)
+	for i := start; i < end; i++ {
+		prefix := "  "
+		if i == current {
+			prefix = "> "
+		}
+		line := truncateDisplayWidth(prefix+lines[i], vp.Width)
+		switch {
+		case i == current:
+			line = lipgloss.NewStyle().Bold(true).Render(line)
+		case i > current:
+			line = panePositionStyle.Render(line)
+		}
+		rendered = append(rendered, line)
+	}
+	for len(rendered) < height {
+		rendered = append(rendered, "")
+	}
+
+	return paneStyle.Render(
+		renderPaneTitle("HISTORY", vp.Width, titleStyle) + "\n" +
+			lipgloss.NewStyle().Width(vp.Width).Render(strings.Join(rendered, "\n")),
+	)
 }
@@ -265,7 +265,7 @@ func TestReloadFromFilePreservesManualResolution(t *testing.T) {
 		doc:   doc,
 	}
 
-	if err := m.reloadFromFile(); err != nil {
+	if err := m.reloadFromFile("edit in editor"); err != nil {
 		t.Fatalf("reloadFromFile error = %v", err)
 	}
 
@@ -585,6 +585,29 @@ func TestLoadResolverDocumentStateFallsBackForMixedResolvedMergedFile(t *testing
 
 }
 
+func TestLoadResolverDocumentStateMergedOnlyUsesMergedMarkers(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	mergedContent := "start\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nend\n"
+	if err := os.WriteFile(mergedPath, []byte(mergedContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadResolverDocumentState(context.Background(), cli.Options{MergedPath: mergedPath, AllowMissingBase: true})
+	if err != nil {
+		t.Fatalf("loadResolverDocumentState error = %v", err)
+	}
+	if len(state.doc.Conflicts) != 1 {
+		t.Fatalf("conflicts = %d, want 1", len(state.doc.Conflicts))
+	}
+	seg := conflictSegment(t, state.doc, 0)
+	if string(seg.Ours) != "ours\n" || string(seg.Theirs) != "theirs\n" || len(seg.Base) != 0 {
+		t.Fatalf("conflict = %+v, want two-way ours/theirs", seg)
+	}
+	if seg.Resolution != markers.ResolutionUnset {
+		t.Fatalf("resolution = %q, want unset", seg.Resolution)
+	}
+}
+
 func TestInitialLoadRenderUsesModelOwnedMergeState(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration-style test in short mode")
@@ -722,7 +745,7 @@ func TestReloadFromFileKeepsCanonicalConflictStructureWithMergedMarkers(t *testi
 		doc:   canonicalDoc,
 	}
 
-	if err := m.reloadFromFile(); err != nil {
+	if err := m.reloadFromFile("edit in editor"); err != nil {
 		t.Fatalf("reloadFromFile error = %v", err)
 	}
 
@@ -833,7 +856,7 @@ func TestReloadFromFileKeepsExistingUndoHistory(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := m.reloadFromFile(); err != nil {
+	if err := m.reloadFromFile("edit in editor"); err != nil {
 		t.Fatalf("reloadFromFile error = %v", err)
 	}
 
@@ -843,6 +866,9 @@ func TestReloadFromFileKeepsExistingUndoHistory(t *testing.T) {
 	if got := m.redoDepth(); got != 0 {
 		t.Fatalf("redo depth after manual reload = %d, want 0", got)
 	}
+	if !m.canUndo() || m.canRedo() {
+		t.Fatalf("canUndo = %v, canRedo = %v after manual reload, want true, false", m.canUndo(), m.canRedo())
+	}
 }
 
 func TestReloadFromFileAllowsTwoWayMergedConflictWhenCanonicalBaseLabelExists(t *testing.T) {
@@ -888,7 +914,7 @@ func TestReloadFromFileAllowsTwoWayMergedConflictWhenCanonicalBaseLabelExists(t
 		doc:   doc,
 	}
 
-	if err := m.reloadFromFile(); err != nil {
+	if err := m.reloadFromFile("edit in editor"); err != nil {
 		t.Fatalf("reloadFromFile error = %v", err)
 	}
 	seg := conflictSegment(t, m.doc, 0)
@@ -906,6 +932,43 @@ func TestReloadFromFileAllowsTwoWayMergedConflictWhenCanonicalBaseLabelExists(t
 	}
 }
 
+func TestEditorFinishedReportsConflictCountChange(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	edited := "start\nours1\nmid\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nend\n"
+	if err := os.WriteFile(mergedPath, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cli.Options{MergedPath: mergedPath, AllowMissingBase: true}
+
+	updated, _ := m.Update(editorFinishedMsg{})
+	m = updated.(model)
+	if m.quitting {
+		t.Fatalf("model quit after a successful reload: %v", m.err)
+	}
+	if m.toastMessage != "Unresolved conflicts: 2 → 1 after edit" {
+		t.Fatalf("toastMessage = %q", m.toastMessage)
+	}
+}
+
+func TestEditorFinishedKeepsStateWhenReloadFails(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cli.Options{MergedPath: filepath.Join(t.TempDir(), "missing.txt"), AllowMissingBase: true}
+	before := m.state
+
+	updated, _ := m.Update(editorFinishedMsg{})
+	m = updated.(model)
+	if m.quitting || m.err != nil {
+		t.Fatalf("quitting = %v, err = %v; want the resolver to stay open", m.quitting, m.err)
+	}
+	if !strings.HasPrefix(m.toastMessage, "Reload after editor failed, kept previous state:") {
+		t.Fatalf("toastMessage = %q", m.toastMessage)
+	}
+	if m.state != before {
+		t.Fatalf("state replaced after a failed reload")
+	}
+}
+
 func TestModelInitReturnsNil(t *testing.T) {
 	if cmd := (model{}).Init(); cmd != nil {
 		t.Fatalf("Init() = %v, want nil", cmd)
@@ -927,7 +990,7 @@ func TestRunReturnsThemeLoadError(t *testing.T) {
 		t.Fatalf("WriteFile error = %v", err)
 	}
 
-	if err := Run(context.Background(), cli.Options{}); err == nil {
+	if _, err := Run(context.Background(), cli.Options{}); err == nil {
 		t.Fatal("Run() error = nil, want error")
 	}
 }
@@ -995,6 +1058,29 @@ func TestRenderResultPaneTitleKeepsStatusWhenWide(t *testing.T) {
 	}
 }
 
+func TestRenderPaneTitleWithPositionShowsScrollPercent(t *testing.T) {
+	vp := viewport.New(30, 5)
+	vp.SetContent(strings.Repeat("line\n", 19) + "line")
+
+	got := renderPaneTitleWithPosition("OURS (a-very-long-branch-name)", vp, titleStyle)
+	if lipgloss.Width(got) > vp.Width {
+		t.Fatalf("title width = %d, want <= %d", lipgloss.Width(got), vp.Width)
+	}
+	if !strings.Contains(got, "[0%]") {
+		t.Fatalf("expected top position indicator, got %q", got)
+	}
+
+	vp.GotoBottom()
+	if got := renderPaneTitleWithPosition("OURS", vp, titleStyle); !strings.Contains(got, "[100%]") {
+		t.Fatalf("expected bottom position indicator, got %q", got)
+	}
+
+	vp.SetContent("short")
+	if got := panePosition(vp); got != "" {
+		t.Fatalf("panePosition for fitting content = %q, want empty", got)
+	}
+}
+
 func TestFirstHexRun(t *testing.T) {
 	start, end := firstHexRun("x1234567y")
 	if start != 1 || end != 8 {
@@ -1054,6 +1140,44 @@ func TestModelViewQuittingStates(t *testing.T) {
 		if !strings.Contains(m.View(), tc.want) {
 			t.Fatalf("%s: expected %q in view", tc.name, tc.want)
 		}
+		m.opts.NoAltScreen = true
+		if view := m.View(); view != "" {
+			t.Fatalf("%s: inline view = %q, want empty", tc.name, view)
+		}
+	}
+}
+
+func TestWindowSizeTooSmall(t *testing.T) {
+	for _, size := range []tea.WindowSizeMsg{{Width: 0, Height: 0}, {Width: 5, Height: 3}, {Width: 30, Height: 40}, {Width: 120, Height: 10}} {
+		m := newModelForDoc(t, parseMultiConflictDoc(t))
+		m.ready = false
+		m.opts = cliOptionsWithMergedPath("merged.txt")
+		updated, _ := m.Update(size)
+		m = updated.(model)
+		for _, viewportModel := range []viewport.Model{m.viewportOurs, m.viewportResult, m.viewportTheirs} {
+			if viewportModel.Width < 1 || viewportModel.Height < 1 {
+				t.Fatalf("%dx%d: viewport size = %dx%d, want at least 1x1", size.Width, size.Height, viewportModel.Width, viewportModel.Height)
+			}
+		}
+		if view := m.View(); !strings.Contains(view, "Terminal too small") {
+			t.Fatalf("%dx%d: View() = %q, want too-small message", size.Width, size.Height, view)
+		}
+	}
+}
+
+func TestWindowSizeRecoversFromTooSmall(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cliOptionsWithMergedPath("merged.txt")
+	m.ready = true
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 10, Height: 5})
+	m = updated.(model)
+	updated, _ = m.Update(tea.WindowSizeMsg{Width: minTerminalWidth, Height: minTerminalHeight})
+	m = updated.(model)
+	if view := m.View(); strings.Contains(view, "Terminal too small") {
+		t.Fatalf("View() still too small at %dx%d", minTerminalWidth, minTerminalHeight)
+	}
+	if m.viewportOurs.Width != minPaneWidth || m.viewportOurs.Height != minContentHeight {
+		t.Fatalf("viewport size = %dx%d, want %dx%d", m.viewportOurs.Width, m.viewportOurs.Height, minPaneWidth, minContentHeight)
 	}
 }
 
@@ -1196,6 +1320,65 @@ func TestModelViewNoLabelsWithoutMergedLabels(t *testing.T) {
 	}
 }
 
+func TestModelViewMinibarFollowsResolutionState(t *testing.T) {
+	newViewModel := func(doc markers.Document) model {
+		m := newModelForDoc(t, doc)
+		m.ready = true
+		m.opts = cliOptionsWithMergedPath("merged.txt")
+		m.width = 200
+		m.height = 20
+		m.updateViewports()
+		return m
+	}
+
+	unresolved := newViewModel(parseSingleConflictDoc(t)).View()
+	if !strings.Contains(unresolved, "h/l: pick side") {
+		t.Fatalf("expected resolution keys in unresolved minibar, got:\n%s", unresolved)
+	}
+	if strings.Contains(unresolved, "w: write") {
+		t.Fatalf("unresolved minibar should not offer write, got:\n%s", unresolved)
+	}
+
+	resolvedDoc := parseSingleConflictDoc(t)
+	seg := resolvedDoc.Segments[resolvedDoc.Conflicts[0].SegmentIndex].(markers.ConflictSegment)
+	seg.Resolution = markers.ResolutionOurs
+	resolvedDoc.Segments[resolvedDoc.Conflicts[0].SegmentIndex] = seg
+	resolvedModel := newViewModel(resolvedDoc)
+	resolved := resolvedModel.View()
+	if resolved == unresolved {
+		t.Fatalf("expected minibar to differ once all conflicts are resolved")
+	}
+	if !strings.Contains(resolved, "All conflicts resolved - w/ctrl+s: write") {
+		t.Fatalf("expected write hint in resolved minibar, got:\n%s", resolved)
+	}
+
+	updated, _ := resolvedModel.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'?'}})
+	help := updated.(model).View()
+	if !strings.Contains(help, "?: hide help") {
+		t.Fatalf("expected full key help after ?, got:\n%s", help)
+	}
+}
+
+func TestModelViewWarnsOnMixedLineEndings(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.ready = true
+	m.opts = cliOptionsWithMergedPath("merged.txt")
+	m.width = 200
+	m.height = 20
+	m.lineEndings = markers.LineEndings{LF: 3, CRLF: 1}
+	m.updateViewports()
+
+	if view := m.View(); !strings.Contains(view, "mixed line endings (3 LF, 1 CRLF, 0 CR)") {
+		t.Fatalf("expected mixed line ending warning in header, got:\n%s", view)
+	}
+
+	m.opts.NormalizeEOL = "lf"
+	if view := m.View(); strings.Contains(view, "mixed line endings") {
+		t.Fatalf("expected no warning when --normalize-eol is set, got:\n%s", view)
+	}
+}
+
 func TestRenderToastLine(t *testing.T) {
 	m := model{width: 20, toastMessage: "Saved"}
 	if !strings.Contains(m.renderToastLine(), "Saved") {
@@ -1256,6 +1439,49 @@ func TestUpdateApplyAndUndo(t *testing.T) {
 	}
 }
 
+func TestUpdateHistoryListsUndoAndRedoSteps(t *testing.T) {
+	doc := parseMultiConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.viewportTheirs.Width = 30
+	m.ready = true
+
+	keys := []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune{'o'}},
+		{Type: tea.KeyRunes, Runes: []rune{'n'}},
+		{Type: tea.KeyRunes, Runes: []rune{'t'}},
+		{Type: tea.KeyRunes, Runes: []rune{'T'}},
+		{Type: tea.KeyRunes, Runes: []rune{'u'}},
+		{Type: tea.KeyRunes, Runes: []rune{'Y'}},
+	}
+	var updated tea.Model = m
+	for _, key := range keys {
+		updated, _ = updated.(model).Update(key)
+	}
+	result := updated.(model)
+
+	entries, current := result.history()
+	want := []string{"conflict 1: ours", "conflict 2: theirs", "apply-all: theirs"}
+	if strings.Join(entries, "|") != strings.Join(want, "|") {
+		t.Fatalf("history = %q, want %q", entries, want)
+	}
+	if current != 2 {
+		t.Fatalf("history current = %d, want 2 after one undo", current)
+	}
+
+	if !result.showHistory {
+		t.Fatalf("showHistory = false, want true after Y")
+	}
+	panel := result.renderHistoryPanel(result.viewportTheirs)
+	if !strings.Contains(panel, "> conflict 2: theirs") {
+		t.Fatalf("history panel = %q, want current step marked", panel)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	if _, current := updated.(model).history(); current != 3 {
+		t.Fatalf("history current = %d, want 3 after redo", current)
+	}
+}
+
 func TestUpdateApplyUsesResolverUndo(t *testing.T) {
 	doc := parseSingleConflictDoc(t)
 	m := newModelForDoc(t, doc)
@@ -1350,6 +1576,261 @@ func TestUpdateAcceptSelectionWithSpace(t *testing.T) {
 	}
 }
 
+func TestUpdateAcceptAndAdvance(t *testing.T) {
+	doc := parseMultiConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.selectedSide = selectedTheirs
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	result := updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionTheirs {
+		t.Fatalf("resolution = %q, want theirs", got)
+	}
+	if result.currentConflict != 1 {
+		t.Fatalf("currentConflict = %d, want 1", result.currentConflict)
+	}
+
+	updated, cmd := result.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	result = updated.(model)
+	if got := conflictResolution(t, result.doc, 1); got != markers.ResolutionTheirs {
+		t.Fatalf("resolution = %q, want theirs", got)
+	}
+	if result.currentConflict != 1 {
+		t.Fatalf("currentConflict = %d, want to stay on last conflict", result.currentConflict)
+	}
+	if cmd == nil || !strings.Contains(result.toastMessage, "w to write") {
+		t.Fatalf("toastMessage = %q, want write hint", result.toastMessage)
+	}
+}
+
+func TestUpdateCycleResolution(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.manualResolved = map[int][]byte{0: []byte("manual\n")}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	result := updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionOurs {
+		t.Fatalf("resolution = %q, want ours", got)
+	}
+	if len(result.manualResolved) != 0 {
+		t.Fatalf("manualResolved len = %d, want 0", len(result.manualResolved))
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	result = updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionTheirs {
+		t.Fatalf("resolution = %q, want theirs", got)
+	}
+	if result.undoDepth() != 2 {
+		t.Fatalf("undoDepth = %d, want 2", result.undoDepth())
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'u'}})
+	result = updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionOurs {
+		t.Fatalf("resolution after undo = %q, want ours", got)
+	}
+}
+
+func TestUpdateMouseClickSelectsSide(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.ready = true
+
+	// Each 10-column viewport is drawn 14 columns wide with border and padding.
+	click := tea.MouseMsg{X: 30, Y: 2, Action: tea.MouseActionPress, Button: tea.MouseButtonLeft}
+	updated, _ := m.Update(click)
+	result := updated.(model)
+	if result.selectedSide != selectedTheirs {
+		t.Fatalf("selectedSide = %v, want theirs after clicking THEIRS", result.selectedSide)
+	}
+
+	click.X = 15
+	updated, _ = result.Update(click)
+	result = updated.(model)
+	if result.selectedSide != selectedTheirs {
+		t.Fatalf("selectedSide = %v, clicking the result pane should not change it", result.selectedSide)
+	}
+
+	click.X = 3
+	updated, _ = result.Update(click)
+	result = updated.(model)
+	if result.selectedSide != selectedOurs {
+		t.Fatalf("selectedSide = %v, want ours after clicking OURS", result.selectedSide)
+	}
+}
+
+func TestUpdateMouseClickOnMinimapJumpsToConflict(t *testing.T) {
+	var data strings.Builder
+	for i := 0; i < 3; i++ {
+		data.WriteString(strings.Repeat("text\n", 15))
+		data.WriteString("<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n")
+	}
+	doc, err := markers.Parse([]byte(data.String()))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 24})
+	m = updated.(model)
+
+	// The last conflict is the lowest dot of the minimap.
+	x, y := -1, -1
+	for row, line := range strings.Split(m.View(), "\n") {
+		if i := strings.LastIndex(line, "●"); i >= 0 {
+			x, y = lipgloss.Width(line[:i]), row
+		}
+	}
+	if x < 0 {
+		t.Fatalf("no conflict dot in the minimap:\n%s", m.View())
+	}
+	updated, _ = m.Update(tea.MouseMsg{X: x, Y: y, Action: tea.MouseActionPress, Button: tea.MouseButtonLeft})
+	m = updated.(model)
+	if m.currentConflict != 2 {
+		t.Fatalf("currentConflict = %d, want 2 after clicking its dot", m.currentConflict)
+	}
+}
+
+func TestUpdateMouseWheelScrollsPaneUnderCursor(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.ready = true
+	content := strings.Repeat("line\n", 20)
+	m.viewportOurs.SetContent(content)
+	m.viewportResult.SetContent(content)
+	m.viewportTheirs.SetContent(content)
+
+	wheel := tea.MouseMsg{X: 20, Y: 3, Action: tea.MouseActionPress, Button: tea.MouseButtonWheelDown}
+	updated, _ := m.Update(wheel)
+	result := updated.(model)
+	if result.viewportResult.YOffset == 0 {
+		t.Fatalf("result YOffset = 0, want wheel to scroll the result pane")
+	}
+	if result.viewportOurs.YOffset != 0 || result.viewportTheirs.YOffset != 0 {
+		t.Fatalf("ours/theirs YOffset = %d/%d, want other panes untouched", result.viewportOurs.YOffset, result.viewportTheirs.YOffset)
+	}
+
+	wheel.Y = 0
+	updated, _ = result.Update(wheel)
+	if got := updated.(model).viewportResult.YOffset; got != result.viewportResult.YOffset {
+		t.Fatalf("result YOffset = %d, want header wheel ignored", got)
+	}
+}
+
+func TestUpdateViewBaseWithoutBaseShowsToast(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.opts.AllowMissingBase = true
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'v'}})
+	result := updated.(model)
+	if result.toastMessage != "No base file for this conflict" {
+		t.Fatalf("toastMessage = %q, want missing base toast", result.toastMessage)
+	}
+	if cmd == nil {
+		t.Fatalf("expected toast expiry command")
+	}
+
+	m.opts.AllowMissingBase = false
+	m.opts.BasePath = filepath.Join(t.TempDir(), "missing")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'v'}})
+	if got := updated.(model).toastMessage; !strings.HasPrefix(got, "Cannot open base:") {
+		t.Fatalf("toastMessage = %q, want open failure toast", got)
+	}
+}
+
+func TestCollapseIdenticalAddsKeepsSingleCopy(t *testing.T) {
+	data := []byte("start\n<<<<<<< HEAD\nadded\n||||||| base\n=======\nadded\n>>>>>>> branch\nend\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+
+	if err := m.collapseIdenticalAdds(); err != nil {
+		t.Fatalf("collapseIdenticalAdds error = %v", err)
+	}
+	if got := string(m.state.RenderMerged()); got != "start\nadded\nend\n" {
+		t.Fatalf("RenderMerged = %q, want single copy", got)
+	}
+	if !strings.Contains(m.toastMessage, "Collapsed 1") {
+		t.Fatalf("toastMessage = %q, want collapse notice", m.toastMessage)
+	}
+	if m.Init() == nil {
+		t.Fatalf("expected Init to schedule toast expiry")
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'u'}})
+	result := updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionUnset {
+		t.Fatalf("resolution after undo = %q, want unset", got)
+	}
+}
+
+func TestCollapseIdenticalAddsIgnoresDifferingSides(t *testing.T) {
+	data := []byte("<<<<<<< HEAD\nours\n||||||| base\n=======\ntheirs\n>>>>>>> branch\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	if err := m.collapseIdenticalAdds(); err != nil {
+		t.Fatalf("collapseIdenticalAdds error = %v", err)
+	}
+	if got := conflictResolution(t, m.doc, 0); got != markers.ResolutionUnset {
+		t.Fatalf("resolution = %q, want unset", got)
+	}
+	if m.undoDepth() != 0 || m.toastMessage != "" {
+		t.Fatalf("expected no mutation for differing sides")
+	}
+}
+
+func TestIgnoreWhitespaceToggle(t *testing.T) {
+	data := []byte("<<<<<<< HEAD\n\tfoo() \n||||||| base\nbar()\n=======\n    foo()\n>>>>>>> branch\nmid\n<<<<<<< HEAD\nours\n||||||| base\nbase\n=======\ntheirs\n>>>>>>> branch\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	m.opts.WhitespaceSide = "theirs"
+
+	press := func(m model, keys ...rune) model {
+		for _, r := range keys {
+			updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			m = updated.(model)
+		}
+		return m
+	}
+
+	m = press(m, 'z', 'i')
+	if !m.ignoreWhitespace {
+		t.Fatalf("ignoreWhitespace = false after zi")
+	}
+	if got := conflictResolution(t, m.doc, 0); got != markers.ResolutionTheirs {
+		t.Fatalf("whitespace-only conflict resolution = %q, want theirs", got)
+	}
+	if got := conflictResolution(t, m.doc, 1); got != markers.ResolutionUnset {
+		t.Fatalf("other conflict resolution = %q, want unset", got)
+	}
+	if !strings.HasPrefix(string(m.state.RenderMerged()), "    foo()\nmid\n") {
+		t.Fatalf("RenderMerged = %q, want theirs bytes unchanged", m.state.RenderMerged())
+	}
+	m.ready, m.width, m.height = true, 200, 20
+	m.viewportResult = viewport.New(60, 5)
+	if !strings.Contains(m.View(), "Resolved: theirs (whitespace only)") {
+		t.Fatalf("status line does not flag the whitespace-only conflict")
+	}
+
+	m = press(m, 'z', 'i')
+	if m.ignoreWhitespace {
+		t.Fatalf("ignoreWhitespace = true after second zi")
+	}
+	if got := conflictResolution(t, m.doc, 0); got != markers.ResolutionUnset {
+		t.Fatalf("resolution after turning off = %q, want unset", got)
+	}
+}
+
 func TestUpdateApplyTheirs(t *testing.T) {
 	doc := parseSingleConflictDoc(t)
 	m := newModelForDoc(t, doc)
@@ -1399,6 +1880,29 @@ func TestUpdateApplyBothAndNone(t *testing.T) {
 	}
 }
 
+func TestUpdateApplyBothDedup(t *testing.T) {
+	data := []byte("start\n<<<<<<< HEAD\nshared\nours\n||||||| base\n=======\nshared\ntheirs\n>>>>>>> branch\nend\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'B'}})
+	result := updated.(model)
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionBothDedup {
+		t.Fatalf("resolution = %q, want both-dedup", got)
+	}
+
+	rendered, err := markers.RenderResolved(result.doc)
+	if err != nil {
+		t.Fatalf("RenderResolved error: %v", err)
+	}
+	if want := "start\nshared\nours\ntheirs\nend\n"; string(rendered) != want {
+		t.Fatalf("rendered = %q, want %q", rendered, want)
+	}
+}
+
 func TestUpdateScrollHorizontalKeys(t *testing.T) {
 	content := "0123456789"
 	m := model{
@@ -1509,32 +2013,389 @@ func TestUpdateKeySeqRecenterSelectedHunk(t *testing.T) {
 	}
 }
 
-func TestUpdateIgnoresUnmappedViewportKeys(t *testing.T) {
-	lines := strings.Join([]string{"one", "two", "three", "four", "five", "six"}, "\n")
-	m := model{
-		viewportOurs:   viewport.New(5, 3),
-		viewportResult: viewport.New(5, 3),
-		viewportTheirs: viewport.New(5, 3),
-	}
+func TestRecenterUsesAnchorsFromLastUpdate(t *testing.T) {
+	doc := parseMultiConflictDoc(t)
+	m := newModelForDoc(t, doc)
 	for _, viewportModel := range []*viewport.Model{&m.viewportOurs, &m.viewportResult, &m.viewportTheirs} {
-		viewportModel.SetContent(lines)
+		viewportModel.Height = 2
 	}
-
-	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
-	result := updated.(model)
-
-	if result.viewportOurs.YOffset != 0 {
-		t.Fatalf("YOffset = %d, want 0 after unmapped key", result.viewportOurs.YOffset)
+	m.currentConflict = 1
+	m.updateViewports()
+	if m.oursAnchor.start == 0 || m.oursAnchor.total == 0 {
+		t.Fatalf("oursAnchor = %+v, want the second conflict's position", m.oursAnchor)
 	}
-	if result.viewportResult.YOffset != 0 {
-		t.Fatalf("result YOffset = %d, want 0 after unmapped key", result.viewportResult.YOffset)
+
+	m.viewportOurs.YOffset = 0
+	m.recenter()
+	if m.viewportOurs.YOffset != m.oursAnchor.start-1 {
+		t.Fatalf("YOffset = %d, want %d", m.viewportOurs.YOffset, m.oursAnchor.start-1)
 	}
-	if result.viewportTheirs.YOffset != 0 {
-		t.Fatalf("theirs YOffset = %d, want 0 after unmapped key", result.viewportTheirs.YOffset)
+	if m.viewportOurs.TotalLineCount() != m.oursAnchor.total {
+		t.Fatalf("TotalLineCount = %d, want %d", m.viewportOurs.TotalLineCount(), m.oursAnchor.total)
 	}
 }
 
-func TestUpdateVerticalScrollKeys(t *testing.T) {
+func TestToggleAlignKeepsPanesOnSameRows(t *testing.T) {
+	tmpDir := t.TempDir()
+	opts := cli.Options{
+		BasePath:   filepath.Join(tmpDir, "base.txt"),
+		LocalPath:  filepath.Join(tmpDir, "local.txt"),
+		RemotePath: filepath.Join(tmpDir, "remote.txt"),
+	}
+	for path, content := range map[string]string{
+		opts.BasePath:   "start\nb1\nmid\nend\n",
+		opts.LocalPath:  "start\nours1\nextra\nmid\nend\n",
+		opts.RemotePath: "start\ntheirs1\nmid\nend\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile error = %v", err)
+		}
+	}
+	doc, err := markers.Parse([]byte("start\n<<<<<<< HEAD\nours1\nextra\n||||||| base\nb1\n=======\ntheirs1\n>>>>>>> branch\nmid\nend\n"))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	m.opts = opts
+	m.baseLines, m.oursLines, m.theirsLines, m.conflictRanges, m.useFullDiff = prepareFullDiff(doc, opts)
+	if !m.useFullDiff {
+		t.Fatalf("expected useFullDiff for complete stage files")
+	}
+	m.updateViewports()
+	if m.viewportOurs.TotalLineCount() == m.viewportTheirs.TotalLineCount() {
+		t.Fatalf("independent panes should differ in height")
+	}
+
+	for _, r := range "za" {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+	if !m.alignPanes {
+		t.Fatalf("za did not enable alignment")
+	}
+	if got := conflictResolution(t, m.doc, 0); got != markers.ResolutionUnset {
+		t.Fatalf("za accepted the conflict: resolution = %q", got)
+	}
+	ours, result, theirs := m.viewportOurs.TotalLineCount(), m.viewportResult.TotalLineCount(), m.viewportTheirs.TotalLineCount()
+	if ours != theirs || ours != result {
+		t.Fatalf("aligned heights = %d/%d/%d, want equal", ours, result, theirs)
+	}
+}
+
+func TestUpdateRestoresConflictScrollOffset(t *testing.T) {
+	doc := parseMultiConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	for _, viewportModel := range []*viewport.Model{&m.viewportOurs, &m.viewportResult, &m.viewportTheirs} {
+		viewportModel.Height = 2
+	}
+	m.pendingScroll = true
+	m.updateViewports()
+	centered := m.viewportResult.YOffset
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	result := updated.(model)
+	scrolled := result.viewportResult.YOffset
+	if scrolled != centered+1 {
+		t.Fatalf("result YOffset = %d, want %d after j", scrolled, centered+1)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	result = updated.(model)
+	if result.currentConflict != 1 {
+		t.Fatalf("currentConflict = %d, want 1", result.currentConflict)
+	}
+	secondCentered := result.viewportResult.YOffset
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	result = updated.(model)
+	if result.currentConflict != 0 {
+		t.Fatalf("currentConflict = %d, want 0", result.currentConflict)
+	}
+	if result.viewportResult.YOffset != scrolled {
+		t.Fatalf("result YOffset = %d, want restored %d", result.viewportResult.YOffset, scrolled)
+	}
+	if result.viewportOurs.YOffset != result.viewportTheirs.YOffset {
+		t.Fatalf("ours/theirs YOffset = %d/%d, want panes kept aligned", result.viewportOurs.YOffset, result.viewportTheirs.YOffset)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	result = updated.(model)
+	if result.viewportResult.YOffset != secondCentered {
+		t.Fatalf("result YOffset = %d, want %d saved for second conflict", result.viewportResult.YOffset, secondCentered)
+	}
+}
+
+func TestUpdateToggleWhitespace(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.updateViewports()
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	result := updated.(model)
+	if !result.showWhitespace {
+		t.Fatalf("showWhitespace = false, want true after ctrl+w")
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	result = updated.(model)
+	if result.showWhitespace {
+		t.Fatalf("showWhitespace = true, want false after second ctrl+w")
+	}
+}
+
+func TestUpdateKeySeqToggleWrap(t *testing.T) {
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.updateViewports()
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	result := updated.(model)
+	updated, cmd := result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result = updated.(model)
+	if cmd != nil {
+		t.Fatalf("expected no cmd for zw, got write")
+	}
+	if !result.wrap {
+		t.Fatalf("wrap = false, want true after zw")
+	}
+	if result.keySeq != "" {
+		t.Fatalf("keySeq = %q, want cleared", result.keySeq)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	result = updated.(model)
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result = updated.(model)
+	if result.wrap {
+		t.Fatalf("wrap = true, want false after second zw")
+	}
+}
+
+func TestUpdateKeySeqCyclesLineNumbers(t *testing.T) {
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+	m.updateViewports()
+
+	for _, want := range []lineNumberMode{lineNumbersPosition, lineNumbersOff, lineNumbersFile} {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+		m = updated.(model)
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+		m = updated.(model)
+		if m.lineNumberMode != want || m.toastMessage != "Line numbers: "+want.String() {
+			t.Fatalf("after zn: mode = %s, toast = %q; want %s", m.lineNumberMode, m.toastMessage, want)
+		}
+	}
+	if m.currentConflict != 0 {
+		t.Fatalf("zn moved to conflict %d", m.currentConflict)
+	}
+}
+
+func TestUpdateKeySeqSwapsSides(t *testing.T) {
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	m = updated.(model)
+	before := m.state.RenderMerged()
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}})
+	m = updated.(model)
+	if !m.swapped || m.toastMessage != "Sides: theirs left, ours right" {
+		t.Fatalf("after zs: swapped = %v, toast = %q", m.swapped, m.toastMessage)
+	}
+	view := m.View()
+	if theirs, ours := strings.Index(view, "THEIRS"), strings.Index(view, "OURS"); theirs < 0 || ours < 0 || theirs > ours {
+		t.Fatalf("expected THEIRS left of OURS, got:\n%s", view)
+	}
+
+	// h picks the left pane, now theirs; o still applies git's ours.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}})
+	m = updated.(model)
+	if m.selectedSide != selectedTheirs {
+		t.Fatalf("h selected %v, want theirs", m.selectedSide)
+	}
+	if after := m.state.RenderMerged(); !bytes.Equal(before, after) {
+		t.Fatalf("swapping changed the result: %q -> %q", before, after)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	m = updated.(model)
+	if res := conflictResolution(t, m.doc, 0); res != markers.ResolutionOurs {
+		t.Fatalf("o resolved to %q, want ours", res)
+	}
+}
+
+func TestUpdateKeySeqTogglesUnifiedLayout(t *testing.T) {
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 30, Height: 30})
+	m = updated.(model)
+	if !m.tooSmall {
+		t.Fatalf("three panes fit in 30 columns")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'u'}})
+	m = updated.(model)
+	if m.layout != layoutUnified || m.toastMessage != "Layout: unified" {
+		t.Fatalf("after zu: layout = %s, toast = %q", m.layout, m.toastMessage)
+	}
+	if m.tooSmall {
+		t.Fatalf("unified layout does not fit in 30 columns")
+	}
+	view := m.View()
+	if !strings.Contains(view, "@@ ours (HEAD) @@") || !strings.Contains(view, "+ theirs") {
+		t.Fatalf("View() lacks the unified hunks:\n%s", view)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'u'}})
+	m = updated.(model)
+	if m.layout != layoutPanes || !m.tooSmall {
+		t.Fatalf("after second zu: layout = %s, tooSmall = %v", m.layout, m.tooSmall)
+	}
+}
+
+func TestUpdateContextFoldKeys(t *testing.T) {
+	data := []byte("a\nb\nc\nd\ne\nf\ng\nh\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nend\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	m.viewportOurs = viewport.New(80, 30)
+	m.viewportResult = viewport.New(80, 30)
+	m.viewportTheirs = viewport.New(80, 30)
+	m.updateViewports()
+	if strings.Contains(m.viewportOurs.View(), "lines folded") {
+		t.Fatalf("expected no fold marker before folding")
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'-'}})
+	result := updated.(model)
+	if result.contextLines != defaultFoldContext {
+		t.Fatalf("contextLines = %d, want %d", result.contextLines, defaultFoldContext)
+	}
+	for i := defaultFoldContext; i > 1; i-- {
+		updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'-'}})
+		result = updated.(model)
+	}
+	if result.contextLines != 1 {
+		t.Fatalf("contextLines = %d, want 1", result.contextLines)
+	}
+	for _, view := range []string{result.viewportOurs.View(), result.viewportResult.View(), result.viewportTheirs.View()} {
+		if !strings.Contains(view, "... 7 lines folded ...") {
+			t.Fatalf("expected fold marker with context 1, got:\n%s", view)
+		}
+	}
+
+	for i := 0; i < 7; i++ {
+		updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'+'}})
+		result = updated.(model)
+	}
+	if result.contextLines != 8 {
+		t.Fatalf("contextLines = %d, want 8", result.contextLines)
+	}
+	if strings.Contains(result.viewportOurs.View(), "lines folded") {
+		t.Fatalf("expected fold marker to disappear once context covers all lines")
+	}
+}
+
+func TestUpdateKeySeqOpensFoldsInView(t *testing.T) {
+	data := []byte("a\nb\nc\nd\ne\nf\ng\nh\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nend\n")
+	doc, err := markers.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	m := newModelForDoc(t, doc)
+	m.viewportOurs = viewport.New(80, 30)
+	m.viewportResult = viewport.New(80, 30)
+	m.viewportTheirs = viewport.New(80, 30)
+	m.updateViewports()
+	pressZ := func(second rune) {
+		t.Helper()
+		for _, r := range []rune{'z', second} {
+			updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			m = updated.(model)
+		}
+	}
+
+	pressZ('o')
+	if m.toastMessage != "No folded lines in view" {
+		t.Fatalf("zo without folds: toast = %q", m.toastMessage)
+	}
+
+	m.contextLines = 1
+	m.updateViewports()
+	pressZ('o')
+	if m.toastMessage != "Opened 3 fold(s)" {
+		t.Fatalf("zo: toast = %q, want 3 folds opened", m.toastMessage)
+	}
+	for _, view := range []string{m.viewportOurs.View(), m.viewportResult.View(), m.viewportTheirs.View()} {
+		if strings.Contains(view, "lines folded") || !strings.Contains(view, "a") {
+			t.Fatalf("expected the fold opened, got:\n%s", view)
+		}
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'+'}})
+	m = updated.(model)
+	if m.oursOpenFolds != nil || !strings.Contains(m.viewportOurs.View(), "lines folded") {
+		t.Fatalf("changing the context should fold again")
+	}
+}
+
+func TestFoldContextLinesRemapsStart(t *testing.T) {
+	lines := makeLineInfos([]string{"1", "2", "3", "4", "5"}, categoryDefault, false, false, false, false, "")
+	lines = append(lines, lineInfo{text: "conflict", category: categoryConflicted, selected: true})
+	lines = append(lines, makeLineInfos([]string{"7"}, categoryDefault, false, false, false, false, "")...)
+
+	folded, start := foldContextLines(lines, 5, 1, nil)
+	if len(folded) != 4 {
+		t.Fatalf("folded len = %d, want 4", len(folded))
+	}
+	if folded[0].text != "... 4 lines folded ..." {
+		t.Fatalf("folded[0] = %q, want fold marker", folded[0].text)
+	}
+	if start != 2 || folded[start].text != "conflict" {
+		t.Fatalf("start = %d, want index of conflict line", start)
+	}
+
+	unfolded, start := foldContextLines(lines, 5, 0, nil)
+	if len(unfolded) != len(lines) || start != 5 {
+		t.Fatalf("foldContextLines with 0 context changed lines")
+	}
+
+	opened, start := foldContextLines(lines, 5, 1, map[int]bool{folded[0].foldStart: true})
+	if len(opened) != len(lines) || start != 5 || opened[0].text != "1" {
+		t.Fatalf("opened fold: len = %d, start = %d, first = %q; want every line", len(opened), start, opened[0].text)
+	}
+}
+
+func TestUpdateIgnoresUnmappedViewportKeys(t *testing.T) {
+	lines := strings.Join([]string{"one", "two", "three", "four", "five", "six"}, "\n")
+	m := model{
+		viewportOurs:   viewport.New(5, 3),
+		viewportResult: viewport.New(5, 3),
+		viewportTheirs: viewport.New(5, 3),
+	}
+	for _, viewportModel := range []*viewport.Model{&m.viewportOurs, &m.viewportResult, &m.viewportTheirs} {
+		viewportModel.SetContent(lines)
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	result := updated.(model)
+
+	if result.viewportOurs.YOffset != 0 {
+		t.Fatalf("YOffset = %d, want 0 after unmapped key", result.viewportOurs.YOffset)
+	}
+	if result.viewportResult.YOffset != 0 {
+		t.Fatalf("result YOffset = %d, want 0 after unmapped key", result.viewportResult.YOffset)
+	}
+	if result.viewportTheirs.YOffset != 0 {
+		t.Fatalf("theirs YOffset = %d, want 0 after unmapped key", result.viewportTheirs.YOffset)
+	}
+}
+
+func TestUpdateVerticalScrollKeys(t *testing.T) {
 	lines := strings.Join([]string{"one", "two", "three", "four", "five", "six"}, "\n")
 	m := model{
 		viewportOurs:   viewport.New(5, 3),
@@ -1635,6 +2496,165 @@ func TestUpdateWriteKey(t *testing.T) {
 	}
 }
 
+func TestUpdateWriteKeyCountsRemainingConflicts(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	if err := os.WriteFile(mergedPath, []byte("original\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cliOptionsWithMergedPath(mergedPath)
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result := updated.(model)
+	if result.toastMessage != "Saved (1 conflict(s) remaining)" || !result.toastWarning {
+		t.Fatalf("toast = %q (warning %v), want the remaining conflict counted", result.toastMessage, result.toastWarning)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result = updated.(model)
+	if result.toastMessage != "Saved" || result.toastWarning {
+		t.Fatalf("toast = %q (warning %v), want plain Saved", result.toastMessage, result.toastWarning)
+	}
+}
+
+func TestUpdateWriteKeyAdvancesInBatchMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+	if err := os.WriteFile(mergedPath, []byte("original\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.opts = cli.Options{MergedPath: mergedPath, Batch: true}
+	m.nextFiles = []string{"next.txt"}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result := updated.(model)
+	if result.err != nil || result.quitting {
+		t.Fatalf("expected unresolved write to stay in resolver, err=%v quitting=%v", result.err, result.quitting)
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	result = updated.(model)
+	updated, cmd := result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	result = updated.(model)
+	if !errors.Is(result.err, ErrNextFile) {
+		t.Fatalf("err = %v, want ErrNextFile", result.err)
+	}
+	if !result.quitting || cmd == nil {
+		t.Fatalf("expected quit after resolved batch write")
+	}
+	result.ready = true
+	if !strings.Contains(result.View(), "Opening next file") {
+		t.Fatalf("expected next file view")
+	}
+}
+
+func TestUpdateWriteAndContinueStagesAndContinues(t *testing.T) {
+	repoRoot := t.TempDir()
+	gitDir := filepath.Join(repoRoot, ".git")
+	if err := os.MkdirAll(gitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "MERGE_HEAD"), []byte("abc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mergedPath := filepath.Join(repoRoot, "file.txt")
+	if err := os.WriteFile(mergedPath, []byte("original\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logPath := filepath.Join(t.TempDir(), "git.log")
+	fakeDir := t.TempDir()
+	script := `#!/bin/sh
+echo "$*" >> "` + logPath + `"
+if [ "$1" = "rev-parse" ]; then
+  echo ".git"
+fi
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(fakeDir, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", fakeDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+	m.ctx = context.Background()
+	m.opts = cli.Options{MergedPath: mergedPath}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'W'}})
+	result := updated.(model)
+	if result.quitting || result.toastMessage != "Stage and continue needs repo mode (run ec without paths)" {
+		t.Fatalf("expected no-op toast outside repo mode, got quitting=%v toast=%q", result.quitting, result.toastMessage)
+	}
+
+	result.repoRoot = repoRoot
+	result.repoPath = "file.txt"
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'W'}})
+	result = updated.(model)
+	if result.quitting {
+		t.Fatalf("expected unresolved file to stay in resolver")
+	}
+	if _, err := os.Stat(logPath); err == nil {
+		t.Fatalf("expected no git commands before the file is resolved")
+	}
+
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	result = updated.(model)
+	updated, cmd := result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'W'}})
+	result = updated.(model)
+	if !result.quitting || cmd == nil || result.err != nil {
+		t.Fatalf("expected clean quit after continuing, quitting=%v err=%v toast=%q", result.quitting, result.err, result.toastMessage)
+	}
+
+	written, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "start\nours\nend\n" {
+		t.Fatalf("merged = %q, want resolved content", written)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "add -- file.txt\nrev-parse --git-dir\nmerge --continue\n"
+	if string(log) != want {
+		t.Fatalf("git commands = %q, want %q", log, want)
+	}
+	if result.result.Continued != "merge" {
+		t.Fatalf("result Continued = %q, want merge", result.result.Continued)
+	}
+	result.ready = true
+	if !strings.Contains(result.View(), "git merge --continue") {
+		t.Fatalf("expected continue confirmation in view")
+	}
+}
+
+func TestUpdateNextFileKey(t *testing.T) {
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'N'}})
+	result := updated.(model)
+	if result.quitting {
+		t.Fatalf("expected to stay when no next file")
+	}
+	if result.toastMessage != "No more unresolved files" {
+		t.Fatalf("toastMessage = %q", result.toastMessage)
+	}
+
+	result.nextFiles = []string{"other.txt"}
+	updated, _ = result.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'N'}})
+	result = updated.(model)
+	if !errors.Is(result.err, ErrNextFile) || !result.quitting {
+		t.Fatalf("err = %v quitting = %v, want ErrNextFile", result.err, result.quitting)
+	}
+}
+
 func TestUpdateEditorKey(t *testing.T) {
 	originalEditor := os.Getenv("EDITOR")
 	if err := os.Setenv("EDITOR", "true"); err != nil {
@@ -1676,6 +2696,23 @@ func TestPrepareFullDiffGuards(t *testing.T) {
 	}
 }
 
+func TestExceedsFullDiffLimit(t *testing.T) {
+	doc := parseMultiConflictDoc(t)
+	tests := []struct {
+		limit int
+		want  bool
+	}{
+		{limit: 0, want: false},
+		{limit: 1, want: true},
+		{limit: 2, want: false},
+	}
+	for _, tt := range tests {
+		if got := exceedsFullDiffLimit(doc, cli.Options{FullDiffLimit: tt.limit}); got != tt.want {
+			t.Fatalf("exceedsFullDiffLimit(limit %d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
 func TestIsTrulyMissingBasePath(t *testing.T) {
 	if !isTrulyMissingBasePath(os.DevNull) {
 		t.Fatalf("expected os.DevNull to be treated as missing base")
@@ -1877,6 +2914,306 @@ func TestPrepareFullDiffRangeFailure(t *testing.T) {
 	}
 }
 
+func TestWriteResolvedRecordsResult(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	if err := os.WriteFile(mergedPath, []byte("placeholder\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cliOptionsWithMergedPath(mergedPath)
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	m = updated.(model)
+	if _, err := m.writeResolved(); err != nil {
+		t.Fatalf("writeResolved error = %v", err)
+	}
+
+	want := Result{Path: mergedPath, Written: true, Conflicts: 2, Theirs: 1, Unresolved: 1}
+	if m.result != want {
+		t.Fatalf("result = %+v, want %+v", m.result, want)
+	}
+	wantSummary := mergedPath + ": 2 conflict(s) - ours 0, theirs 1, both 0, none 0, manual 0, unresolved 1"
+	if got := m.result.Summary(); got != wantSummary {
+		t.Fatalf("Summary() = %q, want %q", got, wantSummary)
+	}
+}
+
+func TestReviewWriteConfirmsBeforeWriting(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	original := "start\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> branch\nmid\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nend\n"
+	if err := os.WriteFile(mergedPath, []byte(original), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.opts = cliOptionsWithMergedPath(mergedPath)
+	m.width, m.height = 80, 40
+
+	press := func(key tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(key)
+		m = updated.(model)
+	}
+	review := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'D'}}
+
+	press(review)
+	if m.reviewing {
+		t.Fatalf("reviewing = true with nothing to write")
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	press(review)
+	if !m.reviewing {
+		t.Fatalf("reviewing = false, want the diff shown")
+	}
+	content := m.reviewViewport.View()
+	for _, want := range []string{"-ours1", "->>>>>>> branch", " theirs1"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("review content missing %q:\n%s", want, content)
+		}
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.reviewing {
+		t.Fatalf("reviewing = true after esc")
+	}
+	if data, _ := os.ReadFile(mergedPath); string(data) != original {
+		t.Fatalf("esc wrote the file: %q", data)
+	}
+
+	press(review)
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	if m.reviewing || m.err != nil {
+		t.Fatalf("after y: reviewing = %v, err = %v", m.reviewing, m.err)
+	}
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	if !strings.HasPrefix(string(data), "start\ntheirs1\nmid\n") {
+		t.Fatalf("written = %q, want the first conflict resolved to theirs", data)
+	}
+}
+
+func TestRevertRestoresOpenedStateAsOneStep(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.pristine = m.state.Clone()
+	press := func(r rune) {
+		t.Helper()
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+
+	press('R')
+	if m.toastMessage != "Nothing to revert" || m.canUndo() {
+		t.Fatalf("R on an untouched file: toast = %q, canUndo = %v", m.toastMessage, m.canUndo())
+	}
+
+	press('o')
+	press('n')
+	press('t')
+	if m.state.HasUnresolvedConflicts() {
+		t.Fatalf("expected both conflicts resolved before revert")
+	}
+	depth := m.undoDepth()
+
+	press('R')
+	if !m.state.HasUnresolvedConflicts() || conflictResolution(t, m.doc, 0) != markers.ResolutionUnset || conflictResolution(t, m.doc, 1) != markers.ResolutionUnset {
+		t.Fatalf("conflicts not unresolved after R")
+	}
+	if m.undoDepth() != depth+1 {
+		t.Fatalf("undo depth = %d, want %d (one step)", m.undoDepth(), depth+1)
+	}
+
+	press('u')
+	if conflictResolution(t, m.doc, 0) != markers.ResolutionOurs || conflictResolution(t, m.doc, 1) != markers.ResolutionTheirs {
+		t.Fatalf("u after R did not restore the resolutions")
+	}
+}
+
+func TestConflictEditStoresManualResolution(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	path := filepath.Join(t.TempDir(), "conflict.txt")
+	if err := os.WriteFile(path, []byte("ours1\ntweak\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, _ := m.Update(conflictEditFinishedMsg{index: 0, path: path})
+	m = updated.(model)
+	if out := m.state.RenderMerged(); !strings.HasPrefix(string(out), "start\nours1\ntweak\nmid\n") {
+		t.Fatalf("Preview = %q, want the edited conflict", out)
+	}
+	if _, ok := m.state.ManualResolved()[0]; !ok || m.undoDepth() != 1 {
+		t.Fatalf("edit not stored as one manual step: undo depth = %d", m.undoDepth())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("edit file not removed: %v", err)
+	}
+
+	updated, _ = m.Update(conflictEditFinishedMsg{index: 1, path: path, err: errors.New("exit status 1")})
+	m = updated.(model)
+	if conflictResolution(t, m.doc, 1) != markers.ResolutionUnset || !strings.Contains(m.toastMessage, "conflict unchanged") {
+		t.Fatalf("failed editor changed the conflict: toast = %q", m.toastMessage)
+	}
+}
+
+func TestConflictEditSeedFollowsResolution(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	seedOf := func() string {
+		t.Helper()
+		seed, err := m.conflictEditSeed(0)
+		if err != nil {
+			t.Fatalf("conflictEditSeed error = %v", err)
+		}
+		return string(seed)
+	}
+	press := func(r rune) {
+		t.Helper()
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+
+	if got := seedOf(); got != "ours1\n" {
+		t.Fatalf("seed = %q, want the selected ours side", got)
+	}
+	m.selectedSide = selectedTheirs
+	if got := seedOf(); got != "theirs1\n" {
+		t.Fatalf("seed = %q, want the selected theirs side", got)
+	}
+
+	press('b')
+	m.selectedSide = selectedOurs
+	if got := seedOf(); got != "ours1\ntheirs1\n" {
+		t.Fatalf("seed = %q, want both sides of the resolution", got)
+	}
+	press('t')
+	if got := seedOf(); got != "theirs1\n" {
+		t.Fatalf("seed = %q, want theirs as resolved, not the selected side", got)
+	}
+}
+
+func TestReviewedConflictsAreSkipped(t *testing.T) {
+	doc, err := markers.Parse([]byte("<<<<<<< HEAD\na\n=======\nb\n>>>>>>> branch\n<<<<<<< HEAD\nc\n=======\nd\n>>>>>>> branch\n<<<<<<< HEAD\ne\n=======\nf\n>>>>>>> branch\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newModelForDoc(t, doc)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 160, Height: 30})
+	m = updated.(model)
+	press := func(r rune) {
+		t.Helper()
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+
+	press('m')
+	if !m.reviewed[0] || m.toastMessage != "Conflict 1 marked reviewed" {
+		t.Fatalf("m: reviewed = %v, toast = %q", m.reviewed, m.toastMessage)
+	}
+	view := m.View()
+	if !strings.Contains(view, "(1 reviewed)") || !strings.Contains(view, "Unresolved (reviewed)") {
+		t.Fatalf("reviewed conflict not shown in the header:\n%s", view)
+	}
+
+	// Conflict 2 is resolved and 1 reviewed, so M goes from 1 to 3 and
+	// then wraps back to 3 alone.
+	press('n')
+	press('o')
+	press('p')
+	press('M')
+	if m.currentConflict != 2 {
+		t.Fatalf("M moved to conflict %d, want 2", m.currentConflict)
+	}
+	press('m')
+	press('M')
+	if m.currentConflict != 2 || m.toastMessage != "No unresolved conflicts left to review" {
+		t.Fatalf("M with every conflict reviewed or resolved: conflict %d, toast %q", m.currentConflict, m.toastMessage)
+	}
+
+	press('m')
+	if m.reviewed[2] || m.reviewedCount() != 1 {
+		t.Fatalf("second m left reviewed = %v", m.reviewed)
+	}
+}
+
+func TestFilterLimitsConflictNavigation(t *testing.T) {
+	doc, err := markers.Parse([]byte("<<<<<<< HEAD\nalpha\n=======\nbeta\n>>>>>>> branch\n<<<<<<< HEAD\ngamma\n=======\ndelta\n>>>>>>> branch\n<<<<<<< HEAD\nx\n=======\nAlphabet\n>>>>>>> branch\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newModelForDoc(t, doc)
+	m.ready, m.width, m.height = true, 120, 30
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	typeText := func(text string) {
+		t.Helper()
+		for _, r := range text {
+			press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}})
+	typeText("alphx")
+	press(tea.KeyMsg{Type: tea.KeyBackspace})
+	typeText("a")
+	if !m.filtering || m.filterInput != "alpha" || !strings.Contains(m.View(), "Filter: alpha_") {
+		t.Fatalf("filter input = %q, filtering = %v", m.filterInput, m.filtering)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.filtering || m.filterText != "alpha" || !strings.Contains(m.View(), "(filtered: 2 matches)") {
+		t.Fatalf("filter not applied: text = %q", m.filterText)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if m.currentConflict != 2 {
+		t.Fatalf("n with filter moved to conflict %d, want 2", m.currentConflict)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if m.currentConflict != 2 {
+		t.Fatalf("n past the last match moved to conflict %d", m.currentConflict)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	if m.currentConflict != 0 {
+		t.Fatalf("p with filter moved to conflict %d, want 0", m.currentConflict)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if m.filterText != "" || m.currentConflict != 1 {
+		t.Fatalf("after esc: filter = %q, n moved to conflict %d, want 1", m.filterText, m.currentConflict)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}})
+	typeText("nothing")
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.filterText != "" || !strings.Contains(m.toastMessage, "No conflicts match") {
+		t.Fatalf("unmatched filter applied: text = %q, toast = %q", m.filterText, m.toastMessage)
+	}
+}
+
+func TestViewRawShowsConflictWithMarkers(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	m.ready, m.width, m.height = true, 100, 20
+	m.currentConflict = 1
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	m = updated.(model)
+	view := m.View()
+	for _, want := range []string{"raw conflict 2/2", "<<<<<<< HEAD", "ours2", "=======", "theirs2", ">>>>>>> branch"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("raw view missing %q:\n%s", want, view)
+		}
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	m = updated.(model)
+	if m.showingRaw || conflictResolution(t, m.doc, 1) != markers.ResolutionUnset {
+		t.Fatalf("key after r should only close the raw view")
+	}
+}
+
 func parseMultiConflictDoc(t *testing.T) markers.Document {
 	t.Helper()
 	data := []byte("start\n<<<<<<< HEAD\nours1\n=======\ntheirs1\n>>>>>>> branch\nmid\n<<<<<<< HEAD\nours2\n=======\ntheirs2\n>>>>>>> branch\nend\n")
@@ -1918,30 +3255,88 @@ func conflictResolution(t *testing.T, doc markers.Document, index int) markers.R
 func TestEnsureVisibleOffsets(t *testing.T) {
 	viewportModel := viewport.New(10, 4)
 	viewportModel.YOffset = 3
-	ensureVisible(&viewportModel, 0, 10)
+	ensureVisible(&viewportModel, 0, 10, scrollAnchorCenter)
 	if viewportModel.YOffset != 0 {
 		t.Fatalf("YOffset = %d, want 0", viewportModel.YOffset)
 	}
 
-	ensureVisible(&viewportModel, 9, 10)
+	ensureVisible(&viewportModel, 9, 10, scrollAnchorCenter)
 	if viewportModel.YOffset != 6 {
 		t.Fatalf("YOffset = %d, want 6", viewportModel.YOffset)
 	}
 
 	viewportModel.YOffset = 5
-	ensureVisible(&viewportModel, 1, 0)
+	ensureVisible(&viewportModel, 1, 0, scrollAnchorCenter)
 	if viewportModel.YOffset != 0 {
 		t.Fatalf("YOffset = %d, want 0 for empty total", viewportModel.YOffset)
 	}
 
 	viewportModel.Height = 0
 	viewportModel.YOffset = 5
-	ensureVisible(&viewportModel, 2, 10)
+	ensureVisible(&viewportModel, 2, 10, scrollAnchorCenter)
 	if viewportModel.YOffset != 5 {
 		t.Fatalf("YOffset = %d, want unchanged when height is zero", viewportModel.YOffset)
 	}
 }
 
+func TestEnsureVisibleScrollAnchors(t *testing.T) {
+	tests := []struct {
+		anchor scrollAnchor
+		start  int
+		want   int
+	}{
+		{scrollAnchorCenter, 20, 14},
+		{scrollAnchorTop, 20, 20},
+		{scrollAnchorThird, 20, 16},
+		{"", 20, 14},
+		{scrollAnchorTop, 95, 88},
+		{scrollAnchorThird, 2, 0},
+	}
+	for _, tt := range tests {
+		viewportModel := viewport.New(10, 12)
+		ensureVisible(&viewportModel, tt.start, 100, tt.anchor)
+		if viewportModel.YOffset != tt.want {
+			t.Fatalf("anchor %q start %d: YOffset = %d, want %d", tt.anchor, tt.start, viewportModel.YOffset, tt.want)
+		}
+	}
+}
+
+func TestJumpToChangeScrollsSelectedPane(t *testing.T) {
+	m := newModelForDoc(t, parseMultiConflictDoc(t))
+	content := strings.Repeat("line\n", 20)
+	m.viewportOurs.SetContent(content)
+	m.viewportResult.SetContent(content)
+	m.viewportTheirs.SetContent(content)
+	m.oursPaneLines = make([]lineInfo, 20)
+	m.oursPaneLines[4].category = categoryConflicted
+	m.theirsPaneLines = make([]lineInfo, 20)
+	m.theirsPaneLines[9].category = categoryConflicted
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	m = updated.(model)
+	if m.viewportOurs.YOffset != 4 || m.viewportResult.YOffset != 4 {
+		t.Fatalf("YOffset after ] = %d/%d, want 4 in ours and result", m.viewportOurs.YOffset, m.viewportResult.YOffset)
+	}
+
+	m.selectedSide = selectedTheirs
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	m = updated.(model)
+	if m.viewportTheirs.YOffset != 9 {
+		t.Fatalf("theirs YOffset after ] = %d, want 9", m.viewportTheirs.YOffset)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}})
+	m = updated.(model)
+	if m.toastMessage != "No next change" {
+		t.Fatalf("toast = %q, want No next change", m.toastMessage)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'['}})
+	m = updated.(model)
+	if m.toastMessage != "No previous change" || m.viewportTheirs.YOffset != 9 {
+		t.Fatalf("after [: toast = %q, YOffset = %d", m.toastMessage, m.viewportTheirs.YOffset)
+	}
+}
+
 func TestScrollToTopAndBottom(t *testing.T) {
 	lines := strings.Join([]string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}, "\n")
 
@@ -2056,7 +3451,7 @@ func TestWriteResolvedAllowsUnresolved(t *testing.T) {
 		opts:  cli.Options{MergedPath: mergedPath},
 	}
 
-	if err := m.writeResolved(); err != nil {
+	if _, err := m.writeResolved(); err != nil {
 		t.Fatalf("writeResolved error = %v", err)
 	}
 
@@ -2095,7 +3490,7 @@ func TestWriteResolvedPreservesMergedLabelsForUnresolved(t *testing.T) {
 	}
 	m.refreshResolverCaches()
 
-	if err := m.writeResolved(); err != nil {
+	if _, err := m.writeResolved(); err != nil {
 		t.Fatalf("writeResolved error = %v", err)
 	}
 
@@ -2132,7 +3527,7 @@ func TestWriteResolvedCreatesBackup(t *testing.T) {
 		opts:  cli.Options{MergedPath: mergedPath, Backup: true},
 	}
 
-	if err := m.writeResolved(); err != nil {
+	if _, err := m.writeResolved(); err != nil {
 		t.Fatalf("writeResolved error = %v", err)
 	}
 
@@ -2145,3 +3540,213 @@ func TestWriteResolvedCreatesBackup(t *testing.T) {
 		t.Fatalf("backup content = %q, want %q", string(backup), "original\\n")
 	}
 }
+
+func TestRestoreBackupUndoesWrite(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	original := "start\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\nend\n"
+	if err := os.WriteFile(mergedPath, []byte(original), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	m := newModelForDoc(t, parseSingleConflictDoc(t))
+	m.opts = cli.Options{MergedPath: mergedPath, AllowMissingBase: true}
+	if _, err := m.handleRestoreBackup(); err != nil {
+		t.Fatalf("handleRestoreBackup error = %v", err)
+	}
+	if !strings.Contains(m.toastMessage, "no backup") {
+		t.Fatalf("toast = %q, want missing backup reported", m.toastMessage)
+	}
+
+	m.opts.Backup = true
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'U'}})
+	result := updated.(model)
+
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	if string(data) != original {
+		t.Fatalf("merged = %q, want backup restored", data)
+	}
+	if got := conflictResolution(t, result.doc, 0); got != markers.ResolutionUnset {
+		t.Fatalf("resolution = %q, want unresolved after restore", got)
+	}
+	if !result.canUndo() {
+		t.Fatalf("canUndo = false, want the restore undoable")
+	}
+}
+
+func TestWriteAsksBeforeOverwritingChangedFile(t *testing.T) {
+	mergedPath := filepath.Join(t.TempDir(), "merged.txt")
+	if err := os.WriteFile(mergedPath, []byte("original\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	newModel := func(opts cli.Options) model {
+		t.Helper()
+		m := newModelForDoc(t, parseSingleConflictDoc(t))
+		m.opts = opts
+		stamp, err := statFile(mergedPath)
+		if err != nil {
+			t.Fatalf("statFile error = %v", err)
+		}
+		m.mergedStamp = stamp
+		updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+		updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+		return updated.(model)
+	}
+	press := func(m model, r rune) model {
+		t.Helper()
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		return updated.(model)
+	}
+	readMerged := func() string {
+		t.Helper()
+		data, err := os.ReadFile(mergedPath)
+		if err != nil {
+			t.Fatalf("ReadFile error = %v", err)
+		}
+		return string(data)
+	}
+
+	m := newModel(cliOptionsWithMergedPath(mergedPath))
+	external := "rewritten by another program\n"
+	if err := os.WriteFile(mergedPath, []byte(external), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	m = press(m, 'w')
+	if m.overwrite == nil || m.err != nil {
+		t.Fatalf("after w: overwrite = %v, err = %v, want the prompt", m.overwrite, m.err)
+	}
+	if !strings.Contains(m.View(), "changed on disk since open - overwrite? [y/n]") {
+		t.Fatalf("view does not show the overwrite prompt")
+	}
+	if got := readMerged(); got != external {
+		t.Fatalf("merged = %q, want the outside change kept until confirmed", got)
+	}
+
+	m = press(m, 'n')
+	if m.overwrite != nil || !strings.Contains(m.toastMessage, "Write cancelled") {
+		t.Fatalf("after n: overwrite = %v, toast = %q", m.overwrite, m.toastMessage)
+	}
+	if got := readMerged(); got != external {
+		t.Fatalf("merged = %q after n, want the outside change kept", got)
+	}
+
+	m = press(press(m, 'w'), 'y')
+	if m.overwrite != nil || m.toastMessage != "Saved" {
+		t.Fatalf("after y: overwrite = %v, toast = %q, want saved", m.overwrite, m.toastMessage)
+	}
+	if got := readMerged(); got != "start\nours\nend\n" {
+		t.Fatalf("merged = %q after y, want the result", got)
+	}
+	if m = press(m, 'w'); m.overwrite != nil {
+		t.Fatalf("w after ec's own write asked to overwrite")
+	}
+
+	m = newModel(cli.Options{MergedPath: mergedPath, AutoWrite: true})
+	if err := os.WriteFile(mergedPath, []byte(external), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	m = press(press(m, 'q'), 'n')
+	if !m.quitting {
+		t.Fatalf("quitting = false after n at the exit prompt, want true")
+	}
+	if got := readMerged(); got != external {
+		t.Fatalf("merged = %q after quitting with n, want the outside change kept", got)
+	}
+
+	m = newModel(cli.Options{MergedPath: mergedPath, Force: true})
+	if err := os.WriteFile(mergedPath, []byte("changed again\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	if m = press(m, 'w'); m.overwrite != nil {
+		t.Fatalf("w with --force asked to overwrite")
+	}
+	if got := readMerged(); got != "start\nours\nend\n" {
+		t.Fatalf("merged = %q with --force, want the result", got)
+	}
+
+	m = newModel(cli.Options{MergedPath: mergedPath, Backup: true, AllowMissingBase: true})
+	m = press(m, 'w')
+	if err := os.WriteFile(mergedPath, []byte(external), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	m = press(press(m, 'U'), 'n')
+	if m.overwrite != nil {
+		t.Fatalf("overwrite prompt still open after n")
+	}
+	if got := readMerged(); got != external {
+		t.Fatalf("merged = %q after U and n, want the outside change kept", got)
+	}
+	m = press(press(m, 'U'), 'y')
+	if got := readMerged(); got != "start\nours\nend\n" {
+		t.Fatalf("merged = %q after U and y, want the backup restored", got)
+	}
+}
+
+func TestQuitAutoWritesWhenResolved(t *testing.T) {
+	tmpDir := t.TempDir()
+	mergedPath := filepath.Join(tmpDir, "merged.txt")
+	original := "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> branch\n"
+	if err := os.WriteFile(mergedPath, []byte(original), 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	doc := parseSingleConflictDoc(t)
+	m := newModelForDoc(t, doc)
+	m.opts = cli.Options{MergedPath: mergedPath, AutoWrite: true, Backup: true}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+	if !updated.(model).quitting {
+		t.Fatalf("quitting = false, want true after q")
+	}
+	data, err := os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	if string(data) != original {
+		t.Fatalf("merged = %q, want unresolved file left untouched", data)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'o'}})
+	updated, _ = updated.(model).Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	result := updated.(model)
+	if !result.quitting {
+		t.Fatalf("quitting = false, want true after ctrl+c")
+	}
+	data, err = os.ReadFile(mergedPath)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	if string(data) != "start\nours\nend\n" {
+		t.Fatalf("merged = %q, want resolved result written on exit", data)
+	}
+	backup, err := os.ReadFile(mergedPath + ".ec.bak")
+	if err != nil {
+		t.Fatalf("ReadFile backup error = %v", err)
+	}
+	if string(backup) != original {
+		t.Fatalf("backup = %q, want original merged content", backup)
+	}
+	if !result.result.Written {
+		t.Fatalf("result.Written = false, want true after auto-write")
+	}
+}
+
+func TestLoadLinesStripsBOM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ours.txt")
+	if err := os.WriteFile(path, []byte("\xef\xbb\xbffirst\nsecond\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	lines, err := loadLines(path, "")
+	if err != nil {
+		t.Fatalf("loadLines error: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != "first" {
+		t.Fatalf("lines = %q, want BOM stripped from line 1", lines)
+	}
+}